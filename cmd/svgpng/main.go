@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"image/color"
@@ -15,13 +16,19 @@ func main() {
 	// コマンドラインオプションの定義
 	var (
 		inputFile             = flag.String("in", "", "入力SVGファイル")
-		outputFile            = flag.String("out", "", "出力PNGファイル")
+		outputFile            = flag.String("out", "", "出力ファイル（.png、.jpg）")
 		width                 = flag.Int("w", 0, "出力幅（0でSVGから自動計算）")
 		height                = flag.Int("h", 0, "出力高さ（0でSVGから自動計算）")
 		scale                 = flag.Float64("scale", 1, "スケール倍率（-wと-hが0の場合に適用）")
 		background            = flag.String("bg", "transparent", "背景色（transparent、#RRGGBB、色名）")
 		dpi                   = flag.Float64("dpi", 96, "DPI")
 		noSystemFontScan      = flag.Bool("no-system-font-scan", false, "システムフォントのスキャンを無効にする")
+		hinting               = flag.String("hinting", "none", "グリフのヒンティング（none、vertical、full）")
+		noSubpixel            = flag.Bool("no-subpixel", false, "グリフの原点を整数ピクセルに丸める")
+		textGamma             = flag.Float64("text-gamma", 1, "グリフの被覆率のガンマ")
+		textContrast          = flag.Float64("text-contrast", 0, "グリフの被覆率のコントラスト")
+		timeout               = flag.Duration("timeout", 0, "描画の制限時間（例: 10s。0で無制限）")
+		maxPixels             = flag.Int64("max-pixels", 0, "出力画像の画素数の上限（0で既定値、負の値で無制限）")
 		help                  = flag.Bool("help", false, "ヘルプを表示")
 	)
 
@@ -37,11 +44,18 @@ func main() {
 		log.Fatal("入力ファイル（-in）と出力ファイル（-out）を指定してください")
 	}
 
-	// 入力ファイルの読み込み
-	svgData, err := os.ReadFile(*inputFile)
+	// 出力形式は拡張子から判定する（.png / .jpg / .jpeg）
+	format, err := svg2png.FormatForPath(*outputFile)
+	if err != nil {
+		log.Fatalf("出力ファイルの形式を判定できません: %v", err)
+	}
+
+	// 入力ファイルを開く（内容は描画時に読み込みながらパースする）
+	in, err := os.Open(*inputFile)
 	if err != nil {
 		log.Fatalf("入力ファイルの読み込みに失敗: %v", err)
 	}
+	defer in.Close()
 
 	// 背景色の解析
 	var bgColor *color.RGBA
@@ -61,38 +75,34 @@ func main() {
 		DPI:                   *dpi,
 		Background:            bgColor,
 		DisableSystemFontScan: *noSystemFontScan,
+		Hinting:               *hinting,
+		DisableSubpixelPositioning: *noSubpixel,
+		TextGamma:             *textGamma,
+		TextContrast:          *textContrast,
+		Limits:                svg2png.Limits{MaxPixels: *maxPixels},
+		Timeout:               *timeout,
 	}
 
-	// SVGからPNGへの変換
-	pngData, diag, err := svg2png.RenderPNG(svgData, opts)
+	// SVGを描画して出力ファイルへ書き込み
+	out, err := os.Create(*outputFile)
 	if err != nil {
-		log.Fatalf("レンダリングに失敗: %v", err)
-	}
-
-	// 出力ファイルへの書き込み
-	if err := os.WriteFile(*outputFile, pngData, 0644); err != nil {
 		log.Fatalf("出力ファイルの書き込みに失敗: %v", err)
 	}
-
-	// 診断情報の表示
-	if len(diag.Warnings) > 0 {
-		fmt.Println("警告:")
-		for _, warning := range diag.Warnings {
-			fmt.Printf("  - %s\n", warning)
-		}
+	diag, err := svg2png.RenderTo(context.Background(), out, in, opts, format)
+	if err != nil {
+		out.Close()
+		os.Remove(*outputFile)
+		log.Fatalf("レンダリングに失敗: %v", err)
 	}
-
-	if len(diag.MissingFonts) > 0 {
-		fmt.Println("不足フォント:")
-		for _, font := range diag.MissingFonts {
-			fmt.Printf("  - %s\n", font)
-		}
+	if err := out.Close(); err != nil {
+		log.Fatalf("出力ファイルの書き込みに失敗: %v", err)
 	}
 
-	if len(diag.Unsupported) > 0 {
-		fmt.Println("未対応機能:")
-		for _, feature := range diag.Unsupported {
-			fmt.Printf("  - %s\n", feature)
+	// 診断情報の表示（警告以上。要素のパスとソース上の位置つき）
+	if entries := diag.Filter(svg2png.SeverityWarning); len(entries) > 0 {
+		fmt.Println("診断:")
+		for _, entry := range entries {
+			fmt.Printf("  - %s\n", entry)
 		}
 	}
 
@@ -110,7 +120,7 @@ func printUsage() {
   -in string
         入力SVGファイル（必須）
   -out string
-        出力PNGファイル（必須）
+        出力ファイル（必須。拡張子 .png / .jpg / .jpeg で形式を判定）
   -w int
         出力幅（デフォルト: 800）
   -h int
@@ -122,6 +132,19 @@ func printUsage() {
         DPI（デフォルト: 96）
   -no-system-font-scan
         システムフォントのスキャンを無効にする（デフォルトはON）
+  -hinting string
+        グリフのヒンティング（デフォルト: none）
+        none: 格子に合わせない / vertical: ベースラインを整数ピクセルに合わせる / full: 送り幅と原点も合わせる
+  -no-subpixel
+        サブピクセル位置を使わずグリフの原点を整数ピクセルに丸める
+  -text-gamma float
+        グリフの被覆率のガンマ（デフォルト: 1。大きいほど濃い）
+  -text-contrast float
+        グリフの被覆率のコントラスト（デフォルト: 0）
+  -timeout duration
+        描画の制限時間（例: 10s。デフォルト: 0 = 無制限）
+  -max-pixels int
+        出力画像の画素数の上限（デフォルト: 0 = 既定の 8192×8192 相当、負の値で無制限）
   -help
         このヘルプを表示
 
@@ -130,6 +153,7 @@ func printUsage() {
   svgpng -in input.svg -out output.png -w 800 -h 600 -bg white
   svgpng -in input.svg -out output.png -w 1920 -h 1080 -bg #000000
   svgpng -in input.svg -out output.png -w 800 -h 600 -no-system-font-scan
+  svgpng -in upload.svg -out upload.png -timeout 5s -max-pixels 4000000
 `)
 }
 
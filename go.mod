@@ -4,6 +4,9 @@ go 1.23.0
 
 toolchain go1.24.3
 
-require golang.org/x/image v0.30.0
-
-require golang.org/x/text v0.28.0 // indirect
+require (
+	github.com/andybalholm/brotli v1.1.1
+	github.com/go-text/typesetting v0.3.5
+	golang.org/x/image v0.30.0
+	golang.org/x/text v0.28.0
+)
@@ -0,0 +1,140 @@
+package diagnostic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ============================================================
+// 構造化された診断情報
+// ============================================================
+
+// Severity は診断の重要度です
+type Severity int
+
+const (
+	SeverityInfo    Severity = iota // 描画結果は指定どおり（代替フォントや合成の記録）
+	SeverityWarning                 // 指定の一部を無視・代替して描画した
+	SeverityError                   // 要素を描画できなかった
+)
+
+// String は重要度の名前を返します
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Code は診断の種類を表す識別子です（"<サブシステム>.<種類>"）
+type Code string
+
+const (
+	// パーサー
+	CodeInvalidViewBox Code = "parse.viewbox" // viewBox を解釈できない
+
+	// スタイル
+	CodeInvalidValue        Code = "style.invalid-value" // プロパティの値を解釈できない
+	CodeUnsupportedProperty Code = "style.unsupported"   // 未対応のプロパティ（Message はプロパティ名）
+
+	// 描画
+	CodeUnsupportedElement Code = "render.unsupported"       // 未対応の要素・機能
+	CodeMissingReference   Code = "render.missing-reference" // 参照先の要素がない（clip-path / shape-inside / textPath）
+	CodeInvalidPath        Code = "render.invalid-path"      // パスデータを解釈できない
+
+	// フィルター
+	CodeFilterNotFound    Code = "filter.not-found"   // 参照先のフィルターがない
+	CodeUnsupportedFilter Code = "filter.unsupported" // 未対応のフィルタープリミティブ・演算子
+
+	// フォント
+	CodeFontScan      Code = "font.scan"          // システムフォントのスキャンに失敗した
+	CodeFontConfig    Code = "font.config"        // fontconfig の設定を読み込めない
+	CodeFontFace      Code = "font.face"          // @font-face のフォントを読み込めない
+	CodeFontMissing   Code = "font.missing"       // font-family のどのファミリもない
+	CodeFontFallback  Code = "font.fallback"      // 代替フォントで描画した
+	CodeFontSynthesis Code = "font.synthesis"     // 太字・斜体を合成した
+	CodeMissingGlyph  Code = "font.missing-glyph" // どのフォントにもグリフがない
+	CodeShaping       Code = "font.shaping"       // シェーピングに失敗した
+
+	// オプション
+	CodeInvalidOption Code = "option.invalid" // Options の値を解釈できない
+)
+
+// Location は診断の対象の要素と、その開始タグのソース上の位置です
+type Location struct {
+	Element string // 要素のパス（例: "/svg/g[2]/text[1]"。要素に関係しない場合は空）
+	ID      string // 要素の id 属性
+	Line    int    // 開始タグの行（1 始まり。不明な場合は 0）
+	Column  int    // 開始タグの列（1 始まり。不明な場合は 0）
+}
+
+// String は "/svg/g[2]#id (3:5)" の形式で位置を返します
+func (l Location) String() string {
+	var b strings.Builder
+	b.WriteString(l.Element)
+	if l.ID != "" {
+		b.WriteString("#" + l.ID)
+	}
+	if l.Line > 0 {
+		fmt.Fprintf(&b, " (%d:%d)", l.Line, l.Column)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Entry は1件の診断です
+type Entry struct {
+	Severity Severity
+	Code     Code
+	Message  string
+	Location
+	Err error // 原因のエラー（ない場合は nil。errors.As で型を調べられます）
+}
+
+// String は "warning style.invalid-value /svg/rect[1] (3:5): ..." の形式で診断を返します
+func (e Entry) String() string {
+	s := fmt.Sprintf("%s %s", e.Severity, e.Code)
+	if loc := e.Location.String(); loc != "" {
+		s += " " + loc
+	}
+	return s + ": " + e.Message
+}
+
+// Collector は診断を重複なく集めます
+// 同じコードとメッセージの診断は最初の1件（最初に出現した要素）だけを記録します
+type Collector struct {
+	entries []Entry
+	seen    map[string]bool
+}
+
+// Add は診断を記録します（記録済みの場合は false を返します）
+func (c *Collector) Add(e Entry) bool {
+	if c.Has(e.Code, e.Message) {
+		return false
+	}
+	if c.seen == nil {
+		c.seen = make(map[string]bool)
+	}
+	c.seen[collectorKey(e.Code, e.Message)] = true
+	c.entries = append(c.entries, e)
+	return true
+}
+
+// Has は同じコードとメッセージの診断を記録済みかを返します
+// 位置の計算を省くため、記録する前に確かめるのに使います
+func (c *Collector) Has(code Code, msg string) bool {
+	return c.seen[collectorKey(code, msg)]
+}
+
+func collectorKey(code Code, msg string) string {
+	return string(code) + "\x00" + msg
+}
+
+// Entries は記録した診断を記録順に返します
+func (c *Collector) Entries() []Entry {
+	return c.entries
+}
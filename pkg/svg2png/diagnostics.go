@@ -0,0 +1,60 @@
+package svg2png
+
+import (
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
+)
+
+// ============================================================
+// 診断情報
+// ============================================================
+
+// Diagnostic は1件の診断（重要度・コード・メッセージ・要素のパスと id・ソース上の位置）です
+type Diagnostic = diagnostic.Entry
+
+// Severity は診断の重要度です
+type Severity = diagnostic.Severity
+
+// DiagnosticCode は診断の種類を表す識別子です（"font.fallback" など）
+type DiagnosticCode = diagnostic.Code
+
+// 診断の重要度
+const (
+	SeverityInfo    = diagnostic.SeverityInfo    // 描画結果は指定どおり（代替フォントや合成の記録）
+	SeverityWarning = diagnostic.SeverityWarning // 指定の一部を無視・代替して描画した
+	SeverityError   = diagnostic.SeverityError   // 要素を描画できなかった
+)
+
+// add は診断を Entries と、種類に応じた文字列のリストに記録します
+func (d *Diagnostics) add(e Diagnostic) {
+	d.Entries = append(d.Entries, e)
+	switch e.Code {
+	case diagnostic.CodeFontFallback:
+		d.FontFallbacks = append(d.FontFallbacks, e.Message)
+	case diagnostic.CodeFontSynthesis:
+		d.Syntheses = append(d.Syntheses, e.Message)
+	case diagnostic.CodeFontMissing:
+		d.MissingFonts = append(d.MissingFonts, e.Message)
+	case diagnostic.CodeUnsupportedProperty, diagnostic.CodeUnsupportedElement, diagnostic.CodeUnsupportedFilter:
+		d.Unsupported = append(d.Unsupported, e.Message)
+	default:
+		if e.Severity >= SeverityWarning {
+			d.Warnings = append(d.Warnings, e.Message)
+		}
+	}
+}
+
+// warn はエンジンの診断（要素に関係しない警告）を記録します
+func (d *Diagnostics) warn(code DiagnosticCode, err error) {
+	d.add(Diagnostic{Severity: SeverityWarning, Code: code, Message: err.Error(), Err: err})
+}
+
+// Filter は指定した重要度以上の診断を返します
+func (d Diagnostics) Filter(min Severity) []Diagnostic {
+	var out []Diagnostic
+	for _, e := range d.Entries {
+		if e.Severity >= min {
+			out = append(out, e)
+		}
+	}
+	return out
+}
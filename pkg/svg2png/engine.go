@@ -0,0 +1,270 @@
+package svg2png
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
+	"github.com/shinya/svg2png/pkg/svg2png/font"
+	"github.com/shinya/svg2png/pkg/svg2png/parser"
+	"github.com/shinya/svg2png/pkg/svg2png/raster"
+	"github.com/shinya/svg2png/pkg/svg2png/renderer"
+	"github.com/shinya/svg2png/pkg/svg2png/style"
+	"github.com/shinya/svg2png/pkg/svg2png/viewport"
+)
+
+// Engine は独自のフォントセットを持つレンダリングエンジンです
+// エンジンごとにフォントの登録・総称ファミリの設定が独立するため、用途ごとに異なるフォントセットで描画できます
+// Engine のメソッドは複数のゴルーチンから同時に呼び出せます
+type Engine struct {
+	fonts *font.Manager
+}
+
+// NewEngine は指定したフォントを登録したエンジンを作成します
+// システムフォントは Options.DisableSystemFontScan が false の描画時、または ScanSystemFonts で追加されます
+func NewEngine(fonts ...FontSource) (*Engine, error) {
+	e := &Engine{fonts: font.NewManager()}
+	if err := e.RegisterFonts(fonts...); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// RegisterFonts はエンジンにフォントを登録します
+func (e *Engine) RegisterFonts(fonts ...FontSource) error {
+	return e.fonts.RegisterFonts(fonts...)
+}
+
+// ScanSystemFonts はシステムフォントをスキャンしてエンジンに登録します
+// フォントファイルの情報はインデックスにキャッシュし、フォントデータは初回の使用時に読み込みます
+func (e *Engine) ScanSystemFonts() error {
+	return e.fonts.ScanSystemFonts()
+}
+
+// ScanFontDirectories はディレクトリ内のフォントファイルをスキャンしてエンジンに登録します
+// システムフォントと同じくインデックスを使い、フォントデータは初回の使用時に読み込みます
+func (e *Engine) ScanFontDirectories(dirs ...string) error {
+	return e.fonts.ScanFontDirectories(dirs...)
+}
+
+// SetFontIndexPath はフォントのインデックスの保存先を設定します
+// 既定はユーザーのキャッシュディレクトリの svg2png/fontindex.json で、空文字列を指定すると保存しません
+func (e *Engine) SetFontIndexPath(path string) {
+	e.fonts.SetIndexPath(path)
+}
+
+// ClearFontCache はエンジンに登録したフォントをすべて取り除きます
+// 総称ファミリの設定は保持します
+func (e *Engine) ClearFontCache() {
+	e.fonts.ClearCache()
+}
+
+// QueryFont はエンジンのフォントセットで CSS のフォント照合を行い、選ばれたフェイスと理由を返します
+func (e *Engine) QueryFont(q FontQuery) FontMatch {
+	return e.fonts.Query(q)
+}
+
+// CacheStats はエンジンのフェイスとグリフのキャッシュの利用状況を返します
+// キャッシュは描画をまたいで共有し、ClearFontCache で捨てます
+func (e *Engine) CacheStats() CacheStats {
+	return e.fonts.CacheStats()
+}
+
+// SetCacheLimits はエンジンのフェイスとグリフのキャッシュの上限を設定します
+// faces はフェイスの数（0 は既定の 256）、glyphBytes はグリフのマスクとアウトラインのバイト数（0 は既定の 32MiB）で、
+// 負の値でキャッシュを無効にします。キャッシュはエンジンの描画で共有するため、上限もエンジン全体に適用されます
+func (e *Engine) SetCacheLimits(faces int, glyphBytes int64) {
+	e.fonts.SetCacheLimits(faces, glyphBytes)
+}
+
+// SetGenericFamily はエンジンの総称ファミリの候補を設定します（families が空の場合は既定の候補に戻します）
+func (e *Engine) SetGenericFamily(generic, lang string, families ...string) {
+	e.fonts.SetGenericFamily(generic, lang, families...)
+}
+
+// RenderPNG はエンジンのフォントセットでSVGをPNGに変換します
+// 描画は開始時点のフォントセットの複製で行うため、並行する RegisterFonts や ClearFontCache の影響を受けません
+func (e *Engine) RenderPNG(svg []byte, opts Options) (png []byte, diag Diagnostics, err error) {
+	var buf bytes.Buffer
+	diag, err = e.RenderTo(context.Background(), &buf, bytes.NewReader(svg), opts, FormatPNG)
+	if err != nil {
+		return nil, Diagnostics{}, err
+	}
+	return buf.Bytes(), diag, nil
+}
+
+// RenderTo はエンジンのフォントセットで r から読み込んだSVGを描画し、format の形式で w に書き出します
+func (e *Engine) RenderTo(ctx context.Context, w io.Writer, r io.Reader, opts Options, format Format) (Diagnostics, error) {
+	img, diag, err := e.Render(ctx, r, opts)
+	if err != nil {
+		return Diagnostics{}, err
+	}
+	if err := encodeImage(w, img, format); err != nil {
+		return Diagnostics{}, err
+	}
+	return diag, nil
+}
+
+// Render はエンジンのフォントセットで r から読み込んだSVGを描画した画像を返します
+// SVGは読み込みながら字句解析するため、入力全体を文字列に複製しません。
+// 画像は RenderPNG が書き出すPNGと同じ画素（アルファ乗算済み）で、呼び出し側で自由に変更できます。
+// ctx が終了するか Options.Timeout を過ぎると、読み込み中または要素の区切りで描画を打ち切り ctx.Err() を返します。
+// Options.Limits の上限を超えた場合は *LimitError を、SVGの構文エラーは *ParseError を、
+// 入力を読み込めない場合は *ResourceError を返します
+func (e *Engine) Render(ctx context.Context, r io.Reader, opts Options) (img *image.RGBA, diag Diagnostics, err error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, Diagnostics{}, err
+	}
+	lim := opts.Limits.Resolve()
+
+	// デフォルト値の設定
+	if opts.DPI == 0 {
+		opts.DPI = 96
+	}
+	if opts.DefaultFamily == "" {
+		opts.DefaultFamily = "Arial"
+	}
+
+	// システムフォントスキャン（デフォルトON、DisableSystemFontScan=trueで無効化）
+	if !opts.DisableSystemFontScan {
+		if err := e.fonts.ScanSystemFonts(); err != nil {
+			// 警告として記録するが、処理は続行
+			diag.warn(diagnostic.CodeFontScan, &ResourceError{Op: "font scan", Err: err})
+		}
+	}
+
+	// SVGパース
+	doc, err := parser.ParseWithLimits(&contextReader{ctx: ctx, r: r}, lim)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, Diagnostics{}, ctxErr
+		}
+		var pe *ParseError
+		var le *LimitError
+		if errors.As(err, &pe) || errors.As(err, &le) {
+			return nil, Diagnostics{}, err
+		}
+		return nil, Diagnostics{}, &ResourceError{Op: "read", Err: err}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, Diagnostics{}, err
+	}
+
+	// スケール倍率
+	scaleFactor := opts.Scale
+	if scaleFactor <= 0 {
+		scaleFactor = 1.0
+	}
+
+	// ビューポート解決
+	vp, err := viewport.ResolveViewport(doc, opts.Width, opts.Height, opts.DPI, scaleFactor)
+	if err != nil {
+		// width / height などルート要素の属性を解釈できない
+		return nil, Diagnostics{}, &ParseError{Line: doc.Root.Line, Column: doc.Root.Column, Msg: err.Error(), Err: err}
+	}
+
+	// ビューポートから解決された実際の出力サイズを使用
+	// フレームバッファを確保する前に検査する（巨大な width / height で大量のメモリを確保しない）
+	outWidth, outHeight, err := checkOutputSize(vp, doc.Root, lim.MaxPixels)
+	if err != nil {
+		return nil, Diagnostics{}, err
+	}
+
+	// スタイル解決器作成
+	styleResolver := style.NewResolver(opts.DefaultFamily)
+
+	// フレームバッファ作成
+	fb := raster.NewFrameBuffer(outWidth, outHeight, opts.Background)
+
+	// フォントセットの複製を取得
+	// @font-face のフォントは文書ごとのフォントセットに登録する（エンジンには登録しない）
+	snapshot := e.fonts.Snapshot()
+	if opts.FontConfigFile != "" {
+		if cfg, err := font.LoadFontConfig(opts.FontConfigFile); err != nil {
+			diag.warn(diagnostic.CodeFontConfig, &ResourceError{Op: "fontconfig", Err: err})
+		} else {
+			e.fonts.ApplyFontConfig(snapshot, cfg)
+		}
+	}
+	fontRenderer, err := loadDocumentFonts(doc, snapshot, opts, &diag)
+	if err != nil {
+		return nil, Diagnostics{}, err
+	}
+	hinting, err := font.ParseHinting(opts.Hinting)
+	if err != nil {
+		diag.warn(diagnostic.CodeInvalidOption, err)
+	}
+	fontRenderer.SetGlyphPlacement(hinting, !opts.DisableSubpixelPositioning)
+
+	// レンダリングコンテキスト作成
+	rc := raster.NewRasterContext(fb, fontRenderer, vp, doc.Defs)
+	rc.SetTextCoverage(opts.TextGamma, opts.TextContrast)
+	rc.SetContext(ctx)
+	rc.SetLimits(lim)
+
+	// 要素の描画
+	err = renderer.RenderElements(doc, vp, styleResolver, rc)
+	if err != nil {
+		return nil, Diagnostics{}, err
+	}
+
+	// 診断情報収集（エンジン・フォントの診断の後に、パーサー・スタイル・描画の順で加える）
+	for _, entries := range [][]Diagnostic{doc.Diagnostics, styleResolver.GetDiagnostics(), rc.Diagnostics()} {
+		for _, e := range entries {
+			diag.add(e)
+		}
+	}
+
+	return fb.Image(), diag, nil
+}
+
+// contextReader は読み込みのたびにコンテキストの終了を確かめる io.Reader です
+// 遅い入力や巨大な入力のパースをキャンセルできるようにします
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// maxFrameBufferPixels はフレームバッファの画素数の絶対的な上限です（画素あたり4バイトのバッファの長さが int に収まる範囲）
+// Limits.MaxPixels が負で制限しない場合にも適用します
+const maxFrameBufferPixels = math.MaxInt / 4
+
+// checkOutputSize はビューポートの出力サイズを検査し、整数の幅と高さを返します
+// NaN・無限大・0 以下のサイズは *ParseError を、画素数が max を超える場合は *LimitError を返します。
+// 巨大な値が整数への変換で桁あふれしないよう、画素数は浮動小数点数のまま比較します
+func checkOutputSize(vp *viewport.Viewport, root *parser.Element, max int64) (width, height int, err error) {
+	w, h := math.Trunc(vp.Width), math.Trunc(vp.Height)
+	if math.IsNaN(w) || math.IsInf(w, 0) || w <= 0 || math.IsNaN(h) || math.IsInf(h, 0) || h <= 0 {
+		msg := fmt.Sprintf("invalid output size %gx%g", vp.Width, vp.Height)
+		return 0, 0, &ParseError{Line: root.Line, Column: root.Column, Msg: msg}
+	}
+	if max < 0 || max > maxFrameBufferPixels {
+		max = maxFrameBufferPixels
+	}
+	if pixels := w * h; pixels > float64(max) {
+		// 2^63 以上の画素数は int64 に変換できないため最大値で表す
+		actual := int64(math.MaxInt64)
+		if pixels < math.MaxInt64 {
+			actual = int64(pixels)
+		}
+		return 0, 0, &LimitError{Limit: "pixels", Max: max, Actual: actual}
+	}
+	return int(w), int(h), nil
+}
@@ -0,0 +1,38 @@
+package svg2png
+
+import (
+	"fmt"
+
+	"github.com/shinya/svg2png/pkg/svg2png/limits"
+	"github.com/shinya/svg2png/pkg/svg2png/parser"
+)
+
+// ============================================================
+// エラーの型
+// ============================================================
+
+// ParseError はSVGの構文エラーです（エラーを検出した行と列を持ちます）
+type ParseError = parser.ParseError
+
+// LimitError は資源の上限を超えたことを表すエラーです（errors.As で取り出せます）
+type LimitError = limits.Error
+
+// ResourceError は入出力やフォントなど、SVGの外にある資源を扱えなかったことを表すエラーです
+// 入力の読み込みと出力の書き込みに失敗すると Render / RenderTo が返し、
+// フォントや fontconfig の設定を読み込めない場合は診断（Diagnostic.Err）に記録されます
+type ResourceError struct {
+	Op       string // "read" | "write" | "@font-face" | "fontconfig" | "font scan"
+	Resource string // 資源の名前（URL・パス・ファミリ名など。ない場合は空）
+	Err      error
+}
+
+func (e *ResourceError) Error() string {
+	if e.Resource == "" {
+		return fmt.Sprintf("%s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Resource, e.Err)
+}
+
+func (e *ResourceError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,78 @@
+package font
+
+// ============================================================
+// 送り幅の調整（textLength / lengthAdjust）
+// ============================================================
+
+// inlineY は進行方向が y（縦書きの正立）かを返します
+// 横倒しでは回転前の横組みの座標で保持するため x が進行方向です
+func (run *GlyphRun) inlineY() bool {
+	return run.Vertical && !run.Sideways
+}
+
+// glyphScale はフォント単位からピクセルへの横・縦の拡大率を返します（進行方向には stretch を掛けます）
+func (run *GlyphRun) glyphScale(scale float64) (sx, sy float64) {
+	k := run.stretch
+	if k == 0 {
+		k = 1
+	}
+	if run.inlineY() {
+		return scale, scale * k
+	}
+	return scale * k, scale
+}
+
+// Clusters はグリフ列に含まれるクラスタ（合字などでまとまった文字）の数を返します
+func (run *GlyphRun) Clusters() int {
+	n := 0
+	for i, g := range run.Glyphs {
+		if i == len(run.Glyphs)-1 || run.Glyphs[i+1].Cluster != g.Cluster {
+			n++
+		}
+	}
+	return n
+}
+
+// WithSpacing は各クラスタの後に extra ピクセルの間隔を加えたグリフ列の複製を返します
+// skipLast の場合、視覚順で最後のクラスタの後には加えません
+func (run *GlyphRun) WithSpacing(extra float64, skipLast bool) *GlyphRun {
+	out := *run
+	out.Glyphs = append([]ShapedGlyph(nil), run.Glyphs...)
+	for i := range out.Glyphs {
+		g := &out.Glyphs[i]
+		last := i == len(out.Glyphs)-1
+		if (!last && out.Glyphs[i+1].Cluster == g.Cluster) || (last && skipLast) {
+			continue
+		}
+		if out.inlineY() {
+			g.YAdvance += extra
+		} else {
+			g.XAdvance += extra
+		}
+		out.Advance += extra
+	}
+	return &out
+}
+
+// Stretched は進行方向にグリフの形と送り幅を k 倍したグリフ列の複製を返します
+// カラーグリフの画像は拡大しません
+func (run *GlyphRun) Stretched(k float64) *GlyphRun {
+	out := *run
+	out.Glyphs = append([]ShapedGlyph(nil), run.Glyphs...)
+	if out.stretch == 0 {
+		out.stretch = 1
+	}
+	out.stretch *= k
+	for i := range out.Glyphs {
+		g := &out.Glyphs[i]
+		if out.inlineY() {
+			g.YAdvance *= k
+			g.YOffset *= k
+		} else {
+			g.XAdvance *= k
+			g.XOffset *= k
+		}
+	}
+	out.Advance *= k
+	return &out
+}
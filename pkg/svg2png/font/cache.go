@@ -0,0 +1,461 @@
+package font
+
+import (
+	"container/list"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	tsfont "github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+	xfont "golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/vector"
+)
+
+// ============================================================
+// フェイスとグリフのキャッシュ
+// ============================================================
+
+const (
+	// DefaultFaceCacheSize はキャッシュするフェイスの既定の数です
+	DefaultFaceCacheSize = 256
+	// DefaultGlyphCacheBytes はグリフのマスクとアウトラインのキャッシュの既定の上限（バイト）です
+	DefaultGlyphCacheBytes = 32 << 20
+
+	// subpixelSteps はグリフのマスクを作り分けるサブピクセル位置の段階数（1ピクセルあたり）です
+	subpixelSteps = 4
+
+	// maxGlyphMaskBytes はグリフ1つのマスクの大きさの上限（バイト）です
+	// これより大きなグリフはマスクを作らずに、描画先に切り抜いたアウトラインで描画します
+	maxGlyphMaskBytes = 1 << 20
+)
+
+// CacheStats はキャッシュの利用状況です
+type CacheStats struct {
+	FaceHits, FaceMisses   int64
+	GlyphHits, GlyphMisses int64
+	Faces                  int   // キャッシュしているフェイスの数
+	GlyphBytes             int64 // キャッシュしているグリフのマスクとアウトラインの大きさ（概算）
+}
+
+// Cache は描画をまたいで共有するフェイスとグリフのキャッシュです
+// フェイスはフォント・軸の値（レガシー描画ではサイズとヒンティング）ごとに、
+// グリフのマスクはグリフ・サイズ・サブピクセル位置・合成の設定ごとに、最近使われていないものから捨てます。
+// 複数のゴルーチンから同時に使えます
+type Cache struct {
+	mu     sync.Mutex
+	faces  *lru // faceKey → *sharedFace、xfaceKey → *sharedXFace
+	glyphs *lru // glyphKey → *image.Alpha、outlineKey → []ot.Segment
+	stats  CacheStats
+}
+
+// sharedFace は描画をまたいで共有する go-text のフェイスです
+// フェイスは内部のキャッシュを更新するため、使用中は mu で排他します
+type sharedFace struct {
+	mu   sync.Mutex
+	face *tsfont.Face
+}
+
+// sharedXFace は描画をまたいで共有する golang.org/x/image のフェイスです（使用中は mu で排他します）
+type sharedXFace struct {
+	mu   sync.Mutex
+	face xfont.Face
+}
+
+type faceKey struct {
+	ff         *FontFace
+	variations string
+}
+
+type xfaceKey struct {
+	ff      *FontFace
+	size    float64
+	hinting Hinting
+}
+
+type outlineKey struct {
+	ff         *FontFace
+	variations string
+	gid        uint32
+}
+
+type glyphKey struct {
+	outlineKey
+	size                 float64
+	sx, sy               float64 // フォント単位からピクセルへの拡大率（stretch を含む）
+	embolden, skew       float64
+	subpixelX, subpixelY uint8 // 1/subpixelSteps ピクセル単位の原点の端数
+}
+
+// NewCache は上限を指定してキャッシュを作成します（0 は既定の上限、負の値はキャッシュしない）
+func NewCache(faces int, glyphBytes int64) *Cache {
+	c := &Cache{
+		faces:  newLRU(func(any) int64 { return 1 }),
+		glyphs: newLRU(glyphSize),
+	}
+	c.SetLimits(faces, glyphBytes)
+	return c
+}
+
+// SetLimits はキャッシュの上限を変更し、超えた分を捨てます（0 は既定の上限、負の値はキャッシュしない）
+func (c *Cache) SetLimits(faces int, glyphBytes int64) {
+	if faces == 0 {
+		faces = DefaultFaceCacheSize
+	}
+	if glyphBytes == 0 {
+		glyphBytes = DefaultGlyphCacheBytes
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.faces.setMax(max(int64(faces), 0))
+	c.glyphs.setMax(max(glyphBytes, 0))
+}
+
+// Clear はキャッシュをすべて捨てます（統計は保持します）
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.faces.clear()
+	c.glyphs.clear()
+}
+
+// Stats はキャッシュの利用状況を返します
+func (c *Cache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Faces = c.faces.len()
+	s.GlyphBytes = c.glyphs.used
+	return s
+}
+
+// Cache はフォントセットのフェイスとグリフのキャッシュを返します
+// Scoped で作成したフォントセットは元のフォントセットとキャッシュを共有します
+func (r *Renderer) Cache() *Cache {
+	return r.cache
+}
+
+// face はフォントと軸の値に対応する共有フェイスを返します
+// c が nil の場合やキャッシュしない設定の場合は、共有しない新しいフェイスを返します
+func (c *Cache) face(ff *FontFace, variations []tsfont.Variation) *sharedFace {
+	key := faceKey{ff: ff, variations: variationKey(variations)}
+	if c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if v, ok := c.faces.get(key); ok {
+			c.stats.FaceHits++
+			return v.(*sharedFace)
+		}
+		c.stats.FaceMisses++
+	}
+	face := tsfont.NewFace(ff.TSFont)
+	if len(variations) > 0 {
+		face.SetVariations(variations)
+	}
+	sf := &sharedFace{face: face}
+	if c != nil {
+		c.faces.add(key, sf)
+	}
+	return sf
+}
+
+// xface は OpenType フォントのサイズ・ヒンティングに対応する golang.org/x/image のフェイスを返します
+func (c *Cache) xface(ff *FontFace, size float64, hinting Hinting) (*sharedXFace, error) {
+	key := xfaceKey{ff: ff, size: size, hinting: hinting}
+	if c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if v, ok := c.faces.get(key); ok {
+			c.stats.FaceHits++
+			return v.(*sharedXFace), nil
+		}
+		c.stats.FaceMisses++
+	}
+	face, err := opentype.NewFace(ff.OTFont, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     96,
+		Hinting: hinting.xfont(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sf := &sharedXFace{face: face}
+	if c != nil {
+		c.faces.add(key, sf)
+	}
+	return sf, nil
+}
+
+// outline はグリフのアウトライン（フォント単位）を返します
+// 返すセグメントは共有するため変更してはいけません
+func (c *Cache) outline(sf *sharedFace, key outlineKey) ([]ot.Segment, bool) {
+	if c != nil {
+		c.mu.Lock()
+		v, ok := c.glyphs.get(key)
+		c.mu.Unlock()
+		if ok {
+			segs, _ := v.([]ot.Segment)
+			return segs, segs != nil
+		}
+	}
+	sf.mu.Lock()
+	data, ok := sf.face.GlyphDataOutline(tsfont.GID(key.gid))
+	sf.mu.Unlock()
+	var segs []ot.Segment
+	if ok {
+		segs = data.Segments
+	}
+	if c != nil {
+		// アウトラインのないグリフ（空白など）も記録する
+		c.mu.Lock()
+		c.glyphs.add(key, segs)
+		c.mu.Unlock()
+	}
+	return segs, segs != nil
+}
+
+// mask はキャッシュしたグリフのマスクを返します（ない場合は false）
+func (c *Cache) mask(key glyphKey) (*image.Alpha, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.glyphs.get(key)
+	if !ok {
+		c.stats.GlyphMisses++
+		return nil, false
+	}
+	c.stats.GlyphHits++
+	return v.(*image.Alpha), true
+}
+
+// addMask はグリフのマスクを記録します
+func (c *Cache) addMask(key glyphKey, m *image.Alpha) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.glyphs.add(key, m)
+}
+
+// maskBudget はグリフ1つのマスクに使える大きさ（バイト）を返します
+// キャッシュの上限より大きなマスクは記録できないため、作成する前にこの大きさと比べます
+func (c *Cache) maskBudget() int64 {
+	if c == nil {
+		return maxGlyphMaskBytes
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.glyphs.maxSize > 0 {
+		return min(maxGlyphMaskBytes, c.glyphs.maxSize)
+	}
+	// キャッシュしない設定でも、マスクの大きさは同じ上限で抑える
+	return maxGlyphMaskBytes
+}
+
+// glyphSize はグリフのキャッシュの項目の大きさ（概算のバイト数）を返します
+func glyphSize(v any) int64 {
+	const overhead = 128
+	switch v := v.(type) {
+	case *image.Alpha:
+		return int64(len(v.Pix)) + overhead
+	case []ot.Segment:
+		return int64(len(v))*int64(4+3*8) + overhead
+	}
+	return overhead
+}
+
+// variationKey は軸の値をキャッシュのキーにする文字列に変換します
+func variationKey(variations []tsfont.Variation) string {
+	if len(variations) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, v := range variations {
+		b.WriteString(v.Tag.String())
+		b.WriteByte('=')
+		b.WriteString(strconv.FormatFloat(float64(v.Value), 'g', -1, 32))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+// ============================================================
+// グリフのマスク
+// ============================================================
+
+// Masks はグリフ列を (x, y) に置いたときの各グリフのマスク（被覆率）を draw に渡します
+// マスクはグリフ・サイズ・1/4 ピクセル単位の原点の端数ごとにキャッシュし、Rect は描画先のピクセル位置です。
+// clip（描画先の範囲）と重ならないグリフは作成せずに読み飛ばします。
+// カラーグリフや横倒しのグリフ、clip やマスクの大きさの上限より大きなグリフを含む場合は
+// false を返します（clip に切り抜いた Outline で描画します）
+func (run *GlyphRun) Masks(x, y float64, clip image.Rectangle, draw func(mask *image.Alpha)) bool {
+	if run.Sideways || run.color != nil || run.shared == nil {
+		return false
+	}
+	budget := run.cache.maskBudget()
+	sx, sy := run.glyphScale(run.Size / float64(run.Face.TSFont.Upem()))
+	penX, penY := x, y
+	for _, g := range run.Glyphs {
+		ox, oy := run.snapOrigin(penX+g.XOffset, penY+g.YOffset)
+		penX += g.XAdvance
+		penY += g.YAdvance
+
+		ix, fx := splitSubpixel(ox)
+		iy, fy := splitSubpixel(oy)
+		key := glyphKey{
+			outlineKey: run.outlineKey(g.ID),
+			size:       run.Size,
+			sx:         sx,
+			sy:         sy,
+			embolden:   run.embolden,
+			skew:       run.skew,
+			subpixelX:  fx,
+			subpixelY:  fy,
+		}
+		m, ok := run.cache.mask(key)
+		if !ok {
+			var fits bool
+			m, fits = run.rasterizeGlyph(g.ID, float64(fx)/subpixelSteps, float64(fy)/subpixelSteps, sx, sy, clip.Sub(image.Pt(ix, iy)), budget)
+			if !fits {
+				return false
+			}
+			if m == nil {
+				// clip の外のグリフは描画せず、位置によらないキャッシュにも記録しない
+				continue
+			}
+			run.cache.addMask(key, m)
+		}
+		if m.Rect.Empty() {
+			continue
+		}
+		// キャッシュのマスクは共有するため、画素を複製せずに位置だけを変える
+		placed := *m
+		placed.Rect = m.Rect.Add(image.Pt(ix, iy))
+		draw(&placed)
+	}
+	return true
+}
+
+// splitSubpixel は座標を整数ピクセルと 1/subpixelSteps ピクセル単位の端数に分けます
+func splitSubpixel(v float64) (int, uint8) {
+	i := math.Floor(v)
+	f := math.Round((v - i) * subpixelSteps)
+	if f == subpixelSteps {
+		i, f = i+1, 0
+	}
+	return int(i), uint8(f)
+}
+
+// rasterizeGlyph はグリフを原点 (ox, oy) に置いてラスタライズしたマスクを返します
+// マスクの Rect は整数ピクセルの原点からの相対位置で、clip も同じ座標系です。
+// メモリを確保する前に大きさを調べ、clip より大きいかマスクが budget バイトを超える場合は fits = false を、
+// clip と重ならない場合は nil を返します
+func (run *GlyphRun) rasterizeGlyph(gid uint32, ox, oy, sx, sy float64, clip image.Rectangle, budget int64) (mask *image.Alpha, fits bool) {
+	segs, ok := run.cache.outline(run.shared, run.outlineKey(gid))
+	if !ok {
+		return &image.Alpha{}, true
+	}
+	segs = run.synthesize(segs)
+	var bb boundsSink
+	emitSegments(segs, ox, oy, sx, sy, &bb)
+	if !bb.any {
+		return &image.Alpha{}, true
+	}
+	// 巨大なフォントサイズでも整数に変換する前に浮動小数点のまま比べる（余白の 2 ピクセルを含む）
+	w, h := float64(bb.maxX-bb.minX)+4, float64(bb.maxY-bb.minY)+4
+	if w > float64(clip.Dx()) || h > float64(clip.Dy()) || w*h > float64(budget) {
+		return nil, false
+	}
+	rect := bb.rect()
+	if !rect.Overlaps(clip) {
+		return nil, true
+	}
+	rz := vector.NewRasterizer(rect.Dx(), rect.Dy())
+	emitSegments(segs, ox-float64(rect.Min.X), oy-float64(rect.Min.Y), sx, sy, rz)
+	m := image.NewAlpha(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	rz.Draw(m, m.Bounds(), image.Opaque, image.Point{})
+	m.Rect = rect
+	return m, true
+}
+
+// outlineKey はグリフのアウトラインのキャッシュのキーを返します
+func (run *GlyphRun) outlineKey(gid uint32) outlineKey {
+	return outlineKey{ff: run.Face, variations: run.variations, gid: gid}
+}
+
+// ============================================================
+// LRU
+// ============================================================
+
+// lru は大きさの合計が上限を超えないように、最近使われていない項目から捨てる連想配列です（排他は呼び出し側で行います）
+type lru struct {
+	maxSize int64
+	used    int64
+	size    func(value any) int64
+	order   *list.List // 先頭が最近使われた項目
+	items   map[any]*list.Element
+}
+
+type lruEntry struct {
+	key, value any
+	size       int64
+}
+
+func newLRU(size func(value any) int64) *lru {
+	return &lru{size: size, order: list.New(), items: make(map[any]*list.Element)}
+}
+
+func (l *lru) get(key any) (any, bool) {
+	if e, ok := l.items[key]; ok {
+		l.order.MoveToFront(e)
+		return e.Value.(*lruEntry).value, true
+	}
+	return nil, false
+}
+
+func (l *lru) add(key, value any) {
+	if e, ok := l.items[key]; ok {
+		l.remove(e)
+	}
+	n := l.size(value)
+	if n > l.maxSize {
+		return
+	}
+	l.items[key] = l.order.PushFront(&lruEntry{key: key, value: value, size: n})
+	l.used += n
+	l.evict()
+}
+
+func (l *lru) setMax(n int64) {
+	l.maxSize = n
+	l.evict()
+}
+
+func (l *lru) evict() {
+	for l.used > l.maxSize {
+		l.remove(l.order.Back())
+	}
+}
+
+func (l *lru) remove(e *list.Element) {
+	entry := l.order.Remove(e).(*lruEntry)
+	delete(l.items, entry.key)
+	l.used -= entry.size
+}
+
+func (l *lru) clear() {
+	l.order.Init()
+	l.items = make(map[any]*list.Element)
+	l.used = 0
+}
+
+func (l *lru) len() int { return len(l.items) }
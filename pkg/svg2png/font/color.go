@@ -0,0 +1,875 @@
+package font
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	_ "image/jpeg" // CBDT/sbix の JPEG ビットマップ
+	_ "image/png"  // CBDT/sbix の PNG ビットマップ
+	"math"
+
+	tsfont "github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+	"github.com/go-text/typesetting/font/opentype/tables"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/vector"
+)
+
+// ColorOptions はカラーグリフの描画設定です
+type ColorOptions struct {
+	Palette    int             // CPAL のパレット番号（PaletteFor で font-palette から求めます）
+	Foreground color.Color     // パレット番号 0xFFFF（テキストの前景色）に使う色。nil は黒
+	Clip       image.Rectangle // 描画先の範囲（ピクセル）。画像はこの範囲に切り抜いて確保します。空の場合は切り抜かない
+}
+
+// clipRect は rect を描画先の範囲 clip に切り抜きます（clip が空の場合はそのまま返します）
+func (opts ColorOptions) clipRect(rect image.Rectangle) image.Rectangle {
+	if opts.Clip.Empty() {
+		return rect
+	}
+	return rect.Intersect(opts.Clip)
+}
+
+// CPAL v1 のパレット種別フラグ
+const (
+	paletteUsableWithLight = 1 << 0
+	paletteUsableWithDark  = 1 << 1
+)
+
+// foregroundIndex は前景色を表す COLR のパレット番号です
+const foregroundIndex = 0xFFFF
+
+// maxPaintDepth は COLRv1 のペイントグラフをたどる深さの上限です（循環参照対策）
+const maxPaintDepth = 64
+
+// colorKind はグリフの描画方法です
+type colorKind uint8
+
+const (
+	colorNone   colorKind = iota // 通常のアウトライン
+	colorLayers                  // COLR/CPAL のレイヤー
+	colorBitmap                  // CBDT/sbix のカラービットマップ
+)
+
+// HasColorGlyphs はフォントがカラーグリフ（COLR/CPAL、CBDT/CBLC、sbix）を持つかを返します
+func (ff *FontFace) HasColorGlyphs() bool {
+	ff.load()
+	if ff.TSFont == nil {
+		return false
+	}
+	return ff.TSFont.COLR != nil || len(ff.TSFont.BitmapSizes()) > 0
+}
+
+// PaletteFor は font-palette の値に対応する CPAL パレット番号を返します
+// "light" / "dark" は CPAL v1 のパレット種別から明るい/暗い背景向けのパレットを選び、
+// 該当するパレットがない場合や "normal" などその他の値では既定のパレット（0）を使います
+func (ff *FontFace) PaletteFor(fontPalette string) int {
+	var want uint32
+	switch fontPalette {
+	case "light":
+		want = paletteUsableWithLight
+	case "dark":
+		want = paletteUsableWithDark
+	default:
+		return 0
+	}
+	ff.load()
+	for i, t := range ff.paletteTypes {
+		if t&want != 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// readPaletteTypes は CPAL v1 のパレット種別の配列を読み取ります
+// go-text/typesetting は種別を公開しないため、テーブルを直接解析します
+func readPaletteTypes(data []byte, index int) []uint32 {
+	loaders, err := ot.NewLoaders(bytes.NewReader(data))
+	if err != nil || index >= len(loaders) {
+		return nil
+	}
+	raw, err := loaders[index].RawTable(ot.MustNewTag("CPAL"))
+	if err != nil || len(raw) < 12 || binary.BigEndian.Uint16(raw) < 1 {
+		return nil
+	}
+	numPalettes := int(binary.BigEndian.Uint16(raw[4:]))
+	pos := 12 + 2*numPalettes
+	if len(raw) < pos+4 {
+		return nil
+	}
+	offset := int(binary.BigEndian.Uint32(raw[pos:]))
+	if offset == 0 || len(raw) < offset+4*numPalettes {
+		return nil
+	}
+	types := make([]uint32, numPalettes)
+	for i := range types {
+		types[i] = binary.BigEndian.Uint32(raw[offset+4*i:])
+	}
+	return types
+}
+
+// markColorGlyphs はグリフ列のうちカラーで描画するグリフを記録します
+// ビットマップは要求サイズ以上で最小のストライク（なければ最大のストライク）を使います
+func (run *GlyphRun) markColorGlyphs() {
+	if sizes := run.face.BitmapSizes(); len(sizes) > 0 {
+		run.strikePpem = chooseStrikePpem(sizes, uint16(math.Ceil(run.Size)))
+		run.face.SetPpem(run.strikePpem, run.strikePpem)
+	}
+	kinds := make([]colorKind, len(run.Glyphs))
+	found := false
+	for i, g := range run.Glyphs {
+		kinds[i] = run.colorKindOf(tsfont.GID(g.ID))
+		found = found || kinds[i] != colorNone
+	}
+	if found {
+		run.color = kinds
+	}
+}
+
+// chooseStrikePpem はビットマップのストライクを選びます
+func chooseStrikePpem(sizes []tsfont.BitmapSize, request uint16) uint16 {
+	var best, largest uint16
+	for _, s := range sizes {
+		ppem := max(s.XPpem, s.YPpem)
+		largest = max(largest, ppem)
+		if ppem >= request && (best == 0 || ppem < best) {
+			best = ppem
+		}
+	}
+	if best == 0 {
+		return largest
+	}
+	return best
+}
+
+// colorKindOf はグリフの描画方法を判定します
+// 白黒のビットマップ（EBDT）やアウトラインを併せ持つビットマップはアウトラインで描画します
+func (run *GlyphRun) colorKindOf(gid tsfont.GID) colorKind {
+	if _, ok := run.face.GlyphDataColor(gid); ok {
+		return colorLayers
+	}
+	if run.strikePpem == 0 {
+		return colorNone
+	}
+	bm, ok := run.face.GlyphDataBitmap(gid)
+	if !ok || (bm.Format != tsfont.PNG && bm.Format != tsfont.JPG) {
+		return colorNone
+	}
+	if bm.Outline != nil && len(bm.Outline.Segments) > 0 {
+		return colorNone
+	}
+	return colorBitmap
+}
+
+// isColor は i 番目のグリフをカラーで描画するかを返します
+func (run *GlyphRun) isColor(i int) bool {
+	return run.color != nil && run.color[i] != colorNone
+}
+
+// HasColor はグリフ列がカラーグリフを含むかを返します
+func (run *GlyphRun) HasColor() bool {
+	return run.color != nil
+}
+
+// ColorLayers はカラーグリフを (x, y) を原点として描画した画像を返します
+// 各画像は乗算済みアルファの RGBA で、Bounds は描画先のピクセル座標です
+// カラーグリフは Outline では出力されないため、Outline と併せて使用します
+func (run *GlyphRun) ColorLayers(x, y float64, opts ColorOptions) []*image.RGBA {
+	if !run.HasColor() {
+		return nil
+	}
+	scale := run.Size / float64(run.face.Upem())
+	var layers []*image.RGBA
+	penX, penY := x, y
+	for i, g := range run.Glyphs {
+		ox, oy := penX+g.XOffset, penY+g.YOffset
+		var layer *image.RGBA
+		switch run.color[i] {
+		case colorLayers:
+			layer = run.paintCOLR(tsfont.GID(g.ID), ox, oy, scale, opts)
+		case colorBitmap:
+			layer = run.paintBitmap(tsfont.GID(g.ID), ox, oy, scale, opts)
+		}
+		if layer != nil {
+			layers = append(layers, layer)
+		}
+		penX += g.XAdvance
+		penY += g.YAdvance
+	}
+	return layers
+}
+
+// paintBitmap は CBDT/sbix のビットマップをグリフ位置に拡大縮小して描画します
+// ビットマップのベアリング値は参照できないため、横送り幅の中央に置いて下端をディセンダーに揃えます
+func (run *GlyphRun) paintBitmap(gid tsfont.GID, ox, oy, scale float64, opts ColorOptions) *image.RGBA {
+	bm, ok := run.face.GlyphDataBitmap(gid)
+	if !ok {
+		return nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(bm.Data))
+	if err != nil {
+		return nil
+	}
+	s := run.Size / float64(run.strikePpem)
+	w, h := float64(src.Bounds().Dx())*s, float64(src.Bounds().Dy())*s
+	advance := float64(run.face.HorizontalAdvance(gid)) * scale
+	x0 := ox + (advance-w)/2
+	y0 := oy + run.descent - h
+	rect := image.Rect(int(math.Round(x0)), int(math.Round(y0)), int(math.Round(x0+w)), int(math.Round(y0+h)))
+	if opts.clipRect(rect).Empty() {
+		return nil
+	}
+	// 描画先の外は確保しない（Scale は rect 全体への拡大縮小のうち dst の範囲だけを描く）
+	dst := image.NewRGBA(opts.clipRect(rect))
+	xdraw.CatmullRom.Scale(dst, rect, src, src.Bounds(), xdraw.Over, nil)
+	return dst
+}
+
+// ============================================================
+// COLR/CPAL
+// ============================================================
+
+// paintCOLR は COLR のカラーグリフ（v0 のレイヤー、v1 のペイントグラフ）を描画します
+func (run *GlyphRun) paintCOLR(gid tsfont.GID, ox, oy, scale float64, opts ColorOptions) *image.RGBA {
+	glyph, ok := run.face.GlyphDataColor(gid)
+	if !ok {
+		return nil
+	}
+	p := &colrPainter{face: run.face, colr: run.face.COLR, fg: color.NRGBA{A: 0xFF}}
+	if opts.Foreground != nil {
+		p.fg = color.NRGBAModel.Convert(opts.Foreground).(color.NRGBA)
+	}
+	if cpal := run.face.CPAL; len(cpal) > 0 {
+		idx := opts.Palette
+		if idx < 0 || idx >= len(cpal) {
+			idx = 0
+		}
+		p.palette = cpal[idx]
+	}
+
+	// フォント単位（y 上向き）からピクセル座標（y 下向き）への変換
+	m := affine{a: scale, d: -scale, e: ox, f: oy}
+	rect, ok := p.clipBox(tables.GlyphID(gid), m)
+	if !ok {
+		var bb boundsSink
+		p.bounds(glyph.Paint, m, &bb, 0)
+		rect = bb.rect()
+	}
+	// 合成用の一時的な画像も p.dst と同じ大きさで確保するため、描画先の外は確保しない
+	rect = opts.clipRect(rect)
+	if rect.Empty() {
+		return nil
+	}
+	p.dst = image.NewRGBA(rect)
+	p.paint(glyph.Paint, m, nil, 0)
+	return p.dst
+}
+
+// premul は乗算済みアルファの色（各成分 0〜1）です
+type premul struct{ r, g, b, a float64 }
+
+func (c premul) scale(k float64) premul { return premul{c.r * k, c.g * k, c.b * k, c.a * k} }
+
+func (c premul) add(d premul) premul { return premul{c.r + d.r, c.g + d.g, c.b + d.b, c.a + d.a} }
+
+func premulAt(img *image.RGBA, x, y int) premul {
+	c := img.RGBAAt(x, y)
+	return premul{float64(c.R) / 255, float64(c.G) / 255, float64(c.B) / 255, float64(c.A) / 255}
+}
+
+func (c premul) rgba() color.RGBA {
+	clamp := func(v float64) uint8 { return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255)) }
+	a := clamp(c.a)
+	return color.RGBA{min(clamp(c.r), a), min(clamp(c.g), a), min(clamp(c.b), a), a}
+}
+
+// affine は2次元アフィン変換 (x, y) → (a·x + c·y + e, b·x + d·y + f) です
+type affine struct{ a, b, c, d, e, f float64 }
+
+func (m affine) apply(x, y float64) (float64, float64) {
+	return m.a*x + m.c*y + m.e, m.b*x + m.d*y + m.f
+}
+
+// mul は n を適用してから m を適用する変換を返します
+func (m affine) mul(n affine) affine {
+	return affine{
+		a: m.a*n.a + m.c*n.b, b: m.b*n.a + m.d*n.b,
+		c: m.a*n.c + m.c*n.d, d: m.b*n.c + m.d*n.d,
+		e: m.a*n.e + m.c*n.f + m.e, f: m.b*n.e + m.d*n.f + m.f,
+	}
+}
+
+func (m affine) invert() (affine, bool) {
+	det := m.a*m.d - m.b*m.c
+	if det == 0 {
+		return affine{}, false
+	}
+	a, b, c, d := m.d/det, -m.b/det, -m.c/det, m.a/det
+	return affine{a: a, b: b, c: c, d: d, e: -(a*m.e + c*m.f), f: -(b*m.e + d*m.f)}, true
+}
+
+func translation(dx, dy float64) affine { return affine{a: 1, d: 1, e: dx, f: dy} }
+
+// around は中心 (cx, cy) を基準に t を適用する変換を返します
+func around(t affine, cx, cy float64) affine {
+	return translation(cx, cy).mul(t).mul(translation(-cx, -cy))
+}
+
+func rotation(turns float64) affine {
+	// 角度は 1.0 あたり 180 度（反時計回り）
+	s, c := math.Sincos(turns * math.Pi)
+	return affine{a: c, b: s, c: -s, d: c}
+}
+
+func skew(xTurns, yTurns float64) affine {
+	return affine{a: 1, b: math.Tan(yTurns * math.Pi), c: -math.Tan(xTurns * math.Pi), d: 1}
+}
+
+func f2dot14(v tables.Coord) float64 { return float64(v) / (1 << 14) }
+
+// colrPainter は COLR のペイントを乗算済みアルファの RGBA に描画します
+type colrPainter struct {
+	face    *tsfont.Face
+	colr    *tables.COLR1
+	palette []tables.ColorRecord
+	fg      color.NRGBA
+	dst     *image.RGBA
+}
+
+// clipBox は COLRv1 のクリップボックスをピクセル座標の矩形で返します
+func (p *colrPainter) clipBox(gid tables.GlyphID, m affine) (image.Rectangle, bool) {
+	box, ok := p.colr.ClipList.Search(gid)
+	if !ok {
+		return image.Rectangle{}, false
+	}
+	var x0, y0, x1, y1 int16
+	switch b := box.(type) {
+	case tables.ClipBoxFormat1:
+		x0, y0, x1, y1 = b.XMin, b.YMin, b.XMax, b.YMax
+	case tables.ClipBoxFormat2:
+		x0, y0, x1, y1 = b.XMin, b.YMin, b.XMax, b.YMax
+	default:
+		return image.Rectangle{}, false
+	}
+	var bb boundsSink
+	for _, pt := range [][2]int16{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}} {
+		x, y := m.apply(float64(pt[0]), float64(pt[1]))
+		bb.add(float32(x), float32(y))
+	}
+	return bb.rect(), true
+}
+
+// color はパレット番号と不透明度から色を求めます
+func (p *colrPainter) color(index uint16, alpha float64) premul {
+	c := color.NRGBA{A: 0xFF}
+	switch {
+	case index == foregroundIndex:
+		c = p.fg
+	case int(index) < len(p.palette):
+		rec := p.palette[index]
+		c = color.NRGBA{rec.Red, rec.Green, rec.Blue, rec.Alpha}
+	}
+	a := float64(c.A) / 255 * alpha
+	return premul{float64(c.R) / 255 * a, float64(c.G) / 255 * a, float64(c.B) / 255 * a, a}
+}
+
+// transformed は変形ペイントの子ペイントと合成後の変換を返します
+func transformed(pt tables.PaintTable, m affine) (tables.PaintTable, affine, bool) {
+	var t affine
+	var child tables.PaintTable
+	switch v := pt.(type) {
+	case tables.PaintTransform:
+		child, t = v.Paint, affine{a: float64(v.Transform.Xx), b: float64(v.Transform.Yx), c: float64(v.Transform.Xy), d: float64(v.Transform.Yy), e: float64(v.Transform.Dx), f: float64(v.Transform.Dy)}
+	case tables.PaintVarTransform:
+		child, t = v.Paint, affine{a: float64(v.Transform.Xx), b: float64(v.Transform.Yx), c: float64(v.Transform.Xy), d: float64(v.Transform.Yy), e: float64(v.Transform.Dx), f: float64(v.Transform.Dy)}
+	case tables.PaintTranslate:
+		child, t = v.Paint, translation(float64(v.Dx), float64(v.Dy))
+	case tables.PaintVarTranslate:
+		child, t = v.Paint, translation(float64(v.Dx), float64(v.Dy))
+	case tables.PaintScale:
+		child, t = v.Paint, affine{a: f2dot14(v.ScaleX), d: f2dot14(v.ScaleY)}
+	case tables.PaintVarScale:
+		child, t = v.Paint, affine{a: f2dot14(v.ScaleX), d: f2dot14(v.ScaleY)}
+	case tables.PaintScaleAroundCenter:
+		child, t = v.Paint, around(affine{a: f2dot14(v.ScaleX), d: f2dot14(v.ScaleY)}, float64(v.CenterX), float64(v.CenterY))
+	case tables.PaintVarScaleAroundCenter:
+		child, t = v.Paint, around(affine{a: f2dot14(v.ScaleX), d: f2dot14(v.ScaleY)}, float64(v.CenterX), float64(v.CenterY))
+	case tables.PaintScaleUniform:
+		child, t = v.Paint, affine{a: f2dot14(v.Scale), d: f2dot14(v.Scale)}
+	case tables.PaintVarScaleUniform:
+		child, t = v.Paint, affine{a: f2dot14(v.Scale), d: f2dot14(v.Scale)}
+	case tables.PaintScaleUniformAroundCenter:
+		child, t = v.Paint, around(affine{a: f2dot14(v.Scale), d: f2dot14(v.Scale)}, float64(v.CenterX), float64(v.CenterY))
+	case tables.PaintVarScaleUniformAroundCenter:
+		child, t = v.Paint, around(affine{a: f2dot14(v.Scale), d: f2dot14(v.Scale)}, float64(v.CenterX), float64(v.CenterY))
+	case tables.PaintRotate:
+		child, t = v.Paint, rotation(f2dot14(v.Angle))
+	case tables.PaintVarRotate:
+		child, t = v.Paint, rotation(f2dot14(v.Angle))
+	case tables.PaintRotateAroundCenter:
+		child, t = v.Paint, around(rotation(f2dot14(v.Angle)), float64(v.CenterX), float64(v.CenterY))
+	case tables.PaintVarRotateAroundCenter:
+		child, t = v.Paint, around(rotation(f2dot14(v.Angle)), float64(v.CenterX), float64(v.CenterY))
+	case tables.PaintSkew:
+		child, t = v.Paint, skew(f2dot14(v.XSkewAngle), f2dot14(v.YSkewAngle))
+	case tables.PaintVarSkew:
+		child, t = v.Paint, skew(f2dot14(v.XSkewAngle), f2dot14(v.YSkewAngle))
+	case tables.PaintSkewAroundCenter:
+		child, t = v.Paint, around(skew(f2dot14(v.XSkewAngle), f2dot14(v.YSkewAngle)), float64(v.CenterX), float64(v.CenterY))
+	case tables.PaintVarSkewAroundCenter:
+		child, t = v.Paint, around(skew(f2dot14(v.XSkewAngle), f2dot14(v.YSkewAngle)), float64(v.CenterX), float64(v.CenterY))
+	default:
+		return nil, m, false
+	}
+	return child, m.mul(t), true
+}
+
+// bounds はペイントが参照するグリフアウトラインの外接矩形を求めます（クリップボックスがない場合）
+func (p *colrPainter) bounds(pt tables.PaintTable, m affine, bb *boundsSink, depth int) {
+	if depth > maxPaintDepth {
+		return
+	}
+	switch v := pt.(type) {
+	case tables.PaintColrLayersResolved:
+		for _, l := range v {
+			p.outline(l.GlyphID, m, bb)
+		}
+	case tables.PaintColrLayers:
+		layers, _ := p.colr.LayerList.Resolve(v)
+		for _, l := range layers {
+			p.bounds(l, m, bb, depth+1)
+		}
+	case tables.PaintGlyph:
+		p.outline(v.GlyphID, m, bb)
+	case tables.PaintColrGlyph:
+		if child, ok := p.colr.Search(v.GlyphID); ok {
+			p.bounds(child, m, bb, depth+1)
+		}
+	case tables.PaintComposite:
+		p.bounds(v.BackdropPaint, m, bb, depth+1)
+		p.bounds(v.SourcePaint, m, bb, depth+1)
+	default:
+		if child, cm, ok := transformed(pt, m); ok {
+			p.bounds(child, cm, bb, depth+1)
+		}
+	}
+}
+
+// outline はグリフのアウトラインを変換 m を適用して sink に出力します
+func (p *colrPainter) outline(gid tables.GlyphID, m affine, sink OutlineSink) {
+	data, ok := p.face.GlyphDataOutline(tsfont.GID(gid))
+	if !ok {
+		return
+	}
+	pt := func(q ot.SegmentPoint) (float32, float32) {
+		x, y := m.apply(float64(q.X), float64(q.Y))
+		return float32(x), float32(y)
+	}
+	open := false
+	for _, seg := range data.Segments {
+		a := seg.Args
+		switch seg.Op {
+		case ot.SegmentOpMoveTo:
+			if open {
+				sink.ClosePath()
+			}
+			sink.MoveTo(pt(a[0]))
+			open = true
+		case ot.SegmentOpLineTo:
+			sink.LineTo(pt(a[0]))
+		case ot.SegmentOpQuadTo:
+			x1, y1 := pt(a[0])
+			x, y := pt(a[1])
+			sink.QuadTo(x1, y1, x, y)
+		case ot.SegmentOpCubeTo:
+			x1, y1 := pt(a[0])
+			x2, y2 := pt(a[1])
+			x, y := pt(a[2])
+			sink.CubeTo(x1, y1, x2, y2, x, y)
+		}
+	}
+	if open {
+		sink.ClosePath()
+	}
+}
+
+// glyphMask はグリフのアウトラインを描画先と同じ範囲のマスクにラスタライズし、clip と重ねます
+func (p *colrPainter) glyphMask(gid tables.GlyphID, m affine, clip *image.Alpha) *image.Alpha {
+	b := p.dst.Bounds()
+	mask := image.NewAlpha(b)
+	rz := vector.NewRasterizer(b.Dx(), b.Dy())
+	p.outline(gid, translation(-float64(b.Min.X), -float64(b.Min.Y)).mul(m), rz)
+	rz.Draw(mask, b, image.Opaque, image.Point{})
+	if clip != nil {
+		for i, a := range mask.Pix {
+			mask.Pix[i] = uint8(uint16(a) * uint16(clip.Pix[i]) / 255)
+		}
+	}
+	return mask
+}
+
+// paint はペイントを描画先に over 合成します。clip が nil の場合は描画先全体が対象です
+func (p *colrPainter) paint(pt tables.PaintTable, m affine, clip *image.Alpha, depth int) {
+	if depth > maxPaintDepth {
+		return
+	}
+	switch v := pt.(type) {
+	case tables.PaintColrLayersResolved:
+		// COLRv0: 各レイヤーのグリフを単色で塗り重ねる
+		for _, l := range v {
+			c := p.color(l.PaletteIndex, 1)
+			p.fill(p.glyphMask(l.GlyphID, m, clip), func(float64, float64) premul { return c })
+		}
+	case tables.PaintColrLayers:
+		layers, err := p.colr.LayerList.Resolve(v)
+		if err != nil {
+			return
+		}
+		for _, l := range layers {
+			p.paint(l, m, clip, depth+1)
+		}
+	case tables.PaintSolid:
+		c := p.color(v.PaletteIndex, f2dot14(v.Alpha))
+		p.fill(clip, func(float64, float64) premul { return c })
+	case tables.PaintVarSolid:
+		c := p.color(v.PaletteIndex, f2dot14(v.Alpha))
+		p.fill(clip, func(float64, float64) premul { return c })
+	case tables.PaintLinearGradient:
+		p.fillGradient(clip, m, linearGradient(v.X0, v.Y0, v.X1, v.Y1, v.X2, v.Y2, p.colorLine(v.ColorLine)))
+	case tables.PaintVarLinearGradient:
+		p.fillGradient(clip, m, linearGradient(v.X0, v.Y0, v.X1, v.Y1, v.X2, v.Y2, p.varColorLine(v.ColorLine)))
+	case tables.PaintRadialGradient:
+		p.fillGradient(clip, m, radialGradient(v.X0, v.Y0, v.Radius0, v.X1, v.Y1, v.Radius1, p.colorLine(v.ColorLine)))
+	case tables.PaintVarRadialGradient:
+		p.fillGradient(clip, m, radialGradient(v.X0, v.Y0, v.Radius0, v.X1, v.Y1, v.Radius1, p.varColorLine(v.ColorLine)))
+	case tables.PaintSweepGradient:
+		p.fillGradient(clip, m, sweepGradient(v.CenterX, v.CenterY, v.StartAngle, v.EndAngle, p.colorLine(v.ColorLine)))
+	case tables.PaintVarSweepGradient:
+		p.fillGradient(clip, m, sweepGradient(v.CenterX, v.CenterY, v.StartAngle, v.EndAngle, p.varColorLine(v.ColorLine)))
+	case tables.PaintGlyph:
+		p.paint(v.Paint, m, p.glyphMask(v.GlyphID, m, clip), depth+1)
+	case tables.PaintColrGlyph:
+		if child, ok := p.colr.Search(v.GlyphID); ok {
+			p.paint(child, m, clip, depth+1)
+		}
+	case tables.PaintComposite:
+		p.composite(v, m, clip, depth)
+	default:
+		if child, cm, ok := transformed(pt, m); ok {
+			p.paint(child, cm, clip, depth+1)
+		}
+	}
+}
+
+// fill はマスクの範囲をピクセル中心の色で over 合成します
+func (p *colrPainter) fill(mask *image.Alpha, shade func(x, y float64) premul) {
+	b := p.dst.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			cov := 1.0
+			if mask != nil {
+				a := mask.AlphaAt(x, y).A
+				if a == 0 {
+					continue
+				}
+				cov = float64(a) / 255
+			}
+			src := shade(float64(x)+0.5, float64(y)+0.5).scale(cov)
+			if src.a <= 0 {
+				continue
+			}
+			dst := premulAt(p.dst, x, y)
+			p.dst.SetRGBA(x, y, src.add(dst.scale(1-src.a)).rgba())
+		}
+	}
+}
+
+// fillGradient はフォント座標系で定義されたグラデーションを塗ります
+func (p *colrPainter) fillGradient(mask *image.Alpha, m affine, shade func(u, v float64) premul) {
+	inv, ok := m.invert()
+	if !ok {
+		return
+	}
+	p.fill(mask, func(x, y float64) premul { return shade(inv.apply(x, y)) })
+}
+
+// composite は PaintComposite の合成モードで背景と前景を合成してから描画先に重ねます
+// 非分離ブレンドモード（hue など）は source-over として扱います
+func (p *colrPainter) composite(v tables.PaintComposite, m affine, clip *image.Alpha, depth int) {
+	dst := p.dst
+	backdrop := image.NewRGBA(dst.Bounds())
+	source := image.NewRGBA(dst.Bounds())
+	p.dst = backdrop
+	p.paint(v.BackdropPaint, m, clip, depth+1)
+	p.dst = source
+	p.paint(v.SourcePaint, m, clip, depth+1)
+	p.dst = dst
+
+	b := dst.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := compositePixel(v.CompositeMode, premulAt(source, x, y), premulAt(backdrop, x, y))
+			if c.a <= 0 {
+				continue
+			}
+			d := premulAt(dst, x, y)
+			dst.SetRGBA(x, y, c.add(d.scale(1-c.a)).rgba())
+		}
+	}
+}
+
+// compositePixel は乗算済みアルファの前景 s と背景 d を合成します
+func compositePixel(mode tables.CompositeMode, s, d premul) premul {
+	switch mode {
+	case tables.CompositeClear:
+		return premul{}
+	case tables.CompositeSrc:
+		return s
+	case tables.CompositeDest:
+		return d
+	case tables.CompositeDestOver:
+		return d.add(s.scale(1 - d.a))
+	case tables.CompositeSrcIn:
+		return s.scale(d.a)
+	case tables.CompositeDestIn:
+		return d.scale(s.a)
+	case tables.CompositeSrcOut:
+		return s.scale(1 - d.a)
+	case tables.CompositeDestOut:
+		return d.scale(1 - s.a)
+	case tables.CompositeSrcAtop:
+		return s.scale(d.a).add(d.scale(1 - s.a))
+	case tables.CompositeDestAtop:
+		return d.scale(s.a).add(s.scale(1 - d.a))
+	case tables.CompositeXor:
+		return s.scale(1 - d.a).add(d.scale(1 - s.a))
+	case tables.CompositePlus:
+		c := s.add(d)
+		return premul{math.Min(1, c.r), math.Min(1, c.g), math.Min(1, c.b), math.Min(1, c.a)}
+	}
+	blend := separableBlend(mode)
+	if blend == nil || s.a == 0 || d.a == 0 {
+		return s.add(d.scale(1 - s.a))
+	}
+	// 結果 = (1 - da)·s + (1 - sa)·d + sa·da·B(Cs, Cd)
+	mix := func(sc, dc float64) float64 {
+		return (1-d.a)*sc + (1-s.a)*dc + s.a*d.a*blend(sc/s.a, dc/d.a)
+	}
+	return premul{mix(s.r, d.r), mix(s.g, d.g), mix(s.b, d.b), s.a + d.a - s.a*d.a}
+}
+
+// separableBlend は分離可能なブレンドモードの関数 B(Cs, Cd) を返します
+func separableBlend(mode tables.CompositeMode) func(cs, cd float64) float64 {
+	multiply := func(cs, cd float64) float64 { return cs * cd }
+	screen := func(cs, cd float64) float64 { return cs + cd - cs*cd }
+	hardLight := func(cs, cd float64) float64 {
+		if cs <= 0.5 {
+			return multiply(cd, 2*cs)
+		}
+		return screen(cd, 2*cs-1)
+	}
+	switch mode {
+	case tables.CompositeMultiply:
+		return multiply
+	case tables.CompositeScreen:
+		return screen
+	case tables.CompositeOverlay:
+		return func(cs, cd float64) float64 { return hardLight(cd, cs) }
+	case tables.CompositeDarken:
+		return math.Min
+	case tables.CompositeLighten:
+		return math.Max
+	case tables.CompositeColorDodge:
+		return func(cs, cd float64) float64 {
+			switch {
+			case cd == 0:
+				return 0
+			case cs >= 1:
+				return 1
+			}
+			return math.Min(1, cd/(1-cs))
+		}
+	case tables.CompositeColorBurn:
+		return func(cs, cd float64) float64 {
+			switch {
+			case cd >= 1:
+				return 1
+			case cs <= 0:
+				return 0
+			}
+			return 1 - math.Min(1, (1-cd)/cs)
+		}
+	case tables.CompositeHardLight:
+		return hardLight
+	case tables.CompositeSoftLight:
+		return func(cs, cd float64) float64 {
+			if cs <= 0.5 {
+				return cd - (1-2*cs)*cd*(1-cd)
+			}
+			dd := math.Sqrt(cd)
+			if cd <= 0.25 {
+				dd = ((16*cd-12)*cd + 4) * cd
+			}
+			return cd + (2*cs-1)*(dd-cd)
+		}
+	case tables.CompositeDifference:
+		return func(cs, cd float64) float64 { return math.Abs(cs - cd) }
+	case tables.CompositeExclusion:
+		return func(cs, cd float64) float64 { return cs + cd - 2*cs*cd }
+	}
+	return nil
+}
+
+// ============================================================
+// グラデーション
+// ============================================================
+
+// colorStop はカラーラインの1点です
+type colorStop struct {
+	offset float64
+	color  premul
+}
+
+// colorLine は COLRv1 のカラーラインです
+type colorLine struct {
+	extend tables.Extend
+	stops  []colorStop // offset の昇順
+}
+
+func (p *colrPainter) colorLine(cl tables.ColorLine) colorLine {
+	out := colorLine{extend: cl.Extend}
+	for _, s := range cl.ColorStops {
+		out.stops = append(out.stops, colorStop{f2dot14(s.StopOffset), p.color(s.PaletteIndex, f2dot14(s.Alpha))})
+	}
+	out.sort()
+	return out
+}
+
+func (p *colrPainter) varColorLine(cl tables.VarColorLine) colorLine {
+	out := colorLine{extend: cl.Extend}
+	for _, s := range cl.ColorStops {
+		out.stops = append(out.stops, colorStop{f2dot14(s.StopOffset), p.color(s.PaletteIndex, f2dot14(s.Alpha))})
+	}
+	out.sort()
+	return out
+}
+
+func (cl *colorLine) sort() {
+	// 挿入ソート（同じ位置のストップは元の順序を保つ）
+	for i := 1; i < len(cl.stops); i++ {
+		for j := i; j > 0 && cl.stops[j].offset < cl.stops[j-1].offset; j-- {
+			cl.stops[j], cl.stops[j-1] = cl.stops[j-1], cl.stops[j]
+		}
+	}
+}
+
+// at はカラーライン上の位置 t の色を返します
+// extend はストップの範囲を1周期として適用します
+func (cl colorLine) at(t float64) premul {
+	stops := cl.stops
+	if len(stops) == 0 {
+		return premul{}
+	}
+	lo, hi := stops[0].offset, stops[len(stops)-1].offset
+	if hi > lo && (t < lo || t > hi) {
+		u := (t - lo) / (hi - lo)
+		switch cl.extend {
+		case tables.ExtendRepeat:
+			u -= math.Floor(u)
+		case tables.ExtendReflect:
+			u = math.Mod(math.Abs(u), 2)
+			if u > 1 {
+				u = 2 - u
+			}
+		}
+		t = lo + u*(hi-lo)
+	}
+	if t <= lo {
+		return stops[0].color
+	}
+	for i := 1; i < len(stops); i++ {
+		a, b := stops[i-1], stops[i]
+		if t <= b.offset {
+			if b.offset == a.offset {
+				return b.color
+			}
+			k := (t - a.offset) / (b.offset - a.offset)
+			return a.color.scale(1 - k).add(b.color.scale(k))
+		}
+	}
+	return stops[len(stops)-1].color
+}
+
+// linearGradient は COLRv1 の線形グラデーションです
+// p1 を p0 を通り p0p2 に垂直な直線へ射影した点までを色の進む方向とします
+func linearGradient(x0, y0, x1, y1, x2, y2 int16, cl colorLine) func(u, v float64) premul {
+	ox, oy := float64(x0), float64(y0)
+	px, py := float64(x1)-ox, float64(y1)-oy
+	dx, dy := float64(x2)-ox, float64(y2)-oy
+	if d2 := dx*dx + dy*dy; d2 != 0 {
+		k := (px*dy - py*dx) / d2
+		px, py = k*dy, -k*dx
+	}
+	l2 := px*px + py*py
+	return func(u, v float64) premul {
+		if l2 == 0 {
+			return cl.at(0)
+		}
+		return cl.at(((u-ox)*px + (v-oy)*py) / l2)
+	}
+}
+
+// radialGradient は2つの円の間を補間する COLRv1 の放射グラデーションです
+func radialGradient(x0, y0 int16, r0 uint16, x1, y1 int16, r1 uint16, cl colorLine) func(u, v float64) premul {
+	c0x, c0y, rad0 := float64(x0), float64(y0), float64(r0)
+	cdx, cdy, dr := float64(x1)-c0x, float64(y1)-c0y, float64(r1)-rad0
+	a := cdx*cdx + cdy*cdy - dr*dr
+	return func(u, v float64) premul {
+		// |q - c(t)| = r(t) を満たす最大の t（r(t) >= 0）を求める
+		pdx, pdy := u-c0x, v-c0y
+		b := pdx*cdx + pdy*cdy + rad0*dr
+		c := pdx*pdx + pdy*pdy - rad0*rad0
+		if a == 0 {
+			if b == 0 {
+				return premul{}
+			}
+			return cl.at(c / (2 * b))
+		}
+		disc := b*b - a*c
+		if disc < 0 {
+			return premul{}
+		}
+		sq := math.Sqrt(disc)
+		t1, t2 := (b+sq)/a, (b-sq)/a
+		for _, t := range []float64{math.Max(t1, t2), math.Min(t1, t2)} {
+			if rad0+t*dr >= 0 {
+				return cl.at(t)
+			}
+		}
+		return premul{}
+	}
+}
+
+// sweepGradient は中心のまわりの角度で色が変わる COLRv1 のスイープグラデーションです
+func sweepGradient(cx, cy int16, start, end tables.Coord, cl colorLine) func(u, v float64) premul {
+	startDeg := (f2dot14(start) + 1) * 180
+	endDeg := (f2dot14(end) + 1) * 180
+	return func(u, v float64) premul {
+		angle := math.Atan2(v-float64(cy), u-float64(cx)) * 180 / math.Pi
+		if angle < 0 {
+			angle += 360
+		}
+		if endDeg == startDeg {
+			if len(cl.stops) == 0 {
+				return premul{}
+			}
+			if angle < startDeg {
+				return cl.at(cl.stops[0].offset)
+			}
+			return cl.at(cl.stops[len(cl.stops)-1].offset)
+		}
+		return cl.at((angle - startDeg) / (endDeg - startDeg))
+	}
+}
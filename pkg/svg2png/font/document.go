@@ -0,0 +1,84 @@
+package font
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ============================================================
+// 文書スコープのフォント（@font-face）
+// ============================================================
+
+// Scoped は登録済みのフォントを引き継いだレンダラーの複製を作成します
+// 文書ごとのフォントセットや描画用のスナップショットに使い、AddDocumentFont で追加したフォントは元のレンダラーに影響しません
+func (r *Renderer) Scoped() *Renderer {
+	scoped := &Renderer{
+		fonts:            make(map[string]*FontFace, len(r.fonts)),
+		faceKeys:         slices.Clone(r.faceKeys),
+		faceList:         slices.Clone(r.faceList),
+		families:         make(map[string][]*FontFace, len(r.families)),
+		generics:         make(map[genericKey][]string, len(r.generics)),
+		aliases:          r.aliases,
+		documentFamilies: make(map[string]bool),
+		hinting:          r.hinting,
+		noSubpixel:       r.noSubpixel,
+		cache:            r.cache,
+	}
+	for key, ff := range r.fonts {
+		scoped.fonts[key] = ff
+	}
+	// 一覧と索引は複製に追加・削除しても元のレンダラーの配列を書き換えないよう複製する
+	for lower, faces := range r.families {
+		scoped.families[lower] = slices.Clone(faces)
+	}
+	for key, families := range r.generics {
+		scoped.generics[key] = families
+	}
+	return scoped
+}
+
+// AddDocumentFont は @font-face で読み込んだフォントデータ（TTF/OTF/WOFF/WOFF2）を family のフェイスとして登録します
+// q の太さ・幅・傾きは @font-face の記述子で、フォント自体のスタイル名より優先します
+func (r *Renderer) AddDocumentFont(family string, q FontQuery, data []byte) error {
+	ff, err := parseFace(data)
+	if err != nil {
+		return err
+	}
+	r.AddDocumentFace(family, q, ff)
+	return nil
+}
+
+// AddDocumentFace は既存のフェイス（local() で参照したフォントなど）を family のフェイスとして登録します
+// 同じ名前のファミリがインストールされている場合、文書内では @font-face の定義だけが使われます
+func (r *Renderer) AddDocumentFace(family string, q FontQuery, src *FontFace) {
+	src.load()
+	if r.documentFamilies == nil {
+		r.documentFamilies = make(map[string]bool)
+	}
+	lower := strings.ToLower(family)
+	if !r.documentFamilies[lower] {
+		r.documentFamilies[lower] = true
+		for _, ff := range slices.Clone(r.familyFaces(lower)) {
+			r.removeFace(ff.Family + "-" + ff.Style)
+		}
+	}
+
+	ff := *src
+	ff.Family, ff.Style = family, q.StyleName()
+	ff.Weight, ff.Stretch, ff.Slope = q.Weight, q.Stretch, q.Slope
+	r.addFace(fmt.Sprintf("%s-%s", family, ff.Style), &ff)
+}
+
+// LocalFont は local() のフォント名（"DejaVu Serif Bold" などのフルネーム、またはファミリ名）でフェイスを探します
+// 見つからない場合は nil を返します
+func (r *Renderer) LocalFont(name string) *FontFace {
+	lower := strings.ToLower(strings.TrimSpace(name))
+	for _, ff := range r.Faces() {
+		full := strings.ToLower(ff.Family + " " + ff.Style)
+		if lower == full || lower == strings.ToLower(ff.Family+"-"+ff.Style) {
+			return ff
+		}
+	}
+	return r.MatchFont(name, ParseStyleName(""))
+}
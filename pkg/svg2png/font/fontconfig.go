@@ -0,0 +1,302 @@
+package font
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ============================================================
+// fontconfig の設定
+// ============================================================
+
+// FontConfig は fontconfig の設定ファイル（fonts.conf）から読み取ったフォントの設定です
+// <dir>・<include>・<alias>（<prefer> / <accept> / <default>）に対応し、<match> などのその他の要素は無視します
+type FontConfig struct {
+	Dirs    []string    // フォントディレクトリ（記述順）
+	Aliases []FontAlias // ファミリの別名（記述順）
+}
+
+// FontAlias は fontconfig の <alias> 要素です
+type FontAlias struct {
+	Family  string   // 対象のファミリ名
+	Prefer  []string // Family より優先するファミリ
+	Accept  []string // Family の次に探すファミリ
+	Default []string // 最後に探すファミリ
+}
+
+// fcIncludeDepth は <include> の入れ子の上限です（循環参照の防止）
+const fcIncludeDepth = 16
+
+// LoadFontConfig は fontconfig の設定ファイルを読み込みます
+// <include> で参照したファイルやディレクトリ（conf.d など、数字で始まる *.conf を名前順）も読み込みます
+func LoadFontConfig(path string) (*FontConfig, error) {
+	cfg := &FontConfig{}
+	if err := cfg.load(path, 0); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// load は設定ファイル1つを読み込みます
+func (cfg *FontConfig) load(path string, depth int) error {
+	if depth > fcIncludeDepth {
+		return fmt.Errorf("%s: includes nested too deeply", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	base := filepath.Dir(path)
+
+	dec := xml.NewDecoder(f)
+	// 実際の fonts.conf は DOCTYPE と未定義のエンティティ参照を含むことがあるため、非厳格モードで読み飛ばす
+	// （encoding/xml はもともと外部エンティティを解決しない）
+	dec.Strict = false
+	inRoot := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !inRoot {
+			if start.Name.Local != "fontconfig" {
+				return fmt.Errorf("%s: not a fontconfig file", path)
+			}
+			inRoot = true
+			continue
+		}
+
+		switch start.Name.Local {
+		case "dir":
+			var dir fcPath
+			if err := dec.DecodeElement(&dir, &start); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if p := dir.resolve(base, "XDG_DATA_HOME", ".local/share"); p != "" {
+				cfg.Dirs = append(cfg.Dirs, p)
+			}
+		case "include":
+			var inc fcPath
+			if err := dec.DecodeElement(&inc, &start); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			p := inc.resolve(base, "XDG_CONFIG_HOME", ".config")
+			if p == "" {
+				continue
+			}
+			if err := cfg.include(p, depth+1); err != nil && !(inc.IgnoreMissing == "yes" && os.IsNotExist(err)) {
+				return err
+			}
+		case "alias":
+			var a fcAlias
+			if err := dec.DecodeElement(&a, &start); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			for _, family := range a.Families {
+				cfg.Aliases = append(cfg.Aliases, FontAlias{
+					Family:  strings.TrimSpace(family),
+					Prefer:  trimAll(a.Prefer.Families),
+					Accept:  trimAll(a.Accept.Families),
+					Default: trimAll(a.Default.Families),
+				})
+			}
+		default:
+			if err := dec.Skip(); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+}
+
+// include はファイル、またはディレクトリ内の数字で始まる *.conf（fontconfig と同じく [0-9]*.conf）を名前順に読み込みます
+func (cfg *FontConfig) include(path string, depth int) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return cfg.load(path, depth)
+	}
+	matches, err := filepath.Glob(filepath.Join(path, "[0-9]*.conf"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+	for _, m := range matches {
+		if err := cfg.load(m, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fcPath は <dir> / <include> 要素です
+type fcPath struct {
+	Prefix        string `xml:"prefix,attr"`
+	IgnoreMissing string `xml:"ignore_missing,attr"`
+	Path          string `xml:",chardata"`
+}
+
+// resolve は prefix 属性と "~" を展開したパスを返します
+// prefix="xdg" は XDG のベースディレクトリ（環境変数 xdgEnv、未設定の場合は ~/xdgDefault）、
+// それ以外の相対パスは設定ファイルのディレクトリからの相対パスとして扱います
+func (p fcPath) resolve(base, xdgEnv, xdgDefault string) string {
+	path := strings.TrimSpace(p.Path)
+	if path == "" {
+		return ""
+	}
+	home, _ := os.UserHomeDir()
+	switch {
+	case p.Prefix == "xdg":
+		dir := os.Getenv(xdgEnv)
+		if dir == "" {
+			if home == "" {
+				return ""
+			}
+			dir = filepath.Join(home, xdgDefault)
+		}
+		return filepath.Join(dir, path)
+	case path == "~" || strings.HasPrefix(path, "~/"):
+		if home == "" {
+			return ""
+		}
+		return filepath.Join(home, path[1:])
+	case !filepath.IsAbs(path):
+		return filepath.Join(base, path)
+	}
+	return filepath.Clean(path)
+}
+
+// fcAlias は <alias> 要素です
+type fcAlias struct {
+	Families []string    `xml:"family"`
+	Prefer   fcFamilyRef `xml:"prefer"`
+	Accept   fcFamilyRef `xml:"accept"`
+	Default  fcFamilyRef `xml:"default"`
+}
+
+// fcFamilyRef は <prefer> / <accept> / <default> 要素です
+type fcFamilyRef struct {
+	Families []string `xml:"family"`
+}
+
+// trimAll は各要素の前後の空白を取り除きます
+func trimAll(names []string) []string {
+	var out []string
+	for _, n := range names {
+		if n = strings.TrimSpace(n); n != "" {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// systemFontConfig はシステムの fontconfig の設定です（プロセス内で1回だけ読み込みます）
+var systemFontConfig = sync.OnceValue(func() *FontConfig {
+	path := os.Getenv("FONTCONFIG_FILE")
+	if path == "" {
+		path = "/etc/fonts/fonts.conf"
+	}
+	cfg, err := LoadFontConfig(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: failed to read fontconfig file %s: %v", path, err)
+		}
+		return nil
+	}
+	return cfg
+})
+
+// ============================================================
+// ファミリの別名の展開
+// ============================================================
+
+// SetAliases は fontconfig の <alias> を設定します（既存の設定は置き換えます。nil で取り消します）
+func (r *Renderer) SetAliases(aliases []FontAlias) {
+	r.aliases = nil
+	r.AddAliases(aliases)
+}
+
+// AddAliases は fontconfig の <alias> を既存の設定のあとに追加します
+func (r *Renderer) AddAliases(aliases []FontAlias) {
+	if len(aliases) == 0 {
+		return
+	}
+	merged := make(map[string][]FontAlias, len(r.aliases)+len(aliases))
+	for key, list := range r.aliases {
+		merged[key] = list
+	}
+	for _, a := range aliases {
+		key := strings.ToLower(a.Family)
+		// 複製元のレンダラーと共有しているスライスは書き換えない
+		merged[key] = append(append([]FontAlias(nil), merged[key]...), a)
+	}
+	r.aliases = merged
+}
+
+// aliasFamilies は family の <alias> の <prefer> と、<accept> / <default> を記述順に返します
+// 後の規則の <accept> ほどファミリの近くに挿入されます（fontconfig と同じ順序）
+func (r *Renderer) aliasFamilies(family string) (prefer, after []string) {
+	aliases := r.aliases[strings.ToLower(family)]
+	for _, a := range aliases {
+		prefer = append(prefer, a.Prefer...)
+	}
+	for i := len(aliases) - 1; i >= 0; i-- {
+		after = append(after, aliases[i].Accept...)
+	}
+	for _, a := range aliases {
+		after = append(after, a.Default...)
+	}
+	return prefer, after
+}
+
+// FamilyCandidates はファミリ名を照合する順のファミリのリストに展開します
+// 総称ファミリは GenericFamilies で展開し、それ以外のファミリは fontconfig の <alias> があれば
+// <prefer> → ファミリ自身 → <accept> → <default> の順に（再帰的に）展開します
+// 総称ファミリを指す <default>（"DejaVu Serif" → serif など）は font-family リストの次のファミリより
+// 優先されてしまうため展開しません
+func (r *Renderer) FamilyCandidates(family, lang string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	var expand func(name string)
+	expand = func(name string) {
+		key := strings.ToLower(name)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		if r.IsGenericFamily(name) {
+			for _, g := range r.GenericFamilies(name, lang) {
+				expand(g)
+			}
+			return
+		}
+		prefer, after := r.aliasFamilies(name)
+		for _, p := range prefer {
+			expand(p)
+		}
+		out = append(out, name)
+		for _, p := range after {
+			if !r.IsGenericFamily(p) {
+				expand(p)
+			}
+		}
+	}
+	expand(family)
+	return out
+}
@@ -0,0 +1,132 @@
+package font
+
+import (
+	"strings"
+)
+
+// ============================================================
+// 総称ファミリ
+// ============================================================
+
+// genericKey は総称ファミリの設定のキーです（lang が空の場合は言語によらない既定値）
+type genericKey struct {
+	generic, lang string
+}
+
+// defaultGenericFamilies は総称ファミリの既定の候補です（先頭から順に照合します）
+// 言語別の候補は言語によらない候補より先に探します
+var defaultGenericFamilies = map[genericKey][]string{
+	{"sans-serif", ""}: {"Helvetica", "Arial", "Geneva", "FreeSans", "DejaVu Sans", "Liberation Sans", "Noto Sans"},
+	{"serif", ""}:      {"Times", "Times New Roman", "Tinos", "FreeSerif", "DejaVu Serif", "Liberation Serif", "Noto Serif"},
+	{"monospace", ""}:  {"Courier", "Courier New", "Monaco", "FreeMono", "DejaVu Sans Mono", "Liberation Mono", "Noto Sans Mono"},
+	{"cursive", ""}:    {"Apple Chancery", "Comic Sans MS", "URW Chancery L", "Z003"},
+	{"fantasy", ""}:    {"Papyrus", "Impact", "Luminari"},
+	{"system-ui", ""}:  {"Segoe UI", ".AppleSystemUIFont", "Cantarell", "Ubuntu", "Noto Sans", "DejaVu Sans"},
+	{"emoji", ""}:      {"Apple Color Emoji", "Segoe UI Emoji", "Noto Color Emoji"},
+	{"math", ""}:       {"Cambria Math", "STIX Two Math", "Latin Modern Math", "DejaVu Serif"},
+
+	{"sans-serif", "ja"}:      {"Hiragino Sans", "Hiragino Kaku Gothic ProN", "Yu Gothic", "Meiryo", "Noto Sans CJK JP", "Noto Sans JP", "IPAexGothic"},
+	{"serif", "ja"}:           {"Hiragino Mincho ProN", "Yu Mincho", "Noto Serif CJK JP", "Noto Serif JP", "IPAexMincho"},
+	{"monospace", "ja"}:       {"Osaka-Mono", "MS Gothic", "Noto Sans Mono CJK JP"},
+	{"system-ui", "ja"}:       {"Hiragino Sans", "Yu Gothic UI", "Meiryo UI", "Noto Sans CJK JP"},
+	{"sans-serif", "zh-hans"}: {"PingFang SC", "Microsoft YaHei", "Noto Sans CJK SC", "Noto Sans SC", "WenQuanYi Micro Hei"},
+	{"serif", "zh-hans"}:      {"Songti SC", "SimSun", "Noto Serif CJK SC", "Noto Serif SC"},
+	{"sans-serif", "zh-hant"}: {"PingFang TC", "Microsoft JhengHei", "Noto Sans CJK TC", "Noto Sans TC"},
+	{"serif", "zh-hant"}:      {"Songti TC", "PMingLiU", "Noto Serif CJK TC", "Noto Serif TC"},
+	{"sans-serif", "ko"}:      {"Apple SD Gothic Neo", "Malgun Gothic", "Noto Sans CJK KR", "Noto Sans KR"},
+	{"serif", "ko"}:           {"AppleMyungjo", "Batang", "Noto Serif CJK KR", "Noto Serif KR"},
+}
+
+// chineseScripts は地域から中国語の字体を推定する対応表です
+var chineseScripts = map[string]string{
+	"zh": "zh-hans", "zh-cn": "zh-hans", "zh-sg": "zh-hans",
+	"zh-tw": "zh-hant", "zh-hk": "zh-hant", "zh-mo": "zh-hant",
+}
+
+// IsGenericFamily はファミリ名が総称ファミリ（sans-serif など）かを返します
+func (r *Renderer) IsGenericFamily(family string) bool {
+	family = strings.ToLower(family)
+	for key := range defaultGenericFamilies {
+		if key.generic == family {
+			return true
+		}
+	}
+	for key := range r.generics {
+		if key.generic == family {
+			return true
+		}
+	}
+	return false
+}
+
+// SetGenericFamily は総称ファミリの候補を設定します
+// lang を指定するとその言語（例: "ja", "zh-Hant"）のテキストにだけ適用され、空の場合は既定の候補を置き換えます
+// families が空の場合は設定を取り消して既定値に戻します
+func (r *Renderer) SetGenericFamily(generic, lang string, families ...string) {
+	key := genericKey{strings.ToLower(generic), strings.ToLower(lang)}
+	if len(families) == 0 {
+		delete(r.generics, key)
+		return
+	}
+	if r.generics == nil {
+		r.generics = make(map[genericKey][]string)
+	}
+	r.generics[key] = append([]string(nil), families...)
+}
+
+// GenericFamilies は総称ファミリを言語に応じた具体的なファミリのリストに展開します
+// 言語タグは末尾のサブタグを順に外して探し（"zh-Hant-TW" → "zh-hant" → "zh"）、
+// 見つかった言語別の候補のあとに言語によらない候補を続けます
+// fontconfig の <alias> がある場合、<prefer> は組み込みの既定の候補より前に、<accept> / <default> は最後に探します
+func (r *Renderer) GenericFamilies(generic, lang string) []string {
+	generic = strings.ToLower(generic)
+	var families []string
+	seen := make(map[string]bool)
+	add := func(names []string) {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				families = append(families, name)
+			}
+		}
+	}
+	lookup := func(lang string) ([]string, bool) {
+		key := genericKey{generic, lang}
+		if names, ok := r.generics[key]; ok {
+			return names, true
+		}
+		names, ok := defaultGenericFamilies[key]
+		return names, ok
+	}
+
+	lang = strings.ToLower(strings.ReplaceAll(lang, "_", "-"))
+	if script, ok := chineseScripts[lang]; ok {
+		lang = script
+	}
+	for lang != "" {
+		if names, ok := lookup(lang); ok {
+			add(names)
+			break
+		}
+		if i := strings.LastIndex(lang, "-"); i >= 0 {
+			lang = lang[:i]
+		} else {
+			lang = ""
+		}
+	}
+	prefer, after := r.aliasFamilies(generic)
+	key := genericKey{generic, ""}
+	if names, ok := r.generics[key]; ok {
+		add(names)
+		add(prefer)
+	} else {
+		add(prefer)
+		add(defaultGenericFamilies[key])
+	}
+	for _, name := range after {
+		if !r.IsGenericFamily(name) {
+			add([]string{name})
+		}
+	}
+	return families
+}
@@ -0,0 +1,99 @@
+package font
+
+import (
+	"fmt"
+	"math"
+
+	xfont "golang.org/x/image/font"
+)
+
+// ============================================================
+// ヒンティングとサブピクセル位置
+// ============================================================
+
+// Hinting はグリフをピクセルの格子に合わせる度合いです
+type Hinting int
+
+const (
+	HintingNone     Hinting = iota // 格子に合わせない（ブラウザの既定に近い）
+	HintingVertical                // ベースラインを整数ピクセルに合わせる
+	HintingFull                    // さらに送り幅とグリフの原点を整数ピクセルに合わせる
+)
+
+// ParseHinting は "none" / "vertical" / "full" をヒンティングに変換します（空文字列は "none"）
+func ParseHinting(s string) (Hinting, error) {
+	switch s {
+	case "", "none":
+		return HintingNone, nil
+	case "vertical":
+		return HintingVertical, nil
+	case "full":
+		return HintingFull, nil
+	}
+	return HintingNone, fmt.Errorf("unknown hinting: %q", s)
+}
+
+// String はヒンティングの名前を返します
+func (h Hinting) String() string {
+	switch h {
+	case HintingVertical:
+		return "vertical"
+	case HintingFull:
+		return "full"
+	}
+	return "none"
+}
+
+// xfont は golang.org/x/image/font のヒンティングに変換します
+func (h Hinting) xfont() xfont.Hinting {
+	switch h {
+	case HintingVertical:
+		return xfont.HintingVertical
+	case HintingFull:
+		return xfont.HintingFull
+	}
+	return xfont.HintingNone
+}
+
+// SetGlyphPlacement はグリフの配置に使うヒンティングとサブピクセル位置の既定を設定します
+// subpixel が false の場合、グリフの原点を進行方向に整数ピクセルへ丸めます。
+// 描画（Shape / RenderText）と計測（MeasureText）の両方に適用されます
+func (r *Renderer) SetGlyphPlacement(hinting Hinting, subpixel bool) {
+	r.hinting = hinting
+	r.noSubpixel = !subpixel
+}
+
+// glyphPlacement は text-rendering を考慮したヒンティングとサブピクセル位置を返します
+// geometricPrecision は格子に合わせず、optimizeSpeed はグリフの原点を整数ピクセルに合わせます
+func (r *Renderer) glyphPlacement(textRendering string) (hinting Hinting, subpixel bool) {
+	hinting, subpixel = r.hinting, !r.noSubpixel
+	switch textRendering {
+	case "geometricPrecision":
+		return HintingNone, true
+	case "optimizeSpeed":
+		subpixel = false
+	}
+	if hinting == HintingFull {
+		subpixel = false
+	}
+	return hinting, subpixel
+}
+
+// snapOrigin はヒンティングとサブピクセル位置の設定に従ってグリフの原点を整数ピクセルに丸めます
+// 横倒しのグリフ列は回転して配置するため丸めません
+func (run *GlyphRun) snapOrigin(x, y float64) (float64, float64) {
+	if run.Sideways {
+		return x, y
+	}
+	inline, cross := &x, &y
+	if run.Vertical {
+		inline, cross = &y, &x
+	}
+	if run.snapInline {
+		*inline = math.Round(*inline)
+	}
+	if run.snapCross {
+		*cross = math.Round(*cross)
+	}
+	return x, y
+}
@@ -0,0 +1,388 @@
+package font
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	tsfont "github.com/go-text/typesetting/font"
+	"golang.org/x/image/font/sfnt"
+)
+
+// ============================================================
+// システムフォントのインデックス
+// ============================================================
+
+// fontIndexVersion はインデックスファイルの形式の版です（形式を変えたら上げる）
+const fontIndexVersion = 1
+
+// fontIndex はディスクに保存するフォントのインデックスです
+// パスごとに更新時刻とサイズを記録し、変わったファイルだけを解析し直します
+type fontIndex struct {
+	Version int                     `json:"version"`
+	Files   map[string]*indexedFile `json:"files"`
+}
+
+// indexedFile はフォントファイル1つ分のインデックスです（フォントとして読めないファイルは Faces が空）
+type indexedFile struct {
+	ModTime int64         `json:"mtime"`
+	Size    int64         `json:"size"`
+	Faces   []indexedFace `json:"faces,omitempty"`
+}
+
+// indexedFace はフォントファイル内の1つのフェイスの照合用の情報です
+type indexedFace struct {
+	Index     int             `json:"index,omitempty"` // TTC 内の番号
+	Family    string          `json:"family"`
+	Style     string          `json:"style"`
+	Weight    float64         `json:"weight"`
+	Stretch   float64         `json:"stretch"`
+	Slope     string          `json:"slope"`
+	Axes      []VariationAxis `json:"axes,omitempty"`
+	Shapeable bool            `json:"shapeable"`
+	Coverage  coverage        `json:"coverage"`
+}
+
+// systemFace はスキャンで見つかったフェイスです
+type systemFace struct {
+	Path string
+	indexedFace
+}
+
+// lazyFace はインデックスから登録したフェイスの読み込み状態です
+// フォントデータは最初に使われたときに読み込みます
+type lazyFace struct {
+	path      string
+	index     int
+	coverage  coverage
+	shapeable bool
+
+	once   sync.Once
+	loaded atomic.Bool
+}
+
+// DefaultFontIndexPath はフォントのインデックスの既定の保存先を返します（ユーザーのキャッシュディレクトリ）
+// キャッシュディレクトリがない環境では空文字列（インデックスを保存しない）を返します
+func DefaultFontIndexPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "svg2png", "fontindex.json")
+}
+
+// scannedFonts はプロセス内でスキャン済みの結果です（インデックスのパスとディレクトリの組ごと）
+var scannedFonts = struct {
+	sync.Mutex
+	results map[string][]systemFace
+}{results: make(map[string][]systemFace)}
+
+// scanFontDirs はディレクトリ内のフォントをインデックスを使ってスキャンします
+// 同じ組み合わせのスキャンはプロセス内で1回だけ行い、インデックスは変更があった場合だけ保存します
+func scanFontDirs(indexPath string, dirs []string) []systemFace {
+	key := indexPath + "\x00" + strings.Join(dirs, "\x00")
+	scannedFonts.Lock()
+	defer scannedFonts.Unlock()
+	if faces, ok := scannedFonts.results[key]; ok {
+		return faces
+	}
+
+	idx := readFontIndex(indexPath)
+	changed, parsed := false, 0
+	seen := make(map[string]bool)
+	var faces []systemFace
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".ttf", ".otf", ".ttc", ".woff", ".woff2":
+			default:
+				return nil
+			}
+			seen[path] = true
+			entry := idx.Files[path]
+			if entry == nil || entry.ModTime != info.ModTime().UnixNano() || entry.Size != info.Size() {
+				entry = indexFontFile(path, info)
+				idx.Files[path] = entry
+				changed = true
+				parsed++
+			}
+			for _, f := range entry.Faces {
+				faces = append(faces, systemFace{Path: path, indexedFace: f})
+			}
+			return nil
+		})
+		if err != nil {
+			// 警告として記録するが、処理は続行
+			log.Printf("Warning: failed to scan directory %s: %v", dir, err)
+		}
+	}
+
+	// スキャンしたディレクトリから消えたファイルを取り除く（他のディレクトリの項目は残す）
+	for path := range idx.Files {
+		if seen[path] {
+			continue
+		}
+		for _, dir := range dirs {
+			if strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator)) {
+				delete(idx.Files, path)
+				changed = true
+				break
+			}
+		}
+	}
+	if changed {
+		if err := writeFontIndex(indexPath, idx); err != nil {
+			log.Printf("Warning: failed to write font index %s: %v", indexPath, err)
+		}
+	}
+	log.Printf("Font scan of %v: %d faces (%d files parsed, index %q)", dirs, len(faces), parsed, indexPath)
+
+	scannedFonts.results[key] = faces
+	return faces
+}
+
+// indexFontFile はフォントファイルを解析してインデックスの項目を作成します
+func indexFontFile(path string, info os.FileInfo) *indexedFile {
+	entry := &indexedFile{ModTime: info.ModTime().UnixNano(), Size: info.Size()}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Warning: skipping font %s: %v", path, err)
+		return entry
+	}
+	data, err = decodeWebFont(data)
+	if err != nil {
+		log.Printf("Warning: skipping font %s: %v", path, err)
+		return entry
+	}
+
+	var fonts []*sfnt.Font
+	if collection, err := sfnt.ParseCollection(data); err == nil {
+		for i := 0; i < collection.NumFonts(); i++ {
+			f, err := collection.Font(i)
+			if err != nil {
+				log.Printf("Warning: failed to get font %d from %s: %v", i, path, err)
+				f = nil
+			}
+			fonts = append(fonts, f)
+		}
+	} else {
+		log.Printf("Warning: skipping font %s: %v", path, err)
+		return entry
+	}
+
+	for i, f := range fonts {
+		if f == nil {
+			continue
+		}
+		family, style := extractFontInfoFromSFNT(f)
+		if family == "" {
+			// フォールバック: ファイル名から推測
+			if family, style, err = extractFontInfo(path); err != nil {
+				continue
+			}
+		}
+		ff, err := parseFaceAt(data, i)
+		if err != nil {
+			log.Printf("Warning: skipping font %s/%s from %s: %v", family, style, path, err)
+			continue
+		}
+		ff.Style = normalizeStyle(style)
+		ff.setAspect()
+		face := indexedFace{
+			Index:     i,
+			Family:    family,
+			Style:     ff.Style,
+			Weight:    ff.Weight,
+			Stretch:   ff.Stretch,
+			Slope:     ff.Slope,
+			Axes:      ff.Axes,
+			Shapeable: ff.TSFont != nil,
+		}
+		if ff.TSFont != nil {
+			face.Coverage = newCoverage(ff.TSFont.Cmap.Iter())
+		}
+		entry.Faces = append(entry.Faces, face)
+	}
+	return entry
+}
+
+// readFontIndex はインデックスを読み込みます（ない場合や形式が異なる場合は空のインデックス）
+func readFontIndex(path string) *fontIndex {
+	idx := &fontIndex{Version: fontIndexVersion, Files: make(map[string]*indexedFile)}
+	if path == "" {
+		return idx
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return idx
+	}
+	var stored fontIndex
+	if err := json.Unmarshal(data, &stored); err != nil || stored.Version != fontIndexVersion || stored.Files == nil {
+		log.Printf("Warning: ignoring font index %s", path)
+		return idx
+	}
+	return &stored
+}
+
+// writeFontIndex はインデックスを保存します
+// 他のプロセスが読み込み途中のファイルを壊さないよう、一時ファイルに書いてから置き換えます
+func writeFontIndex(path string, idx *fontIndex) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".fontindex-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// 他のユーザーのプロセスからも読めるようにする
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// newLazyFace はインデックスの項目から未読み込みのフェイスを作成します
+func newLazyFace(sf systemFace) *FontFace {
+	return &FontFace{
+		metrics: &faceMetrics{},
+		Family:  sf.Family,
+		Style:   sf.Style,
+		Path:    sf.Path,
+		Weight:  sf.Weight,
+		Stretch: sf.Stretch,
+		Slope:   sf.Slope,
+		Axes:    sf.Axes,
+		lazy: &lazyFace{
+			path:      sf.Path,
+			index:     sf.Index,
+			coverage:  sf.Coverage,
+			shapeable: sf.Shapeable,
+		},
+	}
+}
+
+// addLazyFace はインデックスの項目を未読み込みのフェイスとして登録します
+// 同じファミリ・スタイルのフェイスが登録済みの場合は登録せずに false を返します
+func (r *Renderer) addLazyFace(sf systemFace) bool {
+	key := sf.Family + "-" + sf.Style
+	if _, exists := r.fonts[key]; exists {
+		return false
+	}
+	r.addFace(key, newLazyFace(sf))
+	return true
+}
+
+// load はインデックスから登録したフェイスのフォントデータを読み込みます（2回目以降は何もしません）
+func (ff *FontFace) load() {
+	l := ff.lazy
+	if l == nil {
+		return
+	}
+	l.once.Do(func() {
+		defer l.loaded.Store(true)
+		data, err := os.ReadFile(l.path)
+		if err != nil {
+			log.Printf("Warning: failed to load font %s: %v", l.path, err)
+			return
+		}
+		loaded, err := parseFaceAt(data, l.index)
+		if err != nil {
+			log.Printf("Warning: failed to load font %s: %v", l.path, err)
+			return
+		}
+		ff.Data, ff.Font, ff.OTFont, ff.TSFont = loaded.Data, loaded.Font, loaded.OTFont, loaded.TSFont
+		ff.paletteTypes, ff.tables = loaded.paletteTypes, loaded.tables
+		log.Printf("Font loaded: %s-%s", ff.Family, ff.Style)
+	})
+}
+
+// CanShape はフォントをシェーピングに使えるかを返します
+// 未読み込みのフェイスはフォントデータを読み込まずにインデックスの情報で判断します
+func (ff *FontFace) CanShape() bool {
+	if l := ff.lazy; l != nil && !l.loaded.Load() {
+		return l.shapeable
+	}
+	return ff.TSFont != nil
+}
+
+// ============================================================
+// 収録文字のビットマップ
+// ============================================================
+
+// coverage は収録文字の集合です
+// 256 文字ごとのページについて、ページ番号（2バイト）と 256 ビットのビットマップを番号順に並べます
+type coverage []byte
+
+const coveragePageSize = 2 + 32
+
+// newCoverage は cmap から収録文字のビットマップを作成します
+func newCoverage(it tsfont.CmapIter) coverage {
+	pages := make(map[uint16]*[32]byte)
+	for it.Next() {
+		r, _ := it.Char()
+		if r < 0 || r > 0x10FFFF {
+			continue
+		}
+		page := uint16(r >> 8)
+		bits := pages[page]
+		if bits == nil {
+			bits = new([32]byte)
+			pages[page] = bits
+		}
+		bits[(r&0xff)>>3] |= 1 << (r & 7)
+	}
+	keys := make([]int, 0, len(pages))
+	for p := range pages {
+		keys = append(keys, int(p))
+	}
+	sort.Ints(keys)
+	c := make(coverage, 0, len(keys)*coveragePageSize)
+	for _, p := range keys {
+		c = binary.BigEndian.AppendUint16(c, uint16(p))
+		c = append(c, pages[uint16(p)][:]...)
+	}
+	return c
+}
+
+// contains は文字が収録されているかを返します
+func (c coverage) contains(r rune) bool {
+	if r < 0 || r > 0x10FFFF {
+		return false
+	}
+	page := uint16(r >> 8)
+	n := len(c) / coveragePageSize
+	i := sort.Search(n, func(i int) bool {
+		return binary.BigEndian.Uint16(c[i*coveragePageSize:]) >= page
+	})
+	if i == n || binary.BigEndian.Uint16(c[i*coveragePageSize:]) != page {
+		return false
+	}
+	return c[i*coveragePageSize+2+int(r&0xff)>>3]&(1<<(r&7)) != 0
+}
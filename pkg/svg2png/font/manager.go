@@ -22,19 +22,43 @@ type FontInfo struct {
 
 // Manager はフォントの管理を行います
 type Manager struct {
-	fonts    map[string]map[string]*FontInfo // family -> style -> FontInfo
-	renderer *Renderer
-	mu       sync.RWMutex
+	fonts     map[string]map[string]*FontInfo // family -> style -> FontInfo
+	renderer  *Renderer
+	indexPath string          // フォントのインデックスの保存先（空の場合は保存しない）
+	scanned   map[string]bool // 登録済みのスキャン対象（ディレクトリの組）
+	// キャッシュの上限（ClearCache で作り直したキャッシュにも適用する）
+	cacheFaces      int
+	cacheGlyphBytes int64
+	mu              sync.RWMutex
 }
 
 // NewManager は新しいフォントマネージャーを作成します
+// システムフォントのインデックスは DefaultFontIndexPath に保存します
 func NewManager() *Manager {
 	return &Manager{
-		fonts:    make(map[string]map[string]*FontInfo),
-		renderer: NewRenderer(),
+		fonts:     make(map[string]map[string]*FontInfo),
+		renderer:  NewRenderer(),
+		indexPath: DefaultFontIndexPath(),
+		scanned:   make(map[string]bool),
 	}
 }
 
+// SetIndexPath はフォントのインデックスの保存先を設定します（空文字列で保存しない）
+func (m *Manager) SetIndexPath(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.indexPath = path
+}
+
+// SetCacheLimits はフェイスとグリフのキャッシュの上限を設定し、超えた分を捨てます
+// 0 は既定の上限、負の値はキャッシュしません。ClearCache の後も同じ上限を使います
+func (m *Manager) SetCacheLimits(faces int, glyphBytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cacheFaces, m.cacheGlyphBytes = faces, glyphBytes
+	m.renderer.cache.SetLimits(faces, glyphBytes)
+}
+
 // RegisterFonts はフォントを登録します
 func (m *Manager) RegisterFonts(fonts ...FontSource) error {
 	m.mu.Lock()
@@ -75,87 +99,76 @@ func (m *Manager) RegisterFonts(fonts ...FontSource) error {
 }
 
 // ClearCache はフォントキャッシュをクリアします
+// SetGenericFamily で設定した総称ファミリの候補は保持します（fontconfig の <alias> は次の ScanSystemFonts で登録し直します）
 func (m *Manager) ClearCache() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	generics := m.renderer.generics
 	m.fonts = make(map[string]map[string]*FontInfo)
 	m.renderer = NewRenderer()
+	m.renderer.generics = generics
+	m.renderer.cache.SetLimits(m.cacheFaces, m.cacheGlyphBytes)
+	m.scanned = make(map[string]bool)
 }
 
-// GetFont は指定されたファミリとスタイルのフォントを取得します
+// GetFont は指定されたファミリとスタイルに最も近いフォントを CSS のフォント照合で取得します
+// family には総称ファミリ（sans-serif など）も指定できます
 func (m *Manager) GetFont(family, style string) (*FontInfo, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	// スタイルの正規化
-	style = normalizeStyle(style)
-
-	// 直接マッチ
-	if fonts, exists := m.fonts[family]; exists {
-		if font, exists := fonts[style]; exists {
-			return font, nil
-		}
-	}
-
-	// フォールバック: Regularスタイルを試す
-	if fonts, exists := m.fonts[family]; exists {
-		if font, exists := fonts["Regular"]; exists {
-			return font, nil
-		}
+	q := ParseStyleName(style)
+	q.Families = []string{family}
+	match := m.renderer.Query(q)
+	if match.Face == nil {
+		return nil, fmt.Errorf("font not found: %s %s", family, style)
 	}
-
-	// フォールバック: 類似のファミリ名を試す
-	if similarFamily := m.findSimilarFamily(family); similarFamily != "" {
-		if fonts, exists := m.fonts[similarFamily]; exists {
-			if font, exists := fonts[style]; exists {
-				return font, nil
-			}
-			if font, exists := fonts["Regular"]; exists {
-				return font, nil
-			}
-		}
+	if info, ok := m.fonts[match.Face.Family][match.Face.Style]; ok {
+		return info, nil
 	}
-
-	return nil, fmt.Errorf("font not found: %s %s", family, style)
+	match.Face.load()
+	return &FontInfo{Family: match.Face.Family, Style: match.Face.Style, Path: match.Face.Path, Data: match.Face.Data}, nil
 }
 
-// findSimilarFamily は類似のフォントファミリ名を探します
-func (m *Manager) findSimilarFamily(family string) string {
-	family = strings.ToLower(family)
-
-	// 一般的なフォントファミリ名のマッピング
-	fontMappings := map[string]string{
-		"arial":      "Arial Unicode",
-		"helvetica":  "Geneva",
-		"times":      "Tinos",
-		"courier":    "Monaco",
-		"sans-serif": "Geneva",
-		"serif":      "Tinos",
-		"monospace":  "Monaco",
-	}
-
-	if mapped, exists := fontMappings[family]; exists {
-		// マッピングされたフォントが存在するかチェック
-		if fonts, exists := m.fonts[mapped]; exists && len(fonts) > 0 {
-			return mapped
-		}
-	}
-
-	// 部分一致で探す
-	for registeredFamily := range m.fonts {
-		if strings.Contains(strings.ToLower(registeredFamily), family) {
-			return registeredFamily
-		}
-	}
+// Query はフォント照合を行い、選ばれたフェイスとその理由を返します
+// q.Families を先頭から順に照合し、最初に見つかったファミリの中で幅・傾き・太さの最も近いフェイスを選びます
+func (m *Manager) Query(q FontQuery) FontMatch {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.renderer.Query(q)
+}
 
-	return ""
+// SetGenericFamily は総称ファミリ（sans-serif, serif, monospace, cursive, system-ui など）の候補を設定します
+// lang を指定するとその言語のテキストだけに適用されます。families が空の場合は既定値に戻します
+func (m *Manager) SetGenericFamily(generic, lang string, families ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.renderer.SetGenericFamily(generic, lang, families...)
 }
 
 // GetRenderer はフォントレンダラーを取得します
+// 返したレンダラーはその後の登録や ClearCache の影響を受けるため、描画には Snapshot を使います
 func (m *Manager) GetRenderer() *Renderer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.renderer
 }
 
+// CacheStats はフェイスとグリフのキャッシュの利用状況を返します
+func (m *Manager) CacheStats() CacheStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.renderer.cache.Stats()
+}
+
+// Snapshot は現在のフォントセットの複製を返します
+// 描画中に RegisterFonts や ClearCache が呼ばれても、複製したフォントセットは変わりません
+func (m *Manager) Snapshot() *Renderer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.renderer.Scoped()
+}
+
 // ListFonts は登録されているフォントの一覧を返します
 func (m *Manager) ListFonts() []string {
 	m.mu.RLock()
@@ -171,69 +184,83 @@ func (m *Manager) ListFonts() []string {
 }
 
 // ScanSystemFonts はシステムフォントをスキャンします
+// フォントファイルの情報はインデックスに保存し、プロセス内では1回だけスキャンします
+// Linux では fontconfig の設定（FONTCONFIG_FILE または /etc/fonts/fonts.conf）の <dir> をスキャンし、<alias> をファミリの照合に使います
 func (m *Manager) ScanSystemFonts() error {
-	paths := getSystemFontPaths()
-
-	log.Printf("Scanning system fonts from paths: %v", paths)
-
-	for _, path := range paths {
-		if err := m.scanDirectory(path); err != nil {
-			// 警告として記録するが、処理は続行
-			log.Printf("Warning: failed to scan directory %s: %v", path, err)
-		}
+	cfg := systemFontConfigFor(runtime.GOOS)
+	if cfg == nil {
+		return m.ScanFontDirectories(getSystemFontPaths()...)
+	}
+	if err := m.ScanFontDirectories(cfg.Dirs...); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.scanned[fontconfigAliasesKey] {
+		m.renderer.AddAliases(cfg.Aliases)
+		m.scanned[fontconfigAliasesKey] = true
 	}
-
-	log.Printf("System font scan completed. Registered fonts: %v", m.ListFonts())
 	return nil
 }
 
-// scanDirectory は指定されたディレクトリ内のフォントをスキャンします
-func (m *Manager) scanDirectory(dir string) error {
-	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
+// ApplyFontConfig は fontconfig の設定をフォントセットの複製 r に適用します（マネージャーのフォントセットは変えません）
+// <dir> のフォントはインデックスを使って r に追加し、r の <alias> は cfg の <alias> で置き換えます
+func (m *Manager) ApplyFontConfig(r *Renderer, cfg *FontConfig) {
+	m.mu.RLock()
+	indexPath := m.indexPath
+	m.mu.RUnlock()
+	if len(cfg.Dirs) > 0 {
+		for _, sf := range scanFontDirs(indexPath, cfg.Dirs) {
+			r.addLazyFace(sf)
 		}
+	}
+	r.SetAliases(cfg.Aliases)
+}
 
-		ext := strings.ToLower(filepath.Ext(path))
-		if ext != ".ttf" && ext != ".otf" && ext != ".ttc" {
-			return nil
-		}
+// fontconfigAliasesKey は fontconfig の <alias> を登録済みかを scanned に記録するキーです
+const fontconfigAliasesKey = "\x00fontconfig"
 
-		if ext == ".ttc" {
-			// TrueType Collection: 複数フォントを含むファイル
-			m.scanTTCFile(path)
-			return nil
-		}
+// systemFontConfigFor は fontconfig を使うプラットフォームでシステムの設定を返します（ない場合は nil）
+func systemFontConfigFor(goos string) *FontConfig {
+	if goos != "linux" {
+		return nil
+	}
+	cfg := systemFontConfig()
+	if cfg == nil || len(cfg.Dirs) == 0 {
+		return nil
+	}
+	return cfg
+}
 
-		// 単一フォントファイル: メタデータから情報を抽出
-		family, style, err := extractFontInfoFromFile(path)
-		if err != nil {
-			// フォールバック: ファイル名から推測
-			family, style, err = extractFontInfo(path)
-			if err != nil {
-				return nil
-			}
-		}
+// ScanFontDirectories はディレクトリ内のフォントファイル（TTF/OTF/TTC/WOFF/WOFF2）をスキャンして登録します
+// インデックスの情報（ファミリ・スタイル・収録文字）だけを登録し、フォントデータは初回の使用時に読み込みます
+func (m *Manager) ScanFontDirectories(dirs ...string) error {
+	key := strings.Join(dirs, "\x00")
+	m.mu.RLock()
+	done, indexPath := m.scanned[key], m.indexPath
+	m.mu.RUnlock()
+	if done {
+		return nil
+	}
 
-		// フォントの登録
-		font := FontSource{
-			Family: family,
-			Style:  style,
-			Path:   path,
-		}
+	faces := scanFontDirs(indexPath, dirs)
 
-		if err := m.RegisterFonts(font); err != nil {
-			log.Printf("Warning: skipping font %s: %v", path, err)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sf := range faces {
+		if m.renderer.addLazyFace(sf) {
+			if m.fonts[sf.Family] == nil {
+				m.fonts[sf.Family] = make(map[string]*FontInfo)
+			}
+			m.fonts[sf.Family][sf.Style] = &FontInfo{Family: sf.Family, Style: sf.Style, Path: sf.Path}
 		}
-		return nil // 個別フォントのエラーでスキャンを止めない
-	})
+	}
+	m.scanned[key] = true
+	return nil
 }
 
 // getSystemFontPaths はプラットフォーム別のフォントパスを返します
+// Linux で fontconfig の設定を読めた場合は ScanSystemFonts がその <dir> を使い、この一覧は使いません
 func getSystemFontPaths() []string {
 	switch runtime.GOOS {
 	case "linux":
@@ -258,93 +285,9 @@ func getSystemFontPaths() []string {
 }
 
 // normalizeStyle はスタイル名を正規化します
+// 太さ・幅・斜体を保ったまま "Regular", "BoldItalic", "SemiBold", "CondensedLight" などの形にそろえます
 func normalizeStyle(style string) string {
-	style = strings.ToLower(style)
-
-	switch {
-	case strings.Contains(style, "bold") && strings.Contains(style, "italic"):
-		return "BoldItalic"
-	case strings.Contains(style, "bold"):
-		return "Bold"
-	case strings.Contains(style, "italic"):
-		return "Italic"
-	default:
-		return "Regular"
-	}
-}
-
-// scanTTCFile はTrueType Collectionファイルをスキャンして個別フォントを登録します
-func (m *Manager) scanTTCFile(path string) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		log.Printf("Warning: failed to read TTC file %s: %v", path, err)
-		return
-	}
-
-	collection, err := sfnt.ParseCollection(data)
-	if err != nil {
-		log.Printf("Warning: failed to parse TTC file %s: %v", path, err)
-		return
-	}
-
-	numFonts := collection.NumFonts()
-	for i := 0; i < numFonts; i++ {
-		f, err := collection.Font(i)
-		if err != nil {
-			log.Printf("Warning: failed to get font %d from %s: %v", i, path, err)
-			continue
-		}
-
-		family, style := extractFontInfoFromSFNT(f)
-		if family == "" {
-			continue
-		}
-
-		key := fmt.Sprintf("%s-%s", family, normalizeStyle(style))
-		if _, exists := m.renderer.fonts[key]; exists {
-			continue // 既に登録済み
-		}
-
-		// TTC用の特別な登録（sfnt.Fontを直接使用）
-		if err := m.registerTTCFont(family, style, f, data, i); err != nil {
-			log.Printf("Warning: skipping TTC font %s/%s from %s: %v", family, style, path, err)
-		}
-	}
-}
-
-// registerTTCFont はTTCファイル内の個別フォントを登録します
-func (m *Manager) registerTTCFont(family, style string, f *sfnt.Font, ttcData []byte, index int) error {
-	normalizedStyle := normalizeStyle(style)
-
-	if m.fonts[family] == nil {
-		m.fonts[family] = make(map[string]*FontInfo)
-	}
-
-	fontInfo := &FontInfo{
-		Family: family,
-		Style:  normalizedStyle,
-	}
-	m.fonts[family][normalizedStyle] = fontInfo
-
-	// レンダラーに直接登録（opentype.ParseCollectionを使用）
-	return m.renderer.LoadFontFromCollection(family, normalizedStyle, ttcData, index)
-}
-
-// extractFontInfoFromFile はフォントファイルのメタデータからファミリ名とスタイルを抽出します
-func extractFontInfoFromFile(path string) (family, style string, err error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return "", "", err
-	}
-	f, err := sfnt.Parse(data)
-	if err != nil {
-		return "", "", err
-	}
-	family, style = extractFontInfoFromSFNT(f)
-	if family == "" {
-		return "", "", fmt.Errorf("could not extract font family name")
-	}
-	return family, style, nil
+	return ParseStyleName(style).StyleName()
 }
 
 // extractFontInfoFromSFNT はsfnt.Fontからファミリ名とスタイルを抽出します
@@ -359,6 +302,14 @@ func extractFontInfoFromSFNT(f *sfnt.Font) (family, style string) {
 	if name, err := f.Name(&buf, sfnt.NameIDSubfamily); err == nil && name != "" {
 		style = name
 	}
+	// 4スタイルを超える太さ・幅を持つファミリは、タイポグラフィック名（ID 16/17）で
+	// "Inter Light" ではなく "Inter" の "Light" として登録する
+	if name, err := f.Name(&buf, sfnt.NameIDTypographicFamily); err == nil && name != "" {
+		family = name
+		if sub, err := f.Name(&buf, sfnt.NameIDTypographicSubfamily); err == nil && sub != "" {
+			style = sub
+		}
+	}
 
 	if style == "" {
 		style = "Regular"
@@ -0,0 +1,334 @@
+package font
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ============================================================
+// スタイル名とフォントの照合
+// ============================================================
+
+// FontQuery は CSS のフォント照合に使う要求です
+type FontQuery struct {
+	Families []string // font-family のリスト（総称ファミリを含む）。MatchFont では使いません
+	Weight   float64  // font-weight（1〜1000、400 が normal）
+	Stretch  float64  // font-stretch（百分率、100 が normal）
+	Slope    string   // font-style（"normal" | "italic" | "oblique"）
+	Lang     string   // 総称ファミリの解決に使う言語タグ（例: "ja", "zh-Hant"）
+}
+
+// FontMatch はフォント照合の結果です
+type FontMatch struct {
+	Face    *FontFace // 選ばれたフェイス（見つからない場合は nil）
+	Family  string    // 選ばれたフェイスの要求元のファミリ名（総称ファミリは解決後の名前）
+	Reasons []string  // 照合の各段階で候補を絞り込んだ理由
+}
+
+// 太さの名前（長い名前から照合するため、部分一致する名前より先に並べる）
+var weightNames = []struct {
+	name   string
+	weight float64
+}{
+	{"extralight", 200}, {"ultralight", 200},
+	{"semibold", 600}, {"demibold", 600},
+	{"extrabold", 800}, {"ultrabold", 800},
+	{"hairline", 100}, {"thin", 100},
+	{"light", 300},
+	{"regular", 400}, {"normal", 400}, {"book", 400}, {"roman", 400},
+	{"medium", 500},
+	{"bold", 700},
+	{"black", 900}, {"heavy", 900},
+}
+
+// 幅の名前（同上）
+var stretchNames = []struct {
+	name, title string
+	stretch     float64
+}{
+	{"ultracondensed", "UltraCondensed", 50}, {"extracondensed", "ExtraCondensed", 62.5},
+	{"semicondensed", "SemiCondensed", 87.5}, {"condensed", "Condensed", 75},
+	{"ultraexpanded", "UltraExpanded", 200}, {"extraexpanded", "ExtraExpanded", 150},
+	{"semiexpanded", "SemiExpanded", 112.5}, {"expanded", "Expanded", 125},
+}
+
+// ParseStyleName はスタイル名（例: "SemiBold Italic", "Condensed Light"）を照合用の要求に変換します
+// 太さや幅の名前を含まない場合は normal（400 / 100%）になります
+func ParseStyleName(style string) FontQuery {
+	s := strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(style))
+	q := FontQuery{Weight: 400, Stretch: 100, Slope: "normal"}
+	for _, n := range stretchNames {
+		if strings.Contains(s, n.name) {
+			q.Stretch = n.stretch
+			s = strings.Replace(s, n.name, "", 1)
+			break
+		}
+	}
+	for _, n := range weightNames {
+		if strings.Contains(s, n.name) {
+			q.Weight = n.weight
+			break
+		}
+	}
+	switch {
+	case strings.Contains(s, "italic"):
+		q.Slope = "italic"
+	case strings.Contains(s, "oblique"):
+		q.Slope = "oblique"
+	}
+	return q
+}
+
+// StyleName は要求を正規化したスタイル名（例: "Regular", "BoldItalic", "CondensedLight"）で返します
+// フォントの登録キーに使います
+func (q FontQuery) StyleName() string {
+	var name string
+	for _, n := range stretchNames {
+		if q.Stretch == n.stretch {
+			name = n.title
+			break
+		}
+	}
+	switch w := math.Round(q.Weight/100) * 100; w {
+	case 100:
+		name += "Thin"
+	case 200:
+		name += "ExtraLight"
+	case 300:
+		name += "Light"
+	case 500:
+		name += "Medium"
+	case 600:
+		name += "SemiBold"
+	case 700:
+		name += "Bold"
+	case 800:
+		name += "ExtraBold"
+	case 900:
+		name += "Black"
+	}
+	switch q.Slope {
+	case "italic":
+		name += "Italic"
+	case "oblique":
+		name += "Oblique"
+	}
+	if name == "" {
+		return "Regular"
+	}
+	return name
+}
+
+// String は診断用に要求を "weight 700, stretch 100%, italic" の形式で返します
+func (q FontQuery) String() string {
+	slope := q.Slope
+	if slope == "" {
+		slope = "normal"
+	}
+	return fmt.Sprintf("weight %g, stretch %g%%, %s", q.Weight, q.Stretch, slope)
+}
+
+// weightRange は太さの範囲を返します（可変フォントは wght 軸の範囲）
+func (ff *FontFace) weightRange() (lo, hi float64) {
+	if axis, ok := ff.axis("wght"); ok {
+		return axis.Min, axis.Max
+	}
+	return ff.Weight, ff.Weight
+}
+
+// stretchRange は幅の範囲を返します（可変フォントは wdth 軸の範囲）
+func (ff *FontFace) stretchRange() (lo, hi float64) {
+	if axis, ok := ff.axis("wdth"); ok {
+		return axis.Min, axis.Max
+	}
+	return ff.Stretch, ff.Stretch
+}
+
+// hasSlope は ital・slnt 軸を含めてフェイスが指定の傾き（font-style）を表現できるかを返します
+func (ff *FontFace) hasSlope(slope string) bool {
+	if ff.Slope == slope {
+		return true
+	}
+	switch slope {
+	case "italic":
+		axis, ok := ff.axis("ital")
+		return ok && axis.Max >= 1
+	case "oblique":
+		axis, ok := ff.axis("slnt")
+		return ok && axis.Min < 0
+	case "normal":
+		if axis, ok := ff.axis("ital"); ok && axis.Min <= 0 {
+			return true
+		}
+		axis, ok := ff.axis("slnt")
+		return ok && axis.Min <= 0 && axis.Max >= 0
+	}
+	return false
+}
+
+// slopeOrder は font-style ごとに探す傾きの順序です（CSS Fonts Level 4 §5.2）
+var slopeOrder = map[string][]string{
+	"italic":  {"italic", "oblique", "normal"},
+	"oblique": {"oblique", "italic", "normal"},
+	"normal":  {"normal", "oblique", "italic"},
+}
+
+// MatchFont は CSS Fonts Level 4 のフォント照合アルゴリズムでファミリ内の最も近いフェイスを選びます
+// 幅 → スタイル → 太さの順に絞り込み、可変フォントは軸の範囲で照合します
+// ファミリ名は大文字小文字を区別せずに比較し、見つからない場合は nil を返します
+func (r *Renderer) MatchFont(family string, q FontQuery) *FontFace {
+	return r.matchFamily(family, q, nil)
+}
+
+// matchFamily は MatchFont の本体です。explain が nil でなければ各段階の理由を渡します
+func (r *Renderer) matchFamily(family string, q FontQuery, explain func(string)) *FontFace {
+	if explain == nil {
+		explain = func(string) {}
+	}
+	faces := r.familyFaces(strings.ToLower(family))
+	if len(faces) == 0 {
+		explain(fmt.Sprintf("%q: no faces registered", family))
+		return nil
+	}
+	if q.Weight == 0 {
+		q.Weight = 400
+	}
+	if q.Stretch == 0 {
+		q.Stretch = 100
+	}
+	if slopeOrder[q.Slope] == nil {
+		q.Slope = "normal"
+	}
+	explain(fmt.Sprintf("%q: %d faces %s", family, len(faces), faceNames(faces)))
+
+	faces = closestFaces(faces, func(ff *FontFace) float64 {
+		lo, hi := ff.stretchRange()
+		return stretchDistance(q.Stretch, lo, hi)
+	})
+	explain(fmt.Sprintf("stretch %g%%: %s", q.Stretch, faceNames(faces)))
+
+	faces = closestFaces(faces, func(ff *FontFace) float64 {
+		for i, slope := range slopeOrder[q.Slope] {
+			if ff.hasSlope(slope) {
+				return float64(i)
+			}
+		}
+		return float64(len(slopeOrder))
+	})
+	explain(fmt.Sprintf("style %s: %s", q.Slope, faceNames(faces)))
+
+	faces = closestFaces(faces, func(ff *FontFace) float64 {
+		lo, hi := ff.weightRange()
+		return weightDistance(q.Weight, lo, hi)
+	})
+	explain(fmt.Sprintf("weight %g: %s", q.Weight, faceNames(faces)))
+	return faces[0]
+}
+
+// Query は font-family のリストを先頭から順に照合し、最初に見つかったフェイスと選ばれた理由を返します
+// 総称ファミリ（sans-serif など）は q.Lang に応じた具体的なファミリのリストに、
+// fontconfig の <alias> があるファミリは別名を含むリストに展開します（FamilyCandidates）
+func (r *Renderer) Query(q FontQuery) FontMatch {
+	var m FontMatch
+	explain := func(s string) { m.Reasons = append(m.Reasons, s) }
+	for _, family := range q.Families {
+		names := r.FamilyCandidates(family, q.Lang)
+		if len(names) != 1 || names[0] != family {
+			explain(fmt.Sprintf("%q (lang %q) -> %s", family, q.Lang, strings.Join(names, ", ")))
+		}
+		for _, name := range names {
+			if ff := r.matchFamily(name, q, explain); ff != nil {
+				m.Face, m.Family = ff, name
+				explain(fmt.Sprintf("selected %q %s", ff.Family, ff.Style))
+				return m
+			}
+		}
+	}
+	explain("no family in the list is available")
+	return m
+}
+
+// faceNames は診断用にフェイスのスタイル名を並べます（可変フォントは軸の範囲も示します）
+func faceNames(faces []*FontFace) string {
+	names := make([]string, len(faces))
+	for i, ff := range faces {
+		names[i] = ff.Style
+		if len(ff.Axes) > 0 {
+			var axes []string
+			for _, a := range ff.Axes {
+				axes = append(axes, fmt.Sprintf("%s %g..%g", a.Tag, a.Min, a.Max))
+			}
+			names[i] += " (" + strings.Join(axes, ", ") + ")"
+		}
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// closestFaces は距離が最小のフェイスだけを元の順序のまま返します
+func closestFaces(faces []*FontFace, distance func(*FontFace) float64) []*FontFace {
+	best := math.Inf(1)
+	var out []*FontFace
+	for _, ff := range faces {
+		switch d := distance(ff); {
+		case d < best:
+			best = d
+			out = append(out[:0], ff)
+		case d == best:
+			out = append(out, ff)
+		}
+	}
+	return out
+}
+
+// 照合順の段階を分けるための距離の底上げ値
+const (
+	secondChoice = 1e4
+	thirdChoice  = 2e4
+)
+
+// stretchDistance は幅の照合順を距離で表します
+// 100% 以下の要求では狭い幅を近い順に、次に広い幅を近い順に探します（100% 超はその逆）
+func stretchDistance(want, lo, hi float64) float64 {
+	switch {
+	case lo <= want && want <= hi:
+		return 0
+	case want <= 100 && hi < want:
+		return want - hi
+	case want <= 100:
+		return secondChoice + lo - want
+	case lo > want:
+		return lo - want
+	default:
+		return secondChoice + want - hi
+	}
+}
+
+// weightDistance は太さの照合順を距離で表します
+// 400〜500 の要求では要求値〜500 → 要求値未満（降順）→ 500 超（昇順）の順に探します
+// 400 未満では軽い順に近いもの、500 超では重い順に近いものを優先します
+func weightDistance(want, lo, hi float64) float64 {
+	switch {
+	case lo <= want && want <= hi:
+		return 0
+	case want >= 400 && want <= 500:
+		switch {
+		case lo > want && lo <= 500:
+			return lo - want
+		case hi < want:
+			return secondChoice + want - hi
+		default:
+			return thirdChoice + lo - want
+		}
+	case want < 400:
+		if hi < want {
+			return want - hi
+		}
+		return secondChoice + lo - want
+	default:
+		if lo > want {
+			return lo - want
+		}
+		return secondChoice + want - hi
+	}
+}
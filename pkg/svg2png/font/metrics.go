@@ -0,0 +1,239 @@
+package font
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+
+	tsfont "github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+)
+
+// ============================================================
+// フォントの寸法
+// ============================================================
+
+// FontMetrics はテキストの装飾線や font-size-adjust、ベースラインの位置、行の高さに使うフォントの寸法です
+// 値は em に対する比率で、位置はベースラインから上向きを正とします
+type FontMetrics struct {
+	Ascent                 float64
+	Descent                float64 // 正の値
+	LineGap                float64 // 行間（line-height: normal で ascent + descent に加える）
+	XHeight                float64
+	CapHeight              float64
+	UnderlinePosition      float64 // 下線の中心（通常は負の値）
+	UnderlineThickness     float64
+	StrikethroughPosition  float64 // 取り消し線の中心
+	StrikethroughThickness float64
+	SubscriptOffset        float64 // 下付き文字を下げる量（正の値）
+	SuperscriptOffset      float64 // 上付き文字を上げる量
+	HangingBaseline        float64 // hanging ベースライン
+	IdeographicBaseline    float64 // ideographic ベースライン（通常は負の値）
+	MathBaseline           float64 // mathematical ベースライン
+}
+
+// Metrics はフォントの寸法を返します
+// フォントに値がない場合（post / OS/2 が 0）は CSS の推奨に沿った既定値で補います
+// 寸法は最初の呼び出しで計算して保持します
+func (ff *FontFace) Metrics() FontMetrics {
+	if ff.metrics == nil {
+		return ff.readMetrics()
+	}
+	ff.metrics.once.Do(func() { ff.metrics.value = ff.readMetrics() })
+	return ff.metrics.value
+}
+
+// faceMetrics は計算済みのフォントの寸法です
+type faceMetrics struct {
+	once  sync.Once
+	value FontMetrics
+}
+
+// readMetrics はフォントのテーブルから寸法を読み取ります
+func (ff *FontFace) readMetrics() FontMetrics {
+	ff.load()
+	m := FontMetrics{
+		Ascent:                 0.8,
+		Descent:                0.2,
+		XHeight:                0.5,
+		CapHeight:              0.7,
+		UnderlinePosition:      -0.1,
+		UnderlineThickness:     0.05,
+		StrikethroughPosition:  0.25,
+		StrikethroughThickness: 0.05,
+		SubscriptOffset:        0.2,
+		SuperscriptOffset:      0.34,
+		HangingBaseline:        0.64,
+		IdeographicBaseline:    -0.2,
+		MathBaseline:           0.4,
+	}
+	if ff.TSFont == nil {
+		return m
+	}
+	face := tsfont.NewFace(ff.TSFont)
+	upem := float64(ff.TSFont.Upem())
+	metric := func(v float32, fallback float64) float64 {
+		if v == 0 {
+			return fallback
+		}
+		return float64(v) / upem
+	}
+	if ext, ok := face.FontHExtents(); ok {
+		m.Ascent = metric(ext.Ascender, m.Ascent)
+		m.Descent = -metric(ext.Descender, -m.Descent)
+		m.LineGap = metric(ext.LineGap, 0)
+	}
+	m.XHeight = metric(face.LineMetric(tsfont.XHeight), m.XHeight)
+	m.CapHeight = metric(face.LineMetric(tsfont.CapHeight), m.CapHeight)
+	m.UnderlineThickness = metric(face.LineMetric(tsfont.UnderlineThickness), m.UnderlineThickness)
+	// post の underlinePosition は線の上端の位置のため、中心に直す
+	m.UnderlinePosition = metric(face.LineMetric(tsfont.UnderlinePosition), m.UnderlinePosition+m.UnderlineThickness/2) - m.UnderlineThickness/2
+	m.StrikethroughThickness = metric(face.LineMetric(tsfont.StrikethroughThickness), m.UnderlineThickness)
+	// OS/2 の yStrikeoutPosition は線の下端の位置のため、中心に直す
+	m.StrikethroughPosition = metric(face.LineMetric(tsfont.StrikethroughPosition), m.XHeight/2-m.StrikethroughThickness/2) + m.StrikethroughThickness/2
+	m.SubscriptOffset = metric(face.LineMetric(tsfont.SubscriptEmYOffset), m.SubscriptOffset)
+	// OS/2 の ySuperscriptYOffset は go-text から取得できないため、テーブルから読んだ値を使う
+	m.SuperscriptOffset = metric(float32(ff.tables.superscriptOffset), m.SuperscriptOffset)
+
+	// BASE テーブルのベースラインがない場合は CSS Inline Layout の既定の求め方に沿って寸法から導く
+	m.HangingBaseline, m.IdeographicBaseline, m.MathBaseline = m.Ascent*0.8, -m.Descent, m.Ascent/2
+	if v, ok := ff.tables.baselines["hang"]; ok {
+		m.HangingBaseline = float64(v) / upem
+	}
+	if v, ok := ff.tables.baselines["ideo"]; ok {
+		m.IdeographicBaseline = float64(v) / upem
+	}
+	if v, ok := ff.tables.baselines["math"]; ok {
+		m.MathBaseline = float64(v) / upem
+	}
+	return m
+}
+
+// Baseline はベースライン表の位置を返します（em に対する比率で、alphabetic から上向きを正とします）
+// hanging / ideographic / mathematical はフォントの BASE テーブルの値（ない場合は寸法から導いた値）を使います
+// 不明な名前（"auto" を含む）は alphabetic として扱います
+func (m FontMetrics) Baseline(name string) float64 {
+	switch name {
+	case "ideographic":
+		return m.IdeographicBaseline
+	case "text-bottom":
+		return -m.Descent
+	case "text-top":
+		return m.Ascent
+	case "central":
+		return (m.Ascent - m.Descent) / 2
+	case "middle":
+		return m.XHeight / 2
+	case "hanging":
+		return m.HangingBaseline
+	case "mathematical":
+		return m.MathBaseline
+	}
+	return 0
+}
+
+// tableValues は go-text から取得できない OS/2 と BASE の値です（フォントの設計単位）
+type tableValues struct {
+	superscriptOffset int16            // OS/2 の ySuperscriptYOffset（ない場合は 0）
+	baselines         map[string]int16 // BASE の横書きのベースライン（"hang" / "ideo" / "math" など。alphabetic からの位置）
+}
+
+// readTableValues はフォントの OS/2 と BASE テーブルから寸法を読み取ります（読めない値は空のまま返します）
+func readTableValues(data []byte, index int) tableValues {
+	var tv tableValues
+	loaders, err := ot.NewLoaders(bytes.NewReader(data))
+	if err != nil || index >= len(loaders) {
+		return tv
+	}
+	if raw, err := loaders[index].RawTable(ot.MustNewTag("OS/2")); err == nil && len(raw) >= 26 {
+		tv.superscriptOffset = int16(binary.BigEndian.Uint16(raw[24:]))
+	}
+	if raw, err := loaders[index].RawTable(ot.MustNewTag("BASE")); err == nil {
+		tv.baselines = readBaseAxis(raw)
+	}
+	return tv
+}
+
+// readBaseAxis は BASE テーブルの横書きの軸から、latn（なければ DFLT、最初のスクリプト）の既定のベースラインを読み取ります
+// 値は romn（alphabetic）からの相対位置に直します
+func readBaseAxis(raw []byte) map[string]int16 {
+	be := binary.BigEndian
+	u16 := func(b []byte, off int) (int, bool) {
+		if off < 0 || off+2 > len(b) {
+			return 0, false
+		}
+		return int(be.Uint16(b[off:])), true
+	}
+	axisOff, ok := u16(raw, 4)
+	if !ok || axisOff == 0 || axisOff >= len(raw) {
+		return nil
+	}
+	axis := raw[axisOff:]
+	tagListOff, ok1 := u16(axis, 0)
+	scriptListOff, ok2 := u16(axis, 2)
+	if !ok1 || !ok2 || tagListOff == 0 || scriptListOff == 0 || tagListOff >= len(axis) || scriptListOff >= len(axis) {
+		return nil
+	}
+	tagList, scriptList := axis[tagListOff:], axis[scriptListOff:]
+	tagCount, _ := u16(tagList, 0)
+	if len(tagList) < 2+4*tagCount {
+		return nil
+	}
+
+	// スクリプトを選ぶ
+	scriptCount, _ := u16(scriptList, 0)
+	if len(scriptList) < 2+6*scriptCount || scriptCount == 0 {
+		return nil
+	}
+	scriptOff := 0
+	for _, want := range []string{"latn", "DFLT", ""} {
+		for i := 0; i < scriptCount && scriptOff == 0; i++ {
+			rec := scriptList[2+6*i:]
+			if want == "" || string(rec[:4]) == want {
+				scriptOff = int(be.Uint16(rec[4:]))
+			}
+		}
+		if scriptOff != 0 {
+			break
+		}
+	}
+	if scriptOff == 0 || scriptOff >= len(scriptList) {
+		return nil
+	}
+	script := scriptList[scriptOff:]
+	valuesOff, ok := u16(script, 0)
+	if !ok || valuesOff == 0 || valuesOff >= len(script) {
+		return nil
+	}
+	values := script[valuesOff:]
+	coordCount, _ := u16(values, 2)
+	if coordCount > tagCount || len(values) < 4+2*coordCount {
+		return nil
+	}
+
+	baselines := make(map[string]int16, coordCount)
+	for i := 0; i < coordCount; i++ {
+		coordOff := int(be.Uint16(values[4+2*i:]))
+		// BaseCoord の形式 1〜3 はいずれも 2 バイト目に座標を持つ
+		if coordOff == 0 || coordOff+4 > len(values) {
+			continue
+		}
+		baselines[string(tagList[2+4*i:6+4*i])] = int16(be.Uint16(values[coordOff+2:]))
+	}
+	if romn, ok := baselines["romn"]; ok && romn != 0 {
+		for tag, v := range baselines {
+			baselines[tag] = v - romn
+		}
+	}
+	return baselines
+}
+
+// HasFeature は GSUB に OpenType フィーチャー（"smcp" など）があるかを返します
+func (ff *FontFace) HasFeature(tag string) bool {
+	ff.load()
+	if ff.TSFont == nil || len(tag) != 4 {
+		return false
+	}
+	_, ok := ff.TSFont.GSUB.FindFeatureIndex(ot.MustNewTag(tag))
+	return ok
+}
@@ -1,11 +1,15 @@
 package font
 
 import (
+	"bytes"
 	"fmt"
 	"image"
 	"image/color"
 	"log"
+	"math"
 	"os"
+	"slices"
+	"sort"
 	"strings"
 
 	xfont "golang.org/x/image/font"
@@ -13,11 +17,25 @@ import (
 	"golang.org/x/image/font/opentype"
 	"golang.org/x/image/font/sfnt"
 	"golang.org/x/image/math/fixed"
+
+	tsfont "github.com/go-text/typesetting/font"
 )
 
 // Renderer はフォントレンダリングを行います
 type Renderer struct {
-	fonts map[string]*FontFace // "Family-Style" → FontFace
+	fonts    map[string]*FontFace    // "Family-Style" → FontFace
+	faceKeys []string                // fonts のキーをソートしたもの（addFace / removeFace で更新する）
+	faceList []*FontFace             // faceKeys の順のフェイス（Faces が返す）
+	families map[string][]*FontFace  // 小文字のファミリ名 → キー順のフェイス
+	generics map[genericKey][]string // SetGenericFamily で設定した総称ファミリの候補
+	aliases  map[string][]FontAlias  // fontconfig の <alias>（小文字のファミリ名 → 記述順の規則）。変更時は作り直す
+
+	documentFamilies map[string]bool // @font-face で定義したファミリ（小文字）。Scoped で作成した場合のみ使う
+
+	hinting    Hinting // グリフを格子に合わせる度合い（SetGlyphPlacement）
+	noSubpixel bool    // グリフの原点を整数ピクセルに丸める
+
+	cache *Cache // フェイスとグリフのキャッシュ（Scoped で作成したフォントセットと共有する）
 }
 
 // FontFace はフォントのメタデータとデータを保持します
@@ -28,6 +46,20 @@ type FontFace struct {
 	Data   []byte
 	Font   *sfnt.Font
 	OTFont *opentype.Font
+	TSFont *tsfont.Font // シェーピング（GSUB/GPOS）とアウトライン取得用
+
+	// フォント照合に使う属性（Style から決まる）
+	Weight  float64         // 太さ（100〜900）
+	Stretch float64         // 幅（百分率）
+	Slope   string          // 傾き（"normal" | "italic" | "oblique"）
+	Axes    []VariationAxis // 可変フォントの変形軸（可変フォントでない場合は nil）
+
+	paletteTypes []uint32    // CPAL v1 のパレット種別（font-palette: light/dark 用）
+	tables       tableValues // go-text から取得できない OS/2 / BASE の値（Metrics 用）
+
+	lazy *lazyFace // インデックスから登録したフェイス（フォントデータは初回の使用時に読み込む）
+
+	metrics *faceMetrics // Metrics の結果（複製したフェイスと共有する）
 }
 
 // GlyphInfo はグリフ情報（互換性のために残す）
@@ -56,7 +88,9 @@ type TextRun struct {
 // NewRenderer は新しいフォントレンダラーを作成します
 func NewRenderer() *Renderer {
 	return &Renderer{
-		fonts: make(map[string]*FontFace),
+		fonts:    make(map[string]*FontFace),
+		families: make(map[string][]*FontFace),
+		cache:    NewCache(0, 0),
 	}
 }
 
@@ -82,27 +116,47 @@ func (r *Renderer) LoadFont(fontInfo *FontInfo) error {
 		return fmt.Errorf("no font data or path provided")
 	}
 
+	ff, err := parseFace(fontData)
+	if err != nil {
+		return err
+	}
+	ff.Family, ff.Style, ff.Path = fontInfo.Family, fontInfo.Style, fontInfo.Path
+	ff.setAspect()
+	r.addFace(key, ff)
+
+	log.Printf("Font loaded: %s", key)
+	return nil
+}
+
+// parseFace は単体のフォントファイルを解析してフェイスを作成します（Family・Style は呼び出し側で設定します）
+// WOFF / WOFF2 は展開してから解析します
+func parseFace(fontData []byte) (*FontFace, error) {
+	fontData, err := decodeWebFont(fontData)
+	if err != nil {
+		return nil, err
+	}
+
 	sfntFont, err := sfnt.Parse(fontData)
 	if err != nil {
-		return fmt.Errorf("failed to parse SFNT: %w", err)
+		return nil, fmt.Errorf("failed to parse SFNT: %w", err)
 	}
 
 	otFont, err := opentype.Parse(fontData)
 	if err != nil {
-		return fmt.Errorf("failed to parse OpenType: %w", err)
+		return nil, fmt.Errorf("failed to parse OpenType: %w", err)
 	}
 
-	r.fonts[key] = &FontFace{
-		Family: fontInfo.Family,
-		Style:  fontInfo.Style,
-		Path:   fontInfo.Path,
-		Data:   fontData,
-		Font:   sfntFont,
-		OTFont: otFont,
-	}
+	return &FontFace{
+		metrics: &faceMetrics{},
+		Data:    fontData,
+		Font:    sfntFont,
+		OTFont:  otFont,
+		TSFont:  parseShapingFont(fontData, 0),
+		Axes:    readVariationAxes(fontData, 0),
 
-	log.Printf("Font loaded: %s", key)
-	return nil
+		paletteTypes: readPaletteTypes(fontData, 0),
+		tables:       readTableValues(fontData, 0),
+	}, nil
 }
 
 // LoadFontFromCollection はTTCファイルからフォントを読み込みます
@@ -113,33 +167,80 @@ func (r *Renderer) LoadFontFromCollection(family, style string, ttcData []byte,
 		return nil
 	}
 
+	ff, err := parseCollectionFace(ttcData, index)
+	if err != nil {
+		return err
+	}
+	ff.Family, ff.Style = family, style
+	ff.setAspect()
+	r.addFace(key, ff)
+
+	log.Printf("Font loaded from TTC: %s", key)
+	return nil
+}
+
+// parseCollectionFace は TTC の index 番目のフォントを解析してフェイスを作成します
+func parseCollectionFace(ttcData []byte, index int) (*FontFace, error) {
 	sfntCollection, err := sfnt.ParseCollection(ttcData)
 	if err != nil {
-		return fmt.Errorf("failed to parse TTC for SFNT: %w", err)
+		return nil, fmt.Errorf("failed to parse TTC for SFNT: %w", err)
 	}
 	sfntFont, err := sfntCollection.Font(index)
 	if err != nil {
-		return fmt.Errorf("failed to get SFNT font %d: %w", index, err)
+		return nil, fmt.Errorf("failed to get SFNT font %d: %w", index, err)
 	}
 
 	otCollection, err := opentype.ParseCollection(ttcData)
 	if err != nil {
-		return fmt.Errorf("failed to parse TTC for OpenType: %w", err)
+		return nil, fmt.Errorf("failed to parse TTC for OpenType: %w", err)
 	}
 	otFont, err := otCollection.Font(index)
 	if err != nil {
-		return fmt.Errorf("failed to get OpenType font %d: %w", index, err)
+		return nil, fmt.Errorf("failed to get OpenType font %d: %w", index, err)
 	}
 
-	r.fonts[key] = &FontFace{
-		Family: family,
-		Style:  style,
-		Font:   sfntFont,
-		OTFont: otFont,
+	return &FontFace{
+		metrics: &faceMetrics{},
+		Font:    sfntFont,
+		OTFont:  otFont,
+		TSFont:  parseShapingFont(ttcData, index),
+		Axes:    readVariationAxes(ttcData, index),
+
+		paletteTypes: readPaletteTypes(ttcData, index),
+		tables:       readTableValues(ttcData, index),
+	}, nil
+}
+
+// parseFaceAt はフォントファイル（TTF/OTF/TTC/WOFF/WOFF2）の index 番目のフォントを解析します
+func parseFaceAt(data []byte, index int) (*FontFace, error) {
+	data, err := decodeWebFont(data)
+	if err != nil {
+		return nil, err
 	}
+	if bytes.HasPrefix(data, []byte("ttcf")) {
+		return parseCollectionFace(data, index)
+	}
+	if index != 0 {
+		return nil, fmt.Errorf("font %d not found in a single font file", index)
+	}
+	return parseFace(data)
+}
 
-	log.Printf("Font loaded from TTC: %s", key)
-	return nil
+// setAspect はスタイル名からフォント照合用の太さ・幅・傾きを設定します
+func (ff *FontFace) setAspect() {
+	q := ParseStyleName(ff.Style)
+	ff.Weight, ff.Stretch, ff.Slope = q.Weight, q.Stretch, q.Slope
+}
+
+// parseShapingFont はシェーピング用にフォントを解析します
+// 解析できない場合は nil を返し、描画は x/image/font の経路にフォールバックします
+func parseShapingFont(data []byte, index int) *tsfont.Font {
+	faces, err := tsfont.ParseTTC(bytes.NewReader(data))
+	if err != nil || index >= len(faces) {
+		log.Printf("Warning: font cannot be used for shaping: %v", err)
+		return nil
+	}
+	return faces[index].Font
 }
 
 // GetFont は指定されたキーのフォントを取得します
@@ -156,6 +257,17 @@ func (r *Renderer) GetFont(family, style string) (*FontFace, error) {
 // x, y はSVGのテキストベースライン位置（ピクセル座標）
 func (r *Renderer) RenderText(text, family, style string, fontSize float64, target *image.RGBA, x, y float64, col color.Color) error {
 	ff := r.FindFont(family, style)
+	if ff != nil {
+		ff.load()
+	}
+	if ff != nil && ff.TSFont != nil {
+		run, err := r.Shape(text, ff, fontSize, ShapeOptions{})
+		if err != nil {
+			return err
+		}
+		r.DrawGlyphRun(run, target, x, y, col)
+		return nil
+	}
 	if ff != nil {
 		return r.renderWithOpenType(text, ff, fontSize, target, x, y, col)
 	}
@@ -165,22 +277,25 @@ func (r *Renderer) RenderText(text, family, style string, fontSize float64, targ
 
 // renderWithOpenType はOpenTypeフォントでテキストを描画します
 func (r *Renderer) renderWithOpenType(text string, ff *FontFace, fontSize float64, target *image.RGBA, x, y float64, col color.Color) error {
-	face, err := opentype.NewFace(ff.OTFont, &opentype.FaceOptions{
-		Size:    fontSize,
-		DPI:     96,
-		Hinting: xfont.HintingFull,
-	})
+	face, err := r.cache.xface(ff, fontSize, r.hinting)
 	if err != nil {
 		return fmt.Errorf("failed to create font face: %w", err)
 	}
-	defer face.Close()
+	face.mu.Lock()
+	defer face.mu.Unlock()
+	if r.noSubpixel || r.hinting == HintingFull {
+		x = math.Round(x)
+	}
+	if r.hinting != HintingNone {
+		y = math.Round(y)
+	}
 
 	// SVGのy属性はベースライン位置を示す
 	// font.Drawer の Dot.Y もベースライン位置なので、そのまま使用する
 	d := &xfont.Drawer{
 		Dst:  target,
 		Src:  image.NewUniform(col),
-		Face: face,
+		Face: face.face,
 		Dot: fixed.Point26_6{
 			X: fixed.Int26_6(x * 64),
 			Y: fixed.Int26_6(y * 64),
@@ -213,24 +328,77 @@ func (r *Renderer) renderWithBasicFont(text string, fontSize float64, target *im
 }
 
 // FindFont はファミリ名とスタイルからフォントを探します
+// スタイル名を太さ・幅・傾きに変換し、MatchFont で最も近いフェイスを選びます
 // 見つからない場合は nil を返します（basicfont フォールバックを示す）
 func (r *Renderer) FindFont(family, style string) *FontFace {
-	key := fmt.Sprintf("%s-%s", family, style)
-	if ff, exists := r.fonts[key]; exists {
+	if ff, exists := r.fonts[family+"-"+style]; exists {
 		return ff
 	}
-	keyReg := fmt.Sprintf("%s-Regular", family)
-	if ff, exists := r.fonts[keyReg]; exists {
-		return ff
+	return r.MatchFont(family, ParseStyleName(style))
+}
+
+// HasGlyph はフォントが文字のグリフを持つか（cmap に登録されているか）を返します
+// 未読み込みのフェイスはフォントデータを読み込まずにインデックスの収録文字で判断します
+func (ff *FontFace) HasGlyph(r rune) bool {
+	if l := ff.lazy; l != nil && !l.loaded.Load() {
+		return l.coverage.contains(r)
 	}
-	// 部分一致（前方一致、大文字小文字区別なし）
-	lowerFamily := strings.ToLower(family)
-	for k, ff := range r.fonts {
-		if strings.HasPrefix(strings.ToLower(k), lowerFamily+"-") {
-			return ff
-		}
+	if ff.TSFont != nil {
+		_, ok := ff.TSFont.NominalGlyph(r)
+		return ok
+	}
+	if ff.Font != nil {
+		gid, err := ff.Font.GlyphIndex(nil, r)
+		return err == nil && gid != 0
+	}
+	return false
+}
+
+// Faces は読み込み済みの全フォントをキー順に返します
+// フォールバック探索の最終段で、順序を決定的にするためにソートしています
+// 一覧は登録時に更新したものを共有して返すため、呼び出し側で変更してはいけません
+func (r *Renderer) Faces() []*FontFace {
+	return r.faceList
+}
+
+// familyFaces は小文字のファミリ名のフェイスをキー順に返します（呼び出し側で変更してはいけません）
+func (r *Renderer) familyFaces(lower string) []*FontFace {
+	return r.families[lower]
+}
+
+// addFace はフェイスを key で登録し、キー順の一覧とファミリの索引を更新します
+// 照合のたびにソートしないよう、登録時に挿入位置を二分探索で求めます
+func (r *Renderer) addFace(key string, ff *FontFace) {
+	i, found := slices.BinarySearch(r.faceKeys, key)
+	if found {
+		r.removeFace(key)
+	}
+	r.fonts[key] = ff
+	r.faceKeys = slices.Insert(r.faceKeys, i, key)
+	r.faceList = slices.Insert(r.faceList, i, ff)
+
+	lower := strings.ToLower(ff.Family)
+	faces := r.families[lower]
+	j := sort.Search(len(faces), func(j int) bool { return faces[j].Family+"-"+faces[j].Style >= key })
+	r.families[lower] = slices.Insert(faces, j, ff)
+}
+
+// removeFace は key のフェイスを一覧と索引から取り除きます
+func (r *Renderer) removeFace(key string) {
+	ff, ok := r.fonts[key]
+	if !ok {
+		return
+	}
+	delete(r.fonts, key)
+	if i, found := slices.BinarySearch(r.faceKeys, key); found {
+		r.faceKeys = slices.Delete(r.faceKeys, i, i+1)
+		r.faceList = slices.Delete(r.faceList, i, i+1)
+	}
+	lower := strings.ToLower(ff.Family)
+	r.families[lower] = slices.DeleteFunc(r.families[lower], func(f *FontFace) bool { return f == ff })
+	if len(r.families[lower]) == 0 {
+		delete(r.families, lower)
 	}
-	return nil
 }
 
 // MeasureText はテキストの描画幅を計算します
@@ -240,22 +408,27 @@ func (r *Renderer) MeasureText(text, family, style string, fontSize float64) (fl
 	if ff == nil {
 		return 0, fmt.Errorf("font not found: %s %s", family, style)
 	}
+	ff.load()
+	if ff.TSFont != nil {
+		run, err := r.Shape(text, ff, fontSize, ShapeOptions{})
+		if err != nil {
+			return 0, err
+		}
+		return run.Advance, nil
+	}
 	return r.measureWithOpenType(text, ff, fontSize)
 }
 
 // measureWithOpenType はOpenTypeフォントでテキスト幅を計算します
 func (r *Renderer) measureWithOpenType(text string, ff *FontFace, fontSize float64) (float64, error) {
-	face, err := opentype.NewFace(ff.OTFont, &opentype.FaceOptions{
-		Size:    fontSize,
-		DPI:     96,
-		Hinting: xfont.HintingFull,
-	})
+	face, err := r.cache.xface(ff, fontSize, r.hinting)
 	if err != nil {
 		return 0, err
 	}
-	defer face.Close()
+	face.mu.Lock()
+	defer face.mu.Unlock()
 
-	d := &xfont.Drawer{Face: face}
+	d := &xfont.Drawer{Face: face.face}
 	advance := d.MeasureString(text)
 	return float64(advance) / 64.0, nil
 }
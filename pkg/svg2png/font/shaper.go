@@ -0,0 +1,532 @@
+package font
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-text/typesetting/di"
+	tsfont "github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+	"github.com/go-text/typesetting/language"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// FontFeature は OpenType フィーチャーの設定（font-feature-settings の1項目）です
+type FontFeature struct {
+	Tag   string // 4文字のフィーチャータグ（例: "liga", "kern"）
+	Value uint32 // 0 で無効、1 以上で有効（代替字形の番号）
+}
+
+// ShapeOptions はシェーピングの設定を表します
+type ShapeOptions struct {
+	Features      []FontFeature // font-feature-settings
+	Kerning       string        // font-kerning: "auto" | "normal" | "none"
+	LetterSpacing float64       // letter-spacing（ピクセル）。0 以外の場合は任意合字を無効化します
+	WordSpacing   float64       // word-spacing（ピクセル）。単語区切りの文字（空白など）の送り幅に加算します
+	Direction     string        // "ltr" | "rtl"。空の場合はスクリプトから判定します
+	Vertical      bool          // 縦書き（上から下へ）でレイアウトします
+	Sideways      bool          // 縦書きで字形を90度回転して横組みします（Vertical 指定時のみ有効）
+
+	// 可変フォントの軸に対応付ける値（0 の場合はフォント既定のインスタンス）
+	Weight      float64         // font-weight（wght 軸）
+	Stretch     float64         // font-stretch の百分率（wdth 軸）
+	Slope       string          // font-style: "italic" / "oblique"（ital または slnt 軸）
+	OpticalSize float64         // CSS ピクセル単位のフォントサイズ（opsz 軸）
+	Variations  []FontVariation // font-variation-settings（上記より優先）
+
+	// フェイスに足りない太さ・傾きの合成（FontFace.Synthesis で判定します）
+	SyntheticBold    bool    // アウトラインを太らせる（送り幅は変えません）
+	SyntheticOblique float64 // 斜体の傾き（度。0 の場合は傾けない）
+
+	// text-rendering（"geometricPrecision" は格子に合わせず、"optimizeSpeed" はグリフの原点を整数ピクセルに合わせます）
+	TextRendering string
+}
+
+// ShapedGlyph はシェーピング済みの1グリフを表します
+// 値はピクセル単位で、y は下向きです
+type ShapedGlyph struct {
+	ID       uint32
+	Cluster  int // 対応する元テキストのルーン位置
+	XAdvance float64
+	YAdvance float64
+	XOffset  float64
+	YOffset  float64
+}
+
+// GlyphRun は単一フォントでシェーピングされたグリフ列（視覚順）です
+// 縦書きの正立（upright）では送り幅は YAdvance に入り、原点は字面の上辺中央です
+// 横倒し（sideways）では横組みの結果を保持し、Outline で時計回りに90度回転します
+type GlyphRun struct {
+	Face     *FontFace
+	Size     float64 // ピクセル単位の em サイズ
+	Glyphs   []ShapedGlyph
+	Advance  float64 // 進行方向の送り幅の合計（ピクセル）
+	RTL      bool
+	Vertical bool
+	Sideways bool
+
+	ascent, descent float64 // 横倒し時の中央揃えに使う（ピクセル、いずれも正の値）
+	stretch         float64 // 進行方向のグリフの拡大率（0 は等倍）
+	embolden        float64 // 合成する太字でアウトラインを外側へ移動する量（フォント単位）
+	skew            float64 // 合成する斜体の傾き（tan。フォント単位の y に掛けて x に加える）
+	snapInline      bool    // グリフの原点を進行方向に整数ピクセルへ丸める（サブピクセル位置を使わない）
+	snapCross       bool    // ベースライン（縦書きでは中央線）を整数ピクセルへ丸める
+
+	color      []colorKind // カラーで描画するグリフ（カラーグリフがない場合は nil）
+	strikePpem uint16      // カラービットマップに使うストライクの ppem
+
+	shared     *sharedFace  // シェーピングとアウトライン取得に使う共有フェイス
+	cache      *Cache       // アウトラインとマスクのキャッシュ（nil の場合はキャッシュしない）
+	variations string       // 軸の値（キャッシュのキー）
+	face       *tsfont.Face // カラーグリフの描画用（並行使用不可のため GlyphRun ごとに保持。カラーグリフがない場合は nil）
+}
+
+// OutlineSink はグリフアウトラインの出力先です（vector.Rasterizer が満たします）
+type OutlineSink interface {
+	MoveTo(x, y float32)
+	LineTo(x, y float32)
+	QuadTo(x1, y1, x, y float32)
+	CubeTo(x1, y1, x2, y2, x, y float32)
+	ClosePath()
+}
+
+// shaperPool は HarfbuzzShaper を再利用します（HarfbuzzShaper は並行使用不可）
+var shaperPool = sync.Pool{
+	New: func() any { return &shaping.HarfbuzzShaper{} },
+}
+
+// 任意合字のフィーチャー（letter-spacing 指定時は CSS Text の規定どおり無効化する）
+var optionalLigatures = []string{"liga", "clig", "dlig", "hlig", "calt"}
+
+// Shape はテキストを GSUB/GPOS でシェーピングしてグリフ列を返します
+// fontSize は RenderText と同じく 96DPI 基準のポイント単位です
+func (r *Renderer) Shape(text string, ff *FontFace, fontSize float64, opts ShapeOptions) (*GlyphRun, error) {
+	if ff != nil {
+		ff.load()
+	}
+	if ff == nil || ff.TSFont == nil {
+		return nil, fmt.Errorf("font has no shaping data")
+	}
+	runes := []rune(text)
+	var variations []tsfont.Variation
+	if len(ff.Axes) > 0 {
+		variations = variationsFor(ff, opts)
+	}
+	shared := r.cache.face(ff, variations)
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	face := shared.face
+	upem := float64(ff.TSFont.Upem())
+
+	// HarfbuzzShaper はサイズを整数ピクセルに丸めるため、em = upem で
+	// シェーピングしてフォント単位の結果を得てから実サイズに換算する
+	input := shaping.Input{
+		Text:         runes,
+		RunStart:     0,
+		RunEnd:       len(runes),
+		Direction:    di.DirectionLTR,
+		Face:         face,
+		Size:         fixed.I(int(upem)),
+		Script:       detectScript(runes),
+		FontFeatures: buildFeatures(opts),
+	}
+	switch opts.Direction {
+	case "rtl":
+		input.Direction = di.DirectionRTL
+	case "ltr":
+	default:
+		if isRTLScript(input.Script) {
+			input.Direction = di.DirectionRTL
+		}
+	}
+	upright := opts.Vertical && !opts.Sideways
+	if upright {
+		// vmtx/vhea があれば縦書きメトリクスを使い、vert/vrt2 が適用される
+		input.Direction = di.DirectionTTB
+		input.Direction.SetSideways(false)
+	}
+
+	var shaper *shaping.HarfbuzzShaper
+	if len(ff.Axes) > 0 {
+		// HarfbuzzShaper はフォントを最初の軸の値のままキャッシュするため、可変フォントでは使い回さない
+		shaper = &shaping.HarfbuzzShaper{}
+	} else {
+		shaper = shaperPool.Get().(*shaping.HarfbuzzShaper)
+		defer shaperPool.Put(shaper)
+	}
+	// スクリプトごとにシェーピングし（前後の文字は文脈として渡す）、視覚順に連結する
+	var glyphs []shaping.Glyph
+	for _, sr := range scriptRuns(runes) {
+		input.RunStart, input.RunEnd, input.Script = sr.start, sr.end, sr.script
+		out := shaper.Shape(input)
+		if input.Direction.Progression() == di.TowardTopLeft {
+			glyphs = append(out.Glyphs, glyphs...)
+		} else {
+			glyphs = append(glyphs, out.Glyphs...)
+		}
+	}
+
+	pxSize := fontSize * 96.0 / 72.0
+	scale := pxSize / upem
+	run := &GlyphRun{
+		Face:       ff,
+		Size:       pxSize,
+		Glyphs:     make([]ShapedGlyph, len(glyphs)),
+		RTL:        !upright && input.Direction.Progression() == di.TowardTopLeft,
+		Vertical:   opts.Vertical,
+		Sideways:   opts.Vertical && opts.Sideways,
+		shared:     shared,
+		cache:      r.cache,
+		variations: variationKey(variations),
+	}
+	if opts.SyntheticBold {
+		// FreeType の FT_GlyphSlot_Embolden と同じく em の 1/24 だけ太らせる（片側はその半分）
+		run.embolden = upem / 48
+	}
+	if opts.SyntheticOblique != 0 {
+		run.skew = math.Tan(opts.SyntheticOblique * math.Pi / 180)
+	}
+	hinting, subpixel := r.glyphPlacement(opts.TextRendering)
+	run.snapInline = !subpixel
+	run.snapCross = hinting != HintingNone
+	if ext, ok := face.FontHExtents(); ok {
+		run.ascent = float64(ext.Ascender) * scale
+		run.descent = -float64(ext.Descender) * scale
+	}
+	for i, g := range glyphs {
+		sg := ShapedGlyph{
+			ID:       uint32(g.GlyphID),
+			Cluster:  g.ClusterIndex,
+			XAdvance: fixedToFloat(g.XAdvance) * scale,
+			YAdvance: -fixedToFloat(g.YAdvance) * scale,
+			XOffset:  fixedToFloat(g.XOffset) * scale,
+			YOffset:  -fixedToFloat(g.YOffset) * scale,
+		}
+		// letter-spacing と word-spacing はクラスタの末尾グリフに加算する
+		if i == len(glyphs)-1 || glyphs[i+1].ClusterIndex != g.ClusterIndex {
+			spacing := opts.LetterSpacing
+			if g.ClusterIndex < len(runes) && isWordSeparator(runes[g.ClusterIndex]) {
+				spacing += opts.WordSpacing
+			}
+			if upright {
+				sg.YAdvance += spacing
+			} else {
+				sg.XAdvance += spacing
+			}
+		}
+		if hinting == HintingFull {
+			// 計測と描画が一致するよう、送り幅自体を整数ピクセルに丸める
+			sg.XAdvance, sg.YAdvance = math.Round(sg.XAdvance), math.Round(sg.YAdvance)
+		}
+		run.Glyphs[i] = sg
+		if upright {
+			run.Advance += sg.YAdvance
+		} else {
+			run.Advance += sg.XAdvance
+		}
+	}
+	// 横倒しのカラーグリフは回転できないため、アウトラインで描画する
+	if !run.Sideways && ff.HasColorGlyphs() {
+		run.face = tsfont.NewFace(ff.TSFont)
+		if len(variations) > 0 {
+			run.face.SetVariations(variations)
+		}
+		run.markColorGlyphs()
+	}
+	return run, nil
+}
+
+// Outline はグリフ列のアウトラインを (x, y) を原点として sink に出力します
+// 横書きではベースライン上、縦書きでは中央線上の位置が原点です
+// カラーグリフは出力しません（ColorLayers で描画します）
+func (run *GlyphRun) Outline(x, y float64, sink OutlineSink) {
+	scale := run.Size / float64(run.Face.TSFont.Upem())
+	penX, penY := x, y
+	if run.Sideways {
+		// 横組みの結果を (0, 中央線) 基準で配置し、時計回りに90度回転して (x, y) に置く
+		sink = &rotateSink{sink: sink, x: float32(x), y: float32(y)}
+		penX, penY = 0, (run.ascent-run.descent)/2
+	}
+	sx, sy := run.glyphScale(scale)
+	for i, g := range run.Glyphs {
+		ox, oy := run.snapOrigin(penX+g.XOffset, penY+g.YOffset)
+		if segs, ok := run.cache.outline(run.shared, run.outlineKey(g.ID)); ok && !run.isColor(i) {
+			emitSegments(run.synthesize(segs), ox, oy, sx, sy, sink)
+		}
+		penX += g.XAdvance
+		penY += g.YAdvance
+	}
+}
+
+// GlyphOutline は i 番目のグリフのアウトラインを、ペン位置を原点として sink に出力します
+// グリフごとに変形して配置する場合（textPath など）に使用します
+func (run *GlyphRun) GlyphOutline(i int, sink OutlineSink) {
+	g := run.Glyphs[i]
+	if segs, ok := run.cache.outline(run.shared, run.outlineKey(g.ID)); ok {
+		sx, sy := run.glyphScale(run.Size / float64(run.Face.TSFont.Upem()))
+		emitSegments(run.synthesize(segs), g.XOffset, g.YOffset, sx, sy, sink)
+	}
+}
+
+// rotateSink は座標を時計回りに90度回転して (x, y) に平行移動します（y 下向き座標系）
+type rotateSink struct {
+	sink OutlineSink
+	x, y float32
+}
+
+func (s *rotateSink) pt(u, v float32) (float32, float32) { return s.x - v, s.y + u }
+
+func (s *rotateSink) MoveTo(u, v float32) { s.sink.MoveTo(s.pt(u, v)) }
+func (s *rotateSink) LineTo(u, v float32) { s.sink.LineTo(s.pt(u, v)) }
+func (s *rotateSink) QuadTo(u1, v1, u, v float32) {
+	x1, y1 := s.pt(u1, v1)
+	x, y := s.pt(u, v)
+	s.sink.QuadTo(x1, y1, x, y)
+}
+func (s *rotateSink) CubeTo(u1, v1, u2, v2, u, v float32) {
+	x1, y1 := s.pt(u1, v1)
+	x2, y2 := s.pt(u2, v2)
+	x, y := s.pt(u, v)
+	s.sink.CubeTo(x1, y1, x2, y2, x, y)
+}
+func (s *rotateSink) ClosePath() { s.sink.ClosePath() }
+
+// SidewaysRunes は縦書きの text-orientation: mixed における各文字の向きを返します
+// Unicode の Vertical_Orientation（UAX #50）に従い、横倒しにする文字で true になります
+func SidewaysRunes(text []rune) []bool {
+	sideways := make([]bool, len(text))
+	if len(text) == 0 {
+		return sideways
+	}
+	var seg shaping.Segmenter
+	input := shaping.Input{Text: text, RunStart: 0, RunEnd: len(text), Direction: di.DirectionTTB}
+	for _, run := range seg.Split(input, noFaceMap{}) {
+		for i := run.RunStart; i < run.RunEnd; i++ {
+			sideways[i] = run.Direction.IsSideways()
+		}
+	}
+	return sideways
+}
+
+// noFaceMap はフォントによる分割を行わないための Fontmap です
+type noFaceMap struct{}
+
+func (noFaceMap) ResolveFace(rune) *tsfont.Face { return nil }
+
+// emitSegments はフォント単位（y 上向き）のセグメントをピクセル座標に変換して出力します
+// sx, sy は横・縦方向の拡大率です
+func emitSegments(segs []ot.Segment, ox, oy, sx, sy float64, sink OutlineSink) {
+	pt := func(p ot.SegmentPoint) (float32, float32) {
+		return float32(ox + float64(p.X)*sx), float32(oy - float64(p.Y)*sy)
+	}
+	open := false
+	for _, seg := range segs {
+		a := seg.Args
+		switch seg.Op {
+		case ot.SegmentOpMoveTo:
+			if open {
+				sink.ClosePath()
+			}
+			x, y := pt(a[0])
+			sink.MoveTo(x, y)
+			open = true
+		case ot.SegmentOpLineTo:
+			x, y := pt(a[0])
+			sink.LineTo(x, y)
+		case ot.SegmentOpQuadTo:
+			x1, y1 := pt(a[0])
+			x, y := pt(a[1])
+			sink.QuadTo(x1, y1, x, y)
+		case ot.SegmentOpCubeTo:
+			x1, y1 := pt(a[0])
+			x2, y2 := pt(a[1])
+			x, y := pt(a[2])
+			sink.CubeTo(x1, y1, x2, y2, x, y)
+		}
+	}
+	if open {
+		sink.ClosePath()
+	}
+}
+
+// DrawGlyphRun はグリフ列をターゲット画像に描画します
+// x, y はベースライン上の描画開始位置（ピクセル座標）です
+func (r *Renderer) DrawGlyphRun(run *GlyphRun, target *image.RGBA, x, y float64, col color.Color) {
+	var bb boundsSink
+	run.Outline(x, y, &bb)
+	rect := bb.rect().Intersect(target.Bounds())
+	if rect.Empty() {
+		return
+	}
+	rz := vector.NewRasterizer(rect.Dx(), rect.Dy())
+	run.Outline(x-float64(rect.Min.X), y-float64(rect.Min.Y), rz)
+	rz.Draw(target, rect, image.NewUniform(col), image.Point{})
+}
+
+// boundsSink はアウトラインの制御点を含む外接矩形を記録します
+type boundsSink struct {
+	minX, minY, maxX, maxY float32
+	any                    bool
+}
+
+func (b *boundsSink) add(x, y float32) {
+	if !b.any {
+		b.minX, b.minY, b.maxX, b.maxY = x, y, x, y
+		b.any = true
+		return
+	}
+	b.minX = min(b.minX, x)
+	b.minY = min(b.minY, y)
+	b.maxX = max(b.maxX, x)
+	b.maxY = max(b.maxY, y)
+}
+
+func (b *boundsSink) MoveTo(x, y float32)         { b.add(x, y) }
+func (b *boundsSink) LineTo(x, y float32)         { b.add(x, y) }
+func (b *boundsSink) QuadTo(x1, y1, x, y float32) { b.add(x1, y1); b.add(x, y) }
+func (b *boundsSink) CubeTo(x1, y1, x2, y2, x, y float32) {
+	b.add(x1, y1)
+	b.add(x2, y2)
+	b.add(x, y)
+}
+func (b *boundsSink) ClosePath() {}
+
+// rect はアンチエイリアス分の余白を含めた整数矩形を返します
+func (b *boundsSink) rect() image.Rectangle {
+	if !b.any {
+		return image.Rectangle{}
+	}
+	return image.Rect(
+		int(math.Floor(float64(b.minX)))-1, int(math.Floor(float64(b.minY)))-1,
+		int(math.Ceil(float64(b.maxX)))+1, int(math.Ceil(float64(b.maxY)))+1,
+	)
+}
+
+// OutlineBounds は outline が出力するアウトラインの外接矩形（余白なし）を返します
+// テキストの objectBoundingBox に使います
+func OutlineBounds(outline func(sink OutlineSink)) image.Rectangle {
+	var bb boundsSink
+	outline(&bb)
+	if !bb.any {
+		return image.Rectangle{}
+	}
+	return image.Rect(
+		int(math.Floor(float64(bb.minX))), int(math.Floor(float64(bb.minY))),
+		int(math.Ceil(float64(bb.maxX))), int(math.Ceil(float64(bb.maxY))),
+	)
+}
+
+// ParseFeatureSettings は font-feature-settings の値を解析します
+// 例: `"liga" 0, "smcp", "ss01" on`
+func ParseFeatureSettings(value string) []FontFeature {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "normal" {
+		return nil
+	}
+	var features []FontFeature
+	for _, item := range strings.Split(value, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		tag := strings.Trim(fields[0], `"'`)
+		if len(tag) != 4 {
+			continue
+		}
+		f := FontFeature{Tag: tag, Value: 1}
+		if len(fields) > 1 {
+			switch fields[1] {
+			case "on":
+				f.Value = 1
+			case "off":
+				f.Value = 0
+			default:
+				if v, err := strconv.ParseUint(fields[1], 10, 32); err == nil {
+					f.Value = uint32(v)
+				}
+			}
+		}
+		features = append(features, f)
+	}
+	return features
+}
+
+// buildFeatures はシェーピングオプションから HarfBuzz に渡すフィーチャー列を作ります
+// 後に指定したものが優先されるため、font-feature-settings は最後に追加します
+func buildFeatures(opts ShapeOptions) []shaping.FontFeature {
+	var features []shaping.FontFeature
+	if opts.Kerning == "none" {
+		features = append(features, shaping.FontFeature{Tag: ot.MustNewTag("kern"), Value: 0})
+	}
+	if opts.LetterSpacing != 0 {
+		for _, tag := range optionalLigatures {
+			features = append(features, shaping.FontFeature{Tag: ot.MustNewTag(tag), Value: 0})
+		}
+	}
+	for _, f := range opts.Features {
+		features = append(features, shaping.FontFeature{Tag: ot.MustNewTag(f.Tag), Value: f.Value})
+	}
+	return features
+}
+
+// isWordSeparator は CSS Text の単語区切り文字（word-spacing を加える文字）かを返します
+func isWordSeparator(r rune) bool {
+	switch r {
+	case ' ', '\u00A0', '\u1361', '\U00010100', '\U00010101', '\U0001039F', '\U0001091F':
+		return true
+	}
+	return false
+}
+
+// detectScript はテキスト中の最初の固有スクリプトを返します
+func detectScript(runes []rune) language.Script {
+	for _, r := range runes {
+		if s := language.LookupScript(r); s.Strong() && s != language.Unknown {
+			return s
+		}
+	}
+	return language.Latin
+}
+
+// scriptRun は同じスクリプトの連続した文字の範囲です
+type scriptRun struct {
+	start, end int
+	script     language.Script
+}
+
+// scriptRuns はテキストをスクリプトの変わる位置で分割します
+// 共通文字（空白・数字・記号など）と結合文字は直前の文字のスクリプトに含め、先頭の共通文字は最初のスクリプトに含めます
+func scriptRuns(runes []rune) []scriptRun {
+	runs := []scriptRun{{script: detectScript(runes)}}
+	for i, r := range runes {
+		s := language.LookupScript(r)
+		if s.Strong() && s != language.Unknown && s != runs[len(runs)-1].script {
+			runs[len(runs)-1].end = i
+			runs = append(runs, scriptRun{start: i, script: s})
+		}
+	}
+	runs[len(runs)-1].end = len(runes)
+	return runs
+}
+
+// isRTLScript は右から左に書くスクリプトかを返します
+func isRTLScript(s language.Script) bool {
+	switch s {
+	case language.Arabic, language.Hebrew, language.Syriac, language.Thaana,
+		language.Nko, language.Adlam, language.Mandaic, language.Samaritan:
+		return true
+	}
+	return false
+}
+
+// fixedToFloat は 26.6 固定小数点値を float64 に変換します
+func fixedToFloat(v fixed.Int26_6) float64 {
+	return float64(v) / 64.0
+}
@@ -0,0 +1,121 @@
+package font
+
+import (
+	"math"
+
+	ot "github.com/go-text/typesetting/font/opentype"
+)
+
+// ============================================================
+// 太字・斜体の合成（font-synthesis）
+// ============================================================
+
+// DefaultObliqueAngle は角度を指定しない oblique を合成するときの傾き（度）です
+const DefaultObliqueAngle = 14
+
+// Synthesis は要求に対してフェイスに足りない太さ・傾きを返します
+// CSS Fonts Level 4 に沿って、600 以上の太さを求められたが 600 未満のフェイスしかない場合に太字を、
+// italic / oblique を求められたが傾いたフェイスがない場合に斜体を合成します（可変フォントは軸の範囲で判定します）
+func (ff *FontFace) Synthesis(q FontQuery) (bold, oblique bool) {
+	if _, hi := ff.weightRange(); q.Weight >= 600 && hi < 600 {
+		bold = true
+	}
+	if q.Slope == "italic" || q.Slope == "oblique" {
+		oblique = !ff.hasSlope("italic") && !ff.hasSlope("oblique")
+	}
+	return bold, oblique
+}
+
+// synthesize は合成する太字・斜体をフォント単位のアウトラインに適用します
+// 合成しない場合は segs をそのまま返します
+func (run *GlyphRun) synthesize(segs []ot.Segment) []ot.Segment {
+	if run.embolden == 0 && run.skew == 0 {
+		return segs
+	}
+	out := make([]ot.Segment, len(segs))
+	copy(out, segs)
+	if run.embolden != 0 {
+		emboldenSegments(out, run.embolden)
+	}
+	if run.skew != 0 {
+		for i := range out {
+			args := out[i].ArgsSlice()
+			for j := range args {
+				args[j].X += float32(float64(args[j].Y) * run.skew)
+			}
+		}
+	}
+	return out
+}
+
+// emboldenSegments はアウトラインの各点を塗りの外側へ strength（フォント単位）だけ移動して太らせます
+// FreeType の FT_Outline_Embolden と同様に、制御点を含む点列を輪郭ごとの多角形とみなして
+// 隣り合う辺の法線の和の方向へ移動します。塗りの外側は輪郭全体の向き（面積の符号）で決めます
+func emboldenSegments(segs []ot.Segment, strength float64) {
+	// 輪郭ごとの点（Args の要素へのポインタ）
+	var contours [][]*ot.SegmentPoint
+	for i := range segs {
+		seg := &segs[i]
+		if seg.Op == ot.SegmentOpMoveTo || len(contours) == 0 {
+			contours = append(contours, nil)
+		}
+		n := len(contours) - 1
+		for j := range seg.ArgsSlice() {
+			contours[n] = append(contours[n], &seg.Args[j])
+		}
+	}
+
+	area := 0.0
+	for _, c := range contours {
+		for i := range c {
+			a, b := c[i], c[(i+1)%len(c)]
+			area += float64(a.X)*float64(b.Y) - float64(b.X)*float64(a.Y)
+		}
+	}
+	// y 上向きの座標で、時計回り（面積が負）の輪郭は進行方向の左側が外側
+	side := 1.0
+	if area > 0 {
+		side = -1
+	}
+
+	for _, c := range contours {
+		moved := make([][2]float64, len(c))
+		for i, p := range c {
+			prev := neighbourPoint(c, i, -1)
+			next := neighbourPoint(c, i, 1)
+			if prev == nil || next == nil {
+				moved[i] = [2]float64{float64(p.X), float64(p.Y)}
+				continue
+			}
+			n1x, n1y := unitNormal(prev, p, side)
+			n2x, n2y := unitNormal(p, next, side)
+			// 法線の和を 1 + cos で割ると、両側の辺から strength だけ離れた点になる（鋭角では制限する）
+			d := math.Max(1+n1x*n2x+n1y*n2y, 0.5)
+			moved[i] = [2]float64{
+				float64(p.X) + (n1x+n2x)/d*strength,
+				float64(p.Y) + (n1y+n2y)/d*strength,
+			}
+		}
+		for i, p := range c {
+			p.X, p.Y = float32(moved[i][0]), float32(moved[i][1])
+		}
+	}
+}
+
+// neighbourPoint は輪郭上で i から dir 方向にある、i と異なる位置の点を返します（ない場合は nil）
+func neighbourPoint(c []*ot.SegmentPoint, i, dir int) *ot.SegmentPoint {
+	for k := 1; k < len(c); k++ {
+		q := c[((i+dir*k)%len(c)+len(c))%len(c)]
+		if q.X != c[i].X || q.Y != c[i].Y {
+			return q
+		}
+	}
+	return nil
+}
+
+// unitNormal は辺 a→b の外側を向く単位法線を返します
+func unitNormal(a, b *ot.SegmentPoint, side float64) (float64, float64) {
+	dx, dy := float64(b.X-a.X), float64(b.Y-a.Y)
+	l := math.Hypot(dx, dy)
+	return -dy / l * side, dx / l * side
+}
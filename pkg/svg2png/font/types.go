@@ -3,7 +3,7 @@ package font
 // FontSource はフォントの供給源を表します
 type FontSource struct {
 	Family string // ファミリ名（例: "Noto Sans CJK JP"）
-	Style  string // "Regular","Italic","Bold","BoldItalic"
+	Style  string // "Regular","Italic","Bold","BoldItalic" のほか "Light","SemiBold Italic","Condensed Bold" など
 	Data   []byte // TTF/OTF (任意: メモリ登録用)
 	Path   string // ファイル登録用（Data or Path のいずれか）
 }
@@ -0,0 +1,114 @@
+package font
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	tsfont "github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+	"github.com/go-text/typesetting/font/opentype/tables"
+)
+
+// ============================================================
+// 可変フォント
+// ============================================================
+
+// VariationAxis は可変フォントの変形軸（fvar）です
+type VariationAxis struct {
+	Tag               string
+	Min, Default, Max float64
+}
+
+// FontVariation は変形軸の設定（font-variation-settings の1項目）です
+type FontVariation struct {
+	Tag   string  // 4文字の軸タグ（例: "wght", "wdth"）
+	Value float64 // デザイン空間の値
+}
+
+// axis は指定タグの変形軸を返します
+func (ff *FontFace) axis(tag string) (VariationAxis, bool) {
+	for _, a := range ff.Axes {
+		if a.Tag == tag {
+			return a, true
+		}
+	}
+	return VariationAxis{}, false
+}
+
+// readVariationAxes はフォントの fvar テーブルから変形軸を読み取ります
+// 可変フォントでない場合は nil を返します
+func readVariationAxes(data []byte, index int) []VariationAxis {
+	loaders, err := ot.NewLoaders(bytes.NewReader(data))
+	if err != nil || index >= len(loaders) {
+		return nil
+	}
+	raw, err := loaders[index].RawTable(ot.MustNewTag("fvar"))
+	if err != nil {
+		return nil
+	}
+	fvar, _, err := tables.ParseFvar(raw)
+	if err != nil {
+		return nil
+	}
+	axes := make([]VariationAxis, len(fvar.FvarRecords.Axis))
+	for i, a := range fvar.FvarRecords.Axis {
+		axes[i] = VariationAxis{Tag: a.Tag.String(), Min: float64(a.Minimum), Default: float64(a.Default), Max: float64(a.Maximum)}
+	}
+	return axes
+}
+
+// ParseVariationSettings は font-variation-settings の値を解析します
+// 例: `"wght" 650, "wdth" 80`
+func ParseVariationSettings(value string) []FontVariation {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "normal" {
+		return nil
+	}
+	var variations []FontVariation
+	for _, item := range strings.Split(value, ",") {
+		fields := strings.Fields(item)
+		if len(fields) != 2 {
+			continue
+		}
+		tag := strings.Trim(fields[0], `"'`)
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if len(tag) != 4 || err != nil {
+			continue
+		}
+		variations = append(variations, FontVariation{Tag: tag, Value: v})
+	}
+	return variations
+}
+
+// variationsFor はシェーピング設定から可変フォントの軸の値を決めます
+// font-weight / font-stretch / font-style / フォントサイズを標準の軸に対応付け、
+// font-variation-settings で指定した軸はそれより優先します
+func variationsFor(ff *FontFace, opts ShapeOptions) []tsfont.Variation {
+	var out []tsfont.Variation
+	add := func(tag string, value float64) {
+		out = append(out, tsfont.Variation{Tag: ot.MustNewTag(tag), Value: float32(value)})
+	}
+	if opts.Weight > 0 {
+		add("wght", opts.Weight)
+	}
+	if opts.Stretch > 0 {
+		add("wdth", opts.Stretch)
+	}
+	_, hasItal := ff.axis("ital")
+	_, hasSlnt := ff.axis("slnt")
+	switch {
+	case opts.Slope == "italic" && hasItal, opts.Slope == "oblique" && hasItal && !hasSlnt:
+		add("ital", 1)
+	case opts.Slope == "italic" || opts.Slope == "oblique":
+		// oblique の既定角度 14deg（slnt は反時計回りが正）
+		add("slnt", -14)
+	}
+	if opts.OpticalSize > 0 {
+		add("opsz", opts.OpticalSize)
+	}
+	for _, v := range opts.Variations {
+		add(v.Tag, v.Value)
+	}
+	return out
+}
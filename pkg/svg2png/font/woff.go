@@ -0,0 +1,709 @@
+package font
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/shinya/svg2png/pkg/svg2png/limits"
+)
+
+// ============================================================
+// WOFF / WOFF2
+// ============================================================
+
+// maxWebFontSize はシステムフォントと登録フォントの展開後のサイズの上限です（壊れたファイルによる過大な確保を防ぐ）
+// @font-face のフォントは Limits.MaxFontBytes で制限します
+const maxWebFontSize = 256 << 20
+
+// sfntTable は sfnt を組み立てるためのテーブルです
+type sfntTable struct {
+	tag  string
+	data []byte
+}
+
+// decodeWebFont は WOFF / WOFF2 を maxWebFontSize までの大きさで展開します
+func decodeWebFont(data []byte) ([]byte, error) {
+	return DecodeWebFont(data, maxWebFontSize)
+}
+
+// DecodeWebFont は WOFF / WOFF2 を展開して TTF/OTF のバイト列を返します
+// それ以外のデータはそのまま返します。
+// 展開後の大きさが maxSize バイトを超える場合は、テーブルを展開する前に *limits.Error を返します（負の値は制限しません）
+func DecodeWebFont(data []byte, maxSize int64) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("wOFF")):
+		out, err := decodeWOFF(data, maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode WOFF: %w", err)
+		}
+		return out, nil
+	case bytes.HasPrefix(data, []byte("wOF2")):
+		out, err := decodeWOFF2(data, maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode WOFF2: %w", err)
+		}
+		return out, nil
+	}
+	if err := limits.Check("font bytes", maxSize, int64(len(data))); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// decodeWOFF は WOFF 1.0（テーブルごとの zlib 圧縮）を展開します
+func decodeWOFF(data []byte, maxSize int64) ([]byte, error) {
+	if len(data) < 44 {
+		return nil, fmt.Errorf("truncated header")
+	}
+	flavor := binary.BigEndian.Uint32(data[4:])
+	numTables := int(binary.BigEndian.Uint16(data[12:]))
+	if len(data) < 44+numTables*20 {
+		return nil, fmt.Errorf("truncated table directory")
+	}
+	tables := make([]sfntTable, 0, numTables)
+	total := 0
+	for i := 0; i < numTables; i++ {
+		rec := data[44+i*20:]
+		tag := string(rec[:4])
+		offset := int(binary.BigEndian.Uint32(rec[4:]))
+		compLength := int(binary.BigEndian.Uint32(rec[8:]))
+		origLength := int(binary.BigEndian.Uint32(rec[12:]))
+		if offset < 0 || compLength < 0 || offset+compLength > len(data) || compLength > origLength {
+			return nil, fmt.Errorf("table %q out of bounds", tag)
+		}
+		total += origLength
+		if err := limits.Check("font bytes", maxSize, int64(total)); err != nil {
+			return nil, err
+		}
+		raw := data[offset : offset+compLength]
+		if compLength < origLength {
+			zr, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				return nil, fmt.Errorf("table %q: %w", tag, err)
+			}
+			raw = make([]byte, origLength)
+			_, err = io.ReadFull(zr, raw)
+			zr.Close()
+			if err != nil {
+				return nil, fmt.Errorf("table %q: %w", tag, err)
+			}
+		}
+		tables = append(tables, sfntTable{tag, raw})
+	}
+	return buildSFNT(flavor, tables), nil
+}
+
+// woff2KnownTags は WOFF2 のテーブルディレクトリで番号で表すタグです
+var woff2KnownTags = [63]string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post", "cvt ", "fpgm",
+	"glyf", "loca", "prep", "CFF ", "VORG", "EBDT", "EBLC", "gasp", "hdmx", "kern",
+	"LTSH", "PCLT", "VDMX", "vhea", "vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC",
+	"JSTF", "MATH", "CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+	"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar", "gvar", "hsty",
+	"just", "lcar", "mort", "morx", "opbd", "prop", "trak", "Zapf", "Silf", "Glat",
+	"Gloc", "Feat", "Sill",
+}
+
+// woff2Entry は WOFF2 のテーブルディレクトリの1項目です
+type woff2Entry struct {
+	tag             string
+	origLength      int
+	transformed     bool
+	transformLength int
+}
+
+// decodeWOFF2 は WOFF2（Brotli 圧縮と glyf/loca/hmtx の変換）を展開します
+func decodeWOFF2(data []byte, maxSize int64) ([]byte, error) {
+	if len(data) < 48 {
+		return nil, fmt.Errorf("truncated header")
+	}
+	flavor := binary.BigEndian.Uint32(data[4:])
+	if flavor == 0x74746366 { // 'ttcf'
+		return nil, fmt.Errorf("font collections are not supported")
+	}
+	numTables := int(binary.BigEndian.Uint16(data[12:]))
+	compressedSize := int(binary.BigEndian.Uint32(data[20:]))
+
+	r := &woffReader{data: data, pos: 48}
+	entries := make([]woff2Entry, numTables)
+	total := 0
+	for i := range entries {
+		flags, err := r.u8()
+		if err != nil {
+			return nil, err
+		}
+		e := &entries[i]
+		if flags&0x3f == 0x3f {
+			b, err := r.bytes(4)
+			if err != nil {
+				return nil, err
+			}
+			e.tag = string(b)
+		} else {
+			e.tag = woff2KnownTags[flags&0x3f]
+		}
+		if e.origLength, err = r.base128(); err != nil {
+			return nil, err
+		}
+		// glyf/loca は変換版 0 が変換あり（3 が無変換）、その他は 0 が無変換
+		version := flags >> 6
+		if e.tag == "glyf" || e.tag == "loca" {
+			e.transformed = version == 0
+		} else {
+			e.transformed = version != 0
+		}
+		e.transformLength = e.origLength
+		if e.transformed {
+			if e.transformLength, err = r.base128(); err != nil {
+				return nil, err
+			}
+		}
+		total += e.transformLength
+		if err := limits.Check("font bytes", maxSize, int64(total)); err != nil {
+			return nil, err
+		}
+	}
+
+	compressed, err := r.bytes(compressedSize)
+	if err != nil {
+		return nil, err
+	}
+	stream := make([]byte, total)
+	if _, err := io.ReadFull(brotli.NewReader(bytes.NewReader(compressed)), stream); err != nil {
+		return nil, fmt.Errorf("brotli: %w", err)
+	}
+
+	raw := make(map[string][]byte, numTables)
+	offset := 0
+	for _, e := range entries {
+		raw[e.tag] = stream[offset : offset+e.transformLength]
+		offset += e.transformLength
+	}
+
+	tables := make([]sfntTable, 0, numTables)
+	var glyf, loca []byte
+	var xMins []int16
+	for _, e := range entries {
+		if e.tag == "glyf" && e.transformed {
+			if glyf, loca, xMins, err = reconstructGlyf(raw["glyf"]); err != nil {
+				return nil, fmt.Errorf("glyf: %w", err)
+			}
+			break
+		}
+	}
+	for _, e := range entries {
+		table := raw[e.tag]
+		switch {
+		case !e.transformed:
+		case e.tag == "glyf":
+			table = glyf
+		case e.tag == "loca":
+			if loca == nil {
+				return nil, fmt.Errorf("transformed loca without transformed glyf")
+			}
+			table = loca
+		case e.tag == "hmtx":
+			if table, err = reconstructHmtx(table, raw["hhea"], xMins); err != nil {
+				return nil, fmt.Errorf("hmtx: %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown transform for table %q", e.tag)
+		}
+		tables = append(tables, sfntTable{e.tag, table})
+	}
+	return buildSFNT(flavor, tables), nil
+}
+
+// reconstructGlyf は変換済みの glyf テーブルから glyf と loca を復元します
+// hmtx の復元のため、各グリフの xMin も返します
+func reconstructGlyf(data []byte) (glyf, loca []byte, xMins []int16, err error) {
+	if len(data) < 36 {
+		return nil, nil, nil, fmt.Errorf("truncated header")
+	}
+	optionFlags := binary.BigEndian.Uint16(data[2:])
+	numGlyphs := int(binary.BigEndian.Uint16(data[4:]))
+	indexFormat := binary.BigEndian.Uint16(data[6:])
+
+	// 7つのサブストリーム（輪郭数・点数・フラグ・グリフ・複合グリフ・バウンディングボックス・命令）
+	var streams [7]*woffReader
+	offset := 36
+	for i := range streams {
+		size := int(binary.BigEndian.Uint32(data[8+i*4:]))
+		if size < 0 || offset+size > len(data) {
+			return nil, nil, nil, fmt.Errorf("substream %d out of bounds", i)
+		}
+		streams[i] = &woffReader{data: data[offset : offset+size]}
+		offset += size
+	}
+	nContourStream, nPointsStream, flagStream, glyphStream := streams[0], streams[1], streams[2], streams[3]
+	compositeStream, bboxStream, instructionStream := streams[4], streams[5], streams[6]
+
+	var overlapBitmap []byte
+	if optionFlags&1 != 0 {
+		n := (numGlyphs + 7) / 8
+		if offset+n > len(data) {
+			return nil, nil, nil, fmt.Errorf("truncated overlap bitmap")
+		}
+		overlapBitmap = data[offset : offset+n]
+	}
+	bboxBitmap, err := bboxStream.bytes((numGlyphs + 31) / 32 * 4)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	hasBit := func(bitmap []byte, i int) bool {
+		return bitmap != nil && bitmap[i>>3]&(0x80>>(i&7)) != 0
+	}
+
+	var out bytes.Buffer
+	offsets := make([]int, numGlyphs+1)
+	xMins = make([]int16, numGlyphs)
+	for i := 0; i < numGlyphs; i++ {
+		offsets[i] = out.Len()
+		nContours, err := nContourStream.u16()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		var bbox [4]int16
+		explicitBBox := hasBit(bboxBitmap, i)
+		if explicitBBox {
+			for j := range bbox {
+				v, err := bboxStream.u16()
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				bbox[j] = int16(v)
+			}
+		}
+
+		switch c := int16(nContours); {
+		case c == 0:
+			// 空のグリフ
+		case c > 0:
+			glyph, err := decodeSimpleGlyph(int(c), nPointsStream, flagStream, glyphStream, instructionStream, hasBit(overlapBitmap, i))
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("glyph %d: %w", i, err)
+			}
+			if explicitBBox {
+				for j, v := range bbox {
+					binary.BigEndian.PutUint16(glyph[2+j*2:], uint16(v))
+				}
+			}
+			xMins[i] = int16(binary.BigEndian.Uint16(glyph[2:]))
+			out.Write(glyph)
+		default:
+			if !explicitBBox {
+				return nil, nil, nil, fmt.Errorf("glyph %d: composite glyph without bounding box", i)
+			}
+			glyph, err := decodeCompositeGlyph(compositeStream, glyphStream, instructionStream)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("glyph %d: %w", i, err)
+			}
+			var header [10]byte
+			binary.BigEndian.PutUint16(header[0:], nContours)
+			for j, v := range bbox {
+				binary.BigEndian.PutUint16(header[2+j*2:], uint16(v))
+			}
+			xMins[i] = bbox[0]
+			out.Write(header[:])
+			out.Write(glyph)
+		}
+		for out.Len()%4 != 0 {
+			out.WriteByte(0)
+		}
+	}
+	offsets[numGlyphs] = out.Len()
+
+	if indexFormat == 0 {
+		loca = make([]byte, (numGlyphs+1)*2)
+		for i, o := range offsets {
+			binary.BigEndian.PutUint16(loca[i*2:], uint16(o/2))
+		}
+	} else {
+		loca = make([]byte, (numGlyphs+1)*4)
+		for i, o := range offsets {
+			binary.BigEndian.PutUint32(loca[i*4:], uint32(o))
+		}
+	}
+	return out.Bytes(), loca, xMins, nil
+}
+
+// decodeSimpleGlyph は単純グリフを復元し、ヘッダー（バウンディングボックスは点から計算）を含む glyf の形式で返します
+func decodeSimpleGlyph(nContours int, nPointsStream, flagStream, glyphStream, instructionStream *woffReader, overlap bool) ([]byte, error) {
+	endPts := make([]uint16, nContours)
+	nPoints := 0
+	for i := range endPts {
+		n, err := nPointsStream.u255()
+		if err != nil {
+			return nil, err
+		}
+		nPoints += n
+		if nPoints > 0xffff {
+			return nil, fmt.Errorf("too many points")
+		}
+		endPts[i] = uint16(nPoints - 1)
+	}
+	tripletFlags, err := flagStream.bytes(nPoints)
+	if err != nil {
+		return nil, err
+	}
+
+	xs, ys := make([]int, nPoints), make([]int, nPoints)
+	onCurve := make([]bool, nPoints)
+	x, y := 0, 0
+	for i, flag := range tripletFlags {
+		onCurve[i] = flag>>7 == 0
+		dx, dy, err := decodeTriplet(flag&0x7f, glyphStream)
+		if err != nil {
+			return nil, err
+		}
+		x, y = x+dx, y+dy
+		xs[i], ys[i] = x, y
+	}
+	instructionLength, err := glyphStream.u255()
+	if err != nil {
+		return nil, err
+	}
+	instructions, err := instructionStream.bytes(instructionLength)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	put16 := func(v int) { out.WriteByte(byte(v >> 8)); out.WriteByte(byte(v)) }
+	put16(nContours)
+	xMin, yMin, xMax, yMax := 0, 0, 0, 0
+	for i := range xs {
+		if i == 0 || xs[i] < xMin {
+			xMin = xs[i]
+		}
+		if i == 0 || xs[i] > xMax {
+			xMax = xs[i]
+		}
+		if i == 0 || ys[i] < yMin {
+			yMin = ys[i]
+		}
+		if i == 0 || ys[i] > yMax {
+			yMax = ys[i]
+		}
+	}
+	put16(xMin)
+	put16(yMin)
+	put16(xMax)
+	put16(yMax)
+	for _, e := range endPts {
+		put16(int(e))
+	}
+	put16(instructionLength)
+	out.Write(instructions)
+
+	// 座標は差分で、1バイトに収まる値は短い形式で書く
+	var xData, yData bytes.Buffer
+	prevX, prevY := 0, 0
+	for i := range xs {
+		var flag byte
+		if onCurve[i] {
+			flag |= 0x01
+		}
+		if i == 0 && overlap {
+			flag |= 0x40
+		}
+		flag |= encodeDelta(xs[i]-prevX, 0x02, 0x10, &xData)
+		flag |= encodeDelta(ys[i]-prevY, 0x04, 0x20, &yData)
+		prevX, prevY = xs[i], ys[i]
+		out.WriteByte(flag)
+	}
+	out.Write(xData.Bytes())
+	out.Write(yData.Bytes())
+	return out.Bytes(), nil
+}
+
+// encodeDelta は座標の差分を glyf の形式で書き込み、対応するフラグを返します
+func encodeDelta(d int, short, same byte, buf *bytes.Buffer) byte {
+	switch {
+	case d == 0:
+		return same
+	case d > 0 && d < 256:
+		buf.WriteByte(byte(d))
+		return short | same
+	case d < 0 && d > -256:
+		buf.WriteByte(byte(-d))
+		return short
+	}
+	buf.WriteByte(byte(d >> 8))
+	buf.WriteByte(byte(d))
+	return 0
+}
+
+// decodeTriplet は WOFF2 の三つ組符号化の座標差分を読み取ります
+func decodeTriplet(flag byte, r *woffReader) (dx, dy int, err error) {
+	withSign := func(flag byte, v int) int {
+		if flag&1 != 0 {
+			return v
+		}
+		return -v
+	}
+	var n int
+	switch {
+	case flag < 84:
+		n = 1
+	case flag < 120:
+		n = 2
+	case flag < 124:
+		n = 3
+	default:
+		n = 4
+	}
+	b, err := r.bytes(n)
+	if err != nil {
+		return 0, 0, err
+	}
+	f := int(flag)
+	switch {
+	case flag < 10:
+		dy = withSign(flag, (f&14)<<7+int(b[0]))
+	case flag < 20:
+		dx = withSign(flag, ((f-10)&14)<<7+int(b[0]))
+	case flag < 84:
+		b0, b1 := f-20, int(b[0])
+		dx = withSign(flag, 1+(b0&0x30)+(b1>>4))
+		dy = withSign(flag>>1, 1+(b0&0x0c)<<2+(b1&0x0f))
+	case flag < 120:
+		b0 := f - 84
+		dx = withSign(flag, 1+(b0/12)<<8+int(b[0]))
+		dy = withSign(flag>>1, 1+((b0%12)>>2)<<8+int(b[1]))
+	case flag < 124:
+		dx = withSign(flag, int(b[0])<<4+int(b[1])>>4)
+		dy = withSign(flag>>1, (int(b[1])&0x0f)<<8+int(b[2]))
+	default:
+		dx = withSign(flag, int(b[0])<<8+int(b[1]))
+		dy = withSign(flag>>1, int(b[2])<<8+int(b[3]))
+	}
+	return dx, dy, nil
+}
+
+// decodeCompositeGlyph は複合グリフの構成要素と命令を復元します（ヘッダーは含みません）
+func decodeCompositeGlyph(compositeStream, glyphStream, instructionStream *woffReader) ([]byte, error) {
+	const (
+		argsAreWords     = 0x0001
+		haveScale        = 0x0008
+		moreComponents   = 0x0020
+		haveXYScale      = 0x0040
+		haveTwoByTwo     = 0x0080
+		haveInstructions = 0x0100
+	)
+	start := compositeStream.pos
+	hasInstructions := false
+	for {
+		flags, err := compositeStream.u16()
+		if err != nil {
+			return nil, err
+		}
+		size := 2 // glyphIndex
+		if flags&argsAreWords != 0 {
+			size += 4
+		} else {
+			size += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			size += 2
+		case flags&haveXYScale != 0:
+			size += 4
+		case flags&haveTwoByTwo != 0:
+			size += 8
+		}
+		if _, err := compositeStream.bytes(size); err != nil {
+			return nil, err
+		}
+		hasInstructions = hasInstructions || flags&haveInstructions != 0
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+	out := append([]byte(nil), compositeStream.data[start:compositeStream.pos]...)
+	if hasInstructions {
+		n, err := glyphStream.u255()
+		if err != nil {
+			return nil, err
+		}
+		instructions, err := instructionStream.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, byte(n>>8), byte(n))
+		out = append(out, instructions...)
+	}
+	return out, nil
+}
+
+// reconstructHmtx は変換済みの hmtx テーブルを復元します（省略された左サイドベアリングはグリフの xMin）
+func reconstructHmtx(data, hhea []byte, xMins []int16) ([]byte, error) {
+	if len(hhea) < 36 || len(data) < 1 {
+		return nil, fmt.Errorf("missing hhea")
+	}
+	if xMins == nil {
+		return nil, fmt.Errorf("transformed hmtx without transformed glyf")
+	}
+	numGlyphs := len(xMins)
+	numHMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	if numHMetrics < 1 || numHMetrics > numGlyphs {
+		return nil, fmt.Errorf("invalid numberOfHMetrics %d", numHMetrics)
+	}
+	flags := data[0]
+	r := &woffReader{data: data, pos: 1}
+	advances, err := r.bytes(numHMetrics * 2)
+	if err != nil {
+		return nil, err
+	}
+	readLSBs := func(from, to int, omitted bool) ([]byte, error) {
+		out := make([]byte, (to-from)*2)
+		for i := from; i < to; i++ {
+			if omitted {
+				binary.BigEndian.PutUint16(out[(i-from)*2:], uint16(xMins[i]))
+			} else {
+				v, err := r.u16()
+				if err != nil {
+					return nil, err
+				}
+				binary.BigEndian.PutUint16(out[(i-from)*2:], v)
+			}
+		}
+		return out, nil
+	}
+	lsbs, err := readLSBs(0, numHMetrics, flags&1 != 0)
+	if err != nil {
+		return nil, err
+	}
+	monoLSBs, err := readLSBs(numHMetrics, numGlyphs, flags&2 != 0)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, numHMetrics*4+len(monoLSBs))
+	for i := 0; i < numHMetrics; i++ {
+		out = append(out, advances[i*2:i*2+2]...)
+		out = append(out, lsbs[i*2:i*2+2]...)
+	}
+	return append(out, monoLSBs...), nil
+}
+
+// buildSFNT はテーブルから sfnt（TTF/OTF）を組み立てます
+func buildSFNT(flavor uint32, tables []sfntTable) []byte {
+	sort.Slice(tables, func(i, j int) bool { return tables[i].tag < tables[j].tag })
+	n := len(tables)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= n {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	header := make([]byte, 12+n*16)
+	binary.BigEndian.PutUint32(header[0:], flavor)
+	binary.BigEndian.PutUint16(header[4:], uint16(n))
+	binary.BigEndian.PutUint16(header[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(header[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(header[10:], uint16(n*16-searchRange))
+
+	var body bytes.Buffer
+	for i, t := range tables {
+		rec := header[12+i*16:]
+		copy(rec, t.tag)
+		binary.BigEndian.PutUint32(rec[4:], tableChecksum(t.data))
+		binary.BigEndian.PutUint32(rec[8:], uint32(len(header)+body.Len()))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(t.data)))
+		body.Write(t.data)
+		for body.Len()%4 != 0 {
+			body.WriteByte(0)
+		}
+	}
+	return append(header, body.Bytes()...)
+}
+
+// tableChecksum は sfnt のテーブルのチェックサムを計算します
+func tableChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// woffReader は WOFF2 のストリームを読み取ります
+type woffReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *woffReader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *woffReader) u8() (byte, error) {
+	b, err := r.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *woffReader) u16() (uint16, error) {
+	b, err := r.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+// base128 は UIntBase128 形式の整数を読み取ります
+func (r *woffReader) base128() (int, error) {
+	v := 0
+	for i := 0; i < 5; i++ {
+		b, err := r.u8()
+		if err != nil {
+			return 0, err
+		}
+		if i == 0 && b == 0x80 {
+			return 0, fmt.Errorf("invalid UIntBase128")
+		}
+		if v > (maxWebFontSize >> 7) {
+			return 0, fmt.Errorf("UIntBase128 overflow")
+		}
+		v = v<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid UIntBase128")
+}
+
+// u255 は 255UInt16 形式の整数を読み取ります
+func (r *woffReader) u255() (int, error) {
+	code, err := r.u8()
+	if err != nil {
+		return 0, err
+	}
+	switch code {
+	case 253:
+		v, err := r.u16()
+		return int(v), err
+	case 254:
+		b, err := r.u8()
+		return int(b) + 253*2, err
+	case 255:
+		b, err := r.u8()
+		return int(b) + 253, err
+	}
+	return int(code), nil
+}
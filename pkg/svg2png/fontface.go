@@ -0,0 +1,157 @@
+package svg2png
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
+	"github.com/shinya/svg2png/pkg/svg2png/font"
+	"github.com/shinya/svg2png/pkg/svg2png/parser"
+	"github.com/shinya/svg2png/pkg/svg2png/style"
+)
+
+// ============================================================
+// @font-face
+// ============================================================
+
+// loadDocumentFonts は文書の <style> にある @font-face を読み込み、文書用のフォントセットを返します
+// @font-face がない場合は base をそのまま返します。読み込めなかったフォントは警告に記録します。
+// 読み込むフォントのバイト数の合計が Limits.MaxFontBytes を超える場合は *LimitError を返します
+func loadDocumentFonts(doc *parser.Document, base *font.Renderer, opts Options, diag *Diagnostics) (*font.Renderer, error) {
+	var rules []style.FontFaceRule
+	for _, css := range doc.StyleSheets {
+		rules = append(rules, style.ParseFontFaces(css)...)
+	}
+	if len(rules) == 0 {
+		return base, nil
+	}
+
+	budget := &fontBudget{max: opts.Limits.Resolve().MaxFontBytes}
+	scoped := base.Scoped()
+	for _, rule := range rules {
+		q := font.FontQuery{Weight: rule.Weight, Stretch: rule.Stretch, Slope: rule.Style}
+		if err := loadFontFace(scoped, base, rule, q, opts, budget); err != nil {
+			var le *LimitError
+			if errors.As(err, &le) {
+				return nil, err
+			}
+			diag.warn(diagnostic.CodeFontFace, &ResourceError{Op: "@font-face", Resource: fmt.Sprintf("%q", rule.Family), Err: err})
+		}
+	}
+	return scoped, nil
+}
+
+// fontBudget は文書の @font-face で読み込んだフォントのバイト数を数えます
+type fontBudget struct {
+	max  int64 // 負の値は制限なし
+	used int64
+}
+
+// decode は WOFF / WOFF2 を展開して、展開後の大きさを加算します
+// 合計が上限を超える場合は、展開する前に *LimitError を返します
+func (b *fontBudget) decode(data []byte) ([]byte, error) {
+	remaining := int64(-1)
+	if b.max >= 0 {
+		remaining = b.max - b.used
+	}
+	out, err := font.DecodeWebFont(data, remaining)
+	var le *LimitError
+	if errors.As(err, &le) {
+		return nil, &LimitError{Limit: le.Limit, Max: b.max, Actual: b.used + le.Actual}
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.used += int64(len(out))
+	return out, nil
+}
+
+// loadFontFace は src を先頭から順に試し、最初に読み込めたフォントを登録します
+// フォントのバイト数が上限を超えた場合は、残りの src を試さずに *LimitError を返します
+func loadFontFace(scoped, base *font.Renderer, rule style.FontFaceRule, q font.FontQuery, opts Options, budget *fontBudget) error {
+	var errs []string
+	for _, src := range rule.Sources {
+		if src.Local != "" {
+			if ff := base.LocalFont(src.Local); ff != nil {
+				scoped.AddDocumentFace(rule.Family, q, ff)
+				return nil
+			}
+			errs = append(errs, fmt.Sprintf("local(%q): not installed", src.Local))
+			continue
+		}
+		switch src.Format {
+		case "embedded-opentype", "svg":
+			errs = append(errs, fmt.Sprintf("format(%q): not supported", src.Format))
+			continue
+		}
+		data, err := fetchFontURL(src.URL, opts)
+		if err == nil {
+			data, err = budget.decode(data)
+			var le *LimitError
+			if errors.As(err, &le) {
+				return err
+			}
+		}
+		if err == nil {
+			err = scoped.AddDocumentFont(rule.Family, q, data)
+		}
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", shortURL(src.URL), err))
+	}
+	return fmt.Errorf("no usable source (%s)", strings.Join(errs, "; "))
+}
+
+// fetchFontURL は url() の内容を取得します
+// data URI は直接デコードし、それ以外は Options.ResolveURL に任せます
+func fetchFontURL(rawURL string, opts Options) ([]byte, error) {
+	if strings.HasPrefix(strings.ToLower(rawURL), "data:") {
+		return decodeDataURI(rawURL)
+	}
+	if opts.ResolveURL == nil {
+		return nil, fmt.Errorf("external URL not loaded (set Options.ResolveURL)")
+	}
+	return opts.ResolveURL(rawURL)
+}
+
+// decodeDataURI は data URI（data:[<mediatype>][;base64],<data>）をデコードします
+func decodeDataURI(uri string) ([]byte, error) {
+	header, payload, ok := strings.Cut(uri[len("data:"):], ",")
+	if !ok {
+		return nil, fmt.Errorf("malformed data URI")
+	}
+	if !strings.HasSuffix(strings.ToLower(header), ";base64") {
+		s, err := url.PathUnescape(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed data URI: %w", err)
+		}
+		return []byte(s), nil
+	}
+	// スタイルシート中の改行や空白を取り除く
+	payload = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, payload)
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("malformed base64 in data URI: %w", err)
+	}
+	return data, nil
+}
+
+// shortURL は診断用に長い data URI を省略します
+func shortURL(u string) string {
+	if len(u) > 48 {
+		return u[:48] + "..."
+	}
+	return u
+}
@@ -0,0 +1,61 @@
+package svg2png
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Format は RenderTo で書き出す画像の形式です
+type Format int
+
+const (
+	FormatPNG  Format = iota // PNG（透過を保持します）
+	FormatJPEG               // JPEG（品質は既定の 75。透過部分は黒になるため Options.Background の指定を推奨します）
+)
+
+// String は形式の名前を返します
+func (f Format) String() string {
+	switch f {
+	case FormatPNG:
+		return "png"
+	case FormatJPEG:
+		return "jpeg"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// FormatForPath はファイル名の拡張子から形式を判定します（.png / .jpg / .jpeg。大文字小文字は区別しません）
+func FormatForPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return FormatPNG, nil
+	case ".jpg", ".jpeg":
+		return FormatJPEG, nil
+	}
+	return 0, fmt.Errorf("unsupported output format: %q", filepath.Ext(path))
+}
+
+// encodeImage は画像を format の形式で w に書き出します（書き出しの失敗は *ResourceError で返します）
+func encodeImage(w io.Writer, img image.Image, format Format) error {
+	if b := img.Bounds(); b.Empty() {
+		return fmt.Errorf("cannot encode an empty image (%dx%d)", b.Dx(), b.Dy())
+	}
+	var err error
+	switch format {
+	case FormatPNG:
+		err = png.Encode(w, img)
+	case FormatJPEG:
+		err = jpeg.Encode(w, img, nil)
+	default:
+		return fmt.Errorf("unsupported output format: %v", format)
+	}
+	if err != nil {
+		return &ResourceError{Op: "write", Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package limits
+
+import "fmt"
+
+// ============================================================
+// 信頼できない入力に対する資源の上限
+// ============================================================
+
+// Limits は1回の描画で使う資源の上限です
+// 0 の項目は既定値（Default）を使い、負の値の項目は制限しません
+type Limits struct {
+	MaxPixels       int64 // 出力画像の画素数（幅×高さ）
+	MaxElements     int   // 文書の要素数
+	MaxDepth        int   // 要素の入れ子の深さ
+	MaxPathSegments int   // path の d と polyline / polygon の points のコマンド・座標の数の合計
+	MaxFilterArea   int64 // フィルターの処理量（プリミティブごとの画素数の合計。ぼかしは画素数×カーネルの長さ）
+	MaxTextLength   int   // テキストの文字数（ルーン数）の合計
+	MaxTextArea     int64 // テキストの描画量（グリフごとの em ボックスの画素数の合計）
+	MaxFontBytes    int64 // @font-face で読み込むフォントのバイト数の合計（WOFF / WOFF2 は展開後の大きさ）
+	// MaxUseExpansion は <use> の参照を展開したときに複製される要素数の合計です
+	// <use> は描画しない（未対応として診断に記録する）ため、この上限はパース時に指数的な展開や
+	// 循環参照を持つ悪意のある文書を前もって拒否するためだけに使います
+	MaxUseExpansion int
+}
+
+// Default は既定の上限です
+var Default = Limits{
+	MaxPixels:       1 << 26, // 8192×8192
+	MaxElements:     200000,
+	MaxDepth:        256,
+	MaxPathSegments: 1000000,
+	MaxFilterArea:   1 << 31,
+	MaxTextLength:   1000000,
+	MaxTextArea:     1 << 34,
+	MaxFontBytes:    64 << 20,
+	MaxUseExpansion: 100000,
+}
+
+// Resolve は 0 の項目を既定値で埋めた上限を返します
+func (l Limits) Resolve() Limits {
+	if l.MaxPixels == 0 {
+		l.MaxPixels = Default.MaxPixels
+	}
+	if l.MaxElements == 0 {
+		l.MaxElements = Default.MaxElements
+	}
+	if l.MaxDepth == 0 {
+		l.MaxDepth = Default.MaxDepth
+	}
+	if l.MaxPathSegments == 0 {
+		l.MaxPathSegments = Default.MaxPathSegments
+	}
+	if l.MaxFilterArea == 0 {
+		l.MaxFilterArea = Default.MaxFilterArea
+	}
+	if l.MaxTextLength == 0 {
+		l.MaxTextLength = Default.MaxTextLength
+	}
+	if l.MaxTextArea == 0 {
+		l.MaxTextArea = Default.MaxTextArea
+	}
+	if l.MaxFontBytes == 0 {
+		l.MaxFontBytes = Default.MaxFontBytes
+	}
+	if l.MaxUseExpansion == 0 {
+		l.MaxUseExpansion = Default.MaxUseExpansion
+	}
+	return l
+}
+
+// Error は上限を超えたことを表すエラーです
+// Actual は上限を超えたと判明した時点の値で、入力全体の値とは限りません
+type Error struct {
+	Limit  string // "pixels" | "elements" | "depth" | "path segments" | "filter area" | "text length" | "text area" | "font bytes" | "use expansion"
+	Max    int64
+	Actual int64
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("limit exceeded: %s %d > %d", e.Limit, e.Actual, e.Max)
+}
+
+// Check は actual が max を超えていれば *Error を返します（max が負の場合は制限しません）
+func Check(limit string, max, actual int64) error {
+	if max >= 0 && actual > max {
+		return &Error{Limit: limit, Max: max, Actual: actual}
+	}
+	return nil
+}
@@ -1,11 +1,17 @@
 package parser
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
+	"github.com/shinya/svg2png/pkg/svg2png/limits"
 )
 
 // Document はSVGドキュメントを表します
@@ -16,6 +22,8 @@ type Document struct {
 	Height  string
 	DPI     float64
 	Defs    *Defs
+	StyleSheets []string // <style> 要素の内容（文書順）
+	Diagnostics []diagnostic.Entry // パース中に記録した診断（解釈できない viewBox・未対応のフィルタープリミティブなど）
 }
 
 // Element はSVG要素を表します
@@ -23,7 +31,52 @@ type Element struct {
 	Name       string
 	Attributes map[string]string
 	Children   []*Element
-	Text       string
+	Text       string // 文字データを TrimSpace して連結したもの（互換性のために残す）
+	Content    []Node // 文字データと子要素を出現順に保持した混在コンテンツ
+	Parent     *Element // 親要素（ルートは nil）
+	Line       int      // 開始タグの行（1 始まり）
+	Column     int      // 開始タグの列（1 始まり）
+
+	nth int // 同名の兄弟の中での順番（1 始まり）
+}
+
+// Path は要素の位置を "/svg/g[2]/text[1]" の形式で返します（添字は同名の兄弟の中での順番）
+func (e *Element) Path() string {
+	if e.Parent == nil {
+		return "/" + e.Name
+	}
+	return fmt.Sprintf("%s/%s[%d]", e.Parent.Path(), e.Name, e.nth)
+}
+
+// Location は診断に使う要素の位置を返します（e が nil の場合はゼロ値）
+func (e *Element) Location() diagnostic.Location {
+	if e == nil {
+		return diagnostic.Location{}
+	}
+	return diagnostic.Location{Element: e.Path(), ID: e.Attributes["id"], Line: e.Line, Column: e.Column}
+}
+
+// ParseError はSVGの構文エラーです
+type ParseError struct {
+	Line   int // エラーを検出した行（1 始まり）
+	Column int // エラーを検出した列（1 始まり）
+	Msg    string
+	Err    error // 元のエラー（*xml.SyntaxError など。ない場合は nil）
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("failed to parse SVG at %d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Node は混在コンテンツの1要素（文字データまたは子要素）を表します
+// Elem が nil の場合は Text が生の文字データ（空白を含む）です
+type Node struct {
+	Text string
+	Elem *Element
 }
 
 // ViewBox はSVGのviewBox属性を表します
@@ -38,6 +91,8 @@ type Defs struct {
 	ClipPaths       map[string]*Element // clipPath要素（子要素ごとレンダリングに使う）
 	Patterns        map[string]*Element // pattern要素
 	Filters         map[string]*FilterDef
+	Paths           map[string]*Element // id を持つ path 要素（文書全体。textPath の参照先）
+	Shapes          map[string]*Element // id を持つ rect / polygon 要素（文書全体。shape-inside の参照先）
 }
 
 // FilterDef はSVGフィルター定義を表します
@@ -81,17 +136,34 @@ type RadialGradient struct {
 	Stops         []GradientStop
 }
 
+// xmlNamespace は xml: 接頭辞に対応する名前空間URIです
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
 // ParseSVG はSVGデータをパースします
 func ParseSVG(data []byte) (*Document, error) {
-	decoder := xml.NewDecoder(strings.NewReader(string(data)))
+	return Parse(bytes.NewReader(data))
+}
+
+// Parse は r からSVGを読み込みながらパースします
+// 入力は字句単位で読み進めるため、全体を文字列に複製しません（上限は既定値を使います）
+func Parse(r io.Reader) (*Document, error) {
+	return ParseWithLimits(r, limits.Limits{})
+}
+
+// ParseWithLimits は要素数・深さ・パスのセグメント数・テキストの長さ・<use> の展開数に上限を設けてパースします
+// 上限を超えた時点で読み込みをやめ、*limits.Error を返します。構文エラーは位置つきの *ParseError を返します
+func ParseWithLimits(r io.Reader, lim limits.Limits) (*Document, error) {
+	ps := &parseState{lim: lim.Resolve(), input: &inputReader{r: r}}
+	decoder := xml.NewDecoder(ps.input)
 	decoder.Strict = false
 	decoder.AutoClose = xml.HTMLAutoClose
 
 	// SVGルート要素を探す
 	for {
-		tok, err := decoder.Token()
+		tok, err := ps.token(decoder)
 		if err == io.EOF {
-			return nil, fmt.Errorf("no SVG root element found")
+			line, column := decoder.InputPos()
+			return nil, &ParseError{Line: line, Column: column, Msg: "no SVG root element found"}
 		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse SVG: %w", err)
@@ -99,10 +171,18 @@ func ParseSVG(data []byte) (*Document, error) {
 
 		if se, ok := tok.(xml.StartElement); ok {
 			if se.Name.Local == "svg" {
-				root, err := parseElement(decoder, se)
+				root, err := ps.parseElement(decoder, se, nil, 1, false)
 				if err != nil {
+					var pe *ParseError
+					var le *limits.Error
+					if errors.As(err, &pe) || errors.As(err, &le) {
+						return nil, err
+					}
 					return nil, fmt.Errorf("failed to parse SVG root: %w", err)
 				}
+				if err := ps.checkUseExpansion(root); err != nil {
+					return nil, err
+				}
 
 				doc := &Document{
 					Root:   root,
@@ -114,21 +194,88 @@ func ParseSVG(data []byte) (*Document, error) {
 				if vbStr := root.Attributes["viewBox"]; vbStr != "" {
 					if vb, err := parseViewBox(vbStr); err == nil {
 						doc.ViewBox = vb
+					} else {
+						ps.report(root, diagnostic.SeverityWarning, diagnostic.CodeInvalidViewBox, err.Error())
 					}
 				}
 
-				doc.Defs = parseDefs(root)
+				doc.Defs = ps.parseDefs(root)
+				doc.StyleSheets = collectStyleSheets(root, nil)
+				doc.Diagnostics = ps.diag.Entries()
 				return doc, nil
 			}
 		}
 	}
 }
 
+// parseState はパース中に数えた資源の量と、字句の位置・診断です
+type parseState struct {
+	lim          limits.Limits
+	elements     int64
+	pathSegments int64
+	textLength   int64
+
+	line, column int // 直前に読んだ字句の開始位置
+	diag         diagnostic.Collector
+	input        *inputReader
+}
+
+// inputReader は入力の読み込みのエラーを記録する io.Reader です
+// デコーダーのエラーが入力によるものか、文書の内容によるものかを区別するために使います
+type inputReader struct {
+	r   io.Reader
+	err error
+}
+
+func (ir *inputReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if err != nil && err != io.EOF {
+		ir.err = err
+	}
+	return n, err
+}
+
+// token は次の字句を読み、その開始位置を記録します
+// 文字データも1つの字句になるため、読む前の位置がそのまま字句の開始位置になります
+// 入力の読み込みのエラー以外（構文エラーや未対応の文字コードなど）は位置つきの *ParseError に変換します
+func (ps *parseState) token(decoder *xml.Decoder) (xml.Token, error) {
+	ps.line, ps.column = decoder.InputPos()
+	tok, err := decoder.Token()
+	if err == nil || err == io.EOF || ps.input.err != nil {
+		return tok, err
+	}
+	line, column := decoder.InputPos()
+	msg := err.Error()
+	var se *xml.SyntaxError
+	if errors.As(err, &se) {
+		msg = se.Msg
+	}
+	return nil, &ParseError{Line: line, Column: column, Msg: msg, Err: err}
+}
+
+// report は要素についての診断を記録します
+func (ps *parseState) report(elem *Element, severity diagnostic.Severity, code diagnostic.Code, msg string) {
+	ps.diag.Add(diagnostic.Entry{Severity: severity, Code: code, Message: msg, Location: elem.Location()})
+}
+
 // parseElement はXMLデコーダーから要素を再帰的にパースします
-func parseElement(decoder *xml.Decoder, start xml.StartElement) (*Element, error) {
+// parent は親要素（ルートは nil）、depth は要素の入れ子の深さ（ルートが 1）、inText は text 要素の内側かどうかです
+func (ps *parseState) parseElement(decoder *xml.Decoder, start xml.StartElement, parent *Element, depth int, inText bool) (*Element, error) {
+	ps.elements++
+	if err := limits.Check("elements", int64(ps.lim.MaxElements), ps.elements); err != nil {
+		return nil, err
+	}
+	if err := limits.Check("depth", int64(ps.lim.MaxDepth), int64(depth)); err != nil {
+		return nil, err
+	}
+	inText = inText || start.Name.Local == "text"
+
 	elem := &Element{
 		Name:       start.Name.Local,
 		Attributes: make(map[string]string),
+		Parent:     parent,
+		Line:       ps.line,
+		Column:     ps.column,
 	}
 
 	// 属性の解析
@@ -137,12 +284,21 @@ func parseElement(decoder *xml.Decoder, start xml.StartElement) (*Element, error
 		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
 			continue
 		}
+		// xml:space・xml:lang は空白処理やフォント選択に使うため接頭辞付きで保持する
+		if attr.Name.Space == xmlNamespace || attr.Name.Space == "xml" {
+			elem.Attributes["xml:"+attr.Name.Local] = attr.Value
+			continue
+		}
 		elem.Attributes[attr.Name.Local] = attr.Value
 	}
+	if err := ps.countPath(elem); err != nil {
+		return nil, err
+	}
 
 	// 子要素・テキストの再帰解析
+	var nth map[string]int // 子要素の名前ごとの数
 	for {
-		tok, err := decoder.Token()
+		tok, err := ps.token(decoder)
 		if err == io.EOF {
 			return elem, nil
 		}
@@ -152,14 +308,28 @@ func parseElement(decoder *xml.Decoder, start xml.StartElement) (*Element, error
 
 		switch t := tok.(type) {
 		case xml.StartElement:
-			child, err := parseElement(decoder, t)
+			child, err := ps.parseElement(decoder, t, elem, depth+1, inText)
 			if err != nil {
 				return nil, err
 			}
+			if nth == nil {
+				nth = make(map[string]int)
+			}
+			nth[child.Name]++
+			child.nth = nth[child.Name]
 			elem.Children = append(elem.Children, child)
+			elem.Content = append(elem.Content, Node{Elem: child})
 
 		case xml.CharData:
-			text := strings.TrimSpace(string(t))
+			raw := string(t)
+			if inText {
+				ps.textLength += int64(utf8.RuneCountInString(raw))
+				if err := limits.Check("text length", int64(ps.lim.MaxTextLength), ps.textLength); err != nil {
+					return nil, err
+				}
+			}
+			elem.Content = append(elem.Content, Node{Text: raw})
+			text := strings.TrimSpace(raw)
 			if text != "" {
 				elem.Text += text
 			}
@@ -175,6 +345,129 @@ func parseElement(decoder *xml.Decoder, start xml.StartElement) (*Element, error
 	}
 }
 
+// countPath は path の d と polyline / polygon の points のコマンド・座標の数を数えます
+func (ps *parseState) countPath(elem *Element) error {
+	var data string
+	switch elem.Name {
+	case "path":
+		data = elem.Attributes["d"]
+	case "polyline", "polygon":
+		data = elem.Attributes["points"]
+	default:
+		return nil
+	}
+	ps.pathSegments += int64(countPathTokens(data))
+	return limits.Check("path segments", int64(ps.lim.MaxPathSegments), ps.pathSegments)
+}
+
+// countPathTokens はパスデータのコマンド文字と数値の数を返します
+func countPathTokens(data string) int {
+	n := 0
+	inNumber := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c >= '0' && c <= '9' || c == '.':
+			if !inNumber {
+				n++
+				inNumber = true
+			}
+		case (c == 'e' || c == 'E') && inNumber:
+			// 指数部は数値の続き
+			if i+1 < len(data) && (data[i+1] == '-' || data[i+1] == '+') {
+				i++
+			}
+		case c == '-' || c == '+':
+			n++
+			inNumber = true
+		case c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z':
+			n++
+			inNumber = false
+		default:
+			inNumber = false
+		}
+	}
+	return n
+}
+
+// checkUseExpansion は <use> の参照をすべて展開したときに複製される要素数を上限と比べます
+// 参照が循環している場合は無限に展開されるため、上限を超えたものとして扱います
+func (ps *parseState) checkUseExpansion(root *Element) error {
+	max := int64(ps.lim.MaxUseExpansion)
+	if max < 0 {
+		return nil
+	}
+	ids := make(map[string]*Element)
+	indexIDs(ids, root)
+
+	// 展開後の要素数は上限を超えた時点で打ち切る（指数的に増える参照でも数え上げない）
+	limit := ps.elements + max + 1
+	sizes := make(map[*Element]int64)
+	visiting := make(map[*Element]bool)
+	var size func(elem *Element) int64
+	size = func(elem *Element) int64 {
+		if n, ok := sizes[elem]; ok {
+			return n
+		}
+		if visiting[elem] {
+			return limit
+		}
+		visiting[elem] = true
+		n := int64(1)
+		for _, child := range elem.Children {
+			n = min(n+size(child), limit)
+		}
+		if elem.Name == "use" {
+			if ref := ids[useTarget(elem)]; ref != nil {
+				n = min(n+size(ref), limit)
+			}
+		}
+		visiting[elem] = false
+		sizes[elem] = n
+		return n
+	}
+	return limits.Check("use expansion", max, size(root)-ps.elements)
+}
+
+// indexIDs は id を持つ要素を集めます
+func indexIDs(ids map[string]*Element, elem *Element) {
+	if id := elem.Attributes["id"]; id != "" {
+		if _, ok := ids[id]; !ok {
+			ids[id] = elem
+		}
+	}
+	for _, child := range elem.Children {
+		indexIDs(ids, child)
+	}
+}
+
+// useTarget は use 要素の href（xlink:href）が参照する id を返します
+func useTarget(elem *Element) string {
+	href := strings.TrimSpace(elem.Attributes["href"])
+	if !strings.HasPrefix(href, "#") {
+		return ""
+	}
+	return href[1:]
+}
+
+// collectStyleSheets は文書中の <style> 要素の内容を文書順に集めます
+// CDATA セクションも文字データとして連結します
+func collectStyleSheets(elem *Element, sheets []string) []string {
+	if elem.Name == "style" {
+		var css strings.Builder
+		for _, node := range elem.Content {
+			if node.Elem == nil {
+				css.WriteString(node.Text)
+			}
+		}
+		return append(sheets, css.String())
+	}
+	for _, child := range elem.Children {
+		sheets = collectStyleSheets(child, sheets)
+	}
+	return sheets
+}
+
 // parseViewBox はviewBox属性を解析します
 func parseViewBox(viewBox string) (*ViewBox, error) {
 	// カンマまたはスペース区切りに対応
@@ -202,24 +495,43 @@ func parseViewBox(viewBox string) (*ViewBox, error) {
 }
 
 // parseDefs はルート要素からdefs定義を抽出します
-func parseDefs(root *Element) *Defs {
+func (ps *parseState) parseDefs(root *Element) *Defs {
 	defs := &Defs{
 		LinearGradients: make(map[string]*LinearGradient),
 		RadialGradients: make(map[string]*RadialGradient),
 		ClipPaths:       make(map[string]*Element),
 		Patterns:        make(map[string]*Element),
 		Filters:         make(map[string]*FilterDef),
+		Paths:           make(map[string]*Element),
+		Shapes:          make(map[string]*Element),
 	}
 
 	for _, child := range root.Children {
 		if child.Name == "defs" {
-			processDefsElement(defs, child)
+			ps.processDefsElement(defs, child)
 		}
 	}
+	collectPaths(defs, root)
 	return defs
 }
 
-func processDefsElement(defs *Defs, defsElem *Element) {
+// collectPaths は文書全体から id を持つ path 要素と rect / polygon 要素を集めます
+// textPath や shape-inside は defs の外にある要素も参照できるため、要素木全体を走査します
+func collectPaths(defs *Defs, elem *Element) {
+	if id := elem.Attributes["id"]; id != "" {
+		switch elem.Name {
+		case "path":
+			defs.Paths[id] = elem
+		case "rect", "polygon":
+			defs.Shapes[id] = elem
+		}
+	}
+	for _, child := range elem.Children {
+		collectPaths(defs, child)
+	}
+}
+
+func (ps *parseState) processDefsElement(defs *Defs, defsElem *Element) {
 	for _, def := range defsElem.Children {
 		id := def.Attributes["id"]
 		if id == "" {
@@ -265,6 +577,9 @@ func processDefsElement(defs *Defs, defsElem *Element) {
 			fd := &FilterDef{ID: id}
 			for _, prim := range def.Children {
 				fp := parseFilterPrimitive(prim)
+				if !supportedFilterPrimitives[prim.Name] {
+					ps.report(prim, diagnostic.SeverityWarning, diagnostic.CodeUnsupportedFilter, "<"+prim.Name+">")
+				}
 				if fp != nil {
 					fd.Primitives = append(fd.Primitives, *fp)
 				}
@@ -274,6 +589,12 @@ func processDefsElement(defs *Defs, defsElem *Element) {
 	}
 }
 
+// supportedFilterPrimitives は描画に反映するフィルタープリミティブです
+var supportedFilterPrimitives = map[string]bool{
+	"feGaussianBlur": true,
+	"feComposite":    true,
+}
+
 // parseFilterPrimitive はフィルタープリミティブ要素をパースします
 func parseFilterPrimitive(elem *Element) *FilterPrimitive {
 	fp := &FilterPrimitive{
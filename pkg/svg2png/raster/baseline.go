@@ -0,0 +1,88 @@
+package raster
+
+import (
+	"github.com/shinya/svg2png/pkg/svg2png/font"
+	"github.com/shinya/svg2png/pkg/svg2png/style"
+)
+
+// ============================================================
+// ベースラインの揃え
+// ============================================================
+
+// fontMetrics はスタイルの最初のフォントの寸法を返します（フォントがない場合は既定値）
+func (rc *RasterContext) fontMetrics(st *style.ComputedStyle) font.FontMetrics {
+	primary := &font.FontFace{}
+	if faces := rc.fontCandidates(st); len(faces) > 0 {
+		primary = faces[0]
+	}
+	return primary.Metrics()
+}
+
+// baselineOffsets はスパンごとのグリフの原点を、指定位置から進行方向と直交する方向にずらす量（ピクセル）を返します
+// 横書きでは下向き、縦書きでは右向きを正とします
+//
+// 指定位置は <text> の dominant-baseline（横書きの auto は alphabetic、縦書きの auto は central）の位置です。
+// スパンは alignment-baseline（baseline の場合は dominant-baseline）の位置を <text> のフォントの同じベースラインに揃え、
+// さらに baseline-shift の分だけずらします
+func (rc *RasterContext) baselineOffsets(spans []TextSpan, root *style.ComputedStyle, vertical bool) []float64 {
+	offsets := make([]float64, len(spans))
+	if root == nil {
+		if len(spans) == 0 {
+			return offsets
+		}
+		root = spans[0].Style
+	}
+	resolve := func(name string) string {
+		if name == "auto" {
+			if vertical {
+				return "central"
+			}
+			return "alphabetic"
+		}
+		return name
+	}
+	// グリフの原点は横書きでは alphabetic、縦書きでは中央線
+	origin := "alphabetic"
+	if vertical {
+		origin = "central"
+	}
+
+	rootMetrics := rc.fontMetrics(root)
+	rootEm := rc.scaledFontSizePt(root) * 96.0 / 72.0
+	dominant := resolve(root.DominantBaseline)
+
+	for i, s := range spans {
+		st := s.Style
+		if st == nil {
+			continue
+		}
+		b := resolve(st.DominantBaseline)
+		if st.AlignmentBaseline != "baseline" {
+			b = st.AlignmentBaseline
+		}
+		m := rootMetrics
+		if st != root {
+			m = rc.fontMetrics(st)
+		}
+		em := rc.scaledFontSizePt(st) * 96.0 / 72.0
+
+		// up は指定位置からグリフの原点までの上向き（縦書きでは右向き）の距離
+		up := (rootMetrics.Baseline(b)-rootMetrics.Baseline(dominant))*rootEm - (m.Baseline(b)-m.Baseline(origin))*em
+		for _, shift := range st.BaselineShifts {
+			switch shift.Keyword {
+			case "sub":
+				up -= rc.fontMetrics(shift.Font).SubscriptOffset * rc.scaledFontSizePt(shift.Font) * 96.0 / 72.0
+			case "super":
+				up += rc.fontMetrics(shift.Font).SuperscriptOffset * rc.scaledFontSizePt(shift.Font) * 96.0 / 72.0
+			default:
+				up += shift.Amount * rc.fontScale()
+			}
+		}
+		if vertical {
+			offsets[i] = up
+		} else {
+			offsets[i] = -up
+		}
+	}
+	return offsets
+}
@@ -0,0 +1,161 @@
+package raster
+
+import (
+	"github.com/go-text/typesetting/bidi"
+	xbidi "golang.org/x/text/unicode/bidi"
+)
+
+// bidiItem は同一スパン・同一埋め込みレベルの連続した文字列です
+type bidiItem struct {
+	span    int    // 元のスパンの添字
+	content string // 双方向制御文字を除いたテキスト（論理順）
+	level   bidi.Level
+	first   bool // スパンの先頭文字を含む（スパンの DX/DY を適用する）
+}
+
+// rtl は項目が右から左に並ぶかを返します
+func (it bidiItem) rtl() bool { return it.level%2 == 1 }
+
+// direction はシェーピングに渡す方向を返します
+func (it bidiItem) direction() string {
+	if it.rtl() {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// isBidiControl は unicode-bidi の実装で挿入される双方向制御文字かを返します
+// これらは描画・計測の対象にしません
+func isBidiControl(r rune) bool {
+	return (r >= 0x202A && r <= 0x202E) || (r >= 0x2066 && r <= 0x2069) || r == 0x200E || r == 0x200F
+}
+
+// bidiItems はスパン列に Unicode 双方向アルゴリズムを適用し、視覚順の項目列を返します
+// direction は段落の基底方向（"ltr" | "rtl" | "auto"）で、"auto" は最初の強い文字から決定します
+// 戻り値 rtl は解決された段落方向が右から左かを表します
+func bidiItems(spans []TextSpan, direction string) (items []bidiItem, rtl bool) {
+	var text []rune
+	spanOf := make([]int, 0, len(spans))
+	for i, s := range spans {
+		for _, r := range s.Content {
+			text = append(text, r)
+			spanOf = append(spanOf, i)
+		}
+	}
+
+	paraLevel := bidi.Level(0)
+	switch direction {
+	case "rtl":
+		paraLevel = 1
+	case "auto":
+		paraLevel = firstStrongLevel(text)
+	}
+	base := bidi.LeftToRight
+	if paraLevel == 1 {
+		base = bidi.RightToLeft
+	}
+
+	levels := make([]bidi.Level, len(text))
+	if len(text) > 0 {
+		var p bidi.Paragraph
+		runs := p.Segment(text, base)
+		for i := 0; i < runs.NumRuns(); i++ {
+			run := runs.Run(i)
+			for j := run.Start; j < run.End; j++ {
+				levels[j] = run.Level
+			}
+		}
+	}
+
+	// 論理順の項目に分割（スパンまたはレベルが変わる位置で区切る）
+	pos := 0
+	for i, s := range spans {
+		if s.Content == "" {
+			// 内容のないスパンも DX/DY を持つため、直前の文字のレベルで項目を作る
+			lvl := paraLevel
+			if pos > 0 {
+				lvl = levels[pos-1]
+			}
+			items = append(items, bidiItem{span: i, level: lvl, first: true})
+			continue
+		}
+		first := true
+		for pos < len(text) && spanOf[pos] == i {
+			start, lvl := pos, levels[pos]
+			for pos < len(text) && spanOf[pos] == i && levels[pos] == lvl {
+				pos++
+			}
+			items = append(items, bidiItem{span: i, content: stripBidiControls(text[start:pos]), level: lvl, first: first})
+			first = false
+		}
+	}
+
+	reorderItems(items)
+	return items, paraLevel%2 == 1
+}
+
+// firstStrongLevel は規則 P2・P3 に従い、段落レベルを最初の強い文字（L・R・AL）から決定します
+// 分離区間（LRI・RLI・FSI から対応する PDI まで）の内側の文字は読み飛ばし、強い文字がない場合は 0 を返します
+func firstStrongLevel(text []rune) bidi.Level {
+	isolates := 0
+	for _, r := range text {
+		props, _ := xbidi.LookupRune(r)
+		switch props.Class() {
+		case xbidi.LRI, xbidi.RLI, xbidi.FSI:
+			isolates++
+		case xbidi.PDI:
+			isolates = max(0, isolates-1)
+		case xbidi.L:
+			if isolates == 0 {
+				return 0
+			}
+		case xbidi.R, xbidi.AL:
+			if isolates == 0 {
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// stripBidiControls は双方向制御文字を除いた文字列を返します
+func stripBidiControls(runes []rune) string {
+	out := make([]rune, 0, len(runes))
+	for _, r := range runes {
+		if !isBidiControl(r) {
+			out = append(out, r)
+		}
+	}
+	return string(out)
+}
+
+// reorderItems は規則 L2 に従って項目を視覚順に並べ替えます
+// 最大レベルから最小の奇数レベルまで、各レベル以上の連続区間を反転します
+func reorderItems(items []bidiItem) {
+	if len(items) == 0 {
+		return
+	}
+	maxLevel, minOdd := bidi.Level(0), bidi.Level(127)
+	for _, it := range items {
+		maxLevel = max(maxLevel, it.level)
+		if it.level%2 == 1 {
+			minOdd = min(minOdd, it.level)
+		}
+	}
+	for lvl := maxLevel; lvl >= minOdd && lvl > 0; lvl-- {
+		for i := 0; i < len(items); {
+			if items[i].level < lvl {
+				i++
+				continue
+			}
+			j := i
+			for j < len(items) && items[j].level >= lvl {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				items[a], items[b] = items[b], items[a]
+			}
+			i = j
+		}
+	}
+}
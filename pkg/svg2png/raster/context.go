@@ -1,6 +1,7 @@
 package raster
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"log"
@@ -10,6 +11,7 @@ import (
 
 	"golang.org/x/image/vector"
 
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
 	"github.com/shinya/svg2png/pkg/svg2png/font"
 	"github.com/shinya/svg2png/pkg/svg2png/parser"
 	"github.com/shinya/svg2png/pkg/svg2png/style"
@@ -23,6 +25,15 @@ type RasterContext struct {
 	viewport     *viewport.Viewport
 	defs         *parser.Defs
 	clipMask     *image.Alpha
+
+	coverage     *coverageTable // 描画中の図形・テキストの被覆率の変換表（nil は変換なし）
+	textCoverage *coverageTable // グリフの被覆率の変換表（SetTextCoverage）
+
+	limit *limitState // 中断の理由とフィルターの処理量（一時的なコンテキストと共有）
+
+	candidateCache map[string][]*font.FontFace // "Family-Style" → フォールバック候補
+	diagnostics    *diagnostic.Collector       // 診断（一時的なコンテキストと共有）
+	element        *parser.Element             // 診断の対象の要素（AtElement）
 }
 
 // NewRasterContext は新しいラスタリングコンテキストを作成します
@@ -32,6 +43,8 @@ func NewRasterContext(fb *FrameBuffer, fontRenderer *font.Renderer, vp *viewport
 		fontRenderer: fontRenderer,
 		viewport:     vp,
 		defs:         defs,
+		limit:        &limitState{maxFilterArea: -1},
+		diagnostics:  &diagnostic.Collector{},
 	}
 }
 
@@ -52,6 +65,12 @@ func (rc *RasterContext) toPixelXY(x, y float64) (float32, float32) {
 	return float32(x*scaleX + offsetX), float32(y*scaleY + offsetY)
 }
 
+// fromPixelXY はピクセル座標をSVG座標に逆変換します
+func (rc *RasterContext) fromPixelXY(px, py float64) (float64, float64) {
+	scaleX, scaleY, offsetX, offsetY := rc.scales()
+	return (px - offsetX) / scaleX, (py - offsetY) / scaleY
+}
+
 // scaleLength は長さ値をスケーリングします（X方向）
 func (rc *RasterContext) scaleLenX(v float64) float64 {
 	scaleX, _, _, _ := rc.scales()
@@ -79,109 +98,122 @@ func (rc *RasterContext) scaledFontSizePt(st *style.ComputedStyle) float64 {
 	return st.FontSize * rc.fontScale() * 72.0 / dpi
 }
 
+// fontQuery は ComputedStyle からフォント照合の要求を返します
+func (rc *RasterContext) fontQuery(st *style.ComputedStyle) font.FontQuery {
+	q := font.FontQuery{
+		Families: rc.fontFamilies(st),
+		Weight:   st.FontWeight,
+		Stretch:  st.FontStretch,
+		Slope:    "normal",
+		Lang:     st.Lang,
+	}
+	// "oblique 10deg" のような角度の指定は oblique として扱う
+	switch {
+	case st.FontStyle == "italic":
+		q.Slope = "italic"
+	case strings.HasPrefix(st.FontStyle, "oblique"):
+		q.Slope = "oblique"
+	}
+	return q
+}
+
 // fontStyleStr はComputedStyle からフォントスタイル文字列を返します
 func (rc *RasterContext) fontStyleStr(st *style.ComputedStyle) string {
-	fs := "Regular"
-	if st.FontStyle == "italic" || st.FontStyle == "oblique" {
-		fs = "Italic"
-	}
-	if st.FontWeight == "bold" || st.FontWeight == "700" || st.FontWeight == "800" || st.FontWeight == "900" {
-		if fs == "Italic" {
-			fs = "BoldItalic"
-		} else {
-			fs = "Bold"
-		}
-	}
-	return fs
+	return rc.fontQuery(st).StyleName()
 }
 
-// fontFamilies はフォントファミリリストを返します（フォールバック含む）
+// fontFamilies は font-family のリストを返します
 func (rc *RasterContext) fontFamilies(st *style.ComputedStyle) []string {
-	families := []string{st.FontFamily}
-	switch strings.ToLower(st.FontFamily) {
-	case "sans-serif", "helvetica", "arial":
-		families = append(families, "Helvetica", "Arial", "Geneva", "FreeSans")
-	case "serif", "times", "times new roman":
-		families = append(families, "Times", "Times New Roman", "FreeSerif")
-	case "monospace", "courier", "courier new":
-		families = append(families, "Courier", "Courier New", "FreeMono")
+	if len(st.FontFamilies) > 0 {
+		return st.FontFamilies
 	}
-	return families
+	return []string{st.FontFamily}
 }
 
-// measureTextPix はテキストのピクセル幅を返します（letter-spacing 込み）
-func (rc *RasterContext) measureTextPix(content string, st *style.ComputedStyle) float64 {
-	if rc.fontRenderer == nil || content == "" {
-		return 0
-	}
-	scaledFontSize := rc.scaledFontSizePt(st)
-	fontStyle := rc.fontStyleStr(st)
-	families := rc.fontFamilies(st)
-
-	for _, family := range families {
-		if w, err := rc.fontRenderer.MeasureText(content, family, fontStyle, scaledFontSize); err == nil {
-			nChars := float64(len([]rune(content)))
-			w += st.LetterSpacing * rc.fontScale() * nChars
-			return w
-		}
+// shapeOptions は ComputedStyle からシェーピング設定を作成します
+func (rc *RasterContext) shapeOptions(st *style.ComputedStyle) font.ShapeOptions {
+	q := rc.fontQuery(st)
+	return font.ShapeOptions{
+		Features:      font.ParseFeatureSettings(st.FontFeatureSettings),
+		Kerning:       st.FontKerning,
+		LetterSpacing: st.LetterSpacing * rc.fontScale(),
+		WordSpacing:   st.WordSpacing * rc.fontScale(),
+		Weight:        q.Weight,
+		Stretch:       q.Stretch,
+		Slope:         q.Slope,
+		OpticalSize:   st.FontSize,
+		Variations:    font.ParseVariationSettings(st.FontVariationSettings),
+		TextRendering: st.TextRendering,
 	}
-	return float64(len([]rune(content))) * scaledFontSize * 0.6
 }
 
-// drawTextRaw はテキストをピクセル位置に直接描画します（text-anchor 処理なし）
-func (rc *RasterContext) drawTextRaw(content string, pixX, pixY float64, st *style.ComputedStyle) {
-	if rc.fontRenderer == nil || content == "" {
-		return
-	}
-	if st.FillNone {
-		return
-	}
-	textColor := st.Fill
-
-	scaledFontSize := rc.scaledFontSizePt(st)
-	fontStyle := rc.fontStyleStr(st)
-	families := rc.fontFamilies(st)
+// textFlow はシェーピング時の組み方向です
+type textFlow struct {
+	direction string // "ltr" / "rtl" / ""（スクリプトから判定）
+	vertical  bool   // 縦書き
+	sideways  bool   // 縦書きで横倒しにする
+}
 
-	// letter-spacing が指定されている場合は文字ごとに描画
-	if st.LetterSpacing != 0 {
-		rc.drawTextWithLetterSpacing(content, pixX, pixY, st, scaledFontSize, fontStyle, families, textColor)
-		return
-	}
+// shapedText はフォントごとに分割してシェーピングしたテキストです
+type shapedText struct {
+	runs     []*font.GlyphRun // 論理順
+	rtl      bool
+	vertical bool
+	advance  float64 // 進行方向の送り幅
+}
 
-	for _, family := range families {
-		if rc.fontRenderer.FindFont(family, fontStyle) != nil {
-			if err := rc.fontRenderer.RenderText(content, family, fontStyle, scaledFontSize, rc.fb.Image(), pixX, pixY, textColor); err == nil {
-				return
+// shapeText はグリフの収録状況でフォールバックしながらテキストをシェーピングします
+// シェーピング可能なフォントがない場合は nil を返します（basicfont フォールバック）
+func (rc *RasterContext) shapeText(content string, st *style.ComputedStyle, flow textFlow) *shapedText {
+	items := rc.itemizeByCoverage(content, st)
+	if len(items) == 0 {
+		return nil
+	}
+	opts := rc.shapeOptions(st)
+	opts.Direction = flow.direction
+	opts.Vertical = flow.vertical
+	opts.Sideways = flow.sideways
+	size := rc.scaledFontSizePt(st)
+	aspect := rc.fontSizeAdjust(st)
+	out := &shapedText{vertical: flow.vertical}
+	for _, it := range items {
+		itemOpts := rc.synthesisOptions(opts, it.face, st)
+		// font-size-adjust はフォントごとに x-height が指定の比率になるようにサイズを変える
+		itemSize := size
+		if aspect > 0 {
+			itemSize = size * aspect / it.face.Metrics().XHeight
+		}
+		for _, seg := range capsSegments(it.content, it.face, st.FontVariantCaps, st.FontSynthesisSmallCaps, itemOpts) {
+			run, err := rc.fontRenderer.Shape(seg.content, it.face, itemSize*seg.scale, seg.opts)
+			if err != nil {
+				rc.Report(diagnostic.SeverityWarning, diagnostic.CodeShaping, fmt.Sprintf("shaping failed with font %q: %v", it.face.Family, err))
+				return nil
 			}
+			out.runs = append(out.runs, run)
+			out.rtl = run.RTL
+			out.advance += run.Advance
 		}
 	}
-	// フォールバック: basicfont
-	_ = rc.fontRenderer.RenderText(content, "", fontStyle, scaledFontSize, rc.fb.Image(), pixX, pixY, textColor)
+	return out
 }
 
-// drawTextWithLetterSpacing は letter-spacing を考慮して1文字ずつ描画します
-func (rc *RasterContext) drawTextWithLetterSpacing(content string, x, y float64, st *style.ComputedStyle, scaledFontSize float64, fontStyle string, families []string, textColor color.Color) {
-	// 使用するフォントを決定
-	usedFamily := ""
-	for _, family := range families {
-		if rc.fontRenderer.FindFont(family, fontStyle) != nil {
-			usedFamily = family
-			break
-		}
+// measureTextPix はテキストのピクセル幅を返します（letter-spacing 込み）
+// 描画と同じシェーピング結果の送り幅を使うため、計測と描画は一致します
+func (rc *RasterContext) measureTextPix(content string, st *style.ComputedStyle) float64 {
+	if rc.fontRenderer == nil || content == "" {
+		return 0
 	}
+	return rc.shapedWidth(rc.shapeText(content, st, textFlow{}), content, st)
+}
 
-	letterSpacingPix := st.LetterSpacing * rc.fontScale()
-	curX := x
-	for _, r := range content {
-		ch := string(r)
-		_ = rc.fontRenderer.RenderText(ch, usedFamily, fontStyle, scaledFontSize, rc.fb.Image(), curX, y, textColor)
-		// 文字幅を計測して進める
-		advance := float64(len([]rune(ch))) * scaledFontSize * 0.6 // フォールバック幅
-		if w, err := rc.fontRenderer.MeasureText(ch, usedFamily, fontStyle, scaledFontSize); err == nil {
-			advance = w
-		}
-		curX += advance + letterSpacingPix
+// shapedWidth はシェーピング結果の送り幅を返します
+// shaped が nil の場合は basicfont 相当の概算幅を返します
+func (rc *RasterContext) shapedWidth(shaped *shapedText, content string, st *style.ComputedStyle) float64 {
+	if shaped != nil {
+		return shaped.advance
 	}
+	nChars := float64(len([]rune(content)))
+	return nChars*rc.scaledFontSizePt(st)*0.6 + st.LetterSpacing*rc.fontScale()*nChars
 }
 
 // ============================================================
@@ -195,7 +227,7 @@ func (rc *RasterContext) PushClipPath(clipPathID string) {
 	}
 	clipElem, ok := rc.defs.ClipPaths[clipPathID]
 	if !ok {
-		log.Printf("clipPath not found: %s", clipPathID)
+		rc.Report(diagnostic.SeverityWarning, diagnostic.CodeMissingReference, fmt.Sprintf("clipPath not found: #%s", clipPathID))
 		return
 	}
 
@@ -290,7 +322,7 @@ func (rc *RasterContext) compositeAlpha(alpha *image.Alpha, col color.Color, opa
 	cb := float64(b16 >> 8)
 
 	img := rc.fb.Image()
-	bounds := img.Bounds()
+	bounds := img.Bounds().Intersect(alpha.Bounds())
 
 	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
 		for px := bounds.Min.X; px < bounds.Max.X; px++ {
@@ -327,10 +359,7 @@ func (rc *RasterContext) compositeAlpha(alpha *image.Alpha, col color.Color, opa
 
 // rasterizeAndComposite はラスタライザーの内容を合成します
 func (rc *RasterContext) rasterizeAndComposite(rz *vector.Rasterizer, col color.Color, opacity float64) {
-	w, h := rc.fb.Bounds().Dx(), rc.fb.Bounds().Dy()
-	alpha := image.NewAlpha(image.Rect(0, 0, w, h))
-	rz.Draw(alpha, alpha.Bounds(), image.Opaque, image.Point{})
-	rc.compositeAlpha(alpha, col, opacity)
+	rc.compositeAlpha(rc.rasterizeAlpha(rz), col, opacity)
 }
 
 // drawURLFill はFillURL に対応するグラデーション/パターン塗りを行います
@@ -353,6 +382,7 @@ func (rc *RasterContext) drawURLFill(alpha *image.Alpha, fillURL string, bounds
 
 // DrawRect は矩形を描画します
 func (rc *RasterContext) DrawRect(rect *Rect, st *style.ComputedStyle) {
+	defer rc.useCoverage(shapeCoverage(st))()
 	log.Printf("DrawRect: x=%f y=%f w=%f h=%f", rect.X, rect.Y, rect.Width, rect.Height)
 
 	// フィルター適用
@@ -377,8 +407,7 @@ func (rc *RasterContext) DrawRect(rect *Rect, st *style.ComputedStyle) {
 	if st.FillURL != "" {
 		rz := vector.NewRasterizer(w, h)
 		addRoundedRect(rz, x1, y1, x2, y2, rx, ry)
-		alpha := image.NewAlpha(image.Rect(0, 0, w, h))
-		rz.Draw(alpha, alpha.Bounds(), image.Opaque, image.Point{})
+		alpha := rc.rasterizeAlpha(rz)
 		rc.applyClipToAlpha(alpha)
 		bounds := image.Rect(int(x1), int(y1), int(x2), int(y2))
 		rc.drawURLFill(alpha, st.FillURL, bounds, st.FillOpacity*st.Opacity)
@@ -478,6 +507,7 @@ func (rc *RasterContext) DrawCircle(circle *Circle, st *style.ComputedStyle) {
 
 // DrawEllipse は楕円を描画します
 func (rc *RasterContext) DrawEllipse(ellipse *Ellipse, st *style.ComputedStyle) {
+	defer rc.useCoverage(shapeCoverage(st))()
 	// フィルター適用
 	if st.FilterID != "" {
 		stNoFilter := *st
@@ -497,8 +527,7 @@ func (rc *RasterContext) DrawEllipse(ellipse *Ellipse, st *style.ComputedStyle)
 	if st.FillURL != "" {
 		rz := vector.NewRasterizer(w, h)
 		addEllipse(rz, cx, cy, rx, ry)
-		alpha := image.NewAlpha(image.Rect(0, 0, w, h))
-		rz.Draw(alpha, alpha.Bounds(), image.Opaque, image.Point{})
+		alpha := rc.rasterizeAlpha(rz)
 		rc.applyClipToAlpha(alpha)
 		bounds := image.Rect(int(cx-rx), int(cy-ry), int(cx+rx), int(cy+ry))
 		rc.drawURLFill(alpha, st.FillURL, bounds, st.FillOpacity*st.Opacity)
@@ -582,6 +611,7 @@ func addEllipseCCW(rz *vector.Rasterizer, cx, cy, rx, ry float32) {
 
 // DrawLine は線を描画します
 func (rc *RasterContext) DrawLine(line *Line, st *style.ComputedStyle) {
+	defer rc.useCoverage(shapeCoverage(st))()
 	if st.StrokeNone || st.StrokeWidth <= 0 {
 		return
 	}
@@ -714,6 +744,7 @@ func strokeSegmentsWithDash(rz *vector.Rasterizer, pts [][2]float32, sw float32,
 
 // DrawPolyline は折れ線を描画します
 func (rc *RasterContext) DrawPolyline(points []Point, st *style.ComputedStyle, closed bool) {
+	defer rc.useCoverage(shapeCoverage(st))()
 	if len(points) < 2 {
 		return
 	}
@@ -788,6 +819,7 @@ func (rc *RasterContext) DrawPolyline(points []Point, st *style.ComputedStyle, c
 
 // DrawPath はSVGパスを描画します
 func (rc *RasterContext) DrawPath(path *Path, st *style.ComputedStyle) {
+	defer rc.useCoverage(shapeCoverage(st))()
 	log.Printf("DrawPath: d=%s", path.Data)
 	if path.Data == "" {
 		return
@@ -815,8 +847,7 @@ func (rc *RasterContext) DrawPath(path *Path, st *style.ComputedStyle) {
 	if st.FillURL != "" {
 		rz := vector.NewRasterizer(w, h)
 		if err := buildPathRasterizer(rz, path.Data, toPixel); err == nil {
-			alpha := image.NewAlpha(image.Rect(0, 0, w, h))
-			rz.Draw(alpha, alpha.Bounds(), image.Opaque, image.Point{})
+			alpha := rc.rasterizeAlpha(rz)
 			rc.applyClipToAlpha(alpha)
 			// パスのboundsは全キャンバスを使用（大抵の場合は問題ない）
 			bounds := rc.fb.Bounds()
@@ -827,7 +858,7 @@ func (rc *RasterContext) DrawPath(path *Path, st *style.ComputedStyle) {
 		if fa > 0 {
 			rz := vector.NewRasterizer(w, h)
 			if err := buildPathRasterizer(rz, path.Data, toPixel); err != nil {
-				log.Printf("DrawPath fill error: %v", err)
+				rc.Report(diagnostic.SeverityError, diagnostic.CodeInvalidPath, err.Error())
 			} else {
 				rc.rasterizeAndComposite(rz, st.Fill, st.FillOpacity*st.Opacity)
 			}
@@ -848,7 +879,7 @@ func (rc *RasterContext) DrawPath(path *Path, st *style.ComputedStyle) {
 			} else {
 				rz := vector.NewRasterizer(w, h)
 				if err := buildStrokeRasterizer(rz, path.Data, sw, toPixel); err != nil {
-					log.Printf("DrawPath stroke error: %v", err)
+					rc.Report(diagnostic.SeverityError, diagnostic.CodeInvalidPath, err.Error())
 				} else {
 					rc.rasterizeAndComposite(rz, st.Stroke, st.StrokeOpacity*st.Opacity)
 				}
@@ -973,6 +1004,15 @@ func buildDashStrokeFromPath(rz *vector.Rasterizer, data string, sw float32, toP
 // SVG パスパーサー
 // ============================================================
 
+// pathSink はパスの出力先です（vector.Rasterizer やパスの平坦化器が満たします）
+type pathSink interface {
+	MoveTo(x, y float32)
+	LineTo(x, y float32)
+	QuadTo(x1, y1, x, y float32)
+	CubeTo(x1, y1, x2, y2, x, y float32)
+	ClosePath()
+}
+
 // pathReader はSVGパスデータを読み取るためのリーダーです
 type pathReader struct {
 	s   string
@@ -1194,7 +1234,7 @@ func buildStrokeRasterizer(rz *vector.Rasterizer, data string, strokeWidth float
 }
 
 // buildPath はSVGパスデータをラスタライザーに追加します（fill用）
-func buildPath(rz *vector.Rasterizer, data string, toPixel func(float64, float64) (float32, float32), _ bool, _ float32) error {
+func buildPath(rz pathSink, data string, toPixel func(float64, float64) (float32, float32), _ bool, _ float32) error {
 	pr := &pathReader{s: data}
 
 	var curX, curY float64     // 現在位置
@@ -1477,7 +1517,7 @@ func buildPath(rz *vector.Rasterizer, data string, toPixel func(float64, float64
 }
 
 // arcToBezier はSVG楕円弧をcubic Bezier曲線に変換してラスタライザーに追加します
-func arcToBezier(rz *vector.Rasterizer, x1, y1, rx, ry, phi float64, largeArc, sweep bool, x2, y2 float64, toPixel func(float64, float64) (float32, float32)) {
+func arcToBezier(rz pathSink, x1, y1, rx, ry, phi float64, largeArc, sweep bool, x2, y2 float64, toPixel func(float64, float64) (float32, float32)) {
 	if rx == 0 || ry == 0 {
 		px, py := toPixel(x2, y2)
 		rz.LineTo(px, py)
@@ -1605,50 +1645,203 @@ func arcToBezier(rz *vector.Rasterizer, x1, y1, rx, ry, phi float64, largeArc, s
 // ============================================================
 
 // TextSpan はテキストスパン（テキスト＋スタイル）を表します
+// DX/DY はスパンの描画前に現在位置へ加算する相対オフセット（SVGユーザー単位）です
 type TextSpan struct {
 	Content string
 	Style   *style.ComputedStyle
+	DX, DY  float64
+	Lengths []*TextLength // スパンを含む要素の textLength（外側から内側の順）
+}
+
+// TextLength は要素の textLength / lengthAdjust の指定です
+// 同じ要素に含まれるスパンは同じ *TextLength を共有します
+type TextLength struct {
+	Length float64 // textLength（SVGユーザー単位）
+	Adjust string  // lengthAdjust（"spacing" | "spacingAndGlyphs"）
+}
+
+// TextFlow はテキストグループ全体の配置方法を表します
+type TextFlow struct {
+	Anchor      string               // text-anchor（"start" | "middle" | "end"）
+	Direction   string               // 段落の基底方向（"ltr" | "rtl" | "auto"）
+	WritingMode string               // writing-mode（"horizontal-tb" | "vertical-rl" | "vertical-lr"）
+	Style       *style.ComputedStyle // <text> 要素のスタイル（dominant-baseline と揃える基準のフォント。nil の場合は先頭のスパン）
+}
+
+// textPiece は同じ向き・同じスパンでまとめてシェーピングする区間です
+type textPiece struct {
+	span    int
+	content string
+	shaped  *shapedText
+	advance float64 // 進行方向の送り幅（ピクセル）
+	gap     float64 // スパン先頭の相対オフセット（進行方向、ピクセル）
+	rtl     bool
 }
 
 // DrawTextGroup は複数スパンをグループとして描画します（text-anchor対応）
-func (rc *RasterContext) DrawTextGroup(spans []TextSpan, anchorX, anchorY float64, textAnchor string) {
+// スパンは Unicode 双方向アルゴリズムで視覚順に並べ替えられ、text-anchor の start/end は
+// 段落方向に対して解決されます。縦書きでは y 方向に進み、x は中央線の位置です
+// 戻り値は描画後の現在テキスト位置（SVGユーザー単位）です
+func (rc *RasterContext) DrawTextGroup(spans []TextSpan, anchorX, anchorY float64, flow TextFlow) (endX, endY float64) {
 	if len(spans) == 0 || rc.fontRenderer == nil {
-		return
+		return anchorX, anchorY
 	}
 
-	_, py := rc.toPixelXY(anchorX, anchorY)
-	px, _ := rc.toPixelXY(anchorX, anchorY)
+	px, py := rc.toPixelXY(anchorX, anchorY)
+	vertical := flow.WritingMode == "vertical-rl" || flow.WritingMode == "vertical-lr"
+	direction := flow.Direction
+	if vertical {
+		// 縦書きの進行方向は常に上から下
+		direction = "ltr"
+	}
+	items, rtl := bidiItems(spans, direction)
 
-	// 各スパンの幅を計測
-	widths := make([]float64, len(spans))
-	totalWidth := 0.0
+	// 進行方向と直交する方向のオフセット（横書きの DY、縦書きの DX）は論理順に累積する
+	cross := make([]float64, len(spans))
+	curCross := float64(py)
+	if vertical {
+		curCross = float64(px)
+	}
 	for i, s := range spans {
-		if s.Style.FillNone {
-			continue
+		if vertical {
+			curCross += rc.scaleLenX(s.DX)
+		} else {
+			curCross += rc.scaleLenY(s.DY)
 		}
-		w := rc.measureTextPix(s.Content, s.Style)
-		widths[i] = w
-		totalWidth += w
+		cross[i] = curCross
+	}
+
+	// ベースラインの揃えと baseline-shift は現在テキスト位置を動かさない
+	baselines := rc.baselineOffsets(spans, flow.Style, vertical)
+	for i := range cross {
+		cross[i] += baselines[i]
 	}
 
-	// text-anchor に基づいて開始x を決定
-	startX := float64(px)
-	switch textAnchor {
+	pieces, total := rc.shapePieces(spans, items, vertical)
+	total = rc.adjustTextLength(spans, pieces, total, vertical)
+
+	// text-anchor に基づいて開始位置を決定（RTL 段落では start が右端）
+	start := float64(px)
+	if vertical {
+		start = float64(py)
+	}
+	switch resolveTextAnchor(flow.Anchor, rtl) {
 	case "middle":
-		startX -= totalWidth / 2
+		start -= total / 2
 	case "end":
-		startX -= totalWidth
+		start -= total
 	}
 
-	// スパンを順に描画
-	curX := startX
-	for i, s := range spans {
-		if s.Content == "" || s.Style.FillNone {
-			curX += widths[i]
-			continue
+	// 視覚順に描画（DX は LTR 区間では手前、RTL 区間では奥に空ける）
+	pos := start
+	var placed []placedText
+	var decorations []decorationSpan
+	for _, p := range pieces {
+		if !p.rtl {
+			pos += p.gap
+		}
+		if p.content != "" {
+			st := spans[p.span].Style
+			if vertical {
+				placed = append(placed, placeShaped(p.shaped, p.content, cross[p.span], pos, st))
+			} else {
+				placed = append(placed, placeShaped(p.shaped, p.content, pos, cross[p.span], st))
+			}
+			decorations = addDecorations(decorations, st, pos, pos+p.advance, cross[p.span], vertical)
+		}
+		pos += p.advance
+		if p.rtl {
+			pos += p.gap
+		}
+	}
+	bbox := placedBounds(placed)
+	rc.paintDecorations(decorations, false, bbox)
+	rc.paintTexts(placed)
+	rc.paintDecorations(decorations, true, bbox)
+
+	// 現在テキスト位置はインライン方向の終端（RTL 段落では左端）
+	if rtl {
+		pos = start
+	}
+	if vertical {
+		return rc.fromPixelXY(curCross, pos)
+	}
+	return rc.fromPixelXY(pos, curCross)
+}
+
+// shapePieces は視覚順の項目を向きごとの区間に分けてシェーピングし、送り幅の合計を返します
+// fill="none" のスパンも送り幅は持つため、描画の有無にかかわらず計測します
+func (rc *RasterContext) shapePieces(spans []TextSpan, items []bidiItem, vertical bool) (pieces []textPiece, total float64) {
+	for _, it := range items {
+		st := spans[it.span].Style
+		gap := 0.0
+		if it.first {
+			if vertical {
+				gap = rc.scaleLenY(spans[it.span].DY)
+			} else {
+				gap = rc.scaleLenX(spans[it.span].DX)
+			}
+		}
+		for _, seg := range rc.orientationSegments(it.content, st, vertical) {
+			p := textPiece{span: it.span, content: seg.content, gap: gap, rtl: it.rtl()}
+			gap = 0
+			if p.content != "" {
+				p.shaped = rc.shapeText(p.content, st, textFlow{direction: it.direction(), vertical: vertical, sideways: seg.sideways})
+				p.advance = rc.shapedWidth(p.shaped, p.content, st)
+			}
+			pieces = append(pieces, p)
+			total += p.gap + p.advance
+		}
+	}
+	return pieces, total
+}
+
+// orientedText は縦書きで同じ向きに並ぶ連続した文字列です
+type orientedText struct {
+	content  string
+	sideways bool
+}
+
+// orientationSegments は縦書きのテキストを正立・横倒しの区間に分割します
+// glyph-orientation-vertical が auto 以外なら優先し、次に text-orientation に従います
+// mixed の場合は Unicode の Vertical_Orientation により文字ごとに決定します
+func (rc *RasterContext) orientationSegments(content string, st *style.ComputedStyle, vertical bool) []orientedText {
+	if !vertical || content == "" {
+		return []orientedText{{content: content}}
+	}
+	switch {
+	case st.GlyphOrientationVertical == "0", st.GlyphOrientationVertical == "auto" && st.TextOrientation == "upright":
+		return []orientedText{{content: content}}
+	case st.GlyphOrientationVertical == "90", st.GlyphOrientationVertical == "auto" && st.TextOrientation == "sideways":
+		return []orientedText{{content: content, sideways: true}}
+	}
+
+	runes := []rune(content)
+	sideways := font.SidewaysRunes(runes)
+	var segs []orientedText
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		if i == len(runes) || sideways[i] != sideways[start] {
+			segs = append(segs, orientedText{content: string(runes[start:i]), sideways: sideways[start]})
+			start = i
 		}
-		rc.drawTextRaw(s.Content, curX, float64(py), s.Style)
-		curX += widths[i]
+	}
+	return segs
+}
+
+// resolveTextAnchor は text-anchor を左右の物理的な位置に解決します
+// 戻り値の "start" は左端、"end" は右端に揃えることを表します
+func resolveTextAnchor(anchor string, rtl bool) string {
+	if !rtl {
+		return anchor
+	}
+	switch anchor {
+	case "end":
+		return "start"
+	case "middle":
+		return "middle"
+	default:
+		return "end"
 	}
 }
 
@@ -1664,49 +1857,16 @@ func (rc *RasterContext) DrawText(text *Text, st *style.ComputedStyle) {
 		return
 	}
 
-	// ビューポート変換
-	px, py := rc.toPixelXY(text.X, text.Y)
-
-	textColor := st.Fill
-	if st.FillNone {
-		return // fill=none のテキストは見えない
-	}
-
-	// テキスト幅を計測（letter-spacing 込み）
-	textWidth := rc.measureTextPix(text.Content, st)
-
-	// text-anchor に基づいて x 位置を調整
-	finalX := float64(px)
-	switch st.TextAnchor {
-	case "middle":
-		finalX -= textWidth / 2
-	case "end":
-		finalX -= textWidth
-	}
-
-	// テキストを描画
-	scaledFontSize := rc.scaledFontSizePt(st)
-	fontStyle := rc.fontStyleStr(st)
-	families := rc.fontFamilies(st)
-
-	if st.LetterSpacing != 0 {
-		rc.drawTextWithLetterSpacing(text.Content, finalX, float64(py), st, scaledFontSize, fontStyle, families, textColor)
-		return
-	}
+	rc.DrawTextGroup([]TextSpan{{Content: text.Content, Style: st}}, text.X, text.Y, TextFlowOf(st))
+}
 
-	for _, family := range families {
-		if rc.fontRenderer.FindFont(family, fontStyle) != nil {
-			err := rc.fontRenderer.RenderText(text.Content, family, fontStyle, scaledFontSize, rc.fb.Image(), finalX, float64(py), textColor)
-			if err == nil {
-				log.Printf("Text rendered with font %s", family)
-				return
-			}
-		}
+// TextFlowOf は <text> 要素のスタイルからテキストの配置方法を作成します
+func TextFlowOf(st *style.ComputedStyle) TextFlow {
+	direction := st.Direction
+	if st.UnicodeBidi == "plaintext" {
+		direction = "auto"
 	}
-
-	// 最終フォールバック: basicfont
-	_ = rc.fontRenderer.RenderText(text.Content, "", fontStyle, scaledFontSize, rc.fb.Image(), finalX, float64(py), textColor)
-	log.Printf("Text rendered with basicfont fallback for '%s'", text.Content)
+	return TextFlow{Anchor: st.TextAnchor, Direction: direction, WritingMode: st.WritingMode, Style: st}
 }
 
 // ============================================================
@@ -0,0 +1,122 @@
+package raster
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/vector"
+
+	"github.com/shinya/svg2png/pkg/svg2png/style"
+)
+
+// ============================================================
+// アンチエイリアスの被覆率（shape-rendering / グリフのガンマ・コントラスト）
+// ============================================================
+
+// coverageTable はラスタライズした被覆率（アルファ値）の変換表です
+type coverageTable [256]uint8
+
+// aliasedCoverage は被覆率が半分以上の画素だけを塗る変換表です（アンチエイリアスなし）
+var aliasedCoverage = func() *coverageTable {
+	var t coverageTable
+	for i := 128; i < 256; i++ {
+		t[i] = 255
+	}
+	return &t
+}()
+
+// SetTextCoverage はグリフの被覆率に適用するガンマとコントラストを設定します
+// gamma が 1 より大きいと字形が濃く（太く）、小さいと薄くなります（0 は 1 として扱います）。
+// contrast は被覆率の中間値（0.5）を中心に傾きを 1+contrast 倍します（0 は変換なし）
+func (rc *RasterContext) SetTextCoverage(gamma, contrast float64) {
+	if gamma <= 0 {
+		gamma = 1
+	}
+	if gamma == 1 && contrast == 0 {
+		rc.textCoverage = nil
+		return
+	}
+	var t coverageTable
+	for i := range t {
+		a := math.Pow(float64(i)/255, 1/gamma)
+		a = (a-0.5)*(1+contrast) + 0.5
+		t[i] = uint8(math.Round(math.Max(0, math.Min(1, a)) * 255))
+	}
+	rc.textCoverage = &t
+}
+
+// shapeCoverage は図形の shape-rendering に対応する変換表を返します
+// crispEdges と optimizeSpeed はアンチエイリアスせずに描画します
+func shapeCoverage(st *style.ComputedStyle) *coverageTable {
+	switch st.ShapeRendering {
+	case "crispEdges", "optimizeSpeed":
+		return aliasedCoverage
+	}
+	return nil
+}
+
+// glyphCoverage はテキストの被覆率の変換表を返します
+// text-rendering: geometricPrecision ではガンマ・コントラストを適用しません
+func (rc *RasterContext) glyphCoverage(st *style.ComputedStyle) *coverageTable {
+	if st.TextRendering == "geometricPrecision" {
+		return nil
+	}
+	return rc.textCoverage
+}
+
+// useCoverage は以降のラスタライズに使う変換表を設定し、元に戻す関数を返します
+func (rc *RasterContext) useCoverage(t *coverageTable) (restore func()) {
+	prev := rc.coverage
+	rc.coverage = t
+	return func() { rc.coverage = prev }
+}
+
+// rasterizeAlpha はラスタライザーの内容をフレームバッファと同じ大きさのアルファマスクに描画し、
+// 設定された変換表で被覆率を変換します
+func (rc *RasterContext) rasterizeAlpha(rz *vector.Rasterizer) *image.Alpha {
+	w, h := rc.fb.Bounds().Dx(), rc.fb.Bounds().Dy()
+	alpha := image.NewAlpha(image.Rect(0, 0, w, h))
+	rz.Draw(alpha, alpha.Bounds(), image.Opaque, image.Point{})
+	if t := rc.coverage; t != nil {
+		for i, a := range alpha.Pix {
+			alpha.Pix[i] = t[a]
+		}
+	}
+	return alpha
+}
+
+// maskAlpha はグリフのマスクを重ねたアルファマスクを作成し、設定された変換表で被覆率を変換します
+// アルファマスクはグリフのある範囲だけの大きさです。masks が nil かマスクで描画できない場合は nil を返します
+func (rc *RasterContext) maskAlpha(masks glyphMasks) *image.Alpha {
+	if masks == nil {
+		return nil
+	}
+	var list []*image.Alpha
+	var bounds image.Rectangle
+	ok := masks(rc.fb.Bounds(), func(m *image.Alpha) {
+		list = append(list, m)
+		bounds = bounds.Union(m.Rect)
+	})
+	if !ok {
+		return nil
+	}
+	alpha := image.NewAlpha(bounds.Intersect(rc.fb.Bounds()))
+	for _, m := range list {
+		r := m.Rect.Intersect(alpha.Rect)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			src := m.Pix[m.PixOffset(r.Min.X, y):]
+			dst := alpha.Pix[alpha.PixOffset(r.Min.X, y):]
+			for x := 0; x < r.Dx(); x++ {
+				// 重なったグリフは "over" で合成する
+				a, b := uint32(dst[x]), uint32(src[x])
+				dst[x] = uint8(a + (b*(255-a)+127)/255)
+			}
+		}
+	}
+	if t := rc.coverage; t != nil {
+		for i, a := range alpha.Pix {
+			alpha.Pix[i] = t[a]
+		}
+	}
+	return alpha
+}
@@ -0,0 +1,160 @@
+package raster
+
+import (
+	"image"
+	"math"
+
+	"github.com/shinya/svg2png/pkg/svg2png/font"
+	"github.com/shinya/svg2png/pkg/svg2png/style"
+)
+
+// ============================================================
+// テキストの装飾線
+// ============================================================
+
+// decorationSpan は装飾線を引く区間です（ピクセル座標）
+// 横書きでは start/end は x、base はベースラインの y です。縦書きでは start/end は y、base は中央線の x です
+type decorationSpan struct {
+	deco       style.Decoration
+	start, end float64
+	base       float64
+	vertical   bool
+}
+
+// addDecorations はスパンの装飾線の区間を追加します
+// 同じ要素の装飾線が同じベースライン上で続く場合は1本にまとめ、点線や波線の周期が途切れないようにします
+func addDecorations(spans []decorationSpan, st *style.ComputedStyle, start, end, base float64, vertical bool) []decorationSpan {
+	for _, d := range st.Decorations {
+		merged := false
+		for i := len(spans) - 1; i >= 0; i-- {
+			s := &spans[i]
+			if s.deco.Paint == d.Paint && s.deco.Line == d.Line && s.base == base && math.Abs(s.end-start) < 0.5 {
+				s.end = end
+				merged = true
+				break
+			}
+		}
+		if !merged && end > start {
+			spans = append(spans, decorationSpan{deco: d, start: start, end: end, base: base, vertical: vertical})
+		}
+	}
+	return spans
+}
+
+// paintDecorations は装飾線を描画します
+// CSS の描画順どおり、下線と上線はテキストの前に（lineThrough=false）、取り消し線はテキストの後に（lineThrough=true）描画します
+func (rc *RasterContext) paintDecorations(spans []decorationSpan, lineThrough bool, bbox image.Rectangle) {
+	for _, s := range spans {
+		if (s.deco.Line == "line-through") != lineThrough {
+			continue
+		}
+		rc.paintGlyphs(rc.decorationOutline(s), nil, s.deco.Paint, bbox)
+	}
+}
+
+// decorationOutline は装飾線の形をアウトラインとして返します
+// 位置と太さは装飾線を指定した要素の最初のフォントの寸法（post / OS/2）から求めます
+func (rc *RasterContext) decorationOutline(s decorationSpan) glyphOutline {
+	paint := s.deco.Paint
+	em := rc.scaledFontSizePt(paint) * 96.0 / 72.0
+	metrics := rc.fontMetrics(paint)
+
+	t := metrics.UnderlineThickness * em
+	if s.deco.Line == "line-through" && s.deco.Thickness == 0 {
+		t = metrics.StrikethroughThickness * em
+	}
+	if s.deco.Thickness > 0 {
+		t = s.deco.Thickness * rc.fontScale()
+	}
+	t = math.Max(t, 1)
+
+	// v は進行方向と直交する位置（横書きでは下向き、縦書きでは右向き）
+	var v float64
+	switch {
+	case s.vertical && s.deco.Line == "underline":
+		v = s.base - em/2 + t/2
+	case s.vertical && s.deco.Line == "overline":
+		v = s.base + em/2 - t/2
+	case s.vertical:
+		v = s.base
+	case s.deco.Line == "underline":
+		v = s.base - metrics.UnderlinePosition*em
+	case s.deco.Line == "overline":
+		v = s.base - metrics.Ascent*em + t/2
+	default:
+		v = s.base - metrics.StrikethroughPosition*em
+	}
+
+	// 二重線の2本目はテキストから離れる側に引く（取り消し線は中心の両側）
+	away := 0.0
+	switch s.deco.Line {
+	case "underline":
+		away = 1
+	case "overline":
+		away = -1
+	}
+	if s.vertical {
+		away = -away
+	}
+
+	decoStyle, u0, u1, vertical := s.deco.Style, s.start, s.end, s.vertical
+	return func(sink font.OutlineSink) {
+		pt := func(u, v float64) (float32, float32) {
+			if vertical {
+				return float32(v), float32(u)
+			}
+			return float32(u), float32(v)
+		}
+		rect := func(a, b, top, bottom float64) {
+			sink.MoveTo(pt(a, top))
+			sink.LineTo(pt(b, top))
+			sink.LineTo(pt(b, bottom))
+			sink.LineTo(pt(a, bottom))
+			sink.ClosePath()
+		}
+		switch decoStyle {
+		case "double":
+			// 線と同じ幅の間隔をあけた2本の線
+			if away == 0 {
+				rect(u0, u1, v-t*3/2, v-t/2)
+				rect(u0, u1, v+t/2, v+t*3/2)
+			} else {
+				rect(u0, u1, v-t/2, v+t/2)
+				second := v + away*2*t
+				rect(u0, u1, second-t/2, second+t/2)
+			}
+		case "dotted":
+			for c := u0 + t/2; c+t/2 <= u1+0.01; c += 2 * t {
+				const n = 12
+				sink.MoveTo(pt(c+t/2, v))
+				for i := 1; i < n; i++ {
+					theta := 2 * math.Pi * float64(i) / n
+					sink.LineTo(pt(c+t/2*math.Cos(theta), v+t/2*math.Sin(theta)))
+				}
+				sink.ClosePath()
+			}
+		case "dashed":
+			dash, gap := 3*t, 2*t
+			for a := u0; a < u1; a += dash + gap {
+				rect(a, math.Min(a+dash, u1), v-t/2, v+t/2)
+			}
+		case "wavy":
+			// 振幅 t・波長 4t の正弦波を太さ t の帯として描く
+			wave := func(u float64) float64 { return v + t*math.Sin((u-u0)*math.Pi/(2*t)) }
+			step := math.Max(t/4, 0.5)
+			sink.MoveTo(pt(u0, wave(u0)-t/2))
+			for u := u0 + step; u < u1; u += step {
+				sink.LineTo(pt(u, wave(u)-t/2))
+			}
+			sink.LineTo(pt(u1, wave(u1)-t/2))
+			sink.LineTo(pt(u1, wave(u1)+t/2))
+			for u := u1 - step; u > u0; u -= step {
+				sink.LineTo(pt(u, wave(u)+t/2))
+			}
+			sink.LineTo(pt(u0, wave(u0)+t/2))
+			sink.ClosePath()
+		default:
+			rect(u0, u1, v-t/2, v+t/2)
+		}
+	}
+}
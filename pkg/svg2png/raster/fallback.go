@@ -0,0 +1,184 @@
+package raster
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
+	"github.com/shinya/svg2png/pkg/svg2png/font"
+	"github.com/shinya/svg2png/pkg/svg2png/parser"
+	"github.com/shinya/svg2png/pkg/svg2png/style"
+)
+
+// fontItem は同一フォントで描画する連続した文字列です
+type fontItem struct {
+	face    *font.FontFace
+	content string
+}
+
+// genericFamilies は最終段の前に探索する総称ファミリです
+var genericFamilies = []string{"sans-serif", "serif", "monospace"}
+
+// Diagnostics は描画中に収集した診断情報を返します
+func (rc *RasterContext) Diagnostics() []diagnostic.Entry {
+	return rc.diagnostics.Entries()
+}
+
+// Report は描画中の要素（AtElement）についての診断を記録します
+// 同じコードとメッセージの診断は最初の1件だけを記録します
+func (rc *RasterContext) Report(severity diagnostic.Severity, code diagnostic.Code, msg string) {
+	if rc.diagnostics.Has(code, msg) {
+		return
+	}
+	rc.diagnostics.Add(diagnostic.Entry{Severity: severity, Code: code, Message: msg, Location: rc.element.Location()})
+}
+
+// AtElement は以降の診断の対象とする要素を設定し、元に戻す関数を返します
+func (rc *RasterContext) AtElement(elem *parser.Element) (restore func()) {
+	prev := rc.element
+	rc.element = elem
+	return func() { rc.element = prev }
+}
+
+// fontCandidates はフォールバック探索の候補フォントを優先順に返します
+// 指定ファミリのリスト → 総称ファミリ → 読み込み済みの全フォント（同じスタイルを優先）の順です
+// 総称ファミリは xml:lang に応じたファミリのリストに展開します
+func (rc *RasterContext) fontCandidates(st *style.ComputedStyle) []*font.FontFace {
+	q := rc.fontQuery(st)
+	fontStyle := q.StyleName()
+	key := fmt.Sprintf("%s|%s|%s", strings.Join(q.Families, ","), q.Lang, q)
+	if faces, ok := rc.candidateCache[key]; ok {
+		return faces
+	}
+
+	var faces []*font.FontFace
+	seen := make(map[*font.FontFace]bool)
+	add := func(ff *font.FontFace) {
+		// シェーピングできないフォントは候補にしない
+		if ff != nil && ff.CanShape() && !seen[ff] {
+			seen[ff] = true
+			faces = append(faces, ff)
+		}
+	}
+	addFamily := func(family string) {
+		for _, name := range rc.fontRenderer.FamilyCandidates(family, q.Lang) {
+			add(rc.fontRenderer.MatchFont(name, q))
+		}
+	}
+	for _, family := range q.Families {
+		addFamily(family)
+	}
+	for _, generic := range genericFamilies {
+		addFamily(generic)
+	}
+	all := rc.fontRenderer.Faces()
+	for _, ff := range all {
+		if ff.Style == fontStyle {
+			add(ff)
+		}
+	}
+	for _, ff := range all {
+		add(ff)
+	}
+
+	if rc.candidateCache == nil {
+		rc.candidateCache = make(map[string][]*font.FontFace)
+	}
+	rc.candidateCache[key] = faces
+	return faces
+}
+
+// itemizeByCoverage はグリフの収録状況に応じてテキストをフォントごとに分割します
+// 結合文字や異体字セレクタなどは直前の文字と同じフォントに含めます
+// 共通文字（空白・記号など）は現在のフォントが収録していればそのまま続けます
+func (rc *RasterContext) itemizeByCoverage(content string, st *style.ComputedStyle) []fontItem {
+	candidates := rc.fontCandidates(st)
+	if len(candidates) == 0 {
+		return nil
+	}
+	primary := candidates[0]
+	// 指定ファミリそのもののフォント（見つからない場合は全区間がフォールバック）
+	requested := rc.fontRenderer.Query(rc.fontQuery(st)).Face
+	if requested == nil {
+		rc.Report(diagnostic.SeverityWarning, diagnostic.CodeFontMissing, st.FontFamily)
+	}
+
+	var items []fontItem
+	var cur *font.FontFace
+	var buf []rune
+	flush := func() {
+		if len(buf) > 0 {
+			items = append(items, fontItem{face: cur, content: string(buf)})
+			buf = buf[:0]
+		}
+	}
+
+	for _, r := range content {
+		face := cur
+		switch {
+		case cur != nil && isClusterExtender(r):
+			// 直前の文字と同じフォントを使う
+		case cur != nil && isCommonRune(r) && cur.HasGlyph(r):
+			// 共通文字は現在のフォントのまま
+		default:
+			face = nil
+			for _, ff := range candidates {
+				if ff.HasGlyph(r) {
+					face = ff
+					break
+				}
+			}
+			if face == nil {
+				rc.Report(diagnostic.SeverityWarning, diagnostic.CodeMissingGlyph, fmt.Sprintf("no font covers U+%04X %q", r, r))
+				face = primary
+				if cur != nil {
+					face = cur
+				}
+			}
+		}
+		if face != cur {
+			flush()
+			cur = face
+		}
+		buf = append(buf, r)
+	}
+	flush()
+
+	for _, it := range items {
+		if it.face != requested {
+			rc.Report(diagnostic.SeverityInfo, diagnostic.CodeFontFallback, fmt.Sprintf("font fallback: %q (%s) -> %q for %q",
+				st.FontFamily, rc.fontStyleStr(st), it.face.Family, truncateRunes(it.content, 16)))
+		}
+	}
+	return items
+}
+
+// isClusterExtender は直前の文字と結合して1つのクラスタを構成する文字かを返します
+func isClusterExtender(r rune) bool {
+	switch {
+	case r == 0x200C || r == 0x200D: // ZWNJ / ZWJ
+		return true
+	case r >= 0xFE00 && r <= 0xFE0F, r >= 0xE0100 && r <= 0xE01EF: // 異体字セレクタ
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF: // 絵文字の肌色修飾子
+		return true
+	case r >= 0xE0020 && r <= 0xE007F: // タグ文字
+		return true
+	}
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc)
+}
+
+// isCommonRune はスクリプトに依存しない文字（空白・数字・記号など）かを返します
+func isCommonRune(r rune) bool {
+	return unicode.In(r, unicode.Common, unicode.Inherited)
+}
+
+// truncateRunes は診断メッセージ用に文字列を n 文字に切り詰めます
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:n])) + "…"
+}
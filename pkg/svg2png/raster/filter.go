@@ -1,10 +1,12 @@
 package raster
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"math"
 
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
 	"github.com/shinya/svg2png/pkg/svg2png/parser"
 )
 
@@ -16,6 +18,7 @@ func (rc *RasterContext) applyFilterToLayer(layer *image.RGBA, filterID string,
 	}
 	fd, ok := rc.defs.Filters[filterID]
 	if !ok {
+		rc.Report(diagnostic.SeverityWarning, diagnostic.CodeFilterNotFound, fmt.Sprintf("filter not found: #%s", filterID))
 		rc.compositeRGBALayer(layer, opacity)
 		return
 	}
@@ -29,6 +32,7 @@ func (rc *RasterContext) applyFilterToLayer(layer *image.RGBA, filterID string,
 
 	// SVGユーザー座標→ピクセル座標のスケール
 	scaleX, scaleY, _, _ := rc.scales()
+	w, h := layer.Bounds().Dx(), layer.Bounds().Dy()
 
 	for _, prim := range fd.Primitives {
 		switch prim.Type {
@@ -37,6 +41,10 @@ func (rc *RasterContext) applyFilterToLayer(layer *image.RGBA, filterID string,
 			// stdDeviation は SVG ユーザー単位 → ピクセル単位に変換
 			sigmaX := prim.StdDeviationX * scaleX
 			sigmaY := prim.StdDeviationY * scaleY
+			if (sigmaX > 0 || sigmaY > 0) && !rc.chargeFilter(blurCost(w, h, sigmaX, sigmaY)) {
+				// 上限を超えた（または中断された）場合は合成しない。理由は Err で報告する
+				return
+			}
 			blurred := GaussianBlurRGBA(inLayer, sigmaX, sigmaY)
 			if prim.Result != "" {
 				namedLayers[prim.Result] = blurred
@@ -48,11 +56,16 @@ func (rc *RasterContext) applyFilterToLayer(layer *image.RGBA, filterID string,
 				// in を in2 の上に重ねる（SVG仕様通り）
 				inLayer := resolveFilterInput(prim.In, current, namedLayers, layer)
 				in2Layer := resolveFilterInput(prim.In2, current, namedLayers, layer)
+				if !rc.chargeFilter(float64(w) * float64(h)) {
+					return
+				}
 				result := compositeOver(inLayer, in2Layer, layer.Bounds())
 				if prim.Result != "" {
 					namedLayers[prim.Result] = result
 				}
 				current = result
+			} else {
+				rc.Report(diagnostic.SeverityWarning, diagnostic.CodeUnsupportedFilter, fmt.Sprintf("feComposite operator=%q", prim.Operator))
 			}
 		}
 	}
@@ -291,6 +304,10 @@ func (rc *RasterContext) renderToTempBuffer() *RasterContext {
 		viewport:     rc.viewport,
 		defs:         rc.defs,
 		clipMask:     rc.clipMask,
+		textCoverage: rc.textCoverage,
+		limit:        rc.limit,
+		diagnostics:  rc.diagnostics,
+		element:      rc.element,
 		// filterID は設定しない（再帰防止）
 	}
 }
@@ -317,3 +334,11 @@ func clampFloat(v float64) float64 {
 	}
 	return v
 }
+
+// DrawFiltered は draw が一時バッファに描いた内容にフィルターを適用して合成します
+// テキストのように複数回の描画で1つの要素を構成する場合に使います
+func (rc *RasterContext) DrawFiltered(filterID string, draw func(layer *RasterContext)) {
+	tmp := rc.renderToTempBuffer()
+	draw(tmp)
+	rc.applyFilterToLayer(tmp.fb.Image(), filterID, 1.0)
+}
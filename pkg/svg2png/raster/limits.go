@@ -0,0 +1,91 @@
+package raster
+
+import (
+	"context"
+	"math"
+
+	"github.com/shinya/svg2png/pkg/svg2png/limits"
+)
+
+// ============================================================
+// 描画の中断と資源の上限
+// ============================================================
+
+// limitState は描画全体（フィルター用の一時的なコンテキストを含む）で共有する中断の状態です
+type limitState struct {
+	ctx           context.Context
+	maxFilterArea int64   // 負の値は制限なし
+	filterArea    float64 // これまでのフィルターの処理量（大きなぼかしでも桁あふれしないよう浮動小数点で数える）
+	maxTextArea   int64   // 負の値は制限なし
+	textArea      float64 // これまでのテキストの描画量
+	err           error   // 上限を超えたときのエラー
+}
+
+// SetContext は描画の中断に使うコンテキストを設定します
+func (rc *RasterContext) SetContext(ctx context.Context) {
+	rc.limit.ctx = ctx
+}
+
+// SetLimits はフィルターとテキストの描画量の上限を設定します（0 の項目は既定値を使います）
+func (rc *RasterContext) SetLimits(lim limits.Limits) {
+	lim = lim.Resolve()
+	rc.limit.maxFilterArea = lim.MaxFilterArea
+	rc.limit.maxTextArea = lim.MaxTextArea
+}
+
+// Err は描画を中断すべき理由を返します
+// 上限を超えた場合は *limits.Error を、コンテキストが終了した場合はその理由を返します
+func (rc *RasterContext) Err() error {
+	if rc.limit.err != nil {
+		return rc.limit.err
+	}
+	if rc.limit.ctx != nil {
+		return rc.limit.ctx.Err()
+	}
+	return nil
+}
+
+// chargeFilter はフィルターの処理量を加算し、上限を超えた場合は false を返します
+// 上限を超えたことは Err で報告します
+func (rc *RasterContext) chargeFilter(cost float64) bool {
+	if rc.Err() != nil {
+		return false
+	}
+	st := rc.limit
+	st.filterArea += cost
+	if st.maxFilterArea >= 0 && st.filterArea > float64(st.maxFilterArea) {
+		st.err = &limits.Error{Limit: "filter area", Max: st.maxFilterArea, Actual: int64(math.Min(st.filterArea, math.MaxInt64))}
+		return false
+	}
+	return true
+}
+
+// chargeText はテキストの描画量を加算し、上限を超えた場合は false を返します
+// 上限を超えたことは Err で報告します
+func (rc *RasterContext) chargeText(cost float64) bool {
+	if rc.Err() != nil {
+		return false
+	}
+	st := rc.limit
+	st.textArea += cost
+	if st.maxTextArea >= 0 && st.textArea > float64(st.maxTextArea) {
+		st.err = &limits.Error{Limit: "text area", Max: st.maxTextArea, Actual: int64(math.Min(st.textArea, math.MaxInt64))}
+		return false
+	}
+	return true
+}
+
+// blurCost はガウシアンブラーの処理量（画素数×水平・垂直のカーネルの長さ）を返します
+// カーネルを作成せずに求めるため、巨大な標準偏差でもメモリを確保しません
+func blurCost(w, h int, sigmaX, sigmaY float64) float64 {
+	if sigmaX <= 0 {
+		sigmaX = sigmaY
+	}
+	if sigmaY <= 0 {
+		sigmaY = sigmaX
+	}
+	kernelLen := func(sigma float64) float64 {
+		return 2*math.Max(1, math.Ceil(sigma*3)) + 1
+	}
+	return float64(w) * float64(h) * (kernelLen(sigmaX) + kernelLen(sigmaY))
+}
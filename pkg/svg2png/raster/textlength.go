@@ -0,0 +1,145 @@
+package raster
+
+import (
+	"sort"
+
+	"github.com/shinya/svg2png/pkg/svg2png/font"
+)
+
+// ============================================================
+// textLength / lengthAdjust
+// ============================================================
+
+// adjustTextLength は textLength を指定した要素のテキストが指定の長さになるよう、区間の送り幅を調整します
+// 戻り値は調整後の送り幅の合計です
+//
+// 長さは描画と同じシェーピング結果で計測するため、指定時と異なるフォントで描画しても指定の長さに収まります。
+// lengthAdjust="spacing" では文字の間隔を均等に広げ（縮め）、"spacingAndGlyphs" ではグリフを進行方向に拡大縮小します。
+// 入れ子の指定では内側の要素から調整し、外側の調整では内側の要素の文字を動かしません。
+// 要素が複数のテキストチャンクにまたがる場合は、チャンクごとに調整します
+func (rc *RasterContext) adjustTextLength(spans []TextSpan, pieces []textPiece, total float64, vertical bool) float64 {
+	// 内側（深い）の指定から順に処理する
+	type group struct {
+		tl    *TextLength
+		depth int
+	}
+	var groups []group
+	seen := map[*TextLength]bool{}
+	for _, s := range spans {
+		for depth, tl := range s.Lengths {
+			if !seen[tl] {
+				seen[tl] = true
+				groups = append(groups, group{tl, depth})
+			}
+		}
+	}
+	if len(groups) == 0 {
+		return total
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].depth > groups[j].depth })
+
+	for _, g := range groups {
+		// 要素に含まれる区間（視覚順）と、そのうち要素が最も内側の指定である区間
+		var members []int
+		var measured, freeAdvance float64
+		freeClusters := 0
+		for i, p := range pieces {
+			if !containsLength(spans[p.span].Lengths, g.tl) {
+				continue
+			}
+			if len(members) > 0 {
+				measured += p.gap
+			}
+			members = append(members, i)
+			measured += p.advance
+			if isFreePiece(spans, p, g.tl) {
+				freeAdvance += p.advance
+				for _, run := range p.shaped.runs {
+					freeClusters += run.Clusters()
+				}
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+		target := rc.scaleLenX(g.tl.Length)
+		if vertical {
+			target = rc.scaleLenY(g.tl.Length)
+		}
+		delta := target - measured
+
+		last := members[len(members)-1]
+		lastFree := isFreePiece(spans, pieces[last], g.tl)
+		switch g.tl.Adjust {
+		case "spacingAndGlyphs":
+			if freeAdvance <= 0 || freeAdvance+delta <= 0 {
+				continue
+			}
+			k := (freeAdvance + delta) / freeAdvance
+			for _, i := range members {
+				if isFreePiece(spans, pieces[i], g.tl) {
+					adjustPiece(&pieces[i], func(run *font.GlyphRun, _ bool) *font.GlyphRun { return run.Stretched(k) })
+				}
+			}
+		default:
+			// 文字の間に均等に配分する（要素の最後の文字の後には加えない）
+			gaps := freeClusters
+			if lastFree {
+				gaps--
+			}
+			if gaps <= 0 {
+				continue
+			}
+			extra := delta / float64(gaps)
+			for _, i := range members {
+				if isFreePiece(spans, pieces[i], g.tl) {
+					isLast := i == last
+					adjustPiece(&pieces[i], func(run *font.GlyphRun, visualLast bool) *font.GlyphRun {
+						return run.WithSpacing(extra, isLast && visualLast)
+					})
+				}
+			}
+		}
+	}
+
+	total = 0
+	for _, p := range pieces {
+		total += p.gap + p.advance
+	}
+	return total
+}
+
+// adjustPiece は区間のグリフ列を adjust で置き換え、送り幅を更新します
+// adjust の visualLast は区間の中で視覚順に最後のグリフ列かを表します
+func adjustPiece(p *textPiece, adjust func(run *font.GlyphRun, visualLast bool) *font.GlyphRun) {
+	shaped := *p.shaped
+	shaped.runs = make([]*font.GlyphRun, len(p.shaped.runs))
+	shaped.advance = 0
+	for i, run := range p.shaped.runs {
+		// runs は論理順のため、RTL では先頭が視覚順の最後になる
+		visualLast := i == len(p.shaped.runs)-1
+		if shaped.rtl {
+			visualLast = i == 0
+		}
+		shaped.runs[i] = adjust(run, visualLast)
+		shaped.advance += shaped.runs[i].Advance
+	}
+	p.shaped = &shaped
+	p.advance = shaped.advance
+}
+
+// isFreePiece は区間の最も内側の textLength が tl か（tl の調整で動かす区間か）を返します
+func isFreePiece(spans []TextSpan, p textPiece, tl *TextLength) bool {
+	lengths := spans[p.span].Lengths
+	return p.shaped != nil && len(lengths) > 0 && lengths[len(lengths)-1] == tl
+}
+
+// containsLength は lengths に tl が含まれるかを返します
+func containsLength(lengths []*TextLength, tl *TextLength) bool {
+	for _, l := range lengths {
+		if l == tl {
+			return true
+		}
+	}
+	return false
+}
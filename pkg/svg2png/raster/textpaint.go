@@ -0,0 +1,289 @@
+package raster
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/vector"
+
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
+	"github.com/shinya/svg2png/pkg/svg2png/font"
+	"github.com/shinya/svg2png/pkg/svg2png/style"
+)
+
+// glyphOutline は配置済みのグリフアウトラインをピクセル座標で sink に出力する関数です
+type glyphOutline func(sink font.OutlineSink)
+
+// glyphMasks は配置済みのグリフのマスク（被覆率）を draw に渡す関数です
+// clip は描画先の範囲で、マスクで描画できないグリフ（clip より大きいグリフなど）を含む場合は false を返します
+type glyphMasks func(clip image.Rectangle, draw func(mask *image.Alpha)) bool
+
+// glyphColors は配置済みのカラーグリフを clip（描画先の範囲）に切り抜いて描画した画像を返す関数です
+type glyphColors func(clip image.Rectangle) []*image.RGBA
+
+// placedText は位置の決まったテキストの描画単位です
+type placedText struct {
+	st      *style.ComputedStyle
+	outline glyphOutline // nil の場合は basicfont で描画する
+	masks   glyphMasks   // 単色の塗りに使うキャッシュ済みのマスク（nil の場合は outline をラスタライズする）
+	color   glyphColors  // カラーグリフの画像（なければ nil）
+	content string
+	x, y    float64 // basicfont 用のピクセル位置
+	area    float64 // 描画量（グリフごとの em ボックスの画素数の合計）
+}
+
+// outlineAt はシェーピング済みのテキストを (pixX, pixY) に置いたアウトラインを返します
+// 縦書きでは (pixX, pixY) は中央線上の開始位置です
+func (shaped *shapedText) outlineAt(pixX, pixY float64) glyphOutline {
+	return func(sink font.OutlineSink) {
+		// RTL ではフォントごとの区間も逆順に並ぶ
+		x, y := pixX, pixY
+		for i := range shaped.runs {
+			run := shaped.runs[i]
+			if shaped.rtl {
+				run = shaped.runs[len(shaped.runs)-1-i]
+			}
+			run.Outline(x, y, sink)
+			if shaped.vertical {
+				y += run.Advance
+			} else {
+				x += run.Advance
+			}
+		}
+	}
+}
+
+// masksAt はシェーピング済みのテキストを (pixX, pixY) に置いたグリフのマスクを返す関数です
+func (shaped *shapedText) masksAt(pixX, pixY float64) glyphMasks {
+	return func(clip image.Rectangle, draw func(mask *image.Alpha)) bool {
+		x, y := pixX, pixY
+		for i := range shaped.runs {
+			run := shaped.runs[i]
+			if shaped.rtl {
+				run = shaped.runs[len(shaped.runs)-1-i]
+			}
+			if !run.Masks(x, y, clip, draw) {
+				return false
+			}
+			if shaped.vertical {
+				y += run.Advance
+			} else {
+				x += run.Advance
+			}
+		}
+		return true
+	}
+}
+
+// colorAt はシェーピング済みテキストのカラーグリフを (pixX, pixY) に置いた画像を返す関数です
+// カラーグリフを含まない場合は nil を返します
+func (shaped *shapedText) colorAt(pixX, pixY float64, st *style.ComputedStyle) glyphColors {
+	hasColor := false
+	for _, run := range shaped.runs {
+		hasColor = hasColor || run.HasColor()
+	}
+	if !hasColor {
+		return nil
+	}
+	return func(clip image.Rectangle) []*image.RGBA {
+		var layers []*image.RGBA
+		x, y := pixX, pixY
+		for i := range shaped.runs {
+			run := shaped.runs[i]
+			if shaped.rtl {
+				run = shaped.runs[len(shaped.runs)-1-i]
+			}
+			opts := font.ColorOptions{Palette: run.Face.PaletteFor(st.FontPalette), Foreground: st.Fill, Clip: clip}
+			layers = append(layers, run.ColorLayers(x, y, opts)...)
+			if shaped.vertical {
+				y += run.Advance
+			} else {
+				x += run.Advance
+			}
+		}
+		return layers
+	}
+}
+
+// placeShaped はシェーピング結果をピクセル位置に配置した描画単位を返します
+// shaped が nil の場合は basicfont で描画する単位になります
+func placeShaped(shaped *shapedText, content string, pixX, pixY float64, st *style.ComputedStyle) placedText {
+	p := placedText{st: st, content: content, x: pixX, y: pixY}
+	if shaped != nil {
+		p.outline = shaped.outlineAt(pixX, pixY)
+		p.masks = shaped.masksAt(pixX, pixY)
+		p.color = shaped.colorAt(pixX, pixY, st)
+		for _, run := range shaped.runs {
+			p.area += float64(len(run.Glyphs)) * run.Size * run.Size
+		}
+	}
+	return p
+}
+
+// placedBounds は配置済みのテキスト全体の外接矩形（ピクセル）を返します
+func placedBounds(placed []placedText) image.Rectangle {
+	var bbox image.Rectangle
+	for _, p := range placed {
+		if p.outline != nil {
+			bbox = bbox.Union(font.OutlineBounds(p.outline))
+		}
+	}
+	return bbox
+}
+
+// paintTexts は配置済みのテキストをパスと同じ塗り・線・クリップの処理で描画します
+// グラデーションやパターンの objectBoundingBox はテキスト全体の外接矩形です
+func (rc *RasterContext) paintTexts(placed []placedText) {
+	bbox := placedBounds(placed)
+	for _, p := range placed {
+		// 巨大なフォントサイズのグリフは、ラスタライズする前に描画量の上限で拒否する
+		if !rc.chargeText(p.area) {
+			return
+		}
+		if p.outline != nil {
+			rc.paintGlyphs(p.outline, p.masks, p.st, bbox)
+			if p.color != nil {
+				// カラーグリフは fill/stroke の指定によらずフォントの色で描画する
+				for _, layer := range p.color(rc.fb.Bounds()) {
+					rc.compositePremultiplied(layer, p.st.Opacity)
+				}
+			}
+			continue
+		}
+		if p.content == "" || p.st.FillNone {
+			continue
+		}
+		// フォールバック: basicfont（塗りのみ）
+		_ = rc.fontRenderer.RenderText(p.content, "", rc.fontStyleStr(p.st), rc.scaledFontSizePt(p.st), rc.fb.Image(), p.x, p.y, p.st.Fill)
+		rc.Report(diagnostic.SeverityWarning, diagnostic.CodeShaping, fmt.Sprintf("no shaping font; %q drawn with the built-in bitmap font", truncateRunes(p.content, 16)))
+	}
+}
+
+// paintGlyphs はグリフアウトラインを塗り・線で描画します
+// 単色の塗りは masks があればキャッシュ済みのグリフのマスクを合成します
+func (rc *RasterContext) paintGlyphs(outline glyphOutline, masks glyphMasks, st *style.ComputedStyle, bbox image.Rectangle) {
+	defer rc.useCoverage(rc.glyphCoverage(st))()
+	w, h := rc.fb.Bounds().Dx(), rc.fb.Bounds().Dy()
+
+	// Fill
+	if st.FillURL != "" {
+		rz := vector.NewRasterizer(w, h)
+		outline(rz)
+		alpha := rc.rasterizeAlpha(rz)
+		rc.applyClipToAlpha(alpha)
+		rc.drawURLFill(alpha, st.FillURL, bbox, st.FillOpacity*st.Opacity)
+	} else if !st.FillNone {
+		_, _, _, fa := st.Fill.RGBA()
+		if fa > 0 {
+			if alpha := rc.maskAlpha(masks); alpha != nil {
+				rc.compositeAlpha(alpha, st.Fill, st.FillOpacity*st.Opacity)
+			} else {
+				rz := vector.NewRasterizer(w, h)
+				outline(rz)
+				rc.rasterizeAndComposite(rz, st.Fill, st.FillOpacity*st.Opacity)
+			}
+		}
+	}
+
+	// Stroke（アウトラインを折れ線に平坦化して線を引く）
+	if !st.StrokeNone && st.StrokeWidth > 0 {
+		_, _, _, sa := st.Stroke.RGBA()
+		if sa > 0 {
+			fl := &pathFlattener{}
+			outline(fl)
+			sw := float32(rc.scaleLenX(st.StrokeWidth))
+			rz := vector.NewRasterizer(w, h)
+			if len(st.StrokeDasharray) > 0 {
+				dashPixels := scaleDasharray(st.StrokeDasharray, rc.fontScale())
+				for _, line := range fl.polylines() {
+					strokeSegmentsWithDash(rz, line, sw, dashPixels)
+				}
+			} else {
+				for _, line := range fl.polylines() {
+					strokePolyline(rz, line, sw)
+				}
+			}
+			rc.rasterizeAndComposite(rz, st.Stroke, st.StrokeOpacity*st.Opacity)
+		}
+	}
+}
+
+// strokePolyline は折れ線を太線で描き、曲がり角を丸く繋ぎます
+// 閉じた折れ線（始点と終点が一致）では始点の角も繋ぎます
+func strokePolyline(rz *vector.Rasterizer, pts [][2]float32, sw float32) {
+	if len(pts) < 2 {
+		return
+	}
+	for i := 0; i < len(pts)-1; i++ {
+		addThickLine(rz, pts[i][0], pts[i][1], pts[i+1][0], pts[i+1][1], sw)
+	}
+	closed := pts[0] == pts[len(pts)-1]
+	for i := range pts {
+		var prev, next [2]float32
+		switch {
+		case i > 0 && i < len(pts)-1:
+			prev, next = pts[i-1], pts[i+1]
+		case i == 0 && closed && len(pts) > 2:
+			prev, next = pts[len(pts)-2], pts[1]
+		default:
+			continue
+		}
+		if isSharpTurn(prev, pts[i], next) {
+			addJoinDisc(rz, pts[i][0], pts[i][1], sw/2)
+		}
+	}
+}
+
+// isSharpTurn は折れ線が点 p で約10度以上曲がるかを返します
+// 曲線を平坦化した細かな折れ目には継ぎ目を追加しません
+func isSharpTurn(prev, p, next [2]float32) bool {
+	ax, ay := float64(p[0]-prev[0]), float64(p[1]-prev[1])
+	bx, by := float64(next[0]-p[0]), float64(next[1]-p[1])
+	la, lb := math.Hypot(ax, ay), math.Hypot(bx, by)
+	if la == 0 || lb == 0 {
+		return false
+	}
+	return (ax*bx+ay*by)/(la*lb) < math.Cos(10*math.Pi/180)
+}
+
+// addJoinDisc は線の継ぎ目を埋める円をラスタライザーに追加します
+// addThickLine の四角形と同じ回転方向で追加し、重なりで打ち消し合わないようにします
+func addJoinDisc(rz *vector.Rasterizer, cx, cy, r float32) {
+	const n = 12
+	rz.MoveTo(cx+r, cy)
+	for i := 1; i < n; i++ {
+		theta := -2 * math.Pi * float64(i) / n
+		rz.LineTo(cx+r*float32(math.Cos(theta)), cy+r*float32(math.Sin(theta)))
+	}
+	rz.ClosePath()
+}
+
+// compositePremultiplied は乗算済みアルファの RGBA 画像をクリップを適用して合成します
+// 画像の Bounds はフレームバッファ上のピクセル座標です
+func (rc *RasterContext) compositePremultiplied(layer *image.RGBA, opacity float64) {
+	img := rc.fb.Image()
+	r := layer.Bounds().Intersect(img.Bounds())
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for px := r.Min.X; px < r.Max.X; px++ {
+			src := layer.RGBAAt(px, py)
+			if src.A == 0 {
+				continue
+			}
+			k := opacity
+			if rc.clipMask != nil {
+				k *= float64(rc.clipMask.AlphaAt(px, py).A) / 255
+			}
+			if k <= 0 {
+				continue
+			}
+			bg := img.RGBAAt(px, py)
+			inv := 1 - float64(src.A)/255*k
+			blend := func(s, d uint8) uint8 {
+				return uint8(math.Min(255, float64(s)*k+float64(d)*inv))
+			}
+			img.SetRGBA(px, py, color.RGBA{blend(src.R, bg.R), blend(src.G, bg.G), blend(src.B, bg.B), blend(src.A, bg.A)})
+		}
+	}
+}
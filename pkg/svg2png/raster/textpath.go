@@ -0,0 +1,350 @@
+package raster
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
+	"github.com/shinya/svg2png/pkg/svg2png/font"
+	"github.com/shinya/svg2png/pkg/svg2png/parser"
+)
+
+// TextPath は <textPath> による配置情報を表します
+type TextPath struct {
+	Data          string  // 参照先パスの d 属性
+	PathLength    float64 // 参照先パスの pathLength 属性（0 は未指定）
+	StartOffset   float64 // startOffset（ユーザー単位、または OffsetPercent 時は 0〜1 の割合）
+	OffsetPercent bool
+	Method        string // method（"align" | "stretch"）
+	Spacing       string // spacing（"exact" | "auto"。auto も exact と同じ配置を行う）
+	Side          string // side（"left" | "right"）
+}
+
+// LookupPath は id で参照される path 要素を返します（見つからない場合は nil）
+func (rc *RasterContext) LookupPath(id string) *parser.Element {
+	if rc.defs == nil || rc.defs.Paths == nil {
+		return nil
+	}
+	return rc.defs.Paths[id]
+}
+
+// flatPoint は平坦化したパス上の点です
+type flatPoint struct {
+	x, y float64
+	s    float64 // パス始点からの距離
+	move bool    // サブパスの開始点（直前の点とは繋がらない）
+}
+
+// pathFlattener は buildPath の出力を折れ線に平坦化し、長さと接線を求めます
+type pathFlattener struct {
+	pts    []flatPoint
+	startX float64
+	startY float64
+	length float64
+}
+
+func (f *pathFlattener) last() (float64, float64) {
+	if len(f.pts) == 0 {
+		return 0, 0
+	}
+	p := f.pts[len(f.pts)-1]
+	return p.x, p.y
+}
+
+func (f *pathFlattener) MoveTo(x, y float32) {
+	f.startX, f.startY = float64(x), float64(y)
+	f.pts = append(f.pts, flatPoint{x: float64(x), y: float64(y), s: f.length, move: true})
+}
+
+func (f *pathFlattener) lineTo(x, y float64) {
+	if len(f.pts) == 0 {
+		f.MoveTo(float32(x), float32(y))
+		return
+	}
+	lx, ly := f.last()
+	f.length += math.Hypot(x-lx, y-ly)
+	f.pts = append(f.pts, flatPoint{x: x, y: y, s: f.length})
+}
+
+func (f *pathFlattener) LineTo(x, y float32) { f.lineTo(float64(x), float64(y)) }
+
+func (f *pathFlattener) QuadTo(x1, y1, x, y float32) {
+	x0, y0 := f.last()
+	n := flattenSteps(x0, y0, float64(x1), float64(y1), float64(x), float64(y))
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		mt := 1 - t
+		f.lineTo(
+			mt*mt*x0+2*mt*t*float64(x1)+t*t*float64(x),
+			mt*mt*y0+2*mt*t*float64(y1)+t*t*float64(y),
+		)
+	}
+}
+
+func (f *pathFlattener) CubeTo(x1, y1, x2, y2, x, y float32) {
+	x0, y0 := f.last()
+	n := flattenSteps(x0, y0, float64(x1), float64(y1), float64(x2), float64(y2), float64(x), float64(y))
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		mt := 1 - t
+		a, b, c, d := mt*mt*mt, 3*mt*mt*t, 3*mt*t*t, t*t*t
+		f.lineTo(
+			a*x0+b*float64(x1)+c*float64(x2)+d*float64(x),
+			a*y0+b*float64(y1)+c*float64(y2)+d*float64(y),
+		)
+	}
+}
+
+func (f *pathFlattener) ClosePath() { f.lineTo(f.startX, f.startY) }
+
+// flattenSteps は制御点列の長さから曲線の分割数を決めます（約2ピクセルごと）
+func flattenSteps(coords ...float64) int {
+	l := 0.0
+	for i := 2; i+1 < len(coords); i += 2 {
+		l += math.Hypot(coords[i]-coords[i-2], coords[i+1]-coords[i-1])
+	}
+	return max(4, min(256, int(math.Ceil(l/2))))
+}
+
+// reverse はパスの向きを反転します（side="right" 用）
+func (f *pathFlattener) reverse() {
+	// サブパス単位で逆順に並べ、各サブパス内の点も反転する
+	var subpaths [][]flatPoint
+	for i, p := range f.pts {
+		if p.move || i == 0 {
+			subpaths = append(subpaths, nil)
+		}
+		subpaths[len(subpaths)-1] = append(subpaths[len(subpaths)-1], p)
+	}
+	var pts []flatPoint
+	length := 0.0
+	for i := len(subpaths) - 1; i >= 0; i-- {
+		sp := subpaths[i]
+		for j := len(sp) - 1; j >= 0; j-- {
+			p := sp[j]
+			p.move = j == len(sp)-1
+			if !p.move {
+				prev := pts[len(pts)-1]
+				length += math.Hypot(p.x-prev.x, p.y-prev.y)
+			}
+			p.s = length
+			pts = append(pts, p)
+		}
+	}
+	f.pts = pts
+	f.length = length
+}
+
+// polylines はサブパスごとの折れ線をピクセル座標で返します
+func (f *pathFlattener) polylines() [][][2]float32 {
+	var lines [][][2]float32
+	for i, p := range f.pts {
+		if p.move || i == 0 {
+			lines = append(lines, nil)
+		}
+		lines[len(lines)-1] = append(lines[len(lines)-1], [2]float32{float32(p.x), float32(p.y)})
+	}
+	return lines
+}
+
+// pointAt はパス始点から距離 s の位置と接線の角度を返します
+// s がパスの範囲外の場合は ok=false です
+func (f *pathFlattener) pointAt(s float64) (x, y, angle float64, ok bool) {
+	if s < 0 || s > f.length {
+		return 0, 0, 0, false
+	}
+	for i := 1; i < len(f.pts); i++ {
+		p0, p1 := f.pts[i-1], f.pts[i]
+		if p1.move || p1.s <= p0.s || s > p1.s {
+			continue
+		}
+		t := (s - p0.s) / (p1.s - p0.s)
+		return p0.x + (p1.x-p0.x)*t, p0.y + (p1.y-p0.y)*t, math.Atan2(p1.y-p0.y, p1.x-p0.x), true
+	}
+	return 0, 0, 0, false
+}
+
+// clampedPointAt は s をパスの範囲に丸めてから位置と接線を返します
+func (f *pathFlattener) clampedPointAt(s float64) (x, y, angle float64) {
+	x, y, angle, _ = f.pointAt(math.Max(0, math.Min(f.length, s)))
+	return x, y, angle
+}
+
+// DrawTextOnPath はスパン列をパスに沿って描画します
+// 各グリフは送り幅の中点での接線方向に回転され（method="stretch" ではパスに沿って変形）、
+// 中点がパスの範囲外になるグリフは描画しません
+// 戻り値は描画後の現在テキスト位置（SVGユーザー単位）です
+func (rc *RasterContext) DrawTextOnPath(spans []TextSpan, tp *TextPath, flow TextFlow) (endX, endY float64) {
+	if len(spans) == 0 || rc.fontRenderer == nil || tp == nil {
+		return 0, 0
+	}
+
+	fl := &pathFlattener{}
+	if err := buildPath(fl, tp.Data, rc.toPixelXY, false, 0); err != nil || fl.length == 0 {
+		rc.Report(diagnostic.SeverityError, diagnostic.CodeInvalidPath, fmt.Sprintf("textPath: invalid path: %v", err))
+		return 0, 0
+	}
+	if tp.Side == "right" {
+		fl.reverse()
+	}
+
+	// startOffset（pathLength 指定時はその比率で換算）
+	offset := 0.0
+	switch {
+	case tp.OffsetPercent:
+		offset = tp.StartOffset * fl.length
+	case tp.PathLength > 0:
+		offset = tp.StartOffset * fl.length / tp.PathLength
+	default:
+		offset = rc.scaleLenX(tp.StartOffset)
+	}
+
+	items, rtl := bidiItems(spans, flow.Direction)
+	pieces, total := rc.shapePieces(spans, items, false)
+	total = rc.adjustTextLength(spans, pieces, total, false)
+
+	// DY はパスの法線方向のずれとして論理順に累積する（ベースラインの揃えは累積しない）
+	cross := make([]float64, len(spans))
+	curCross := 0.0
+	baselines := rc.baselineOffsets(spans, flow.Style, false)
+	for i, s := range spans {
+		curCross += rc.scaleLenY(s.DY)
+		cross[i] = curCross + baselines[i]
+	}
+
+	start := offset
+	switch resolveTextAnchor(flow.Anchor, rtl) {
+	case "middle":
+		start -= total / 2
+	case "end":
+		start -= total
+	}
+
+	pos := start
+	var placed []placedText
+	for _, p := range pieces {
+		if !p.rtl {
+			pos += p.gap
+		}
+		if p.shaped == nil {
+			if p.content != "" {
+				rc.Report(diagnostic.SeverityWarning, diagnostic.CodeShaping, fmt.Sprintf("textPath: no shaping font for %q", p.content))
+			}
+			pos += p.advance
+		} else {
+			var glyphs []pathGlyph
+			for i := range p.shaped.runs {
+				run := p.shaped.runs[i]
+				if p.shaped.rtl {
+					run = p.shaped.runs[len(p.shaped.runs)-1-i]
+				}
+				for gi, g := range run.Glyphs {
+					mid := pos + g.XAdvance/2
+					if _, _, _, ok := fl.pointAt(mid); ok {
+						glyphs = append(glyphs, pathGlyph{run: run, index: gi, mid: mid, advance: g.XAdvance})
+					}
+					pos += g.XAdvance
+				}
+			}
+			if len(glyphs) > 0 {
+				shift, method := cross[p.span], tp.Method
+				placed = append(placed, placedText{st: spans[p.span].Style, outline: func(sink font.OutlineSink) {
+					for _, g := range glyphs {
+						placeGlyphOnPath(g, fl, shift, method, sink)
+					}
+				}})
+			}
+		}
+		if p.rtl {
+			pos += p.gap
+		}
+	}
+	rc.paintTexts(placed)
+
+	if rtl {
+		pos = start
+	}
+	x, y, _ := fl.clampedPointAt(pos)
+	return rc.fromPixelXY(x, y)
+}
+
+// pathGlyph はパス上に置くグリフです
+type pathGlyph struct {
+	run     *font.GlyphRun
+	index   int
+	mid     float64 // 送り幅の中点のパス上の距離
+	advance float64
+}
+
+// placeGlyphOnPath はグリフをパス上の距離 g.mid を中心に配置して sink に出力します
+func placeGlyphOnPath(g pathGlyph, fl *pathFlattener, shift float64, method string, sink font.OutlineSink) {
+	if method == "stretch" {
+		g.run.GlyphOutline(g.index, &pathWarpSink{sink: sink, fl: fl, origin: g.mid - g.advance/2, shift: shift})
+		return
+	}
+	x, y, angle, _ := fl.pointAt(g.mid)
+	g.run.GlyphOutline(g.index, &affineSink{
+		sink: sink,
+		cos:  math.Cos(angle), sin: math.Sin(angle),
+		dx: -g.advance / 2, dy: shift,
+		tx: x, ty: y,
+	})
+}
+
+// affineSink はグリフ座標を (dx, dy) 平行移動した後に回転し、(tx, ty) に配置します
+type affineSink struct {
+	sink     pathSink
+	cos, sin float64
+	dx, dy   float64
+	tx, ty   float64
+}
+
+func (a *affineSink) pt(u, v float32) (float32, float32) {
+	x, y := float64(u)+a.dx, float64(v)+a.dy
+	return float32(a.tx + x*a.cos - y*a.sin), float32(a.ty + x*a.sin + y*a.cos)
+}
+
+func (a *affineSink) MoveTo(u, v float32) { a.sink.MoveTo(a.pt(u, v)) }
+func (a *affineSink) LineTo(u, v float32) { a.sink.LineTo(a.pt(u, v)) }
+func (a *affineSink) QuadTo(u1, v1, u, v float32) {
+	x1, y1 := a.pt(u1, v1)
+	x, y := a.pt(u, v)
+	a.sink.QuadTo(x1, y1, x, y)
+}
+func (a *affineSink) CubeTo(u1, v1, u2, v2, u, v float32) {
+	x1, y1 := a.pt(u1, v1)
+	x2, y2 := a.pt(u2, v2)
+	x, y := a.pt(u, v)
+	a.sink.CubeTo(x1, y1, x2, y2, x, y)
+}
+func (a *affineSink) ClosePath() { a.sink.ClosePath() }
+
+// pathWarpSink はグリフ座標をパスに沿って変形します（method="stretch"）
+// x 座標はパス上の距離、y 座標は法線方向のずれとして扱います
+type pathWarpSink struct {
+	sink   pathSink
+	fl     *pathFlattener
+	origin float64 // グリフ原点のパス上の距離
+	shift  float64 // 法線方向のずれ（DY）
+}
+
+func (p *pathWarpSink) pt(u, v float32) (float32, float32) {
+	x, y, angle := p.fl.clampedPointAt(p.origin + float64(u))
+	d := float64(v) + p.shift
+	return float32(x - d*math.Sin(angle)), float32(y + d*math.Cos(angle))
+}
+
+func (p *pathWarpSink) MoveTo(u, v float32) { p.sink.MoveTo(p.pt(u, v)) }
+func (p *pathWarpSink) LineTo(u, v float32) { p.sink.LineTo(p.pt(u, v)) }
+func (p *pathWarpSink) QuadTo(u1, v1, u, v float32) {
+	x1, y1 := p.pt(u1, v1)
+	x, y := p.pt(u, v)
+	p.sink.QuadTo(x1, y1, x, y)
+}
+func (p *pathWarpSink) CubeTo(u1, v1, u2, v2, u, v float32) {
+	x1, y1 := p.pt(u1, v1)
+	x2, y2 := p.pt(u2, v2)
+	x, y := p.pt(u, v)
+	p.sink.CubeTo(x1, y1, x2, y2, x, y)
+}
+func (p *pathWarpSink) ClosePath() { p.sink.ClosePath() }
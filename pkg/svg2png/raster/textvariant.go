@@ -0,0 +1,145 @@
+package raster
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
+	"github.com/shinya/svg2png/pkg/svg2png/font"
+	"github.com/shinya/svg2png/pkg/svg2png/style"
+)
+
+// smallCapsScale は合成するスモールキャップの大文字の縮小率です
+const smallCapsScale = 0.7
+
+// capsSegment は font-variant-caps を適用してシェーピングする区間です
+type capsSegment struct {
+	content string
+	scale   float64 // フォントサイズの倍率（合成したスモールキャップでは smallCapsScale）
+	opts    font.ShapeOptions
+}
+
+// capsFeatures は font-variant-caps に対応する OpenType フィーチャーです
+var capsFeatures = map[string][]string{
+	"small-caps":      {"smcp"},
+	"all-small-caps":  {"smcp", "c2sc"},
+	"petite-caps":     {"pcap"},
+	"all-petite-caps": {"pcap", "c2pc"},
+	"unicase":         {"unic"},
+	"titling-caps":    {"titl"},
+}
+
+// capsSegments は font-variant-caps に従ってテキストをシェーピングの区間に分けます
+// フォントにフィーチャーがあれば有効にし、スモールキャップ（petite-caps を含む）のフィーチャーがない場合は
+// 小文字（all-small-caps では大文字も）を縮小した大文字で合成します（synthesize が false の場合は合成しません）
+func capsSegments(content string, face *font.FontFace, caps string, synthesize bool, opts font.ShapeOptions) []capsSegment {
+	tags := capsFeatures[caps]
+	if len(tags) == 0 {
+		return []capsSegment{{content: content, scale: 1, opts: opts}}
+	}
+	if face.HasFeature(tags[0]) {
+		// font-feature-settings の指定が優先されるよう先頭に追加する
+		var features []font.FontFeature
+		for _, tag := range tags {
+			features = append(features, font.FontFeature{Tag: tag, Value: 1})
+		}
+		opts.Features = append(features, opts.Features...)
+		return []capsSegment{{content: content, scale: 1, opts: opts}}
+	}
+
+	if !synthesize {
+		return []capsSegment{{content: content, scale: 1, opts: opts}}
+	}
+	var all bool
+	switch caps {
+	case "small-caps", "petite-caps":
+	case "all-small-caps", "all-petite-caps":
+		all = true
+	default:
+		// unicase / titling-caps は合成しない
+		return []capsSegment{{content: content, scale: 1, opts: opts}}
+	}
+	var segs []capsSegment
+	var cur []rune
+	curSmall := false
+	flush := func() {
+		if len(cur) > 0 {
+			scale := 1.0
+			if curSmall {
+				scale = smallCapsScale
+			}
+			segs = append(segs, capsSegment{content: string(cur), scale: scale, opts: opts})
+		}
+		cur = cur[:0]
+	}
+	for _, r := range content {
+		small := unicode.IsLower(r) || (all && unicode.IsUpper(r))
+		if small != curSmall {
+			flush()
+			curSmall = small
+		}
+		if small {
+			cur = append(cur, []rune(upperCase(r))...)
+		} else {
+			cur = append(cur, r)
+		}
+	}
+	flush()
+	return segs
+}
+
+// upperCase は文字を大文字にします（ß のように複数の文字になる場合を含む）
+func upperCase(r rune) string {
+	if r == 'ß' {
+		return "SS"
+	}
+	return string(unicode.ToUpper(r))
+}
+
+// synthesisOptions はフェイスに足りない太さ・傾きを、font-synthesis が許す場合に合成する設定を opts に加えます
+// 合成したフェイスは診断情報に記録します
+func (rc *RasterContext) synthesisOptions(opts font.ShapeOptions, face *font.FontFace, st *style.ComputedStyle) font.ShapeOptions {
+	q := rc.fontQuery(st)
+	bold, oblique := face.Synthesis(q)
+	if bold && st.FontSynthesisWeight {
+		opts.SyntheticBold = true
+		rc.Report(diagnostic.SeverityInfo, diagnostic.CodeFontSynthesis, fmt.Sprintf("synthetic bold: %q %s for font-weight %g", face.Family, face.Style, q.Weight))
+	}
+	if angle := obliqueAngle(st.FontStyle); oblique && st.FontSynthesisStyle && angle != 0 {
+		opts.SyntheticOblique = angle
+		rc.Report(diagnostic.SeverityInfo, diagnostic.CodeFontSynthesis, fmt.Sprintf("synthetic oblique: %q %s for font-style %s", face.Family, face.Style, st.FontStyle))
+	}
+	return opts
+}
+
+// obliqueAngle は font-style の傾き（度）を返します
+// italic と角度を指定しない oblique は font.DefaultObliqueAngle、"oblique 10deg" は指定の角度です
+func obliqueAngle(fontStyle string) float64 {
+	fields := strings.Fields(fontStyle)
+	if len(fields) == 0 || (fields[0] != "italic" && fields[0] != "oblique") {
+		return 0
+	}
+	if fields[0] == "oblique" && len(fields) > 1 {
+		if deg, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "deg"), 64); err == nil {
+			return math.Max(-90, math.Min(90, deg))
+		}
+	}
+	return font.DefaultObliqueAngle
+}
+
+// fontSizeAdjust は font-size-adjust で揃える x-height とフォントサイズの比を返します（0 の場合は調整しない）
+// from-font の場合は最初に使えるフォントの比率を使います
+func (rc *RasterContext) fontSizeAdjust(st *style.ComputedStyle) float64 {
+	if st.FontSizeAdjust > 0 {
+		return st.FontSizeAdjust
+	}
+	if st.FontSizeAdjustFromFont {
+		if faces := rc.fontCandidates(st); len(faces) > 0 {
+			return faces[0].Metrics().XHeight
+		}
+	}
+	return 0
+}
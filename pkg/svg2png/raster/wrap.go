@@ -0,0 +1,338 @@
+package raster
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/go-text/typesetting/segmenter"
+
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
+	"github.com/shinya/svg2png/pkg/svg2png/style"
+)
+
+// ============================================================
+// テキストの折り返し（SVG 2 の inline-size / shape-inside）
+// ============================================================
+
+// TextArea は折り返して配置するテキストの領域です
+type TextArea struct {
+	X, Y       float64      // inline-size の場合の最初の行の位置（text-anchor の基準点）
+	InlineSize float64      // 行の長さ（SVGユーザー単位）
+	Shape      [][2]float64 // shape-inside の多角形（SVGユーザー単位。nil の場合は inline-size で折り返す）
+	Padding    float64      // shape-padding
+}
+
+// ShapeInside は shape-inside で参照される rect / polygon を多角形として返します（見つからない場合は nil）
+// 参照先の要素の transform は適用しません
+func (rc *RasterContext) ShapeInside(id string) [][2]float64 {
+	if rc.defs == nil || rc.defs.Shapes == nil {
+		return nil
+	}
+	elem := rc.defs.Shapes[id]
+	if elem == nil {
+		rc.Report(diagnostic.SeverityWarning, diagnostic.CodeMissingReference, fmt.Sprintf("shape-inside: shape not found: #%s", id))
+		return nil
+	}
+	switch elem.Name {
+	case "rect":
+		x, y := parseAttrF(elem, "x"), parseAttrF(elem, "y")
+		w, h := parseAttrF(elem, "width"), parseAttrF(elem, "height")
+		if w <= 0 || h <= 0 {
+			return nil
+		}
+		return [][2]float64{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}
+	case "polygon":
+		if pts := parsePointsStrLocal(elem.Attributes["points"]); len(pts) >= 3 {
+			return pts
+		}
+	}
+	return nil
+}
+
+// wrapSegment は改行の機会（UAX #14）で区切ったテキストの区間です
+type wrapSegment struct {
+	start, end int     // ルーン位置 [start, end)
+	width      float64 // 末尾の空白を含む送り幅（SVGユーザー単位）
+	trimmed    float64 // 末尾の空白と改行を除いた送り幅
+	mandatory  bool    // 区間の後で必ず改行する
+}
+
+// DrawTextArea は複数スパンを領域内で折り返して描画します
+// 改行の位置は Unicode の行分割アルゴリズム（UAX #14）に従い、行の長さは描画と同じシェーピング結果で計測します。
+// white-space が nowrap / pre の文字の後では折り返さず、pre / pre-wrap / pre-line で保持された改行では必ず改行します。
+// 各行は text-anchor に従って配置し、行の間隔は line-height で決めます。
+// shape-inside の領域に収まらない行は描画しません
+// 戻り値は描画後の現在テキスト位置（SVGユーザー単位）です
+func (rc *RasterContext) DrawTextArea(spans []TextSpan, area TextArea, flow TextFlow) (endX, endY float64) {
+	if len(spans) == 0 || rc.fontRenderer == nil {
+		return area.X, area.Y
+	}
+	vertical := flow.WritingMode == "vertical-rl" || flow.WritingMode == "vertical-lr"
+	if vertical && area.Shape != nil {
+		rc.Report(diagnostic.SeverityWarning, diagnostic.CodeUnsupportedElement, "shape-inside for vertical text")
+		return rc.DrawTextGroup(spans, area.X, area.Y, flow)
+	}
+
+	// 折り返した行では子孫の位置属性は使わない
+	spans = append([]TextSpan(nil), spans...)
+	var text []rune
+	var spanOf []int
+	for i, s := range spans {
+		spans[i].DX, spans[i].DY = 0, 0
+		for _, r := range s.Content {
+			text = append(text, r)
+			spanOf = append(spanOf, i)
+		}
+	}
+	if len(text) == 0 {
+		return area.X, area.Y
+	}
+	segments := rc.wrapSegments(spans, text, spanOf, flow, vertical)
+
+	root := flow.Style
+	if root == nil {
+		root = spans[0].Style
+	}
+
+	endX, endY = area.X, area.Y
+	var baseline float64
+	var bottom float64 // shape-inside の下端
+	if area.Shape != nil {
+		top := math.Inf(1)
+		bottom = math.Inf(-1)
+		for _, p := range area.Shape {
+			top, bottom = math.Min(top, p[1]), math.Max(bottom, p[1])
+		}
+		ascent, _ := rc.lineExtent(root)
+		baseline = top + area.Padding + ascent
+	}
+	prevDescent := 0.0
+	for i, first := 0, true; i < len(segments); first = false {
+		// 行の配置位置と長さ
+		x, y := area.X, area.Y
+		avail := area.InlineSize
+		var lo, hi float64
+		if area.Shape != nil {
+			ascent, descent := rc.lineExtent(root)
+			if !first {
+				baseline += prevDescent + ascent
+			}
+			var ok bool
+			for {
+				if baseline+descent > bottom-area.Padding {
+					return endX, endY
+				}
+				if lo, hi, ok = shapeInterval(area.Shape, baseline-ascent, baseline+descent, area.Padding); ok {
+					break
+				}
+				baseline++
+			}
+			avail = hi - lo
+		}
+
+		// 入る限りの区間を1行にまとめる（1つも入らない場合も1区間は置く）
+		j, width := i, 0.0
+		for j < len(segments) {
+			s := segments[j]
+			if j > i && width+s.trimmed > avail {
+				break
+			}
+			width += s.width
+			j++
+			if s.mandatory {
+				break
+			}
+		}
+		lineSpans := lineSpans(spans, text, spanOf, segments[i].start, lineEnd(text, segments[i].start, segments[j-1].end))
+
+		ascent, descent, advance := 0.0, 0.0, 0.0
+		for _, s := range lineSpans {
+			a, d := rc.lineExtent(s.Style)
+			ascent, descent, advance = math.Max(ascent, a), math.Max(descent, d), math.Max(advance, a+d)
+		}
+		if len(lineSpans) == 0 {
+			ascent, descent = rc.lineExtent(root)
+			advance = ascent + descent
+		}
+		switch {
+		case area.Shape != nil:
+			_, rtl := bidiItems(lineSpans, flow.Direction)
+			switch resolveTextAnchor(flow.Anchor, rtl) {
+			case "middle":
+				x = (lo + hi) / 2
+			case "end":
+				x = hi
+			default:
+				x = lo
+			}
+			y = baseline
+			prevDescent = descent
+		case vertical:
+			// 縦書きでは行は vertical-rl で左へ、vertical-lr で右へ進む
+			if !first {
+				step := prevDescent + advance/2
+				if flow.WritingMode == "vertical-rl" {
+					step = -step
+				}
+				endX += step
+			}
+			x, y = endX, area.Y
+			prevDescent = advance / 2
+		default:
+			if !first {
+				baseline += prevDescent + ascent
+			}
+			x, y = area.X, area.Y+baseline
+			prevDescent = descent
+		}
+
+		if len(lineSpans) > 0 {
+			rc.DrawTextGroup(lineSpans, x, y, flow)
+		}
+		endX, endY = x, y
+		i = j
+	}
+	return endX, endY
+}
+
+// wrapSegments はテキストを改行の機会で区間に分け、それぞれの送り幅を計測します
+// 折り返しを禁止する white-space の文字の後の改行の機会は次の区間とまとめます
+func (rc *RasterContext) wrapSegments(spans []TextSpan, text []rune, spanOf []int, flow TextFlow, vertical bool) []wrapSegment {
+	var seg segmenter.Segmenter
+	seg.Init(text)
+	iter := seg.LineIterator()
+
+	var segments []wrapSegment
+	start := 0
+	for iter.Next() {
+		line := iter.Line()
+		end := line.Offset + len(line.Text)
+		ws := spans[spanOf[end-1]].Style.WhiteSpace
+		mandatory := line.IsMandatoryBreak && style.PreservesNewlines(ws)
+		if !mandatory && end < len(text) && (ws == "nowrap" || ws == "pre") {
+			continue
+		}
+		// 改行は送り幅を持たない
+		widthEnd := end
+		if text[end-1] == '\n' {
+			widthEnd--
+		}
+		segments = append(segments, wrapSegment{
+			start:     start,
+			end:       end,
+			width:     rc.measureRange(spans, text, spanOf, start, widthEnd, flow, vertical),
+			trimmed:   rc.measureRange(spans, text, spanOf, start, lineEnd(text, start, end), flow, vertical),
+			mandatory: mandatory,
+		})
+		start = end
+	}
+	return segments
+}
+
+// measureRange はテキストの [start, end) の送り幅（SVGユーザー単位）を返します
+func (rc *RasterContext) measureRange(spans []TextSpan, text []rune, spanOf []int, start, end int, flow TextFlow, vertical bool) float64 {
+	sub := lineSpans(spans, text, spanOf, start, end)
+	if len(sub) == 0 {
+		return 0
+	}
+	direction := flow.Direction
+	if vertical {
+		direction = "ltr"
+	}
+	items, _ := bidiItems(sub, direction)
+	_, total := rc.shapePieces(sub, items, vertical)
+	if vertical {
+		return total / rc.scaleLenY(1)
+	}
+	return total / rc.scaleLenX(1)
+}
+
+// lineSpans はテキストの [start, end) をスパンごとに切り出します
+func lineSpans(spans []TextSpan, text []rune, spanOf []int, start, end int) []TextSpan {
+	var out []TextSpan
+	for i := start; i < end; i++ {
+		if i == start || spanOf[i] != spanOf[i-1] {
+			s := spans[spanOf[i]]
+			s.Content = ""
+			out = append(out, s)
+		}
+		out[len(out)-1].Content += string(text[i])
+	}
+	return out
+}
+
+// lineEnd は行末に置く空白と改行を除いた終端のルーン位置を返します
+func lineEnd(text []rune, start, end int) int {
+	for end > start && (text[end-1] == ' ' || text[end-1] == '\n') {
+		end--
+	}
+	return end
+}
+
+// lineExtent はスタイルの行の高さをベースラインより上と下に分けて返します（SVGユーザー単位）
+// line-height とフォントの ascent + descent の差は上下に等分します（half-leading）
+func (rc *RasterContext) lineExtent(st *style.ComputedStyle) (ascent, descent float64) {
+	m := rc.fontMetrics(st)
+	ascent, descent = m.Ascent*st.FontSize, m.Descent*st.FontSize
+	lineHeight, ok := st.LineHeightPx()
+	if !ok {
+		lineHeight = ascent + descent + m.LineGap*st.FontSize
+	}
+	halfLeading := (lineHeight - ascent - descent) / 2
+	return ascent + halfLeading, descent + halfLeading
+}
+
+// shapeInterval は多角形の中で高さ [top, bottom] の帯全体が収まる最も広い横の区間を返します
+// 帯の上下と内部の数か所で多角形を横に切った区間の共通部分を求め、padding の分だけ内側に狭めます
+func shapeInterval(poly [][2]float64, top, bottom, padding float64) (lo, hi float64, ok bool) {
+	const samples = 5
+	var common [][2]float64
+	for k := 0; k < samples; k++ {
+		y := top - padding + (bottom-top+2*padding)*float64(k)/(samples-1)
+		spans := scanPolygon(poly, y)
+		if k == 0 {
+			common = spans
+		} else {
+			common = intersectIntervals(common, spans)
+		}
+	}
+	for _, iv := range common {
+		a, b := iv[0]+padding, iv[1]-padding
+		if b > a && (!ok || b-a > hi-lo) {
+			lo, hi, ok = a, b, true
+		}
+	}
+	return lo, hi, ok
+}
+
+// scanPolygon は多角形を高さ y で横に切った内側の区間を返します（偶奇規則）
+func scanPolygon(poly [][2]float64, y float64) [][2]float64 {
+	var xs []float64
+	for i := range poly {
+		a, b := poly[i], poly[(i+1)%len(poly)]
+		if (a[1] <= y && b[1] > y) || (b[1] <= y && a[1] > y) {
+			xs = append(xs, a[0]+(y-a[1])*(b[0]-a[0])/(b[1]-a[1]))
+		}
+	}
+	sort.Float64s(xs)
+	var out [][2]float64
+	for i := 0; i+1 < len(xs); i += 2 {
+		out = append(out, [2]float64{xs[i], xs[i+1]})
+	}
+	return out
+}
+
+// intersectIntervals は2つの区間列の共通部分を返します
+func intersectIntervals(a, b [][2]float64) [][2]float64 {
+	var out [][2]float64
+	for _, p := range a {
+		for _, q := range b {
+			lo, hi := math.Max(p[0], q[0]), math.Min(p[1], q[1])
+			if hi > lo {
+				out = append(out, [2]float64{lo, hi})
+			}
+		}
+	}
+	return out
+}
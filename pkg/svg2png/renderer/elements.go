@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
 	"github.com/shinya/svg2png/pkg/svg2png/parser"
 	"github.com/shinya/svg2png/pkg/svg2png/raster"
 	"github.com/shinya/svg2png/pkg/svg2png/style"
@@ -12,13 +13,20 @@ import (
 )
 
 // RenderElements はSVG要素を描画します
+// 描画はコンテキストの中断（rc.SetContext）や資源の上限で要素の区切りごとに打ち切り、その理由を返します
 func RenderElements(doc *parser.Document, vp *viewport.Viewport, resolver *style.StyleResolver, rc *raster.RasterContext) error {
-	return renderChildren(doc.Root.Children, vp, resolver, rc)
+	if err := renderChildren(doc.Root.Children, vp, resolver, rc); err != nil {
+		return err
+	}
+	return rc.Err()
 }
 
 // renderChildren は子要素リストを描画します
 func renderChildren(children []*parser.Element, vp *viewport.Viewport, resolver *style.StyleResolver, rc *raster.RasterContext) error {
 	for _, child := range children {
+		if err := rc.Err(); err != nil {
+			return err
+		}
 		if err := renderElement(child, vp, resolver, rc); err != nil {
 			return err
 		}
@@ -29,6 +37,7 @@ func renderChildren(children []*parser.Element, vp *viewport.Viewport, resolver
 // renderElement は個別の要素を描画します
 func renderElement(elem *parser.Element, vp *viewport.Viewport, resolver *style.StyleResolver, rc *raster.RasterContext) error {
 	log.Printf("Rendering element: <%s>", elem.Name)
+	defer rc.AtElement(elem)()
 
 	switch elem.Name {
 	case "g", "svg":
@@ -46,8 +55,9 @@ func renderElement(elem *parser.Element, vp *viewport.Viewport, resolver *style.
 		// 描画しない要素
 		return nil
 
-	case "use":
-		// TODO: use 要素のサポート
+	case "use", "image", "foreignObject":
+		// 未対応の要素は描画せずに診断に記録する
+		rc.Report(diagnostic.SeverityWarning, diagnostic.CodeUnsupportedElement, "<"+elem.Name+">")
 		return nil
 
 	case "path":
@@ -213,128 +223,6 @@ func renderPolyline(elem *parser.Element, st *style.ComputedStyle, rc *raster.Ra
 	return nil
 }
 
-// renderText はテキスト要素を描画します
-func renderText(elem *parser.Element, st *style.ComputedStyle, resolver *style.StyleResolver, rc *raster.RasterContext) error {
-	// ベース位置を取得
-	var baseX, baseY float64
-	if x, err := parseAttrFloat(elem, "x"); err == nil {
-		baseX = x
-	}
-	if y, err := parseAttrFloat(elem, "y"); err == nil {
-		baseY = y
-	}
-
-	// tspan 子要素を持つかチェック
-	var tspanChildren []*parser.Element
-	for _, child := range elem.Children {
-		if child.Name == "tspan" && child.Text != "" {
-			// 絶対x位置を持たないtspan（フロー型）かチェック
-			if _, err := parseAttrFloat(child, "x"); err != nil {
-				tspanChildren = append(tspanChildren, child)
-			}
-		}
-	}
-
-	if len(tspanChildren) > 0 && elem.Text != "" {
-		// フロー型テキスト: text + tspan を結合してグループ描画
-		spans := make([]raster.TextSpan, 0)
-
-		// 親のテキスト（末尾にスペースを追加）
-		mainText := strings.TrimSpace(elem.Text)
-		if mainText != "" {
-			mainText += " "
-			spans = append(spans, raster.TextSpan{Content: mainText, Style: st})
-		}
-
-		for _, child := range tspanChildren {
-			childSt := resolver.ComputedFromParent(child, st)
-			text := strings.TrimSpace(child.Text)
-			if text != "" {
-				spans = append(spans, raster.TextSpan{Content: text, Style: childSt})
-			}
-		}
-
-		if len(spans) > 0 {
-			rc.DrawTextGroup(spans, baseX, baseY, st.TextAnchor)
-		}
-
-		// 絶対位置を持つ tspan は別途描画
-		for _, child := range elem.Children {
-			if child.Name != "tspan" || child.Text == "" {
-				continue
-			}
-			if _, err := parseAttrFloat(child, "x"); err == nil {
-				// 絶対x位置を持つtspan
-				childSt := resolver.ComputedFromParent(child, st)
-				x, y := baseX, baseY
-				if xv, err2 := parseAttrFloat(child, "x"); err2 == nil {
-					x = xv
-				}
-				if yv, err2 := parseAttrFloat(child, "y"); err2 == nil {
-					y = yv
-				}
-				if dx, err2 := parseAttrFloat(child, "dx"); err2 == nil {
-					x += dx
-				}
-				if dy, err2 := parseAttrFloat(child, "dy"); err2 == nil {
-					y += dy
-				}
-				text := &raster.Text{X: x, Y: y, Content: child.Text}
-				rc.DrawText(text, childSt)
-			}
-		}
-		return nil
-	}
-
-	// 単純な直接テキスト（tspan なし）
-	if elem.Text != "" {
-		text := &raster.Text{
-			X:       baseX,
-			Y:       baseY,
-			Content: elem.Text,
-		}
-		rc.DrawText(text, st)
-	}
-
-	// tspan 子要素を個別に描画
-	for _, child := range elem.Children {
-		if child.Name != "tspan" {
-			continue
-		}
-
-		// 親スタイルを継承して子のスタイルを計算
-		childSt := resolver.ComputedFromParent(child, st)
-
-		x := baseX
-		y := baseY
-		if xStr, err := parseAttrFloat(child, "x"); err == nil {
-			x = xStr
-		}
-		if yStr, err := parseAttrFloat(child, "y"); err == nil {
-			y = yStr
-		}
-		// dx/dy 属性（相対オフセット）
-		if dx, err := parseAttrFloat(child, "dx"); err == nil {
-			x += dx
-		}
-		if dy, err := parseAttrFloat(child, "dy"); err == nil {
-			y += dy
-		}
-
-		content := child.Text
-		if content != "" {
-			text := &raster.Text{
-				X:       x,
-				Y:       y,
-				Content: content,
-			}
-			rc.DrawText(text, childSt)
-		}
-	}
-
-	return nil
-}
-
 // ============================================================
 // ユーティリティ関数
 // ============================================================
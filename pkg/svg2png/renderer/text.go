@@ -0,0 +1,457 @@
+package renderer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
+	"github.com/shinya/svg2png/pkg/svg2png/parser"
+	"github.com/shinya/svg2png/pkg/svg2png/raster"
+	"github.com/shinya/svg2png/pkg/svg2png/style"
+)
+
+// textPosition は要素の x/y/dx/dy 属性の値リストと、その消費位置を保持します
+// SVG の仕様どおり、リストの i 番目の値は要素の子孫を含む i 番目の文字に適用されます
+type textPosition struct {
+	x, y, dx, dy []float64
+	index        int
+}
+
+// textChar は空白処理後のアドレス可能な1文字を表します
+type textChar struct {
+	r       rune
+	style   *style.ComputedStyle
+	owners  []*textPosition      // 外側（<text>）から内側の順に並んだ祖先要素の位置属性
+	control bool                 // unicode-bidi により挿入された双方向制御文字（アドレス不可）
+	path    *raster.TextPath     // 文字を含む <textPath>（なければ nil）
+	lengths []*raster.TextLength // 文字を含む要素の textLength（外側から内側の順）
+}
+
+// textChunk は絶対位置（x または y）で始まるテキストチャンクです
+// text-anchor はチャンク単位で適用されます
+type textChunk struct {
+	x, y       float64
+	hasX, hasY bool
+	anchor     string
+	spans      []raster.TextSpan
+	path       *raster.TextPath // パスに沿って配置するチャンク
+}
+
+// textCollector は <text> の混在コンテンツを文書順に走査して文字列を集めます
+type textCollector struct {
+	resolver *style.StyleResolver
+	rc       *raster.RasterContext
+	chars    []textChar
+	wrap     bool                 // inline-size / shape-inside で折り返す（保持する改行を文字として残す）
+	path     *raster.TextPath     // 走査中の <textPath>
+	lengths  []*raster.TextLength // 走査中の要素と祖先の textLength（外側から内側の順）
+}
+
+// renderText はテキスト要素を描画します
+// 文字データと任意の深さの <tspan> を文書順に並べ、チャンクごとに描画します
+func renderText(elem *parser.Element, st *style.ComputedStyle, resolver *style.StyleResolver, rc *raster.RasterContext) error {
+	// フィルターは <text> 要素全体を1つのレイヤーとして適用する
+	if st.FilterID != "" {
+		stNoFilter := *st
+		stNoFilter.FilterID = ""
+		var err error
+		rc.DrawFiltered(st.FilterID, func(layer *raster.RasterContext) {
+			err = renderText(elem, &stNoFilter, resolver, layer)
+		})
+		return err
+	}
+
+	// SVG 2 の自動折り返し（shape-inside は inline-size より優先する）
+	var area *raster.TextArea
+	if st.ShapeInside != "" {
+		if shape := rc.ShapeInside(st.ShapeInside); shape != nil {
+			area = &raster.TextArea{Shape: shape, Padding: st.ShapePadding}
+		}
+	}
+	if area == nil && st.InlineSize > 0 {
+		area = &raster.TextArea{InlineSize: st.InlineSize}
+	}
+
+	tc := &textCollector{resolver: resolver, rc: rc, wrap: area != nil}
+	tc.collect(elem, st, nil)
+	tc.trimTrailingSpace()
+
+	// 段落の基底方向と書字方向は <text> 要素のスタイルで決まる
+	flow := raster.TextFlowOf(st)
+
+	chunks := layoutTextChunks(tc.chars)
+	if area != nil && !hasTextPath(chunks) {
+		// 折り返すテキストは <text> の最初の x / y から始まる1つの段落として配置する
+		var spans []raster.TextSpan
+		for _, chunk := range chunks {
+			spans = append(spans, chunk.spans...)
+		}
+		if len(chunks) > 0 {
+			area.X, area.Y = chunks[0].x, chunks[0].y
+		}
+		flow.Anchor = st.TextAnchor
+		rc.DrawTextArea(spans, *area, flow)
+		return nil
+	}
+
+	// チャンクを順に描画（x/y を持たないチャンクは直前のチャンクの終端から続ける）
+	var penX, penY float64
+	for _, chunk := range chunks {
+		x, y := penX, penY
+		if chunk.hasX {
+			x = chunk.x
+		}
+		if chunk.hasY {
+			y = chunk.y
+		}
+		flow.Anchor = chunk.anchor
+		if chunk.path != nil {
+			penX, penY = rc.DrawTextOnPath(chunk.spans, chunk.path, flow)
+			continue
+		}
+		penX, penY = rc.DrawTextGroup(chunk.spans, x, y, flow)
+	}
+	return nil
+}
+
+// collect は要素の内容を再帰的に走査して文字を集めます
+func (tc *textCollector) collect(elem *parser.Element, st *style.ComputedStyle, owners []*textPosition) {
+	pos := &textPosition{
+		x:  tc.lengthList("x", elem.Attributes["x"], st),
+		y:  tc.lengthList("y", elem.Attributes["y"], st),
+		dx: tc.lengthList("dx", elem.Attributes["dx"], st),
+		dy: tc.lengthList("dy", elem.Attributes["dy"], st),
+	}
+	// 兄弟要素間でスライスを共有しないようにコピーしてから追加する
+	owners = append(owners[:len(owners):len(owners)], pos)
+	if tl := tc.textLength(elem, st); tl != nil {
+		outer := tc.lengths
+		tc.lengths = append(outer[:len(outer):len(outer)], tl)
+		defer func() { tc.lengths = outer }()
+	}
+
+	opening, closing := bidiControls(st)
+	if elem.Name == "text" && st.UnicodeBidi == "plaintext" {
+		// <text> 自体の plaintext は段落の基底方向を内容から決める（TextFlowOf）ため、分離区間で囲まない
+		opening, closing = nil, nil
+	}
+	for _, r := range opening {
+		tc.chars = append(tc.chars, textChar{r: r, style: st, owners: owners, control: true, lengths: tc.lengths})
+	}
+
+	for _, node := range elem.Content {
+		if node.Elem == nil {
+			tc.appendText(node.Text, st, owners)
+			continue
+		}
+		switch node.Elem.Name {
+		case "tspan", "a":
+			childSt := tc.resolver.ComputedFromParent(node.Elem, st)
+			tc.collect(node.Elem, childSt, owners)
+		case "textPath":
+			childSt := tc.resolver.ComputedFromParent(node.Elem, st)
+			tp := tc.textPath(node.Elem, childSt)
+			if tp == nil {
+				// 参照先のないパスの内容は描画しない
+				continue
+			}
+			outer := tc.path
+			tc.path = tp
+			tc.collect(node.Elem, childSt, owners)
+			tc.path = outer
+		default:
+			// title / desc などテキスト内容を持たない要素は無視
+		}
+	}
+
+	for _, r := range closing {
+		tc.chars = append(tc.chars, textChar{r: r, style: st, owners: owners, control: true, lengths: tc.lengths})
+	}
+}
+
+// appendText は空白処理（xml:space / white-space）を適用しながら文字を追加します
+// 折りたたみ時は改行・タブを空白に変換し、連続する空白と先頭の空白を除去します
+// 折り返すテキストでは pre / pre-wrap / pre-line の改行を強制改行として残します
+func (tc *textCollector) appendText(text string, st *style.ComputedStyle, owners []*textPosition) {
+	preserve := style.PreservesSpaces(st.WhiteSpace)
+	keepNewline := tc.wrap && style.PreservesNewlines(st.WhiteSpace)
+	for _, r := range text {
+		if r == '\r' {
+			continue
+		}
+		if r == '\n' && keepNewline {
+			// pre-line では改行の前の空白を除去する
+			if last := tc.lastChar(); !preserve && last != nil && last.r == ' ' {
+				tc.removeLastChar()
+			}
+			tc.chars = append(tc.chars, textChar{r: r, style: st, owners: owners, lengths: tc.lengths})
+			continue
+		}
+		switch r {
+		case '\n', '\t':
+			r = ' '
+		}
+		if r == ' ' && !preserve {
+			if last := tc.lastChar(); last == nil || last.r == ' ' || last.r == '\n' {
+				continue
+			}
+		}
+		for _, t := range tc.transform(r, st) {
+			tc.chars = append(tc.chars, textChar{r: t, style: st, owners: owners, path: tc.path, lengths: tc.lengths})
+		}
+	}
+}
+
+// transform は text-transform を1文字に適用します（ß の大文字化のように複数の文字になる場合があります）
+// 大文字・小文字の変換は xml:lang がトルコ語・アゼルバイジャン語の場合、その言語の規則に従います
+func (tc *textCollector) transform(r rune, st *style.ComputedStyle) []rune {
+	upper, lower, title := unicode.ToUpper, unicode.ToLower, unicode.ToTitle
+	if lang := strings.ToLower(st.Lang); lang == "tr" || lang == "az" || strings.HasPrefix(lang, "tr-") || strings.HasPrefix(lang, "az-") {
+		upper, lower, title = unicode.TurkishCase.ToUpper, unicode.TurkishCase.ToLower, unicode.TurkishCase.ToTitle
+	}
+	switch st.TextTransform {
+	case "uppercase":
+		if r == 'ß' {
+			return []rune("SS")
+		}
+		return []rune{upper(r)}
+	case "lowercase":
+		return []rune{lower(r)}
+	case "capitalize":
+		// 単語の先頭（直前が文字・数字でない）の文字だけを変換する
+		if last := tc.lastChar(); last != nil && isWordRune(last.r) {
+			return []rune{r}
+		}
+		if r == 'ß' {
+			return []rune("Ss")
+		}
+		return []rune{title(r)}
+	case "full-width":
+		switch {
+		case r == ' ':
+			return []rune{'\u3000'}
+		case r >= 0x21 && r <= 0x7E:
+			return []rune{r + 0xFEE0}
+		}
+	}
+	return []rune{r}
+}
+
+// isWordRune は text-transform: capitalize で単語の一部とみなす文字かを返します
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r) || r == '\''
+}
+
+// textLength は要素の textLength / lengthAdjust を解析します（指定がない場合は nil）
+// 負の値は無効として無視します
+func (tc *textCollector) textLength(elem *parser.Element, st *style.ComputedStyle) *raster.TextLength {
+	values := tc.lengthList("textLength", elem.Attributes["textLength"], st)
+	if len(values) == 0 || values[0] < 0 {
+		return nil
+	}
+	tl := &raster.TextLength{Length: values[0], Adjust: "spacing"}
+	if strings.TrimSpace(elem.Attributes["lengthAdjust"]) == "spacingAndGlyphs" {
+		tl.Adjust = "spacingAndGlyphs"
+	}
+	return tl
+}
+
+// textPath は <textPath> 要素の配置情報を作成します
+// href（xlink:href を含む）で参照される path、または SVG 2 の path 属性を使用します
+func (tc *textCollector) textPath(elem *parser.Element, st *style.ComputedStyle) *raster.TextPath {
+	tp := &raster.TextPath{
+		Data:    elem.Attributes["path"],
+		Method:  elem.Attributes["method"],
+		Spacing: elem.Attributes["spacing"],
+		Side:    elem.Attributes["side"],
+	}
+	if href := strings.TrimPrefix(elem.Attributes["href"], "#"); href != "" {
+		target := tc.rc.LookupPath(href)
+		if target == nil {
+			tc.rc.Report(diagnostic.SeverityWarning, diagnostic.CodeMissingReference, fmt.Sprintf("textPath: path not found: #%s", href))
+			return nil
+		}
+		tp.Data = target.Attributes["d"]
+		if v, err := strconv.ParseFloat(strings.TrimSpace(target.Attributes["pathLength"]), 64); err == nil {
+			tp.PathLength = v
+		}
+	}
+	if tp.Data == "" {
+		return nil
+	}
+	if offset := strings.TrimSpace(elem.Attributes["startOffset"]); strings.HasSuffix(offset, "%") {
+		if v, err := strconv.ParseFloat(strings.TrimSuffix(offset, "%"), 64); err == nil {
+			tp.StartOffset = v / 100
+			tp.OffsetPercent = true
+		}
+	} else if values := tc.lengthList("startOffset", offset, st); len(values) > 0 {
+		tp.StartOffset = values[0]
+	}
+	return tp
+}
+
+// lastChar は最後のアドレス可能な文字（制御文字を除く）を返します
+func (tc *textCollector) lastChar() *textChar {
+	for i := len(tc.chars) - 1; i >= 0; i-- {
+		if !tc.chars[i].control {
+			return &tc.chars[i]
+		}
+	}
+	return nil
+}
+
+// removeLastChar は最後のアドレス可能な文字を除去します
+func (tc *textCollector) removeLastChar() {
+	for i := len(tc.chars) - 1; i >= 0; i-- {
+		if !tc.chars[i].control {
+			tc.chars = append(tc.chars[:i], tc.chars[i+1:]...)
+			return
+		}
+	}
+}
+
+// trimTrailingSpace は折りたたみ対象の末尾空白を除去します
+func (tc *textCollector) trimTrailingSpace() {
+	for i := len(tc.chars) - 1; i >= 0; i-- {
+		ch := tc.chars[i]
+		if ch.control {
+			continue
+		}
+		if ch.r != ' ' || style.PreservesSpaces(ch.style.WhiteSpace) {
+			return
+		}
+		tc.chars = append(tc.chars[:i], tc.chars[i+1:]...)
+	}
+}
+
+// bidiControls は unicode-bidi / direction に対応する双方向制御文字を返します
+// CSS Writing Modes の規定どおり、要素の内容をこれらの制御文字で囲んだものとして扱います
+func bidiControls(st *style.ComputedStyle) (opening, closing []rune) {
+	rtl := st.Direction == "rtl"
+	pick := func(ltr, rtlRune rune) rune {
+		if rtl {
+			return rtlRune
+		}
+		return ltr
+	}
+	const pdf, pdi, fsi = '\u202C', '\u2069', '\u2068'
+	switch st.UnicodeBidi {
+	case "embed":
+		return []rune{pick('\u202A', '\u202B')}, []rune{pdf} // LRE / RLE
+	case "bidi-override":
+		return []rune{pick('\u202D', '\u202E')}, []rune{pdf} // LRO / RLO
+	case "isolate":
+		return []rune{pick('\u2066', '\u2067')}, []rune{pdi} // LRI / RLI
+	case "isolate-override":
+		return []rune{pick('\u2066', '\u2067'), pick('\u202D', '\u202E')}, []rune{pdf, pdi}
+	case "plaintext":
+		return []rune{fsi}, []rune{pdi}
+	}
+	return nil, nil
+}
+
+// hasTextPath は <textPath> に沿って配置するチャンクがあるかを返します
+func hasTextPath(chunks []*textChunk) bool {
+	for _, chunk := range chunks {
+		if chunk.path != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// layoutTextChunks は文字列に位置属性を割り当て、チャンクとスパンに分割します
+func layoutTextChunks(chars []textChar) []*textChunk {
+	var chunks []*textChunk
+	var cur *textChunk
+	var content []rune
+
+	flush := func() {
+		if cur != nil && len(cur.spans) > 0 {
+			cur.spans[len(cur.spans)-1].Content = string(content)
+		}
+		content = content[:0]
+	}
+
+	var pending []textChar // チャンク決定前に保留している開始側の制御文字
+	appendChar := func(ch textChar, dx, dy float64) {
+		n := len(cur.spans)
+		if n == 0 || cur.spans[n-1].Style != ch.style || dx != 0 || dy != 0 {
+			flush()
+			cur.spans = append(cur.spans, raster.TextSpan{Style: ch.style, DX: dx, DY: dy, Lengths: ch.lengths})
+		}
+		content = append(content, ch.r)
+	}
+
+	for _, ch := range chars {
+		if ch.control {
+			// 開始側の制御文字は次の文字と同じチャンクに入れる
+			if isBidiTerminator(ch.r) && cur != nil {
+				appendChar(ch, 0, 0)
+			} else if !isBidiTerminator(ch.r) {
+				pending = append(pending, ch)
+			}
+			continue
+		}
+		x, hasX := lookupPosition(ch.owners, func(p *textPosition) []float64 { return p.x })
+		y, hasY := lookupPosition(ch.owners, func(p *textPosition) []float64 { return p.y })
+		dx, _ := lookupPosition(ch.owners, func(p *textPosition) []float64 { return p.dx })
+		dy, _ := lookupPosition(ch.owners, func(p *textPosition) []float64 { return p.dy })
+		for _, o := range ch.owners {
+			o.index++
+		}
+
+		// <textPath> の開始・終了でもチャンクを区切る（パス上では x/y による区切りは行わない）
+		if cur == nil || ch.path != cur.path || (ch.path == nil && (hasX || hasY)) {
+			flush()
+			cur = &textChunk{x: x, y: y, hasX: hasX, hasY: hasY, anchor: ch.style.TextAnchor, path: ch.path}
+			chunks = append(chunks, cur)
+		}
+
+		for _, p := range pending {
+			appendChar(p, 0, 0)
+		}
+		pending = pending[:0]
+		appendChar(ch, dx, dy)
+	}
+	flush()
+	return chunks
+}
+
+// isBidiTerminator は埋め込み・分離を終了する制御文字（PDF / PDI）かを返します
+func isBidiTerminator(r rune) bool {
+	return r == '\u202C' || r == '\u2069'
+}
+
+// lookupPosition は最も内側の要素から順に、現在の文字に対応する値を探します
+func lookupPosition(owners []*textPosition, list func(*textPosition) []float64) (float64, bool) {
+	for i := len(owners) - 1; i >= 0; i-- {
+		values := list(owners[i])
+		if owners[i].index < len(values) {
+			return values[owners[i].index], true
+		}
+	}
+	return 0, false
+}
+
+// lengthList は "10 20,1em" 形式の長さリストの属性を解析します
+// 単位は要素のスタイルで解決し（em は要素のフォントサイズ）、解釈できない値以降は無視して診断に記録します
+func (tc *textCollector) lengthList(name, s string, st *style.ComputedStyle) []float64 {
+	fields := strings.Fields(strings.ReplaceAll(s, ",", " "))
+	if len(fields) == 0 {
+		return nil
+	}
+	values := make([]float64, 0, len(fields))
+	for _, f := range fields {
+		v, err := st.LengthPx(f)
+		if err != nil {
+			// 不正な値以降は無視する
+			tc.rc.Report(diagnostic.SeverityWarning, diagnostic.CodeInvalidValue, fmt.Sprintf("%s: %v", name, err))
+			break
+		}
+		values = append(values, v)
+	}
+	return values
+}
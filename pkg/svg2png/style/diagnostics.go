@@ -0,0 +1,78 @@
+package style
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
+	"github.com/shinya/svg2png/pkg/svg2png/parser"
+)
+
+// ============================================================
+// スタイルの診断
+// ============================================================
+
+// unsupportedProperties は描画に反映しないプロパティ・属性です
+// 指定されていると見た目が変わるため、未対応として報告します
+var unsupportedProperties = map[string]bool{
+	"transform":         true,
+	"mask":              true,
+	"marker":            true,
+	"marker-start":      true,
+	"marker-mid":        true,
+	"marker-end":        true,
+	"stroke-linecap":    true,
+	"stroke-linejoin":   true,
+	"stroke-miterlimit": true,
+	"fill-rule":         true,
+	"clip-rule":         true,
+	"paint-order":       true,
+	"mix-blend-mode":    true,
+	"display":           true,
+	"visibility":        true,
+}
+
+// isValidColor は parseColor が色として解釈できる値かを返します
+// parseColor は未知の色名を黒として扱うため、診断ではそれも解釈できない値とみなします
+func isValidColor(value string) bool {
+	switch {
+	case value == "none", value == "transparent", value == "currentColor":
+		return true
+	case namedColors[strings.ToLower(value)] != nil:
+		return true
+	case strings.HasPrefix(value, "#"), strings.HasPrefix(value, "rgb(") || strings.HasPrefix(value, "rgba("):
+		_, err := parseColor(value)
+		return err == nil
+	}
+	return false
+}
+
+// propertyProblem は applyProperty が適用できなかったプロパティの診断を返します（位置は report で設定します）
+func propertyProblem(key, value string) diagnostic.Entry {
+	if unsupportedProperties[key] {
+		return diagnostic.Entry{Severity: diagnostic.SeverityWarning, Code: diagnostic.CodeUnsupportedProperty, Message: key}
+	}
+	return diagnostic.Entry{
+		Severity: diagnostic.SeverityWarning,
+		Code:     diagnostic.CodeInvalidValue,
+		Message:  fmt.Sprintf("%s: unknown color %q", key, value),
+	}
+}
+
+// report は要素の位置を付けて診断を記録します（記録済みの内容は位置を求めずに捨てます）
+func (r *StyleResolver) report(elem *parser.Element, e diagnostic.Entry) {
+	if r.diagnostics.Has(e.Code, e.Message) {
+		return
+	}
+	e.Location = elem.Location()
+	r.diagnostics.Add(e)
+}
+
+// reportSorted は診断をメッセージ順に記録します
+func (r *StyleResolver) reportSorted(elem *parser.Element, entries []diagnostic.Entry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Message < entries[j].Message })
+	for _, e := range entries {
+		r.report(elem, e)
+	}
+}
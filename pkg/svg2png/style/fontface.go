@@ -0,0 +1,215 @@
+package style
+
+import (
+	"strings"
+)
+
+// FontFaceRule は @font-face 規則を表します
+type FontFaceRule struct {
+	Family  string
+	Sources []FontFaceSource // src（先頭から順に読み込みを試す）
+	Weight  float64          // font-weight（範囲指定の場合は下限。既定 400）
+	Stretch float64          // font-stretch（百分率。既定 100）
+	Style   string           // font-style（"normal" | "italic" | "oblique"）
+}
+
+// FontFaceSource は @font-face の src の1項目です
+type FontFaceSource struct {
+	URL    string // url(...) の中身（data URI を含む）
+	Local  string // local(...) のフォント名
+	Format string // format(...) のヒント（"woff2", "truetype" など。省略時は空）
+}
+
+// ParseFontFaces はスタイルシートから @font-face 規則を取り出します
+// その他の規則（セレクタや @media など）は読み飛ばします
+func ParseFontFaces(css string) []FontFaceRule {
+	css = stripCSSComments(css)
+	var rules []FontFaceRule
+	for {
+		i := strings.Index(strings.ToLower(css), "@font-face")
+		if i < 0 {
+			return rules
+		}
+		css = css[i+len("@font-face"):]
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			return rules
+		}
+		end := matchingBrace(css, open)
+		body := css[open+1 : end]
+		if end < len(css) {
+			end++
+		}
+		css = css[end:]
+
+		rule := FontFaceRule{Weight: 400, Stretch: 100, Style: "normal"}
+		for _, decl := range splitCSS(body, ';') {
+			name, value, ok := strings.Cut(decl, ":")
+			if !ok {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			// 範囲指定（"100 900"）や角度つきの oblique は先頭の値を使う。空の記述子は無視する
+			fields := strings.Fields(value)
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "font-family":
+				rule.Family = unquoteCSS(value)
+			case "src":
+				rule.Sources = parseFontFaceSources(value)
+			case "font-weight":
+				if len(fields) == 0 {
+					continue
+				}
+				// 可変フォントの範囲指定は下限を使う
+				if w, ok := parseFontWeight(fields[0], 400); ok {
+					rule.Weight = w
+				}
+			case "font-stretch":
+				if len(fields) == 0 {
+					continue
+				}
+				if v, ok := parseFontStretch(fields[0]); ok {
+					rule.Stretch = v
+				}
+			case "font-style":
+				if len(fields) == 0 {
+					continue
+				}
+				switch fields[0] {
+				case "normal", "italic", "oblique":
+					rule.Style = fields[0]
+				}
+			}
+		}
+		if rule.Family != "" && len(rule.Sources) > 0 {
+			rules = append(rules, rule)
+		}
+	}
+}
+
+// parseFontFaceSources は src の値を解析します
+// 例: `url(data:font/woff2;base64,...) format("woff2"), local("Arial")`
+func parseFontFaceSources(value string) []FontFaceSource {
+	var sources []FontFaceSource
+	for _, item := range splitCSS(value, ',') {
+		var src FontFaceSource
+		rest := strings.TrimSpace(item)
+		for rest != "" {
+			open := strings.IndexByte(rest, '(')
+			if open < 0 {
+				break
+			}
+			fn := strings.ToLower(strings.TrimSpace(rest[:open]))
+			end := matchingParen(rest, open)
+			arg := unquoteCSS(strings.TrimSpace(rest[open+1 : end]))
+			switch fn {
+			case "url":
+				src.URL = arg
+			case "local":
+				src.Local = arg
+			case "format":
+				src.Format = strings.ToLower(arg)
+			}
+			if end >= len(rest) {
+				break
+			}
+			rest = strings.TrimSpace(rest[end+1:])
+		}
+		if src.URL != "" || src.Local != "" {
+			sources = append(sources, src)
+		}
+	}
+	return sources
+}
+
+// stripCSSComments は /* ... */ コメントを取り除きます
+func stripCSSComments(css string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(css, "/*")
+		if i < 0 {
+			b.WriteString(css)
+			return b.String()
+		}
+		b.WriteString(css[:i])
+		j := strings.Index(css[i+2:], "*/")
+		if j < 0 {
+			return b.String()
+		}
+		css = css[i+2+j+2:]
+	}
+}
+
+// splitCSS は括弧と引用符の外にある sep で文字列を分割します
+// data URI の ";" や "," で分割しないために使います
+func splitCSS(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// matchingBrace は s[open] の "{" に対応する "}" の位置を返します（見つからない場合は len(s)）
+func matchingBrace(s string, open int) int {
+	return matchingClose(s, open, '{', '}')
+}
+
+// matchingParen は s[open] の "(" に対応する ")" の位置を返します（見つからない場合は len(s)）
+func matchingParen(s string, open int) int {
+	return matchingClose(s, open, '(', ')')
+}
+
+func matchingClose(s string, open int, l, r byte) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == l:
+			depth++
+		case c == r:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// unquoteCSS は CSS の文字列の引用符を外します
+func unquoteCSS(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/shinya/svg2png/pkg/svg2png/diagnostic"
 	"github.com/shinya/svg2png/pkg/svg2png/parser"
 )
 
@@ -20,36 +21,62 @@ type ComputedStyle struct {
 	StrokeWidth   float64
 	StrokeOpacity float64
 	Opacity       float64
-	FontFamily    string
+	FontFamily    string   // font-family の先頭のファミリ
+	FontFamilies  []string // font-family のリスト（総称ファミリを含む）
+	Lang          string   // xml:lang / lang（総称ファミリの解決に使う）
 	FontSize      float64
 	FontStyle     string
-	FontWeight    string
+	FontWeight    float64 // font-weight（1〜1000。normal=400, bold=700）
 	TextAnchor    string
 	ClipPathID    string    // clip-path="url(#id)"
 	FilterID      string    // filter="url(#id)"
 	StrokeDasharray  []float64  // stroke-dasharray
 	StrokeDashoffset float64    // stroke-dashoffset
 	LetterSpacing    float64    // letter-spacing (px)
+	WhiteSpace       string     // white-space / xml:space（"normal", "pre", "nowrap", "pre-line", "pre-wrap"）
+	FontFeatureSettings string  // font-feature-settings（例: `"liga" 0, "smcp"`）
+	FontKerning         string  // font-kerning（"auto" | "normal" | "none"）
+	Direction           string  // direction（"ltr" | "rtl"）
+	UnicodeBidi         string  // unicode-bidi（"normal", "embed", "isolate", "bidi-override", "isolate-override", "plaintext"）。継承しない
+	WritingMode         string  // writing-mode（"horizontal-tb" | "vertical-rl" | "vertical-lr"。SVG 1.1 の値は正規化）
+	TextOrientation     string  // text-orientation（"mixed" | "upright" | "sideways"）
+	GlyphOrientationVertical string // glyph-orientation-vertical（"auto" | "0" | "90"）
+	FontPalette         string  // font-palette（"normal" | "light" | "dark"）
+	FontStretch         float64 // font-stretch（百分率。normal=100）
+	FontVariationSettings string // font-variation-settings（例: `"wght" 650, "wdth" 80`）
+	TextDecoration      TextDecoration // text-decoration（この要素での指定。継承しない）
+	Decorations         []Decoration   // 描画する装飾線（祖先の <text> / <tspan> で指定したものを含む）
+	TextTransform       string  // text-transform（"none" | "uppercase" | "lowercase" | "capitalize" | "full-width"）
+	FontVariantCaps     string  // font-variant-caps（"normal" | "small-caps" | "all-small-caps" など）
+	WordSpacing         float64 // word-spacing (px)
+	FontSizeAdjust      float64 // font-size-adjust（x-height とフォントサイズの比。0 は none）
+	FontSizeAdjustFromFont bool // font-size-adjust: from-font（最初のフォントの比率を使う）
+	DominantBaseline    string  // dominant-baseline（"auto", "alphabetic", "central", "middle", "hanging" など。SVG 1.1 の値は正規化）
+	AlignmentBaseline   string  // alignment-baseline（"baseline" は dominant-baseline に従う）。継承しない
+	BaselineShift       string  // baseline-shift（この要素での指定。継承しない）
+	BaselineShifts      []BaselineShift // 適用するベースラインのずれ（祖先の <tspan> で指定したものを含む）
+	LineHeight          string  // line-height（"normal" | 数値 | 長さ | 百分率）。フォントサイズに対して描画時に解決する
+	InlineSize          float64 // inline-size（折り返す行の長さ。0 は折り返さない）。<text> だけに適用する
+	ShapeInside         string  // shape-inside="url(#id)" の id 部分（rect / polygon に沿って折り返す）
+	ShapePadding        float64 // shape-padding（shape-inside の内側の余白）
+	FontSynthesisWeight    bool // font-synthesis の weight（太字の合成を許可する）
+	FontSynthesisStyle     bool // font-synthesis の style（斜体の合成を許可する）
+	FontSynthesisSmallCaps bool // font-synthesis の small-caps（スモールキャップの合成を許可する）
+	TextRendering       string  // text-rendering（"auto" | "optimizeSpeed" | "optimizeLegibility" | "geometricPrecision"）
+	ShapeRendering      string  // shape-rendering（"auto" | "optimizeSpeed" | "crispEdges" | "geometricPrecision"）
 }
 
 // StyleResolver はスタイルの解決を行います
 type StyleResolver struct {
 	defaultFamily string
-	diagnostics   *Diagnostics
-}
-
-// Diagnostics は診断情報を表します
-type Diagnostics struct {
-	Warnings     []string
-	MissingFonts []string
-	Unsupported  []string
+	diagnostics   *diagnostic.Collector
 }
 
 // NewResolver は新しいスタイル解決器を作成します
 func NewResolver(defaultFamily string) *StyleResolver {
 	return &StyleResolver{
 		defaultFamily: defaultFamily,
-		diagnostics:   &Diagnostics{},
+		diagnostics:   &diagnostic.Collector{},
 	}
 }
 
@@ -64,10 +91,30 @@ func (r *StyleResolver) Computed(elem *parser.Element) *ComputedStyle {
 		StrokeOpacity: 1.0,
 		Opacity:       1.0,
 		FontFamily:    r.defaultFamily,
+		FontFamilies:  []string{r.defaultFamily},
 		FontSize:      12,
 		FontStyle:     "normal",
-		FontWeight:    "normal",
+		FontWeight:    400,
 		TextAnchor:    "start",
+		WhiteSpace:    "normal",
+		FontKerning:   "auto",
+		Direction:     "ltr",
+		UnicodeBidi:   "normal",
+		WritingMode:   "horizontal-tb",
+		TextOrientation: "mixed",
+		GlyphOrientationVertical: "auto",
+		FontPalette:   "normal",
+		FontStretch:   100,
+		TextTransform: "none",
+		FontVariantCaps: "normal",
+		DominantBaseline: "auto",
+		AlignmentBaseline: "baseline",
+		LineHeight:    "normal",
+		FontSynthesisWeight: true,
+		FontSynthesisStyle: true,
+		FontSynthesisSmallCaps: true,
+		TextRendering: "auto",
+		ShapeRendering: "auto",
 	}
 
 	// プレゼンテーション属性の適用（style属性より優先度低）
@@ -76,14 +123,21 @@ func (r *StyleResolver) Computed(elem *parser.Element) *ComputedStyle {
 	// style属性の適用（最優先）
 	r.applyStyleAttribute(elem, style)
 
+	finishTextDecoration(style)
 	return style
 }
 
 // applyPresentationAttributes はプレゼンテーション属性を適用します
+// 属性の順序は不定のため、解釈できなかった属性の診断はメッセージ順に記録します
 func (r *StyleResolver) applyPresentationAttributes(elem *parser.Element, style *ComputedStyle) {
+	var problems []diagnostic.Entry
 	for key, value := range elem.Attributes {
-		r.applyProperty(key, strings.TrimSpace(value), style)
+		value = strings.TrimSpace(value)
+		if !r.applyProperty(key, value, style) {
+			problems = append(problems, propertyProblem(key, value))
+		}
 	}
+	r.reportSorted(elem, problems)
 }
 
 // applyStyleAttribute はstyle属性を適用します
@@ -105,12 +159,15 @@ func (r *StyleResolver) applyStyleAttribute(elem *parser.Element, style *Compute
 		}
 		key := strings.TrimSpace(kv[0])
 		value := strings.TrimSpace(kv[1])
-		r.applyProperty(key, value, style)
+		if !r.applyProperty(key, value, style) {
+			r.report(elem, propertyProblem(key, value))
+		}
 	}
 }
 
 // applyProperty は単一のCSSプロパティを適用します
-func (r *StyleResolver) applyProperty(key, value string, style *ComputedStyle) {
+// 未対応のプロパティや解釈できない色の場合は false を返します
+func (r *StyleResolver) applyProperty(key, value string, style *ComputedStyle) bool {
 	switch key {
 	case "fill":
 		if value == "none" {
@@ -126,6 +183,7 @@ func (r *StyleResolver) applyProperty(key, value string, style *ComputedStyle) {
 				style.FillNone = false
 				style.FillURL = ""
 			}
+			return isValidColor(value)
 		}
 	case "fill-opacity":
 		if opacity, err := strconv.ParseFloat(value, 64); err == nil {
@@ -145,6 +203,7 @@ func (r *StyleResolver) applyProperty(key, value string, style *ComputedStyle) {
 				style.StrokeNone = false
 				style.StrokeURL = ""
 			}
+			return isValidColor(value)
 		}
 	case "stroke-width":
 		if width, err := parseDimension(value); err == nil {
@@ -173,9 +232,19 @@ func (r *StyleResolver) applyProperty(key, value string, style *ComputedStyle) {
 	case "filter":
 		style.FilterID = extractURLID(value)
 	case "font-family":
-		// カンマ区切りの最初のフォントを使用
-		families := strings.Split(value, ",")
-		style.FontFamily = strings.Trim(strings.TrimSpace(families[0]), `'"`)
+		// カンマ区切りのリストを先頭から順に照合する
+		var families []string
+		for _, f := range strings.Split(value, ",") {
+			if f = strings.Trim(strings.TrimSpace(f), `'"`); f != "" {
+				families = append(families, f)
+			}
+		}
+		if len(families) > 0 {
+			style.FontFamily = families[0]
+			style.FontFamilies = families
+		}
+	case "xml:lang", "lang":
+		style.Lang = value
 	case "font-size":
 		if size, err := parseFontSize(value); err == nil {
 			style.FontSize = size
@@ -183,9 +252,167 @@ func (r *StyleResolver) applyProperty(key, value string, style *ComputedStyle) {
 	case "font-style":
 		style.FontStyle = value
 	case "font-weight":
-		style.FontWeight = value
+		if w, ok := parseFontWeight(value, style.FontWeight); ok {
+			style.FontWeight = w
+		}
+	case "font-stretch":
+		if v, ok := parseFontStretch(value); ok {
+			style.FontStretch = v
+		}
+	case "font-variation-settings":
+		style.FontVariationSettings = value
 	case "text-anchor":
 		style.TextAnchor = value
+	case "font-feature-settings":
+		style.FontFeatureSettings = value
+	case "font-kerning":
+		style.FontKerning = value
+	case "font-palette":
+		// @font-palette-values で定義する名前付きパレットは未対応のため normal として扱う
+		switch value {
+		case "light", "dark":
+			style.FontPalette = value
+		default:
+			style.FontPalette = "normal"
+		}
+	case "direction":
+		if value == "ltr" || value == "rtl" {
+			style.Direction = value
+		}
+	case "unicode-bidi":
+		style.UnicodeBidi = value
+	case "writing-mode":
+		if mode := normalizeWritingMode(value); mode != "" {
+			style.WritingMode = mode
+		}
+	case "text-orientation":
+		switch value {
+		case "mixed", "upright", "sideways":
+			style.TextOrientation = value
+		case "sideways-right":
+			style.TextOrientation = "sideways"
+		}
+	case "glyph-orientation-vertical":
+		switch strings.TrimSuffix(value, "deg") {
+		case "auto":
+			style.GlyphOrientationVertical = "auto"
+		case "0":
+			style.GlyphOrientationVertical = "0"
+		case "90":
+			style.GlyphOrientationVertical = "90"
+		}
+	case "white-space":
+		style.WhiteSpace = value
+	case "xml:space":
+		// SVG 2 では xml:space="preserve" は white-space: pre 相当
+		if value == "preserve" {
+			style.WhiteSpace = "pre"
+		} else {
+			style.WhiteSpace = "normal"
+		}
+	case "text-decoration":
+		style.TextDecoration.applyShorthand(value)
+	case "text-decoration-line":
+		d := &style.TextDecoration
+		d.Underline, d.Overline, d.LineThrough = false, false, false
+		for _, keyword := range strings.Fields(value) {
+			d.applyLine(keyword)
+		}
+	case "text-decoration-style":
+		if isDecorationStyle(value) {
+			style.TextDecoration.Style = value
+		}
+	case "text-decoration-color":
+		if c, err := parseColor(value); err == nil {
+			style.TextDecoration.Color = c
+		}
+		return isValidColor(value)
+	case "text-decoration-thickness":
+		if isDecorationThickness(value) {
+			style.TextDecoration.Thickness = value
+		}
+	case "text-transform":
+		switch value {
+		case "none", "uppercase", "lowercase", "capitalize", "full-width":
+			style.TextTransform = value
+		}
+	case "font-variant":
+		if caps, ok := parseFontVariant(value); ok {
+			style.FontVariantCaps = caps
+		}
+	case "font-variant-caps":
+		if caps, ok := parseFontVariantCaps(value); ok {
+			style.FontVariantCaps = caps
+		}
+	case "word-spacing":
+		// "normal" は 0 として扱う
+		if value == "normal" {
+			style.WordSpacing = 0
+		} else if v, err := parseDimension(value); err == nil {
+			style.WordSpacing = v
+		}
+	case "font-size-adjust":
+		if aspect, fromFont, ok := parseFontSizeAdjust(value); ok {
+			style.FontSizeAdjust, style.FontSizeAdjustFromFont = aspect, fromFont
+		}
+	case "dominant-baseline":
+		if v, ok := parseDominantBaseline(value); ok {
+			style.DominantBaseline = v
+		}
+	case "alignment-baseline":
+		if v, ok := parseAlignmentBaseline(value); ok {
+			style.AlignmentBaseline = v
+		}
+	case "baseline-shift":
+		if isBaselineShift(value) {
+			style.BaselineShift = value
+		}
+	case "font-synthesis":
+		if weight, slope, smallCaps, ok := parseFontSynthesis(value); ok {
+			style.FontSynthesisWeight, style.FontSynthesisStyle, style.FontSynthesisSmallCaps = weight, slope, smallCaps
+		}
+	case "font-synthesis-weight":
+		if value == "auto" || value == "none" {
+			style.FontSynthesisWeight = value == "auto"
+		}
+	case "font-synthesis-style":
+		if value == "auto" || value == "none" {
+			style.FontSynthesisStyle = value == "auto"
+		}
+	case "font-synthesis-small-caps":
+		if value == "auto" || value == "none" {
+			style.FontSynthesisSmallCaps = value == "auto"
+		}
+	case "text-rendering":
+		switch value {
+		case "auto", "optimizeSpeed", "optimizeLegibility", "geometricPrecision":
+			style.TextRendering = value
+		}
+	case "shape-rendering":
+		switch value {
+		case "auto", "optimizeSpeed", "crispEdges", "geometricPrecision":
+			style.ShapeRendering = value
+		}
+	case "line-height":
+		if isLineHeight(value) {
+			style.LineHeight = value
+		}
+	case "inline-size":
+		// "auto" は折り返さない
+		if value == "auto" {
+			style.InlineSize = 0
+		} else if v, err := parseFontSize(value); err == nil && v >= 0 {
+			style.InlineSize = v
+		}
+	case "shape-inside":
+		style.ShapeInside = ""
+		if strings.HasPrefix(value, "url(") {
+			style.ShapeInside = extractURLID(value)
+		}
+	case "shape-padding":
+		if v, err := parseFontSize(value); err == nil && v >= 0 {
+			style.ShapePadding = v
+		}
 	case "letter-spacing":
 		// "normal" は 0 として扱う
 		if value == "normal" {
@@ -193,7 +420,107 @@ func (r *StyleResolver) applyProperty(key, value string, style *ComputedStyle) {
 		} else if v, err := parseDimension(value); err == nil {
 			style.LetterSpacing = v
 		}
+	default:
+		return !unsupportedProperties[key]
+	}
+	return true
+}
+
+// parseFontWeight は font-weight の値を数値に変換します
+// bolder / lighter は継承した太さ（parent）から CSS Fonts Level 4 の対応表で求めます
+func parseFontWeight(value string, parent float64) (float64, bool) {
+	switch value {
+	case "normal":
+		return 400, true
+	case "bold":
+		return 700, true
+	case "bolder":
+		switch {
+		case parent < 350:
+			return 400, true
+		case parent < 550:
+			return 700, true
+		case parent < 900:
+			return 900, true
+		}
+		return parent, true
+	case "lighter":
+		switch {
+		case parent < 100:
+			return parent, true
+		case parent < 550:
+			return 100, true
+		case parent < 750:
+			return 400, true
+		}
+		return 700, true
+	}
+	w, err := strconv.ParseFloat(value, 64)
+	if err != nil || w < 1 || w > 1000 {
+		return 0, false
+	}
+	return w, true
+}
+
+// fontStretchKeywords は font-stretch のキーワードと百分率の対応です
+var fontStretchKeywords = map[string]float64{
+	"ultra-condensed": 50,
+	"extra-condensed": 62.5,
+	"condensed":       75,
+	"semi-condensed":  87.5,
+	"normal":          100,
+	"semi-expanded":   112.5,
+	"expanded":        125,
+	"extra-expanded":  150,
+	"ultra-expanded":  200,
+}
+
+// parseFontStretch は font-stretch の値（キーワードまたは百分率）を百分率で返します
+func parseFontStretch(value string) (float64, bool) {
+	if v, ok := fontStretchKeywords[value]; ok {
+		return v, true
+	}
+	if !strings.HasSuffix(value, "%") {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil || v < 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+// normalizeWritingMode は SVG 1.1 の writing-mode 値を CSS Writing Modes の値に正規化します
+// 不明な値の場合は空文字を返します
+func normalizeWritingMode(value string) string {
+	switch value {
+	case "horizontal-tb", "lr", "lr-tb", "rl", "rl-tb":
+		return "horizontal-tb"
+	case "vertical-rl", "tb", "tb-rl":
+		return "vertical-rl"
+	case "vertical-lr", "tb-lr":
+		return "vertical-lr"
+	}
+	return ""
+}
+
+// PreservesSpaces は white-space の値が空白を保持するかを返します
+func PreservesSpaces(whiteSpace string) bool {
+	switch whiteSpace {
+	case "pre", "pre-wrap", "break-spaces":
+		return true
+	}
+	return false
+}
+
+// PreservesNewlines は white-space の値が改行を保持するかを返します
+// テキストの組み立て（改行の保持）と折り返し（強制改行）の両方で使います
+func PreservesNewlines(whiteSpace string) bool {
+	switch whiteSpace {
+	case "pre", "pre-wrap", "pre-line", "break-spaces":
+		return true
 	}
+	return false
 }
 
 // extractURLID は "url(#id)" から id 部分を取り出します
@@ -409,14 +736,20 @@ func parseRGBAColor(rgba string) (color.Color, error) {
 // tspan などの子要素で、親の値を引き継ぎつつ上書きする場合に使用します
 func (r *StyleResolver) ComputedFromParent(elem *parser.Element, parent *ComputedStyle) *ComputedStyle {
 	st := *parent // 親のスタイルをコピー
+	st.UnicodeBidi = "normal" // unicode-bidi は継承しない
+	st.TextDecoration = TextDecoration{} // text-decoration は継承しない（装飾線は Decorations で子孫に引き継ぐ）
+	st.AlignmentBaseline = "baseline"    // alignment-baseline は継承しない
+	st.BaselineShift = ""                // baseline-shift は継承しない（ずれは BaselineShifts で子孫に引き継ぐ）
 	r.applyPresentationAttributes(elem, &st)
 	r.applyStyleAttribute(elem, &st)
+	finishTextDecoration(&st)
+	finishBaselineShift(&st) // baseline-shift は <tspan> / <textPath> だけに適用する
 	return &st
 }
 
 // GetDiagnostics は診断情報を返します
-func (r *StyleResolver) GetDiagnostics() Diagnostics {
-	return *r.diagnostics
+func (r *StyleResolver) GetDiagnostics() []diagnostic.Entry {
+	return r.diagnostics.Entries()
 }
 
 // namedColors は名前付き色のマップです（CSS Color Level 4 準拠）
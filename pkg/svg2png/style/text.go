@@ -0,0 +1,359 @@
+package style
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// TextDecoration は要素で指定した text-decoration です（継承しない）
+type TextDecoration struct {
+	Underline   bool
+	Overline    bool
+	LineThrough bool
+	Style       string      // text-decoration-style（"solid" | "double" | "dotted" | "dashed" | "wavy"）
+	Color       color.Color // text-decoration-color（nil の場合は fill の色）
+	Thickness   string      // text-decoration-thickness（"auto" | "from-font" | 長さ | 百分率）
+}
+
+// Decoration は描画する装飾線の1本です
+// SVG の規定どおり、装飾線は指定した要素の塗り・線で描画され、子孫のテキストにも引かれます
+type Decoration struct {
+	Line      string         // "underline" | "overline" | "line-through"
+	Style     string         // text-decoration-style
+	Thickness float64        // 太さ（px）。0 の場合はフォントの値
+	Paint     *ComputedStyle // 指定した要素のスタイル（塗り・線と、位置と太さを決めるフォント）
+}
+
+// applyShorthand は text-decoration（一括指定）を解析します
+// 例: "underline dotted red", "line-through 2px"
+func (d *TextDecoration) applyShorthand(value string) {
+	*d = TextDecoration{}
+	for _, token := range splitCSS(strings.TrimSpace(value), ' ') {
+		token = strings.TrimSpace(token)
+		switch {
+		case token == "":
+		case d.applyLine(token):
+		case isDecorationStyle(token):
+			d.Style = token
+		case isDecorationThickness(token):
+			d.Thickness = token
+		default:
+			if c, err := parseColor(token); err == nil {
+				d.Color = c
+			}
+		}
+	}
+}
+
+// applyLine は text-decoration-line のキーワードを1つ適用します（キーワードでない場合は false）
+func (d *TextDecoration) applyLine(keyword string) bool {
+	switch keyword {
+	case "none":
+		d.Underline, d.Overline, d.LineThrough = false, false, false
+	case "underline":
+		d.Underline = true
+	case "overline":
+		d.Overline = true
+	case "line-through":
+		d.LineThrough = true
+	case "blink":
+		// 点滅は静止画では表現しない
+	default:
+		return false
+	}
+	return true
+}
+
+// isDecorationStyle は text-decoration-style のキーワードかを返します
+func isDecorationStyle(value string) bool {
+	switch value {
+	case "solid", "double", "dotted", "dashed", "wavy":
+		return true
+	}
+	return false
+}
+
+// isDecorationThickness は text-decoration-thickness の値かを返します
+func isDecorationThickness(value string) bool {
+	if value == "auto" || value == "from-font" {
+		return true
+	}
+	if strings.HasSuffix(value, "%") {
+		_, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		return err == nil
+	}
+	_, err := parseFontSize(value)
+	return err == nil
+}
+
+// finishTextDecoration は要素で指定した text-decoration を描画する装飾線に加えます
+// 装飾線の色と太さは要素の他のプロパティ（fill・font-size）が決まってから求めます
+func finishTextDecoration(st *ComputedStyle) {
+	d := st.TextDecoration
+	if !d.Underline && !d.Overline && !d.LineThrough {
+		return
+	}
+	paint := *st
+	paint.Decorations = nil
+	if d.Color != nil {
+		paint.Fill, paint.FillURL, paint.FillNone = d.Color, "", false
+	}
+	thickness := 0.0
+	switch v := d.Thickness; {
+	case v == "", v == "auto", v == "from-font":
+	case strings.HasSuffix(v, "%"):
+		pct, _ := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		thickness = st.FontSize * pct / 100
+	case strings.HasSuffix(v, "em"):
+		em, _ := strconv.ParseFloat(strings.TrimSuffix(v, "em"), 64)
+		thickness = st.FontSize * em
+	default:
+		thickness, _ = parseFontSize(v)
+	}
+	decoStyle := d.Style
+	if decoStyle == "" {
+		decoStyle = "solid"
+	}
+
+	// 祖先の装飾線とスライスを共有しないようにコピーしてから追加する
+	decorations := append([]Decoration(nil), st.Decorations...)
+	for _, line := range []struct {
+		name string
+		on   bool
+	}{{"underline", d.Underline}, {"overline", d.Overline}, {"line-through", d.LineThrough}} {
+		if line.on {
+			decorations = append(decorations, Decoration{Line: line.name, Style: decoStyle, Thickness: thickness, Paint: &paint})
+		}
+	}
+	st.Decorations = decorations
+}
+
+// parseFontVariant は font-variant（一括指定）から font-variant-caps の値を取り出します
+// 合字や数字などの他の指定は font-feature-settings で指定します
+func parseFontVariant(value string) (string, bool) {
+	if value == "normal" || value == "none" {
+		return "normal", true
+	}
+	for _, token := range strings.Fields(value) {
+		if caps, ok := parseFontVariantCaps(token); ok {
+			return caps, true
+		}
+	}
+	return "", false
+}
+
+// parseFontVariantCaps は font-variant-caps の値を解析します
+func parseFontVariantCaps(value string) (string, bool) {
+	switch value {
+	case "normal", "small-caps", "all-small-caps", "petite-caps", "all-petite-caps", "unicase", "titling-caps":
+		return value, true
+	}
+	return "", false
+}
+
+// parseFontSizeAdjust は font-size-adjust の値を解析します
+// 戻り値の aspect が 0 の場合は none、fromFont が true の場合は最初のフォントの比率を使います
+func parseFontSizeAdjust(value string) (aspect float64, fromFont, ok bool) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0, false, false
+	}
+	// CSS Fonts 5 の "ex-height 0.5" 形式は ex-height だけに対応する
+	if fields[0] == "ex-height" && len(fields) == 2 {
+		fields = fields[1:]
+	}
+	switch fields[0] {
+	case "none":
+		return 0, false, true
+	case "from-font":
+		return 0, true, true
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || v < 0 {
+		return 0, false, false
+	}
+	return v, false, true
+}
+
+// BaselineShift は baseline-shift で上下にずらす量です
+// 上付き・下付きの量はフォントの寸法から求めるため、描画時に Font のフォントで解決します
+type BaselineShift struct {
+	Keyword string         // "sub" | "super"（長さ・百分率の場合は空）
+	Amount  float64        // ずらす量（px、上向きが正）。Keyword が空の場合に使う
+	Font    *ComputedStyle // 指定した要素のスタイル（上付き・下付きの量を決めるフォント）
+}
+
+// parseDominantBaseline は dominant-baseline の値を解析します
+// SVG 1.1 の text-before-edge / text-after-edge は text-top / text-bottom に、
+// use-script / no-change / reset-size は auto として扱います
+func parseDominantBaseline(value string) (string, bool) {
+	switch value {
+	case "auto", "alphabetic", "ideographic", "middle", "central", "mathematical", "hanging", "text-top", "text-bottom":
+		return value, true
+	case "text-before-edge":
+		return "text-top", true
+	case "text-after-edge":
+		return "text-bottom", true
+	case "use-script", "no-change", "reset-size":
+		return "auto", true
+	}
+	return "", false
+}
+
+// parseAlignmentBaseline は alignment-baseline の値を解析します
+// auto は baseline、SVG 1.1 の before-edge / after-edge 系は text-top / text-bottom として扱います
+func parseAlignmentBaseline(value string) (string, bool) {
+	switch value {
+	case "auto", "baseline":
+		return "baseline", true
+	case "before-edge", "text-before-edge":
+		return "text-top", true
+	case "after-edge", "text-after-edge":
+		return "text-bottom", true
+	}
+	if v, ok := parseDominantBaseline(value); ok && v != "auto" {
+		return v, true
+	}
+	return "", false
+}
+
+// isBaselineShift は baseline-shift の値かを返します
+func isBaselineShift(value string) bool {
+	switch value {
+	case "baseline", "sub", "super":
+		return true
+	}
+	if strings.HasSuffix(value, "%") {
+		_, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		return err == nil
+	}
+	_, err := parseFontSize(value)
+	return err == nil
+}
+
+// finishBaselineShift は要素で指定した baseline-shift を子孫にも適用するずれに加えます
+// 百分率は line-height（SVG ではフォントサイズ）に対する比率です
+func finishBaselineShift(st *ComputedStyle) {
+	var shift BaselineShift
+	switch v := st.BaselineShift; {
+	case v == "", v == "baseline":
+		return
+	case v == "sub", v == "super":
+		font := *st
+		font.BaselineShifts = nil
+		shift = BaselineShift{Keyword: v, Font: &font}
+	case strings.HasSuffix(v, "%"):
+		pct, _ := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		shift.Amount = st.FontSize * pct / 100
+	case strings.HasSuffix(v, "em"):
+		em, _ := strconv.ParseFloat(strings.TrimSuffix(v, "em"), 64)
+		shift.Amount = st.FontSize * em
+	default:
+		shift.Amount, _ = parseFontSize(v)
+	}
+	if shift.Keyword == "" && shift.Amount == 0 {
+		return
+	}
+	// 祖先のずれとスライスを共有しないようにコピーしてから追加する
+	st.BaselineShifts = append(append([]BaselineShift(nil), st.BaselineShifts...), shift)
+}
+
+// isLineHeight は line-height の値かを返します
+func isLineHeight(value string) bool {
+	if value == "normal" {
+		return true
+	}
+	if strings.HasSuffix(value, "%") {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		return err == nil && v >= 0
+	}
+	v, err := parseFontSize(value)
+	return err == nil && v >= 0
+}
+
+// LineHeightPx は line-height をピクセル（SVGユーザー単位）に解決します
+// normal の場合は false を返し、フォントの寸法から求めます
+func (st *ComputedStyle) LineHeightPx() (float64, bool) {
+	v := st.LineHeight
+	switch {
+	case v == "" || v == "normal":
+		return 0, false
+	case strings.HasSuffix(v, "%"):
+		pct, _ := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		return st.FontSize * pct / 100, true
+	case strings.HasSuffix(v, "em") && !strings.HasSuffix(v, "rem"):
+		em, _ := strconv.ParseFloat(strings.TrimSuffix(v, "em"), 64)
+		return st.FontSize * em, true
+	}
+	if n, err := strconv.ParseFloat(v, 64); err == nil {
+		// 単位のない数値はフォントサイズの倍率
+		return st.FontSize * n, true
+	}
+	px, _ := parseFontSize(v)
+	return px, true
+}
+
+// absoluteUnits は絶対単位の長さをピクセル（96dpi）に換算する倍率です
+var absoluteUnits = map[string]float64{
+	"":   1,
+	"px": 1,
+	"pt": 96.0 / 72.0,
+	"pc": 16,
+	"in": 96,
+	"cm": 96 / 2.54,
+	"mm": 96 / 25.4,
+}
+
+// LengthPx は属性の長さ（x / y / dx / dy / textLength / startOffset）をピクセル（SVGユーザー単位）に解決します
+// em と ex は要素のフォントサイズ（ex は 0.5em）、絶対単位は 96dpi で換算します。
+// ルート要素のフォントサイズが必要な rem や百分率などの未対応の単位は error を返します
+func (st *ComputedStyle) LengthPx(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	i := len(value)
+	for i > 0 && ('a' <= value[i-1] && value[i-1] <= 'z' || 'A' <= value[i-1] && value[i-1] <= 'Z') {
+		i--
+	}
+	num, unit := value[:i], strings.ToLower(value[i:])
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid length %q", value)
+	}
+	switch unit {
+	case "em":
+		return v * st.FontSize, nil
+	case "ex":
+		return v * st.FontSize / 2, nil
+	}
+	if scale, ok := absoluteUnits[unit]; ok {
+		return v * scale, nil
+	}
+	return 0, fmt.Errorf("unsupported length unit %q", value)
+}
+
+// parseFontSynthesis は font-synthesis（一括指定）を解析します
+// 例: "none", "weight style", "small-caps"。position は対応する描画がないため読み飛ばします
+func parseFontSynthesis(value string) (weight, slope, smallCaps, ok bool) {
+	if value == "none" {
+		return false, false, false, true
+	}
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return false, false, false, false
+	}
+	for _, token := range fields {
+		switch token {
+		case "weight":
+			weight = true
+		case "style":
+			slope = true
+		case "small-caps":
+			smallCaps = true
+		case "position":
+		default:
+			return false, false, false, false
+		}
+	}
+	return weight, slope, smallCaps, true
+}
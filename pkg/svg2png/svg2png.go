@@ -1,20 +1,31 @@
 package svg2png
 
 import (
-	"fmt"
+	"context"
+	"image"
 	"image/color"
+	"io"
+	"time"
 
 	"github.com/shinya/svg2png/pkg/svg2png/font"
-	"github.com/shinya/svg2png/pkg/svg2png/parser"
-	"github.com/shinya/svg2png/pkg/svg2png/raster"
-	"github.com/shinya/svg2png/pkg/svg2png/renderer"
-	"github.com/shinya/svg2png/pkg/svg2png/style"
-	"github.com/shinya/svg2png/pkg/svg2png/viewport"
+	"github.com/shinya/svg2png/pkg/svg2png/limits"
 )
 
 // FontSource はフォントの供給源を表します
 type FontSource = font.FontSource
 
+// FontQuery はフォント照合の要求（ファミリのリスト・太さ・幅・傾き・言語）を表します
+type FontQuery = font.FontQuery
+
+// FontMatch はフォント照合の結果と選ばれた理由を表します
+type FontMatch = font.FontMatch
+
+// CacheStats はフェイスとグリフのキャッシュの利用状況です
+type CacheStats = font.CacheStats
+
+// Limits は1回の描画で使う資源の上限です（0 の項目は既定値、負の値は制限なし）
+type Limits = limits.Limits
+
 // Options はレンダリングオプションを表します
 type Options struct {
 	Width, Height         int
@@ -23,103 +34,92 @@ type Options struct {
 	Background            *color.RGBA // nilで透過
 	DefaultFamily         string      // 既定フォント（fallback最終手段）
 	DisableSystemFontScan bool        // trueにするとシステムフォントスキャンをスキップ（デフォルトはスキャンON）
+
+	// ResolveURL は @font-face の url()（data URI 以外）の内容を返します
+	// nil の場合、外部 URL のフォントは読み込まずに警告を記録します
+	ResolveURL func(url string) ([]byte, error)
+
+	// FontConfigFile は描画に使う fontconfig の設定ファイル（fonts.conf）のパスです
+	// <dir> のフォントを追加し、<alias> をシステムの fontconfig の設定の代わりに使います（この描画だけに適用）
+	FontConfigFile string
+
+	// Hinting はグリフをピクセルの格子に合わせる度合いです（"none" | "vertical" | "full"。空文字列は "none"）
+	// "vertical" はベースラインを、"full" はさらに送り幅とグリフの原点を整数ピクセルに合わせます
+	Hinting string
+	// DisableSubpixelPositioning を true にするとグリフの原点を整数ピクセルに丸めます（デフォルトはサブピクセル位置）
+	DisableSubpixelPositioning bool
+	// TextGamma はグリフの被覆率に適用するガンマです（0 は 1.0。1 より大きいと濃く、小さいと薄くなります）
+	TextGamma float64
+	// TextContrast はグリフの被覆率のコントラストです（0 は変換なし。正の値で輪郭がくっきりします）
+	TextContrast float64
+
+	// Limits は信頼できない入力から身を守るための資源の上限です
+	// 画素数・要素数・入れ子の深さ・パスのセグメント数・フィルターの処理量・テキストの長さ・<use> の展開数を制限し、
+	// 超えた場合は *LimitError を返します（ゼロ値は既定の上限。既定値は limits.Default）
+	Limits Limits
+	// Timeout は描画全体の制限時間です（0 は制限なし。超えると context.DeadlineExceeded を返します）
+	Timeout time.Duration
 }
 
 // Diagnostics は診断情報を表します
+// Entries は全サブシステム（パーサー・スタイル・描画・フィルター・フォント）の診断を重要度・コード・要素の位置つきで保持します。
+// 文字列のリストは Entries のメッセージを種類ごとに分けたもので、互換性のために残しています
 type Diagnostics struct {
-	Warnings     []string
-	MissingFonts []string
-	Unsupported  []string // 未対応属性名など
+	Entries       []Diagnostic
+	Warnings      []string
+	MissingFonts  []string
+	Unsupported   []string // 未対応属性名など
+	FontFallbacks []string // 指定フォントにグリフがなく代替フォントを使用した記録
+	Syntheses     []string // 要求された太さ・傾きのフェイスがなく太字・斜体を合成した記録（font-synthesis）
 }
 
-// グローバルフォントマネージャー
-var globalFontManager *font.Manager
+// defaultEngine はパッケージレベルの関数が使う既定のエンジンです
+var defaultEngine = &Engine{fonts: font.NewManager()}
 
-func init() {
-	globalFontManager = font.NewManager()
+// RegisterFonts は既定のエンジンにフォントを登録します
+func RegisterFonts(fonts ...FontSource) error {
+	return defaultEngine.RegisterFonts(fonts...)
 }
 
-// RegisterFonts はフォントを登録します
-func RegisterFonts(fonts ...FontSource) error {
-	return globalFontManager.RegisterFonts(fonts...)
+// SetFontIndexPath は既定のエンジンのフォントのインデックスの保存先を設定します（空文字列で保存しない）
+func SetFontIndexPath(path string) {
+	defaultEngine.SetFontIndexPath(path)
+}
+
+// SetCacheLimits は既定のエンジンのフェイスとグリフのキャッシュの上限を設定します（0 は既定の上限、負の値でキャッシュしない）
+func SetCacheLimits(faces int, glyphBytes int64) {
+	defaultEngine.SetCacheLimits(faces, glyphBytes)
 }
 
-// ClearFontCache はフォントキャッシュをクリアします
+// ClearFontCache は既定のエンジンのフォントキャッシュをクリアします
 func ClearFontCache() {
-	globalFontManager.ClearCache()
+	defaultEngine.ClearFontCache()
 }
 
-// RenderPNG はSVGをPNGに変換します
+// QueryFont は CSS のフォント照合でフェイスを選び、各段階で候補を絞り込んだ理由とともに返します
+// 描画時と同じ照合を行うため、意図しないフォントが使われる原因の調査に使えます
+func QueryFont(q FontQuery) FontMatch {
+	return defaultEngine.QueryFont(q)
+}
+
+// SetGenericFamily は総称ファミリ（sans-serif, serif, monospace, cursive, system-ui など）の候補を設定します
+// lang（例: "ja", "zh-Hant"）を指定すると xml:lang がその言語のテキストにだけ適用されます
+// families が空の場合は既定の候補に戻します
+func SetGenericFamily(generic, lang string, families ...string) {
+	defaultEngine.SetGenericFamily(generic, lang, families...)
+}
+
+// RenderPNG は既定のエンジンでSVGをPNGに変換します
 func RenderPNG(svg []byte, opts Options) (png []byte, diag Diagnostics, err error) {
-	// デフォルト値の設定
-	if opts.DPI == 0 {
-		opts.DPI = 96
-	}
-	if opts.DefaultFamily == "" {
-		opts.DefaultFamily = "Arial"
-	}
-
-	// システムフォントスキャン（デフォルトON、DisableSystemFontScan=trueで無効化）
-	if !opts.DisableSystemFontScan {
-		if err := globalFontManager.ScanSystemFonts(); err != nil {
-			// 警告として記録するが、処理は続行
-			diag.Warnings = append(diag.Warnings, fmt.Sprintf("System font scan failed: %v", err))
-		}
-	}
-
-	// SVGパース
-	doc, err := parser.ParseSVG(svg)
-	if err != nil {
-		return nil, Diagnostics{}, err
-	}
-
-	// スケール倍率
-	scaleFactor := opts.Scale
-	if scaleFactor <= 0 {
-		scaleFactor = 1.0
-	}
-
-	// ビューポート解決
-	vp, err := viewport.ResolveViewport(doc, opts.Width, opts.Height, opts.DPI, scaleFactor)
-	if err != nil {
-		return nil, Diagnostics{}, err
-	}
-
-	// ビューポートから解決された実際の出力サイズを使用
-	outWidth := int(vp.Width)
-	outHeight := int(vp.Height)
-
-	// スタイル解決器作成
-	styleResolver := style.NewResolver(opts.DefaultFamily)
-
-	// フレームバッファ作成
-	fb := raster.NewFrameBuffer(outWidth, outHeight, opts.Background)
-
-	// フォントレンダラーを取得
-	fontRenderer := globalFontManager.GetRenderer()
-
-	// レンダリングコンテキスト作成
-	rc := raster.NewRasterContext(fb, fontRenderer, vp, doc.Defs)
-
-	// 要素の描画
-	err = renderer.RenderElements(doc, vp, styleResolver, rc)
-	if err != nil {
-		return nil, Diagnostics{}, err
-	}
-
-	// PNGエンコード
-	pngData, err := fb.EncodePNG()
-	if err != nil {
-		return nil, Diagnostics{}, err
-	}
-
-	// 診断情報収集
-	styleDiag := styleResolver.GetDiagnostics()
-	diag = Diagnostics{
-		Warnings:     styleDiag.Warnings,
-		MissingFonts: styleDiag.MissingFonts,
-		Unsupported:  styleDiag.Unsupported,
-	}
-
-	return pngData, diag, nil
+	return defaultEngine.RenderPNG(svg, opts)
+}
+
+// Render は既定のエンジンで r から読み込んだSVGを描画した画像を返します
+func Render(ctx context.Context, r io.Reader, opts Options) (*image.RGBA, Diagnostics, error) {
+	return defaultEngine.Render(ctx, r, opts)
+}
+
+// RenderTo は既定のエンジンで r から読み込んだSVGを描画し、format の形式で w に書き出します
+func RenderTo(ctx context.Context, w io.Writer, r io.Reader, opts Options, format Format) (Diagnostics, error) {
+	return defaultEngine.RenderTo(ctx, w, r, opts, format)
 }
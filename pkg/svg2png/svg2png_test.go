@@ -2,10 +2,30 @@ package svg2png
 
 import (
 	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
 	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/image/font/sfnt"
 )
 
 func TestRenderPNG_Basic(t *testing.T) {
@@ -264,3 +284,2011 @@ func TestRenderPNG_ComplexShapes(t *testing.T) {
 		t.Error("PNG data is empty")
 	}
 }
+
+// inkExtent はPNG画像内で条件を満たすピクセルのx範囲を返します（見つからない場合 ok=false）
+func inkExtent(t *testing.T, pngData []byte, match func(r, g, b, a uint8) bool) (minX, maxX int, ok bool) {
+	t.Helper()
+	r, ok := inkBounds(t, pngData, match)
+	return r.Min.X, r.Max.X - 1, ok
+}
+
+// inkBounds はPNG画像内で条件を満たすピクセルの外接矩形を返します（見つからない場合 ok=false）
+func inkBounds(t *testing.T, pngData []byte, match func(r, g, b, a uint8) bool) (r image.Rectangle, ok bool) {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(pngData))
+	if err != nil {
+		t.Fatalf("failed to decode PNG: %v", err)
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if match(c.R, c.G, c.B, c.A) {
+				px := image.Rect(x, y, x+1, y+1)
+				if !ok {
+					r, ok = px, true
+				} else {
+					r = r.Union(px)
+				}
+			}
+		}
+	}
+	return r, ok
+}
+
+// countPixels はPNG画像内で条件を満たすピクセルの数を返します
+func countPixels(t *testing.T, pngData []byte, match func(r, g, b, a uint8) bool) int {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(pngData))
+	if err != nil {
+		t.Fatalf("failed to decode PNG: %v", err)
+	}
+	n := 0
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if match(c.R, c.G, c.B, c.A) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func isInk(r, g, b, a uint8) bool     { return a > 128 }
+func isRedInk(r, g, b, a uint8) bool  { return a > 128 && r > 200 && g < 80 && b < 80 }
+func isDarkInk(r, g, b, a uint8) bool { return a > 128 && r < 80 && g < 80 && b < 80 }
+
+func TestRenderPNG_MixedContentOrder(t *testing.T) {
+	// 文字データとtspanが交互に現れる場合、文書順に描画されること
+	svgData := []byte(`<svg width="300" height="60" xmlns="http://www.w3.org/2000/svg">
+		<text x="10" y="40" font-family="DejaVu Sans" font-size="20">AAA<tspan fill="red">BBB<tspan font-size="24">B</tspan></tspan>CCC</text>
+	</svg>`)
+
+	pngData, _, err := RenderPNG(svgData, Options{})
+	if err != nil {
+		t.Fatalf("RenderPNG failed: %v", err)
+	}
+
+	darkMin, darkMax, ok := inkExtent(t, pngData, isDarkInk)
+	if !ok {
+		t.Fatal("no black text rendered")
+	}
+	redMin, redMax, ok := inkExtent(t, pngData, isRedInk)
+	if !ok {
+		t.Fatal("no red tspan rendered")
+	}
+	if redMin <= darkMin || redMax >= darkMax {
+		t.Errorf("tspan should be rendered between surrounding text: black=[%d,%d] red=[%d,%d]", darkMin, darkMax, redMin, redMax)
+	}
+}
+
+func TestRenderPNG_TextPositionUnits(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+	render := func(attrs string) ([]byte, Diagnostics) {
+		t.Helper()
+		svgData := []byte(`<svg width="200" height="60" xmlns="http://www.w3.org/2000/svg">` +
+			`<text y="40" font-family="DejaVu Sans" font-size="20" ` + attrs + `>A<tspan font-size="10">B</tspan></text></svg>`)
+		pngData, diag, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return pngData, diag
+	}
+
+	// em は要素のフォントサイズ、pt は 96dpi のピクセルに換算する
+	px, _ := render(`x="40" dx="0 20"`)
+	units, diag := render(`x="2em" dx="0 15pt"`)
+	if !bytes.Equal(px, units) {
+		t.Error("x=2em / dx=15pt should match x=40 / dx=20 at font-size 20")
+	}
+	if len(diag.Entries) != 0 {
+		t.Errorf("supported units should not be reported: %v", diag.Entries)
+	}
+
+	// 未対応の単位は診断に記録し、その値以降を無視する
+	ignored, _ := render(`x="40"`)
+	rem, diag := render(`x="40" dx="1rem 5"`)
+	if !bytes.Equal(rem, ignored) {
+		t.Error("a length with an unsupported unit should be ignored")
+	}
+	if len(diag.Entries) != 1 || diag.Entries[0].Code != "style.invalid-value" || !strings.Contains(diag.Entries[0].Message, "dx") {
+		t.Errorf("an unsupported unit should be reported: %v", diag.Entries)
+	}
+}
+
+func TestRenderPNG_XMLSpace(t *testing.T) {
+	render := func(attr string) int {
+		svgData := []byte(`<svg width="400" height="60" xmlns="http://www.w3.org/2000/svg">
+			<text x="10" y="40" font-family="DejaVu Sans" font-size="20"` + attr + `>A        B</text>
+		</svg>`)
+		pngData, _, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		minX, maxX, ok := inkExtent(t, pngData, isInk)
+		if !ok {
+			t.Fatal("no text rendered")
+		}
+		return maxX - minX
+	}
+
+	collapsed := render("")
+	preserved := render(` xml:space="preserve"`)
+	if preserved <= collapsed {
+		t.Errorf("xml:space=preserve should keep consecutive spaces: collapsed=%d preserved=%d", collapsed, preserved)
+	}
+}
+
+// requireFont は指定ファミリがシステムにない場合にテストをスキップします
+func requireFont(t *testing.T, family string) {
+	t.Helper()
+	_ = defaultEngine.fonts.ScanSystemFonts()
+	if _, err := defaultEngine.fonts.GetFont(family, "Regular"); err != nil {
+		t.Skipf("font %q is not installed: %v", family, err)
+	}
+}
+
+func TestRenderPNG_FontKerning(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+
+	render := func(attr string) int {
+		svgData := []byte(`<svg width="400" height="60" xmlns="http://www.w3.org/2000/svg">
+			<text x="10" y="40" font-family="DejaVu Sans" font-size="30"` + attr + `>AVAVAVAV</text>
+		</svg>`)
+		pngData, _, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		minX, maxX, ok := inkExtent(t, pngData, isInk)
+		if !ok {
+			t.Fatal("no text rendered")
+		}
+		return maxX - minX
+	}
+
+	kerned := render("")
+	unkerned := render(` font-kerning="none"`)
+	if kerned >= unkerned {
+		t.Errorf("GPOS kerning should tighten AV pairs: kerned=%d unkerned=%d", kerned, unkerned)
+	}
+	if off := render(` style="font-feature-settings: 'kern' 0"`); off != unkerned {
+		t.Errorf("font-feature-settings 'kern' 0 should match font-kerning none: %d != %d", off, unkerned)
+	}
+}
+
+func TestRenderPNG_BidiDirection(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+
+	render := func(body string) []byte {
+		svgData := []byte(`<svg width="300" height="60" xmlns="http://www.w3.org/2000/svg">` + body + `</svg>`)
+		pngData, _, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return pngData
+	}
+
+	// direction="rtl" では text-anchor="start" が右端に揃う
+	pngData := render(`<text x="200" y="40" font-family="DejaVu Sans" font-size="20" direction="rtl">שלום עולם</text>`)
+	minX, maxX, ok := inkExtent(t, pngData, isInk)
+	if !ok {
+		t.Fatal("no text rendered")
+	}
+	if maxX > 201 || minX >= 190 {
+		t.Errorf("rtl start anchor should end at x=200: ink [%d, %d]", minX, maxX)
+	}
+
+	// RTL 段落では先頭の LTR 語が右側に並ぶ
+	pngData = render(`<text x="250" y="40" font-family="DejaVu Sans" font-size="20" direction="rtl"><tspan fill="red">abc</tspan> <tspan fill="black">שלום</tspan></text>`)
+	redMin, _, okRed := inkExtent(t, pngData, isRedInk)
+	_, darkMax, okDark := inkExtent(t, pngData, isDarkInk)
+	if !okRed || !okDark {
+		t.Fatal("spans not rendered")
+	}
+	if redMin <= darkMax {
+		t.Errorf("leading LTR run should be placed right of Hebrew in rtl paragraph: red min %d, dark max %d", redMin, darkMax)
+	}
+
+	// unicode-bidi="plaintext" の段落方向は最初の強い文字で決まり、先頭の数字や記号では決まらない
+	for _, content := range []string{"123 שלום", "- שלום"} {
+		pngData = render(`<text x="200" y="40" font-family="DejaVu Sans" font-size="20" unicode-bidi="plaintext">` + content + `</text>`)
+		if minX, maxX, ok := inkExtent(t, pngData, isInk); !ok || maxX > 201 || minX >= 190 {
+			t.Errorf("plaintext %q should be an rtl paragraph ending at x=200: ink [%d, %d]", content, minX, maxX)
+		}
+	}
+	pngData = render(`<text x="20" y="40" font-family="DejaVu Sans" font-size="20" unicode-bidi="plaintext">123 abc שלום</text>`)
+	if minX, _, ok := inkExtent(t, pngData, isInk); !ok || minX < 19 || minX > 24 {
+		t.Errorf("plaintext starting with Latin should be an ltr paragraph starting at x=20: ink min %d", minX)
+	}
+
+	// unicode-bidi="bidi-override" で LTR の文字列が反転して描画される
+	plain := render(`<text x="20" y="40" font-family="DejaVu Sans" font-size="20"><tspan fill="red">ab</tspan>c</text>`)
+	override := render(`<text x="20" y="40" font-family="DejaVu Sans" font-size="20" direction="rtl" unicode-bidi="bidi-override" text-anchor="end"><tspan fill="red">ab</tspan>c</text>`)
+	plainRed, _, _ := inkExtent(t, plain, isRedInk)
+	overrideRed, _, _ := inkExtent(t, override, isRedInk)
+	if overrideRed <= plainRed {
+		t.Errorf("bidi-override rtl should move the first span to the right: %d <= %d", overrideRed, plainRed)
+	}
+}
+
+func TestRenderPNG_MixedScriptShaping(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+
+	render := func(content string) *image.RGBA {
+		svgData := `<svg width="200" height="60" xmlns="http://www.w3.org/2000/svg">` +
+			`<text x="20" y="40" font-family="DejaVu Sans" font-size="24" direction="rtl" text-anchor="end">` + content + `</text></svg>`
+		img, _, err := Render(context.Background(), strings.NewReader(svgData), Options{})
+		if err != nil {
+			t.Fatalf("Render failed: %v", err)
+		}
+		return img
+	}
+
+	// 同じフォント・同じ方向の項目でも、アラビア文字はヘブライ文字の後ろでアラビア文字としてシェーピングする（語中形で連結する）
+	alone := render("سلام")
+	mixed := render("שלום سلام")
+	width := 0
+	for x := 0; x < alone.Bounds().Dx(); x++ {
+		for y := 0; y < alone.Bounds().Dy(); y++ {
+			if alone.RGBAAt(x, y).A > 0 {
+				width = x + 1
+			}
+		}
+	}
+	if width == 0 {
+		t.Fatal("no Arabic text rendered")
+	}
+	for x := 0; x < width; x++ {
+		for y := 0; y < alone.Bounds().Dy(); y++ {
+			if alone.RGBAAt(x, y) != mixed.RGBAAt(x, y) {
+				t.Fatalf("Arabic after Hebrew should be shaped like Arabic alone: pixel (%d, %d) differs", x, y)
+			}
+		}
+	}
+}
+
+func TestRenderPNG_GlyphFallback(t *testing.T) {
+	requireFont(t, "DejaVu Serif")
+	requireFont(t, "DejaVu Sans")
+
+	// DejaVu Serif はヘブライ文字を収録していないため、その区間だけ他のフォントで描画される
+	svgData := []byte(`<svg width="300" height="60" xmlns="http://www.w3.org/2000/svg">
+		<text x="10" y="40" font-family="DejaVu Serif" font-size="20">abc <tspan fill="red">שלום</tspan> &#x10FFFD;</text>
+	</svg>`)
+	pngData, diag, err := RenderPNG(svgData, Options{})
+	if err != nil {
+		t.Fatalf("RenderPNG failed: %v", err)
+	}
+	minX, maxX, ok := inkExtent(t, pngData, isRedInk)
+	if !ok || maxX-minX < 20 {
+		t.Errorf("Hebrew span should be rendered with a fallback font: ink [%d, %d] ok=%v", minX, maxX, ok)
+	}
+
+	found := false
+	for _, msg := range diag.FontFallbacks {
+		if strings.Contains(msg, "DejaVu Serif") && strings.Contains(msg, "שלום") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("fallback for Hebrew run should be reported, got %v", diag.FontFallbacks)
+	}
+	for _, msg := range diag.FontFallbacks {
+		if strings.Contains(msg, "abc") {
+			t.Errorf("covered Latin text should not be reported as fallback: %q", msg)
+		}
+	}
+
+	uncovered := false
+	for _, msg := range diag.Warnings {
+		if strings.Contains(msg, "U+10FFFD") {
+			uncovered = true
+		}
+	}
+	if !uncovered {
+		t.Errorf("uncovered code point should be reported, got %v", diag.Warnings)
+	}
+}
+
+func TestRenderPNG_VerticalText(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+
+	render := func(attrs, content string) image.Rectangle {
+		svgData := []byte(`<svg width="200" height="300" xmlns="http://www.w3.org/2000/svg">
+			<text x="100" y="150" font-family="DejaVu Sans" font-size="24" ` + attrs + `>` + content + `</text>
+		</svg>`)
+		pngData, _, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		r, ok := inkBounds(t, pngData, isInk)
+		if !ok {
+			t.Fatalf("no text rendered for %s", attrs)
+		}
+		return r
+	}
+
+	// tb-rl（SVG 1.1）でも縦に進み、x は中央線になる
+	r := render(`writing-mode="tb-rl"`, "Hello")
+	if r.Dy() <= r.Dx() {
+		t.Errorf("vertical text should be taller than wide: %v", r)
+	}
+	if c := (r.Min.X + r.Max.X) / 2; c < 95 || c > 105 {
+		t.Errorf("vertical text should be centered on x=100: %v", r)
+	}
+	if r.Min.Y < 148 {
+		t.Errorf("start anchor should begin at y=150: %v", r)
+	}
+
+	// text-anchor="end" は縦方向の終端で揃う
+	if r := render(`writing-mode="vertical-rl" text-anchor="end"`, "Hello"); r.Max.Y > 152 || r.Min.Y > 140 {
+		t.Errorf("end anchor should finish at y=150: %v", r)
+	}
+
+	// mixed ではラテン文字は横倒し、upright では正立して1文字ずつ縦に積まれる
+	mixed := render(`writing-mode="vertical-rl"`, "ABC")
+	upright := render(`writing-mode="vertical-rl" text-orientation="upright"`, "ABC")
+	if upright.Dy() <= mixed.Dy() || upright.Dx() >= mixed.Dx() {
+		t.Errorf("upright Latin should stack vertically: mixed %v, upright %v", mixed, upright)
+	}
+	if g := render(`writing-mode="vertical-rl" glyph-orientation-vertical="0"`, "ABC"); g != upright {
+		t.Errorf("glyph-orientation-vertical=0 should match text-orientation upright: %v != %v", g, upright)
+	}
+}
+
+func TestRenderPNG_TextPath(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+
+	render := func(pathData, attrs string) (image.Rectangle, bool) {
+		svgData := []byte(`<svg width="300" height="300" xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+			<defs><path id="p" d="` + pathData + `"/></defs>
+			<text font-family="DejaVu Sans" font-size="20"><textPath xlink:href="#p"` + attrs + `>Hello textPath world</textPath></text>
+		</svg>`)
+		pngData, _, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return inkBounds(t, pngData, isInk)
+	}
+
+	// パスの終端を越えるグリフは描画されない
+	r, ok := render("M 10 50 L 110 50", "")
+	if !ok {
+		t.Fatal("no text rendered on path")
+	}
+	if r.Min.X < 9 || r.Max.X > 112 {
+		t.Errorf("glyphs should be clipped to the path [10, 110]: %v", r)
+	}
+
+	// startOffset でパス上の開始位置がずれる
+	if shifted, _ := render("M 10 50 L 290 50", ` startOffset="100"`); shifted.Min.X < 108 {
+		t.Errorf("startOffset=100 should start near x=110: %v", shifted)
+	}
+
+	// 縦方向のパスではグリフが接線方向に回転する
+	if v, _ := render("M 50 10 L 50 290", ""); v.Dy() <= v.Dx() {
+		t.Errorf("text on vertical path should be rotated: %v", v)
+	}
+
+	// 参照先が存在しない textPath は描画しない
+	if _, ok := render("M 10 50 L 110 50", ` href="#missing"`); ok {
+		t.Error("textPath with missing reference should not render")
+	}
+}
+
+func TestRenderPNG_TextPaint(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+
+	render := func(body string) []byte {
+		svgData := []byte(`<svg width="300" height="100" xmlns="http://www.w3.org/2000/svg">
+			<defs>
+				<linearGradient id="g" x1="0" y1="0" x2="1" y2="0"><stop offset="0" stop-color="#ff0000"/><stop offset="1" stop-color="#0000ff"/></linearGradient>
+				<clipPath id="c"><rect x="0" y="0" width="60" height="100"/></clipPath>
+			</defs>` + body + `</svg>`)
+		pngData, _, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return pngData
+	}
+	const text = `font-family="DejaVu Sans" font-size="40">Painted</text>`
+
+	// fill="none" でも stroke があれば輪郭が描かれる
+	if _, ok := inkBounds(t, render(`<text x="10" y="60" fill="none" stroke="#000" stroke-width="2" `+text), isDarkInk); !ok {
+		t.Error("stroked text with fill=none should render its outline")
+	}
+
+	// グラデーションはテキストの外接矩形に沿って変化する
+	grad := render(`<text x="10" y="60" fill="url(#g)" ` + text)
+	if _, ok := inkBounds(t, grad, isRedInk); !ok {
+		t.Error("gradient fill should paint red at the start of the text")
+	}
+	if _, ok := inkBounds(t, grad, func(r, g, b, a uint8) bool { return a > 128 && b > 200 && r < 80 }); !ok {
+		t.Error("gradient fill should paint blue at the end of the text")
+	}
+
+	// クリップパスの外側には描画されない
+	r, ok := inkBounds(t, render(`<g clip-path="url(#c)"><text x="10" y="60" fill="#000" `+text+`</g>`), isInk)
+	if !ok {
+		t.Fatal("clipped text should render inside the clip")
+	}
+	if r.Max.X > 61 {
+		t.Errorf("text should be clipped at x=60: %v", r)
+	}
+}
+
+// withTables は TrueType フォントにテーブルを追加（同じタグは置換）したフォントを返します
+func withTables(data []byte, extra map[string][]byte) []byte {
+	be := binary.BigEndian
+	type table struct {
+		tag  string
+		data []byte
+	}
+	var tables []table
+	for tag, d := range extra {
+		tables = append(tables, table{tag, d})
+	}
+	numTables := int(be.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		rec := data[12+16*i:]
+		if _, ok := extra[string(rec[:4])]; ok {
+			continue
+		}
+		off, length := be.Uint32(rec[8:]), be.Uint32(rec[12:])
+		tables = append(tables, table{string(rec[:4]), data[off : off+length]})
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].tag < tables[j].tag })
+
+	out := make([]byte, 12+16*len(tables))
+	copy(out, data[:12])
+	be.PutUint16(out[4:], uint16(len(tables)))
+	for i, tb := range tables {
+		rec := out[12+16*i:]
+		copy(rec, tb.tag)
+		be.PutUint32(rec[8:], uint32(len(out)))
+		be.PutUint32(rec[12:], uint32(len(tb.data)))
+		out = append(out, tb.data...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+// withColorTables は TrueType フォントに COLR v0 と CPAL v1 テーブルを追加したフォントを返します
+// gid のグリフをパレット 0 番の色で塗るカラーグリフにし、パレットはライト（赤）とダーク（青）の2つです
+func withColorTables(data []byte, gid uint16) []byte {
+	be := binary.BigEndian
+	colr := make([]byte, 24)
+	be.PutUint16(colr[2:], 1)  // numBaseGlyphRecords
+	be.PutUint32(colr[4:], 14) // baseGlyphRecordsOffset
+	be.PutUint32(colr[8:], 20) // layerRecordsOffset
+	be.PutUint16(colr[12:], 1) // numLayerRecords
+	be.PutUint16(colr[14:], gid)
+	be.PutUint16(colr[18:], 1)
+	be.PutUint16(colr[20:], gid)
+
+	cpal := make([]byte, 44)
+	be.PutUint16(cpal[0:], 1)  // version
+	be.PutUint16(cpal[2:], 1)  // numPaletteEntries
+	be.PutUint16(cpal[4:], 2)  // numPalettes
+	be.PutUint16(cpal[6:], 2)  // numColorRecords
+	be.PutUint32(cpal[8:], 28) // colorRecordsArrayOffset
+	be.PutUint16(cpal[14:], 1) // colorRecordIndices[1]
+	be.PutUint32(cpal[16:], 36)
+	copy(cpal[28:], []byte{0x00, 0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0xFF}) // BGRA: 赤, 青
+	be.PutUint32(cpal[36:], 1)                                              // light
+	be.PutUint32(cpal[40:], 2)                                              // dark
+
+	return withTables(data, map[string][]byte{"COLR": colr, "CPAL": cpal})
+}
+
+// systemFontData は登録済みフォントのデータと解析結果を返します
+func systemFontData(t *testing.T, family string) ([]byte, *sfnt.Font) {
+	t.Helper()
+	requireFont(t, family)
+	info, _ := defaultEngine.fonts.GetFont(family, "Regular")
+	data := info.Data
+	if data == nil {
+		var err error
+		if data, err = os.ReadFile(info.Path); err != nil {
+			t.Skipf("cannot read font file: %v", err)
+		}
+	}
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		t.Skipf("cannot parse font: %v", err)
+	}
+	return data, f
+}
+
+func TestRenderPNG_ColorGlyphs(t *testing.T) {
+	data, f := systemFontData(t, "DejaVu Sans")
+	gid, err := f.GlyphIndex(&sfnt.Buffer{}, 'O')
+	if err != nil || gid == 0 {
+		t.Skipf("glyph O not found: %v", err)
+	}
+	if err := RegisterFonts(FontSource{Family: "Test Color Glyphs", Style: "Regular", Data: withColorTables(data, uint16(gid))}); err != nil {
+		t.Fatalf("RegisterFonts failed: %v", err)
+	}
+
+	render := func(attrs string) []byte {
+		svgData := []byte(`<svg width="200" height="100" xmlns="http://www.w3.org/2000/svg">
+			<text x="10" y="70" font-family="Test Color Glyphs" font-size="48" fill="#000"` + attrs + `>IOI</text>
+		</svg>`)
+		pngData, _, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return pngData
+	}
+	isBlueInk := func(r, g, b, a uint8) bool { return a > 128 && b > 200 && r < 80 && g < 80 }
+
+	// カラーグリフはパレットの色、それ以外のグリフは fill で描画される
+	light := render("")
+	if _, ok := inkBounds(t, light, isRedInk); !ok {
+		t.Error("color glyph should be painted with the first palette (red)")
+	}
+	if _, ok := inkBounds(t, light, isDarkInk); !ok {
+		t.Error("non-color glyphs should be painted with the fill color")
+	}
+	if _, ok := inkBounds(t, light, isBlueInk); ok {
+		t.Error("dark palette should not be used by default")
+	}
+
+	// font-palette: dark は CPAL のダーク背景用パレットを選ぶ
+	dark := render(` font-palette="dark"`)
+	if _, ok := inkBounds(t, dark, isBlueInk); !ok {
+		t.Error("font-palette=dark should select the dark palette (blue)")
+	}
+	if _, ok := inkBounds(t, dark, isRedInk); ok {
+		t.Error("font-palette=dark should not use the light palette")
+	}
+}
+
+// withWeightAxis は TrueType フォントに wght 軸（100〜900、既定 400）を追加した可変フォントを返します
+// wght=900 で gid のグリフ（輪郭を持たない空白など）の送り幅が advance 単位だけ広がります
+func withWeightAxis(data []byte, numGlyphs int, gid uint16, advance int16) []byte {
+	be := binary.BigEndian
+	fvar := make([]byte, 36)
+	be.PutUint16(fvar[0:], 1)  // majorVersion
+	be.PutUint16(fvar[4:], 16) // axesArrayOffset
+	be.PutUint16(fvar[6:], 2)  // reserved
+	be.PutUint16(fvar[8:], 1)  // axisCount
+	be.PutUint16(fvar[10:], 20)
+	be.PutUint16(fvar[14:], 8) // instanceSize
+	copy(fvar[16:], "wght")
+	be.PutUint32(fvar[20:], 100<<16)
+	be.PutUint32(fvar[24:], 400<<16)
+	be.PutUint32(fvar[28:], 900<<16)
+
+	// 輪郭点がないグリフの点は4つのファントム点だけで、2番目が送り幅の位置
+	glyphData := []byte{
+		0x00, 0x01, // tupleVariationCount
+		0x00, 0x0A, // dataOffset
+		0x00, 0x0A, // variationDataSize
+		0x80, 0x00, // EMBEDDED_PEAK_TUPLE
+		0x40, 0x00, // peak wght = 1.0
+		0x43, 0, 0, byte(advance >> 8), byte(advance), 0, 0, 0, 0, // x: 4 つの16ビット値
+		0x83, // y: 4 つの 0
+	}
+	dataStart := 20 + 4*(numGlyphs+1)
+	gvar := make([]byte, dataStart, dataStart+len(glyphData))
+	be.PutUint16(gvar[0:], 1) // majorVersion
+	be.PutUint16(gvar[4:], 1) // axisCount
+	be.PutUint32(gvar[8:], uint32(dataStart))
+	be.PutUint16(gvar[12:], uint16(numGlyphs))
+	be.PutUint16(gvar[14:], 1) // 32ビットオフセット
+	be.PutUint32(gvar[16:], uint32(dataStart))
+	for g := int(gid) + 1; g <= numGlyphs; g++ {
+		be.PutUint32(gvar[20+4*g:], uint32(len(glyphData)))
+	}
+	gvar = append(gvar, glyphData...)
+
+	return withTables(data, map[string][]byte{"fvar": fvar, "gvar": gvar})
+}
+
+func TestRenderPNG_FontWeightMatching(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+
+	width := func(family, attrs string) int {
+		t.Helper()
+		svgData := []byte(`<svg width="300" height="60" xmlns="http://www.w3.org/2000/svg">
+			<text x="10" y="40" font-family="` + family + `" font-size="30"` + attrs + `>I I</text>
+		</svg>`)
+		pngData, _, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		minX, maxX, ok := inkExtent(t, pngData, isInk)
+		if !ok {
+			t.Fatalf("no ink rendered for %s", attrs)
+		}
+		return maxX - minX
+	}
+
+	// 静的フォントは CSS の照合順で最も近い太さのフェイスが選ばれる（DejaVu Sans は 400 と 700）
+	regular := width("DejaVu Sans", "")
+	if w := width("DejaVu Sans", ` font-weight="600"`); w <= regular {
+		t.Errorf("font-weight 600 should select the bold face: width %d, regular %d", w, regular)
+	}
+	if w := width("DejaVu Sans", ` font-weight="500"`); w != regular {
+		t.Errorf("font-weight 500 should select the regular face: width %d, regular %d", w, regular)
+	}
+	if w := width("DejaVu Sans", ` font-weight="300"`); w != regular {
+		t.Errorf("font-weight 300 should fall back to the regular face: width %d, regular %d", w, regular)
+	}
+
+	// 可変フォントは font-weight と font-variation-settings が wght 軸に対応する
+	data, f := systemFontData(t, "DejaVu Sans")
+	space, err := f.GlyphIndex(&sfnt.Buffer{}, ' ')
+	if err != nil || space == 0 {
+		t.Skipf("space glyph not found: %v", err)
+	}
+	vf := withWeightAxis(data, f.NumGlyphs(), uint16(space), 1024)
+	if err := RegisterFonts(FontSource{Family: "Test Variable", Style: "Regular", Data: vf}); err != nil {
+		t.Fatalf("RegisterFonts failed: %v", err)
+	}
+	base := width("Test Variable", "")
+	// 1024 / 2048 em = 15px（30pt = 40px の半分）だけ広がる
+	heavy := width("Test Variable", ` font-weight="900"`)
+	if heavy-base < 15 {
+		t.Errorf("font-weight 900 should apply the wght axis: width %d, default %d", heavy, base)
+	}
+	if w := width("Test Variable", ` style="font-variation-settings: 'wght' 900"`); w != heavy {
+		t.Errorf("font-variation-settings should set the wght axis: width %d, want %d", w, heavy)
+	}
+	if w := width("Test Variable", ` font-weight="900" style="font-variation-settings: 'wght' 400"`); w != base {
+		t.Errorf("font-variation-settings should override font-weight: width %d, want %d", w, base)
+	}
+}
+
+func TestQueryFont(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+
+	// 見つからないファミリを飛ばし、総称ファミリを展開して最も近い太さを選ぶ
+	m := QueryFont(FontQuery{Families: []string{"No Such Font", "sans-serif"}, Weight: 600})
+	if m.Face == nil || m.Face.Family != "DejaVu Sans" || m.Face.Style != "Bold" {
+		t.Fatalf("expected DejaVu Sans Bold, got %+v", m.Face)
+	}
+	reasons := strings.Join(m.Reasons, "\n")
+	for _, want := range []string{`"No Such Font": no faces registered`, `"sans-serif"`, "weight 600: [Bold]"} {
+		if !strings.Contains(reasons, want) {
+			t.Errorf("reasons should mention %q:\n%s", want, reasons)
+		}
+	}
+
+	// font-family のリストは先頭から順に照合され、見つかったファミリはフォールバック扱いにならない
+	render := func(attrs string) ([]byte, Diagnostics) {
+		svgData := []byte(`<svg width="200" height="60" xmlns="http://www.w3.org/2000/svg">
+			<text x="10" y="40" font-size="30"` + attrs + `>Qg</text>
+		</svg>`)
+		pngData, diag, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return pngData, diag
+	}
+	requireFont(t, "DejaVu Serif")
+	serif, _ := render(` font-family="DejaVu Serif"`)
+	list, diag := render(` font-family="No Such Font, 'DejaVu Serif', sans-serif"`)
+	if !bytes.Equal(serif, list) {
+		t.Error("font-family list should use the first available family")
+	}
+	if len(diag.FontFallbacks) != 0 {
+		t.Errorf("an available family in the list is not a fallback: %v", diag.FontFallbacks)
+	}
+
+	// 総称ファミリは xml:lang に応じて設定した候補に展開される
+	SetGenericFamily("sans-serif", "ja", "DejaVu Serif")
+	defer SetGenericFamily("sans-serif", "ja")
+	ja, _ := render(` font-family="sans-serif" xml:lang="ja-JP"`)
+	en, _ := render(` font-family="sans-serif" xml:lang="en"`)
+	if !bytes.Equal(ja, serif) {
+		t.Error("sans-serif for lang=ja should resolve to the configured family")
+	}
+	if bytes.Equal(en, serif) {
+		t.Error("sans-serif for lang=en should not use the ja setting")
+	}
+}
+
+func TestRenderPNG_FontFace(t *testing.T) {
+	serifData, _ := systemFontData(t, "DejaVu Serif")
+	requireFont(t, "DejaVu Sans")
+
+	render := func(css, attrs string, opts Options) ([]byte, Diagnostics) {
+		svgData := []byte(`<svg width="200" height="60" xmlns="http://www.w3.org/2000/svg">
+			<style><![CDATA[` + css + `]]></style>
+			<text x="10" y="40" font-size="30"` + attrs + `>Qg</text>
+		</svg>`)
+		pngData, diag, err := RenderPNG(svgData, opts)
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return pngData, diag
+	}
+	serif, _ := render("", ` font-family="DejaVu Serif"`, Options{})
+	sans, _ := render("", ` font-family="DejaVu Sans"`, Options{})
+
+	// data URI の @font-face は文書内でだけ使え、グローバルなフォントには登録されない
+	uri := "data:font/ttf;base64," + base64.StdEncoding.EncodeToString(serifData)
+	css := `/* embedded */ @font-face { font-family: "Doc Font"; src: url("` + uri + `") format("truetype"); }
+		text { fill: black; }`
+	doc, diag := render(css, ` font-family="Doc Font"`, Options{})
+	if !bytes.Equal(doc, serif) {
+		t.Errorf("@font-face with a data URI should render with the embedded font (warnings: %v)", diag.Warnings)
+	}
+	if len(diag.FontFallbacks) != 0 {
+		t.Errorf("an @font-face family is not a fallback: %v", diag.FontFallbacks)
+	}
+	if m := QueryFont(FontQuery{Families: []string{"Doc Font"}}); m.Face != nil {
+		t.Error("@font-face fonts must not leak into the global font set")
+	}
+
+	// @font-face はインストール済みの同名ファミリより優先し、外部 URL は ResolveURL で取得する
+	css = `@font-face { font-family: "DejaVu Sans"; src: url(fonts/serif.ttf); }`
+	var requested string
+	shadow, _ := render(css, ` font-family="DejaVu Sans"`, Options{ResolveURL: func(u string) ([]byte, error) {
+		requested = u
+		return serifData, nil
+	}})
+	if requested != "fonts/serif.ttf" || !bytes.Equal(shadow, serif) {
+		t.Errorf("@font-face should shadow the installed family (requested %q)", requested)
+	}
+	unresolved, diag := render(css, ` font-family="DejaVu Sans"`, Options{})
+	if !bytes.Equal(unresolved, sans) || len(diag.Warnings) == 0 {
+		t.Errorf("an unloadable @font-face should be reported and ignored (warnings: %v)", diag.Warnings)
+	}
+
+	// local() はインストール済みのフォントを別名で参照する
+	local, _ := render(`@font-face { font-family: Alias; src: local("No Such"), local("DejaVu Serif"); }`, ` font-family="Alias"`, Options{})
+	if !bytes.Equal(local, serif) {
+		t.Error("local() should reference an installed font")
+	}
+
+	// 空の記述子は無視して既定値を使う
+	empty, _ := render(`@font-face { font-family: Alias; font-weight: ; font-stretch:; font-style: ; src: local("DejaVu Serif"); }`, ` font-family="Alias"`, Options{})
+	if !bytes.Equal(empty, serif) {
+		t.Error("empty @font-face descriptors should be ignored")
+	}
+}
+
+// sfntTableList は TrueType フォントのテーブルをディレクトリ順に返します
+func sfntTableList(data []byte) (tags []string, tables map[string][]byte) {
+	be := binary.BigEndian
+	tables = make(map[string][]byte)
+	for i := 0; i < int(be.Uint16(data[4:])); i++ {
+		rec := data[12+16*i:]
+		off, length := be.Uint32(rec[8:]), be.Uint32(rec[12:])
+		tags = append(tags, string(rec[:4]))
+		tables[string(rec[:4])] = data[off : off+length]
+	}
+	return tags, tables
+}
+
+// toWOFF は TrueType フォントをテーブルごとに zlib 圧縮した WOFF に変換します
+func toWOFF(data []byte) []byte {
+	be := binary.BigEndian
+	tags, tables := sfntTableList(data)
+	out := make([]byte, 44+20*len(tags))
+	copy(out, "wOFF")
+	copy(out[4:], data[:4])
+	be.PutUint16(out[12:], uint16(len(tags)))
+	for i, tag := range tags {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(tables[tag])
+		zw.Close()
+		comp := z.Bytes()
+		if len(comp) >= len(tables[tag]) {
+			comp = tables[tag]
+		}
+		rec := out[44+20*i:]
+		copy(rec, tag)
+		be.PutUint32(rec[4:], uint32(len(out)))
+		be.PutUint32(rec[8:], uint32(len(comp)))
+		be.PutUint32(rec[12:], uint32(len(tables[tag])))
+		out = append(out, comp...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	be.PutUint32(out[8:], uint32(len(out)))
+	return out
+}
+
+// toWOFF2 は TrueType フォントを glyf/loca を変換した WOFF2 に変換します
+// 座標は常に4バイトの三つ組、バウンディングボックスは常に明示する単純な符号化です
+func toWOFF2(data []byte) []byte {
+	be := binary.BigEndian
+	tags, tables := sfntTableList(data)
+	head, glyf, loca := tables["head"], tables["glyf"], tables["loca"]
+	numGlyphs := int(be.Uint16(tables["maxp"][4:]))
+	longLoca := be.Uint16(head[50:]) != 0
+	glyphAt := func(i int) []byte {
+		if longLoca {
+			return glyf[be.Uint32(loca[i*4:]):be.Uint32(loca[i*4+4:])]
+		}
+		return glyf[int(be.Uint16(loca[i*2:]))*2 : int(be.Uint16(loca[i*2+2:]))*2]
+	}
+	u16 := func(b *bytes.Buffer, v int) { b.WriteByte(byte(v >> 8)); b.WriteByte(byte(v)) }
+	u255 := func(b *bytes.Buffer, v int) { b.WriteByte(253); u16(b, v) }
+
+	var nContours, nPoints, flags, glyphs, composites, bboxes, instructions bytes.Buffer
+	bboxBitmap := make([]byte, (numGlyphs+31)/32*4)
+	for i := 0; i < numGlyphs; i++ {
+		g := glyphAt(i)
+		if len(g) == 0 {
+			u16(&nContours, 0)
+			continue
+		}
+		nc := int(int16(be.Uint16(g)))
+		nContours.Write(g[:2])
+		bboxBitmap[i>>3] |= 0x80 >> (i & 7)
+		bboxes.Write(g[2:10])
+		if nc < 0 {
+			p, hasInstructions := 10, false
+			for more := true; more; {
+				f := be.Uint16(g[p:])
+				size := 6
+				if f&1 != 0 {
+					size = 8
+				}
+				switch {
+				case f&0x08 != 0:
+					size += 2
+				case f&0x40 != 0:
+					size += 4
+				case f&0x80 != 0:
+					size += 8
+				}
+				composites.Write(g[p : p+size])
+				p += size
+				hasInstructions = hasInstructions || f&0x100 != 0
+				more = f&0x20 != 0
+			}
+			if hasInstructions {
+				n := int(be.Uint16(g[p:]))
+				u255(&glyphs, n)
+				instructions.Write(g[p+2 : p+2+n])
+			}
+			continue
+		}
+		last := -1
+		for c := 0; c < nc; c++ {
+			end := int(be.Uint16(g[10+2*c:]))
+			u255(&nPoints, end-last)
+			last = end
+		}
+		total := last + 1
+		p := 10 + 2*nc
+		n := int(be.Uint16(g[p:]))
+		insts := g[p+2 : p+2+n]
+		p += 2 + n
+		pointFlags := make([]byte, 0, total)
+		for len(pointFlags) < total {
+			f := g[p]
+			p++
+			pointFlags = append(pointFlags, f)
+			if f&0x08 != 0 {
+				for r := g[p]; r > 0; r-- {
+					pointFlags = append(pointFlags, f)
+				}
+				p++
+			}
+		}
+		readCoords := func(short, same byte) []int {
+			deltas := make([]int, total)
+			for j, f := range pointFlags {
+				switch {
+				case f&short != 0 && f&same != 0:
+					deltas[j] = int(g[p])
+					p++
+				case f&short != 0:
+					deltas[j] = -int(g[p])
+					p++
+				case f&same == 0:
+					deltas[j] = int(int16(be.Uint16(g[p:])))
+					p += 2
+				}
+			}
+			return deltas
+		}
+		dxs, dys := readCoords(0x02, 0x10), readCoords(0x04, 0x20)
+		for j := range pointFlags {
+			flag := byte(124)
+			if dxs[j] >= 0 {
+				flag |= 1
+			}
+			if dys[j] >= 0 {
+				flag |= 2
+			}
+			if pointFlags[j]&1 == 0 {
+				flag |= 0x80
+			}
+			flags.WriteByte(flag)
+			for _, d := range []int{dxs[j], dys[j]} {
+				if d < 0 {
+					d = -d
+				}
+				u16(&glyphs, d)
+			}
+		}
+		u255(&glyphs, n)
+		instructions.Write(insts)
+	}
+
+	var tglyf bytes.Buffer
+	u16(&tglyf, 0)
+	u16(&tglyf, 0)
+	u16(&tglyf, numGlyphs)
+	u16(&tglyf, int(be.Uint16(head[50:])))
+	bboxStream := append(bboxBitmap, bboxes.Bytes()...)
+	streams := [][]byte{nContours.Bytes(), nPoints.Bytes(), flags.Bytes(), glyphs.Bytes(), composites.Bytes(), bboxStream, instructions.Bytes()}
+	for _, s := range streams {
+		var size [4]byte
+		be.PutUint32(size[:], uint32(len(s)))
+		tglyf.Write(size[:])
+	}
+	for _, s := range streams {
+		tglyf.Write(s)
+	}
+
+	base128 := func(b *bytes.Buffer, v int) {
+		var tmp []byte
+		for tmp = []byte{byte(v & 0x7f)}; v >= 0x80; {
+			v >>= 7
+			tmp = append([]byte{byte(v&0x7f) | 0x80}, tmp...)
+		}
+		b.Write(tmp)
+	}
+	knownTags := map[string]byte{"cmap": 0, "head": 1, "hhea": 2, "hmtx": 3, "maxp": 4, "glyf": 10, "loca": 11}
+	var dir, stream bytes.Buffer
+	for _, tag := range tags {
+		if idx, ok := knownTags[tag]; ok {
+			dir.WriteByte(idx)
+		} else {
+			dir.WriteByte(0x3f)
+			dir.WriteString(tag)
+		}
+		base128(&dir, len(tables[tag]))
+		switch tag {
+		case "glyf":
+			base128(&dir, tglyf.Len())
+			stream.Write(tglyf.Bytes())
+		case "loca":
+			base128(&dir, 0)
+		default:
+			stream.Write(tables[tag])
+		}
+	}
+	var compressed bytes.Buffer
+	bw := brotli.NewWriter(&compressed)
+	bw.Write(stream.Bytes())
+	bw.Close()
+
+	out := make([]byte, 48)
+	copy(out, "wOF2")
+	copy(out[4:], data[:4])
+	be.PutUint16(out[12:], uint16(len(tags)))
+	be.PutUint32(out[16:], uint32(len(data)))
+	be.PutUint32(out[20:], uint32(compressed.Len()))
+	out = append(out, dir.Bytes()...)
+	out = append(out, compressed.Bytes()...)
+	be.PutUint32(out[8:], uint32(len(out)))
+	return out
+}
+
+func TestRenderPNG_WebFonts(t *testing.T) {
+	serifData, _ := systemFontData(t, "DejaVu Serif")
+
+	render := func(css, family string) ([]byte, Diagnostics) {
+		svgData := []byte(`<svg width="260" height="60" xmlns="http://www.w3.org/2000/svg">
+			<style>` + css + `</style>
+			<text x="10" y="40" font-size="30" font-family="` + family + `">Qgé&amp;fi</text>
+		</svg>`)
+		pngData, diag, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return pngData, diag
+	}
+	serif, _ := render("", "DejaVu Serif")
+
+	// WOFF は RegisterFonts で登録できる
+	if err := RegisterFonts(FontSource{Family: "WOFF Serif", Data: toWOFF(serifData)}); err != nil {
+		t.Fatalf("RegisterFonts(WOFF) failed: %v", err)
+	}
+	if got, _ := render("", "WOFF Serif"); !bytes.Equal(got, serif) {
+		t.Error("WOFF font should render like the original TrueType font")
+	}
+
+	// WOFF2（glyf/loca の変換を含む）は @font-face の data URI から読み込める
+	uri := "data:font/woff2;base64," + base64.StdEncoding.EncodeToString(toWOFF2(serifData))
+	got, diag := render(`@font-face { font-family: W2; src: url(`+uri+`) format("woff2"); }`, "W2")
+	if !bytes.Equal(got, serif) {
+		t.Errorf("WOFF2 font should render like the original TrueType font (warnings: %v)", diag.Warnings)
+	}
+
+	// 壊れた WOFF2 は警告に記録して無視する
+	broken := toWOFF2(serifData)[:200]
+	uri = "data:font/woff2;base64," + base64.StdEncoding.EncodeToString(broken)
+	if _, diag := render(`@font-face { font-family: W2; src: url(`+uri+`); }`, "W2"); len(diag.Warnings) == 0 {
+		t.Error("a corrupt WOFF2 font should be reported")
+	}
+
+	// @font-face のフォントの合計（展開後）が MaxFontBytes を超える文書は展開する前に拒否する
+	uri = "data:font/woff2;base64," + base64.StdEncoding.EncodeToString(toWOFF2(serifData))
+	limited := func(css string, maxBytes int64) error {
+		svgData := `<svg width="10" height="10" xmlns="http://www.w3.org/2000/svg"><style>` + css + `</style></svg>`
+		_, _, err := Render(context.Background(), strings.NewReader(svgData), Options{Limits: Limits{MaxFontBytes: maxBytes}})
+		return err
+	}
+	face := func(family string) string {
+		return `@font-face { font-family: ` + family + `; src: url(` + uri + `); }`
+	}
+	var le *LimitError
+	if err := limited(face("A"), 1024); !errors.As(err, &le) || le.Limit != "font bytes" {
+		t.Errorf("a font larger than MaxFontBytes should be a LimitError: %v", err)
+	}
+	total := int64(len(serifData)) * 3 / 2
+	if err := limited(face("A"), total); err != nil {
+		t.Errorf("a font within MaxFontBytes should load: %v", err)
+	}
+	if err := limited(face("A")+face("B"), total); !errors.As(err, &le) || le.Limit != "font bytes" || le.Max != total {
+		t.Errorf("fonts exceeding MaxFontBytes in total should be a LimitError: %v", err)
+	}
+}
+
+func TestEngine_SeparateFontSets(t *testing.T) {
+	serifData, _ := systemFontData(t, "DejaVu Serif")
+	sansData, _ := systemFontData(t, "DejaVu Sans")
+
+	svgData := []byte(`<svg width="200" height="60" xmlns="http://www.w3.org/2000/svg">
+		<text x="10" y="40" font-size="30" font-family="Brand">Qg</text>
+	</svg>`)
+	render := func(e *Engine) []byte {
+		pngData, _, err := e.RenderPNG(svgData, Options{DisableSystemFontScan: true})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return pngData
+	}
+
+	// 同じファミリ名でもエンジンごとに別のフォントが使われ、既定のエンジンには登録されない
+	serifEngine, err := NewEngine(FontSource{Family: "Brand", Data: serifData})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	sansEngine, err := NewEngine(FontSource{Family: "Brand", Data: sansData})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	serif, sans := render(serifEngine), render(sansEngine)
+	if bytes.Equal(serif, sans) {
+		t.Error("engines with different font sets should render differently")
+	}
+	if m := QueryFont(FontQuery{Families: []string{"Brand"}}); m.Face != nil {
+		t.Error("fonts registered on an engine must not leak into the default engine")
+	}
+
+	// 描画中のフォント登録やキャッシュのクリアは描画と競合しない
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if _, _, err := serifEngine.RenderPNG(svgData, Options{DisableSystemFontScan: true}); err != nil {
+					t.Errorf("RenderPNG failed: %v", err)
+				}
+			}
+		}()
+	}
+	for j := 0; j < 5; j++ {
+		serifEngine.ClearFontCache()
+		if err := serifEngine.RegisterFonts(FontSource{Family: "Brand", Data: serifData}); err != nil {
+			t.Errorf("RegisterFonts failed: %v", err)
+		}
+	}
+	wg.Wait()
+	if !bytes.Equal(render(serifEngine), serif) {
+		t.Error("re-registered fonts should render as before")
+	}
+}
+
+func TestEngine_FontIndex(t *testing.T) {
+	serifData, _ := systemFontData(t, "DejaVu Serif")
+	dir := t.TempDir()
+	fontDir := filepath.Join(dir, "fonts")
+	fontPath := filepath.Join(fontDir, "serif.woff2")
+	if err := os.MkdirAll(fontDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fontPath, toWOFF2(serifData), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scan := func(indexPath string) *Engine {
+		e, _ := NewEngine()
+		e.SetFontIndexPath(indexPath)
+		if err := e.ScanFontDirectories(fontDir); err != nil {
+			t.Fatalf("ScanFontDirectories failed: %v", err)
+		}
+		return e
+	}
+
+	// スキャンではインデックスだけを登録し、フォントデータは描画で使われたときに読み込む
+	indexPath := filepath.Join(dir, "index.json")
+	e := scan(indexPath)
+	m := e.QueryFont(FontQuery{Families: []string{"DejaVu Serif"}})
+	if m.Face == nil {
+		t.Fatalf("scanned font should be registered: %v", m.Reasons)
+	}
+	if m.Face.TSFont != nil {
+		t.Error("font data should not be loaded before first use")
+	}
+	svgData := []byte(`<svg width="200" height="60" xmlns="http://www.w3.org/2000/svg">
+		<text x="10" y="40" font-size="30" font-family="DejaVu Serif">Qg</text>
+	</svg>`)
+	got, _, err := e.RenderPNG(svgData, Options{DisableSystemFontScan: true})
+	if err != nil {
+		t.Fatalf("RenderPNG failed: %v", err)
+	}
+	want, _, _ := RenderPNG(svgData, Options{})
+	if !bytes.Equal(got, want) {
+		t.Error("indexed font should render like the installed font")
+	}
+	if m.Face.TSFont == nil {
+		t.Error("font data should be loaded after rendering")
+	}
+
+	// インデックスにはファミリ・スタイル・更新時刻・収録文字が保存される
+	raw, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatalf("font index was not written: %v", err)
+	}
+	var index struct {
+		Files map[string]struct {
+			ModTime int64 `json:"mtime"`
+			Faces   []struct {
+				Family, Style string
+				Coverage      []byte
+			}
+		}
+	}
+	if err := json.Unmarshal(raw, &index); err != nil {
+		t.Fatalf("invalid font index: %v", err)
+	}
+	entry := index.Files[fontPath]
+	if entry.ModTime == 0 || len(entry.Faces) != 1 || entry.Faces[0].Family != "DejaVu Serif" || len(entry.Faces[0].Coverage) == 0 {
+		t.Fatalf("unexpected index entry: %+v", entry)
+	}
+
+	// 更新時刻とサイズが変わらないファイルはインデックスの情報をそのまま使う
+	forged := bytes.Replace(raw, []byte(`"family":"DejaVu Serif"`), []byte(`"family":"Indexed Serif"`), 1)
+	for _, name := range []string{"forged1.json", "forged2.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), forged, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m := scan(filepath.Join(dir, "forged1.json")).QueryFont(FontQuery{Families: []string{"Indexed Serif"}}); m.Face == nil {
+		t.Error("unchanged files should not be parsed again")
+	}
+
+	// 更新されたファイルは解析し直す
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(fontPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if m := scan(filepath.Join(dir, "forged2.json")).QueryFont(FontQuery{Families: []string{"DejaVu Serif"}}); m.Face == nil {
+		t.Error("modified files should be parsed again")
+	}
+}
+
+func TestRenderPNG_FontConfig(t *testing.T) {
+	requireFont(t, "DejaVu Serif")
+	serifData, _ := systemFontData(t, "DejaVu Serif")
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"fonts/serif.ttf": string(serifData),
+		"fonts.conf": `<?xml version="1.0"?>
+<!DOCTYPE fontconfig SYSTEM "fonts.dtd">
+<fontconfig>
+	<dir>fonts</dir>
+	<include ignore_missing="yes">missing.d</include>
+	<include>conf.d</include>
+	<match target="pattern"><test name="family"><string>x</string></test></match>
+	<alias>
+		<family>Corporate Sans</family>
+		<prefer><family>No Such Font</family></prefer>
+		<accept><family>DejaVu Serif</family></accept>
+		<default><family>sans-serif</family></default>
+	</alias>
+</fontconfig>`,
+		"conf.d/10-sans.conf": `<fontconfig>
+	<alias><family>sans-serif</family><prefer><family>DejaVu Serif</family></prefer></alias>
+</fontconfig>`,
+		// fontconfig と同じく、数字で始まらない名前のファイルは読み込まない
+		"conf.d/README.conf": `<fontconfig><include>missing.d</include></fontconfig>`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	render := func(e *Engine, family string, opts Options) []byte {
+		t.Helper()
+		svgData := []byte(`<svg width="200" height="60" xmlns="http://www.w3.org/2000/svg">
+			<text x="10" y="40" font-size="30" font-family="` + family + `">Qg</text>
+		</svg>`)
+		png, diag, err := e.RenderPNG(svgData, opts)
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		for _, w := range diag.Warnings {
+			if strings.Contains(w, "fontconfig") {
+				t.Errorf("unexpected warning: %s", w)
+			}
+		}
+		return png
+	}
+	want, _, _ := RenderPNG([]byte(`<svg width="200" height="60" xmlns="http://www.w3.org/2000/svg">
+		<text x="10" y="40" font-size="30" font-family="DejaVu Serif">Qg</text>
+	</svg>`), Options{})
+
+	// <dir> のフォントと <alias> は FontConfigFile を指定した描画だけに適用される
+	e, _ := NewEngine()
+	e.SetFontIndexPath("")
+	opts := Options{DisableSystemFontScan: true, FontConfigFile: filepath.Join(dir, "fonts.conf")}
+	for _, family := range []string{"Corporate Sans", "sans-serif", "'Corporate Sans', monospace"} {
+		if !bytes.Equal(render(e, family, opts), want) {
+			t.Errorf("%s should resolve to DejaVu Serif through fonts.conf", family)
+		}
+	}
+	if bytes.Equal(render(e, "Corporate Sans", Options{DisableSystemFontScan: true}), want) {
+		t.Error("fonts.conf should not change the engine's font set")
+	}
+
+	// 読めない設定ファイルは警告にして描画を続ける
+	_, diag, err := e.RenderPNG([]byte(`<svg width="10" height="10" xmlns="http://www.w3.org/2000/svg"/>`),
+		Options{DisableSystemFontScan: true, FontConfigFile: filepath.Join(dir, "nope.conf")})
+	if err != nil || len(diag.Warnings) == 0 {
+		t.Errorf("missing fonts.conf should be a warning: %v %v", err, diag.Warnings)
+	}
+
+	// Linux ではシステムの fontconfig の <alias> も使う
+	if runtime.GOOS == "linux" {
+		if _, err := os.Stat("/etc/fonts/conf.d/57-dejavu-serif.conf"); err == nil {
+			if err := defaultEngine.ScanSystemFonts(); err != nil {
+				t.Fatal(err)
+			}
+			if m := QueryFont(FontQuery{Families: []string{"Bitstream Vera Serif"}}); m.Face == nil || m.Face.Family != "DejaVu Serif" {
+				t.Errorf("system fontconfig alias not applied: %v", m.Reasons)
+			}
+		}
+	}
+}
+
+func TestRenderPNG_TextDecorationAndVariants(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+	render := func(body string) []byte {
+		t.Helper()
+		svgData := []byte(`<svg width="300" height="80" xmlns="http://www.w3.org/2000/svg">` + body + `</svg>`)
+		pngData, _, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return pngData
+	}
+	text := func(attrs, content string) []byte {
+		return render(`<text x="10" y="50" font-family="DejaVu Sans" font-size="30" ` + attrs + `>` + content + `</text>`)
+	}
+	isBlueInk := func(r, g, b, a uint8) bool { return a > 128 && b > 200 && r < 80 && g < 80 }
+
+	// 下線はベースラインの下に、子孫の <tspan> の下にも装飾を指定した要素の塗りで引かれる
+	plain, _ := inkBounds(t, text(`fill="red"`, `xx<tspan fill="blue">xx</tspan>`), isRedInk)
+	under, ok := inkBounds(t, text(`fill="red" text-decoration="underline"`, `xx<tspan fill="blue">xx</tspan>`), isRedInk)
+	if !ok || under.Max.Y <= 51 || under.Max.X <= plain.Max.X+20 {
+		t.Errorf("underline should extend below the baseline under the tspan: plain=%v underlined=%v", plain, under)
+	}
+
+	// text-decoration-color の取り消し線は x-height の中ほどに引かれる
+	strike, ok := inkBounds(t, text(`style="text-decoration: line-through blue 3px"`, `xxxx`), isBlueInk)
+	if !ok || strike.Min.Y < 35 || strike.Max.Y > 48 || strike.Dy() > 5 {
+		t.Errorf("unexpected line-through bounds: %v", strike)
+	}
+
+	// 上線・二重線・波線も描画される
+	for _, deco := range []string{"overline", "underline double", "underline wavy", "underline dotted", "underline dashed"} {
+		if bytes.Equal(text(`text-decoration="`+deco+`"`, `xxxx`), text(``, `xxxx`)) {
+			t.Errorf("text-decoration %q was not drawn", deco)
+		}
+	}
+
+	// text-transform は描画前に文字を変換する
+	if !bytes.Equal(text(`text-transform="uppercase"`, `straße`), text(``, `STRASSE`)) {
+		t.Error("uppercase should map ß to SS")
+	}
+	if !bytes.Equal(text(`style="text-transform: capitalize"`, `hello <tspan>wide</tspan> world`), text(``, `Hello <tspan>Wide</tspan> World`)) {
+		t.Error("capitalize should uppercase the first letter of each word")
+	}
+
+	// スモールキャップのないフォントでは縮小した大文字で合成する
+	smallCaps, _ := inkBounds(t, text(`font-variant="small-caps"`, `Ab`), isInk)
+	scaled, _ := inkBounds(t, text(``, `A<tspan font-size="21">B</tspan>`), isInk)
+	if smallCaps != scaled {
+		t.Errorf("small-caps should be synthesized from scaled capitals: %v != %v", smallCaps, scaled)
+	}
+
+	// word-spacing は空白の送り幅に加算される
+	width := func(pngData []byte) int {
+		minX, maxX, _ := inkExtent(t, pngData, isInk)
+		return maxX - minX
+	}
+	if w0, w1 := width(text(``, `a b c`)), width(text(`word-spacing="10"`, `a b c`)); w1-w0 != 20 {
+		t.Errorf("word-spacing should add 10px per space: %d -> %d", w0, w1)
+	}
+
+	// font-size-adjust は x-height を指定の比率に揃える
+	if w0, w1 := width(text(``, `xxxx`)), width(text(`font-size-adjust="0.4"`, `xxxx`)); w1 >= w0 {
+		t.Errorf("font-size-adjust 0.4 should shrink DejaVu Sans: %d -> %d", w0, w1)
+	}
+	if !bytes.Equal(text(`font-size-adjust="from-font"`, `xxxx`), text(``, `xxxx`)) {
+		t.Error("from-font should keep the first font's size")
+	}
+}
+
+func TestRenderPNG_Baselines(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+	text := func(attrs, content string) []byte {
+		t.Helper()
+		svgData := []byte(`<svg width="200" height="120" xmlns="http://www.w3.org/2000/svg">` +
+			`<text x="10" y="60" font-family="DejaVu Sans" font-size="40" ` + attrs + `>` + content + `</text></svg>`)
+		pngData, _, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return pngData
+	}
+	bottom := func(pngData []byte) int {
+		r, ok := inkBounds(t, pngData, isInk)
+		if !ok {
+			t.Fatal("no ink")
+		}
+		return r.Max.Y
+	}
+
+	// y の位置に dominant-baseline のベースラインが来るよう、グリフは上下にずれる
+	alphabetic := bottom(text(``, `H`))
+	shift := map[string]int{}
+	for _, b := range []string{"middle", "central", "hanging", "text-top", "text-bottom"} {
+		shift[b] = bottom(text(`dominant-baseline="`+b+`"`, `H`)) - alphabetic
+	}
+	if !(shift["text-bottom"] < 0 && 0 < shift["middle"] && shift["middle"] < shift["central"] && shift["central"] < shift["hanging"] && shift["hanging"] < shift["text-top"]) {
+		t.Errorf("unexpected baseline order: %v", shift)
+	}
+	// central は em ボックスの中央（DejaVu Sans では alphabetic の約 0.35em 上）
+	if c := shift["central"]; c < 11 || c > 17 {
+		t.Errorf("central baseline should be about 14px above alphabetic, got %d", c)
+	}
+	if !bytes.Equal(text(`dominant-baseline="text-before-edge"`, `H`), text(`dominant-baseline="text-top"`, `H`)) {
+		t.Error("text-before-edge should be treated as text-top")
+	}
+
+	// alignment-baseline は <tspan> のベースラインを <text> の同じベースラインに揃える
+	// 小さい文字の中央を大きい文字の中央に揃えると、alphabetic はその差（約 7px）だけ上がる
+	small, _ := inkBounds(t, text(``, `H<tspan font-size="20" fill="red">H</tspan>`), isRedInk)
+	centered, _ := inkBounds(t, text(``, `H<tspan font-size="20" fill="red" alignment-baseline="central">H</tspan>`), isRedInk)
+	if d := small.Max.Y - centered.Max.Y; d < 5 || d > 9 {
+		t.Errorf("alignment-baseline=central should raise the smaller tspan by about 7px, got %d", d)
+	}
+
+	// baseline-shift は上向きにずらし、後続のテキストの位置は変えない
+	if !bytes.Equal(text(``, `<tspan baseline-shift="10">H</tspan>`), text(``, `<tspan dy="-10">H</tspan>`)) {
+		t.Error("baseline-shift length should raise the tspan")
+	}
+	if got := bottom(text(``, `<tspan baseline-shift="-10">H</tspan>H`)); got != alphabetic+10 {
+		t.Errorf("baseline-shift should lower the tspan only: bottom %d, want %d", got, alphabetic+10)
+	}
+	super, _ := inkBounds(t, text(``, `<tspan baseline-shift="super">H</tspan>`), isInk)
+	sub, _ := inkBounds(t, text(``, `<tspan baseline-shift="sub">H</tspan>`), isInk)
+	if !(super.Max.Y < alphabetic && sub.Max.Y > alphabetic) {
+		t.Errorf("super should raise and sub should lower: super=%v sub=%v alphabetic=%d", super, sub, alphabetic)
+	}
+	// 上付きは OS/2 の ySuperscriptYOffset（DejaVu Sans では 983/2048em、40px で約 19px）だけ上げる
+	if d := alphabetic - super.Max.Y; d < 17 || d > 21 {
+		t.Errorf("super should use the OS/2 superscript offset (about 19px), got %d", d)
+	}
+
+	// BASE テーブルの hang ベースライン（1000/2048em、40px で約 20px）は寸法から導いた値より優先する
+	data, _ := systemFontData(t, "DejaVu Sans")
+	base := []byte{
+		0, 1, 0, 0, 0, 8, 0, 0, // BASE 1.0、横書きの軸
+		0, 4, 0, 14, // BaseTagList / BaseScriptList
+		0, 2, 'h', 'a', 'n', 'g', 'r', 'o', 'm', 'n',
+		0, 1, 'l', 'a', 't', 'n', 0, 8, // latn
+		0, 6, 0, 0, 0, 0, // BaseValues
+		0, 1, 0, 2, 0, 8, 0, 12, // 既定は romn、座標2つ
+		0, 1, 0x03, 0xE8, // hang = 1000
+		0, 1, 0, 0, // romn = 0
+	}
+	engine, err := NewEngine(FontSource{Family: "DejaVu Sans", Data: withTables(data, map[string][]byte{"BASE": base})})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	svgData := []byte(`<svg width="200" height="120" xmlns="http://www.w3.org/2000/svg">` +
+		`<text x="10" y="60" font-family="DejaVu Sans" font-size="40" dominant-baseline="hanging">H</text></svg>`)
+	pngData, _, err := engine.RenderPNG(svgData, Options{DisableSystemFontScan: true})
+	if err != nil {
+		t.Fatalf("RenderPNG failed: %v", err)
+	}
+	if d := bottom(pngData) - alphabetic; d < 18 || d > 22 || d == shift["hanging"] {
+		t.Errorf("hanging baseline should come from the BASE table (about 20px), got %d (derived %d)", d, shift["hanging"])
+	}
+}
+
+func TestRenderPNG_TextLength(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+	requireFont(t, "DejaVu Serif")
+	extent := func(attrs, content string) (int, int) {
+		t.Helper()
+		svgData := []byte(`<svg width="300" height="80" xmlns="http://www.w3.org/2000/svg">` +
+			`<text x="20" y="50" font-size="30" ` + attrs + `>` + content + `</text></svg>`)
+		pngData, _, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		minX, maxX, ok := inkExtent(t, pngData, isInk)
+		if !ok {
+			t.Fatal("no ink")
+		}
+		return minX, maxX
+	}
+	// インクの端は送り幅の端からサイドベアリングの分だけ内側になる
+	near := func(got, want int) bool { return got >= want-10 && got <= want+10 }
+
+	// フォントによらず、テキストは textLength の長さに収まる
+	for _, family := range []string{"DejaVu Sans", "DejaVu Serif"} {
+		for _, adjust := range []string{"spacing", "spacingAndGlyphs"} {
+			minX, maxX := extent(`font-family="`+family+`" textLength="200" lengthAdjust="`+adjust+`"`, `Label`)
+			if !near(minX, 20) || !near(maxX, 220) {
+				t.Errorf("%s/%s: ink %d..%d, want about 20..220", family, adjust, minX, maxX)
+			}
+		}
+	}
+
+	// spacing ではグリフの形を変えず、1文字の場合は調整しない
+	_, plainH := extent(`font-family="DejaVu Sans"`, `H`)
+	if _, maxX := extent(`font-family="DejaVu Sans" textLength="150"`, `H`); maxX != plainH {
+		t.Errorf("spacing should not change a single glyph: %d != %d", maxX, plainH)
+	}
+	// spacingAndGlyphs はグリフを進行方向に引き伸ばす
+	if _, maxX := extent(`font-family="DejaVu Sans" textLength="150" lengthAdjust="spacingAndGlyphs"`, `H`); maxX < plainH+100 {
+		t.Errorf("spacingAndGlyphs should stretch the glyph, right edge %d", maxX)
+	}
+
+	// text-anchor は調整後の長さに対して適用され、<tspan> の textLength は後続の文字を押し出す
+	if _, maxX := extent(`font-family="DejaVu Sans" text-anchor="end" x="250" textLength="100"`, `Label`); !near(maxX, 250) {
+		t.Errorf("text-anchor=end should align the adjusted text to x: right edge %d", maxX)
+	}
+	_, plain := extent(`font-family="DejaVu Sans"`, `ab<tspan>c</tspan>`)
+	_, pushed := extent(`font-family="DejaVu Sans"`, `<tspan textLength="150">ab</tspan>c`)
+	if pushed < plain+80 {
+		t.Errorf("tspan textLength should push following text: %d -> %d", plain, pushed)
+	}
+}
+
+func TestRenderPNG_TextWrapping(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+	bounds := func(body string) image.Rectangle {
+		t.Helper()
+		svgData := []byte(`<svg width="300" height="300" xmlns="http://www.w3.org/2000/svg">` + body + `</svg>`)
+		pngData, _, err := RenderPNG(svgData, Options{})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		r, ok := inkBounds(t, pngData, isInk)
+		if !ok {
+			t.Fatal("no ink")
+		}
+		return r
+	}
+	const sentence = `The quick brown fox jumps over the lazy dog.`
+	text := func(attrs, content string) image.Rectangle {
+		return bounds(`<text x="20" y="30" font-family="DejaVu Sans" font-size="16" ` + attrs + `>` + content + `</text>`)
+	}
+
+	// inline-size を超える行は単語の区切りで折り返す
+	single := text(``, sentence)
+	wrapped := text(`inline-size="120"`, sentence)
+	if wrapped.Max.X > 20+120 || wrapped.Dy() < 3*single.Dy() {
+		t.Errorf("text should wrap within 120px: single=%v wrapped=%v", single, wrapped)
+	}
+	// style プロパティでも指定でき、nowrap では折り返さない
+	if got := text(`style="inline-size: 120px"`, sentence); got != wrapped {
+		t.Errorf("inline-size in style should wrap the same way: %v != %v", got, wrapped)
+	}
+	if got := text(`inline-size="120" white-space="nowrap"`, sentence); got != single {
+		t.Errorf("white-space=nowrap should not wrap: %v != %v", got, single)
+	}
+
+	// line-height は行の間隔を決め、pre-line の改行は強制改行になる
+	lines := text(`inline-size="200" white-space="pre-line" line-height="40px"`, "first\nsecond")
+	if lines.Dy() < 40 || lines.Dy() > 60 {
+		t.Errorf("two lines 40px apart expected, got %v", lines)
+	}
+
+	// text-anchor=middle では各行を x を中心に揃える
+	centered := bounds(`<text x="150" y="30" font-family="DejaVu Sans" font-size="16" inline-size="120" text-anchor="middle">` + sentence + `</text>`)
+	if mid := (centered.Min.X + centered.Max.X) / 2; mid < 145 || mid > 155 || centered.Dx() > 120 {
+		t.Errorf("centered lines should stay around x=150: %v", centered)
+	}
+
+	// shape-inside のテキストは図形の内側（shape-padding を除く）に収まる
+	inside := bounds(`<rect id="box" x="100" y="100" width="120" height="150" fill="none"/>` +
+		`<text font-family="DejaVu Sans" font-size="16" style="shape-inside: url(#box); shape-padding: 10px">` + sentence + `</text>`)
+	if !inside.In(image.Rect(108, 108, 212, 242)) || inside.Dy() < 40 {
+		t.Errorf("text should wrap inside the padded rect: %v", inside)
+	}
+	// 三角形では下に行くほど行が長くなる
+	triangle := bounds(`<polygon id="tri" points="150,20 20,280 280,280" fill="none"/>` +
+		`<text font-family="DejaVu Sans" font-size="14" text-anchor="middle" shape-inside="url(#tri)">` +
+		strings.Repeat(sentence+" ", 3) + `</text>`)
+	if triangle.Min.Y < 20 || triangle.Max.Y > 280 || triangle.Dx() < 150 {
+		t.Errorf("text should fill the triangle: %v", triangle)
+	}
+}
+
+func TestRenderPNG_FontSynthesis(t *testing.T) {
+	sansData, _ := systemFontData(t, "DejaVu Sans")
+	engine, err := NewEngine(FontSource{Family: "Brand", Data: sansData})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	render := func(attrs string) ([]byte, Diagnostics) {
+		t.Helper()
+		svgData := []byte(`<svg width="200" height="60" xmlns="http://www.w3.org/2000/svg">` +
+			`<text x="10" y="40" font-size="30" font-family="Brand" ` + attrs + `>Hlo</text></svg>`)
+		pngData, diag, err := engine.RenderPNG(svgData, Options{DisableSystemFontScan: true})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return pngData, diag
+	}
+
+	// Regular しかないファミリで太字を求めると、アウトラインを太らせて合成し、診断に記録する
+	regular, diag := render(``)
+	if len(diag.Syntheses) != 0 {
+		t.Errorf("no synthesis expected for regular text: %v", diag.Syntheses)
+	}
+	bold, diag := render(`font-weight="bold"`)
+	if countPixels(t, bold, isInk) < countPixels(t, regular, isInk)*11/10 {
+		t.Errorf("synthetic bold should add ink: %d -> %d", countPixels(t, regular, isInk), countPixels(t, bold, isInk))
+	}
+	if len(diag.Syntheses) != 1 || !strings.Contains(diag.Syntheses[0], "synthetic bold") {
+		t.Errorf("synthetic bold should be reported: %v", diag.Syntheses)
+	}
+	// 送り幅は変えない
+	_, regularMax, _ := inkExtent(t, regular, isInk)
+	_, boldMax, _ := inkExtent(t, bold, isInk)
+	if boldMax-regularMax > 2 {
+		t.Errorf("synthetic bold should keep advances: %d -> %d", regularMax, boldMax)
+	}
+
+	// 斜体は傾けて合成し、上端が右にずれる
+	italic, diag := render(`font-style="italic"`)
+	if bytes.Equal(italic, regular) || len(diag.Syntheses) != 1 || !strings.Contains(diag.Syntheses[0], "synthetic oblique") {
+		t.Errorf("synthetic oblique should be drawn and reported: %v", diag.Syntheses)
+	}
+	if angled, _ := render(`font-style="oblique 30deg"`); bytes.Equal(angled, italic) {
+		t.Error("oblique angle should control the skew")
+	}
+
+	// font-synthesis で合成を禁止できる
+	for _, attrs := range []string{
+		`font-weight="bold" font-style="italic" font-synthesis="none"`,
+		`font-weight="bold" font-style="italic" style="font-synthesis-weight: none; font-synthesis-style: none"`,
+	} {
+		got, diag := render(attrs)
+		if !bytes.Equal(got, regular) || len(diag.Syntheses) != 0 {
+			t.Errorf("%s: synthesis should be disabled: %v", attrs, diag.Syntheses)
+		}
+	}
+}
+
+func TestRenderPNG_GlyphPlacement(t *testing.T) {
+	requireFont(t, "DejaVu Sans")
+	render := func(x, y, attrs string, opts Options) []byte {
+		t.Helper()
+		svgData := []byte(`<svg width="200" height="60" xmlns="http://www.w3.org/2000/svg">` +
+			`<text x="` + x + `" y="` + y + `" font-size="20" font-family="DejaVu Sans" ` + attrs + `>Hillo</text></svg>`)
+		opts.DisableSystemFontScan = true
+		pngData, diag, err := RenderPNG(svgData, opts)
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		for _, w := range diag.Warnings {
+			if strings.Contains(w, "hinting") {
+				t.Errorf("unexpected warning: %s", w)
+			}
+		}
+		return pngData
+	}
+
+	// 既定ではサブピクセル位置に描画し、原点を整数ピクセルに丸めると端数は描画に影響しない
+	if bytes.Equal(render("10", "40", "", Options{}), render("10.2", "40", "", Options{})) {
+		t.Error("subpixel positioning should move glyphs by fractions of a pixel")
+	}
+	snapped := Options{DisableSubpixelPositioning: true}
+	if !bytes.Equal(render("10", "40", "", snapped), render("10.2", "40", "", snapped)) {
+		t.Error("glyph origins should snap to whole pixels without subpixel positioning")
+	}
+	// text-rendering: geometricPrecision は格子に合わせない
+	if bytes.Equal(render("10", "40", `text-rendering="geometricPrecision"`, snapped), render("10.2", "40", `text-rendering="geometricPrecision"`, snapped)) {
+		t.Error("geometricPrecision should keep subpixel positions")
+	}
+
+	// vertical はベースラインを、full はさらに横方向の原点を整数ピクセルに合わせる
+	vertical := Options{Hinting: "vertical"}
+	if !bytes.Equal(render("10", "40", "", vertical), render("10", "40.3", "", vertical)) {
+		t.Error("vertical hinting should snap the baseline")
+	}
+	if bytes.Equal(render("10", "40", "", vertical), render("10.2", "40", "", vertical)) {
+		t.Error("vertical hinting should keep horizontal subpixel positions")
+	}
+	full := Options{Hinting: "full"}
+	if !bytes.Equal(render("10", "40", "", full), render("10.2", "40.3", "", full)) {
+		t.Error("full hinting should snap glyph origins")
+	}
+	// 計測も整数ピクセルの送り幅で行うため、end 揃えの右端は描画と一致する
+	_, plainMax, _ := inkExtent(t, render("190", "40", `text-anchor="end"`, Options{}), isInk)
+	_, fullMax, _ := inkExtent(t, render("190", "40", `text-anchor="end"`, full), isInk)
+	if d := fullMax - plainMax; d < -1 || d > 1 {
+		t.Errorf("hinted measurement should match drawing: right edge %d vs %d", fullMax, plainMax)
+	}
+
+	// ガンマが大きいほどグリフの被覆率が上がる
+	plain := countPixels(t, render("10", "40", "", Options{}), isInk)
+	if dark := countPixels(t, render("10", "40", "", Options{TextGamma: 2.2}), isInk); dark <= plain {
+		t.Errorf("text gamma should darken glyph coverage: %d -> %d", plain, dark)
+	}
+
+	// shape-rendering: crispEdges はアンチエイリアスせずに描画する
+	partial := func(rendering string) int {
+		svgData := []byte(`<svg width="40" height="40" xmlns="http://www.w3.org/2000/svg">` +
+			`<circle cx="20.3" cy="20.3" r="12.4" shape-rendering="` + rendering + `"/></svg>`)
+		pngData, _, err := RenderPNG(svgData, Options{DisableSystemFontScan: true})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return countPixels(t, pngData, func(r, g, b, a uint8) bool { return a > 0 && a < 255 })
+	}
+	if partial("auto") == 0 || partial("crispEdges") != 0 {
+		t.Errorf("crispEdges should disable antialiasing: auto=%d crispEdges=%d", partial("auto"), partial("crispEdges"))
+	}
+
+	// 不明なヒンティングは警告して none として扱う
+	_, diag, err := RenderPNG([]byte(`<svg width="10" height="10" xmlns="http://www.w3.org/2000/svg"/>`), Options{DisableSystemFontScan: true, Hinting: "slight"})
+	if err != nil {
+		t.Fatalf("RenderPNG failed: %v", err)
+	}
+	if len(diag.Warnings) == 0 || !strings.Contains(diag.Warnings[len(diag.Warnings)-1], "hinting") {
+		t.Errorf("unknown hinting should be reported: %v", diag.Warnings)
+	}
+}
+
+func TestEngine_GlyphCache(t *testing.T) {
+	sansData, _ := systemFontData(t, "DejaVu Sans")
+	engine, err := NewEngine(FontSource{Family: "Label", Data: sansData})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	svgData := []byte(`<svg width="200" height="80" xmlns="http://www.w3.org/2000/svg">` +
+		`<text x="10" y="30" font-size="16" font-family="Label">Sales 2024</text>` +
+		`<text x="10.5" y="60" font-size="16" font-family="Label" font-weight="bold">Sales 2025</text></svg>`)
+	render := func() []byte {
+		t.Helper()
+		pngData, _, err := engine.RenderPNG(svgData, Options{DisableSystemFontScan: true})
+		if err != nil {
+			t.Fatalf("RenderPNG failed: %v", err)
+		}
+		return pngData
+	}
+
+	// 2回目の描画ではフェイスとグリフのマスクをキャッシュから使い、結果は変わらない
+	first := render()
+	before := engine.CacheStats()
+	if before.GlyphMisses == 0 || before.Faces == 0 || before.GlyphBytes == 0 {
+		t.Fatalf("first render should fill the cache: %+v", before)
+	}
+	second := render()
+	after := engine.CacheStats()
+	if after.GlyphMisses != before.GlyphMisses || after.GlyphHits <= before.GlyphHits || after.FaceHits <= before.FaceHits {
+		t.Errorf("second render should hit the cache: before=%+v after=%+v", before, after)
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("cached glyphs should render identically")
+	}
+
+	// 並行する描画でキャッシュを共有しても結果は同じ
+	var wg sync.WaitGroup
+	results := make([][]byte, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = render()
+		}(i)
+	}
+	wg.Wait()
+	for i, r := range results {
+		if !bytes.Equal(r, first) {
+			t.Errorf("concurrent render %d differs", i)
+		}
+	}
+
+	// 上限を負にするとキャッシュせず、描画結果は同じ
+	engine.SetCacheLimits(-1, -1)
+	if uncached := render(); !bytes.Equal(uncached, first) {
+		t.Error("disabling the cache should not change the output")
+	}
+	if s := engine.CacheStats(); s.Faces != 0 || s.GlyphBytes != 0 {
+		t.Errorf("negative limits should empty the cache: %+v", s)
+	}
+	// 上限を超えるマスクは古いものから捨てる
+	engine.SetCacheLimits(0, 4096)
+	render()
+	if s := engine.CacheStats(); s.GlyphBytes > 4096 {
+		t.Errorf("glyph cache should stay within its limit: %+v", s)
+	}
+
+	render()
+	engine.ClearFontCache()
+	if s := engine.CacheStats(); s.Faces != 0 || s.GlyphBytes != 0 {
+		t.Errorf("ClearFontCache should drop cached glyphs: %+v", s)
+	}
+	// 上限は ClearFontCache の後も保持する
+	engine.RegisterFonts(FontSource{Family: "Label", Data: sansData})
+	render()
+	if s := engine.CacheStats(); s.GlyphBytes > 4096 {
+		t.Errorf("cache limits should survive ClearFontCache: %+v", s)
+	}
+}
+
+func TestRender_Streaming(t *testing.T) {
+	svgData := `<svg width="40" height="30" xmlns="http://www.w3.org/2000/svg">` +
+		`<rect x="5" y="5" width="20" height="10" fill="#336699" opacity="0.5"/></svg>`
+	opts := Options{DisableSystemFontScan: true}
+	want, _, err := RenderPNG([]byte(svgData), opts)
+	if err != nil {
+		t.Fatalf("RenderPNG failed: %v", err)
+	}
+
+	// 1バイトずつしか読めない入力でも読み込みながらパースし、RenderPNG と同じ画素を返す
+	img, _, err := Render(context.Background(), iotest.OneByteReader(strings.NewReader(svgData)), opts)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Error("Render should return the pixels RenderPNG encodes")
+	}
+
+	// RenderTo は指定の形式で書き出す
+	buf.Reset()
+	if _, err := RenderTo(context.Background(), &buf, strings.NewReader(svgData), opts, FormatJPEG); err != nil {
+		t.Fatalf("RenderTo failed: %v", err)
+	}
+	if _, format, err := image.Decode(&buf); err != nil || format != "jpeg" {
+		t.Errorf("RenderTo(FormatJPEG) should write a JPEG: %q %v", format, err)
+	}
+	if f, err := FormatForPath("out.JPG"); err != nil || f != FormatJPEG {
+		t.Errorf("FormatForPath(out.JPG) = %v, %v", f, err)
+	}
+	if _, err := FormatForPath("out.gif"); err == nil {
+		t.Error("FormatForPath should reject unknown extensions")
+	}
+
+	// キャンセル済みのコンテキストでは描画しない
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := Render(ctx, strings.NewReader(svgData), opts); !errors.Is(err, context.Canceled) {
+		t.Errorf("Render with a canceled context should fail: %v", err)
+	}
+}
+
+func TestRender_Limits(t *testing.T) {
+	opts := Options{DisableSystemFontScan: true}
+	ctx := context.Background()
+	render := func(svgData string, lim Limits) error {
+		o := opts
+		o.Limits = lim
+		_, _, err := Render(ctx, strings.NewReader(svgData), o)
+		return err
+	}
+	expectLimit := func(name, svgData string, lim Limits, limit string) {
+		t.Helper()
+		var le *LimitError
+		if err := render(svgData, lim); !errors.As(err, &le) || le.Limit != limit {
+			t.Errorf("%s: expected %q LimitError, got %v", name, limit, err)
+		}
+	}
+
+	// 巨大な width / height はフレームバッファを確保する前に拒否する
+	expectLimit("pixels", `<svg width="100000" height="100000" xmlns="http://www.w3.org/2000/svg"/>`, Limits{}, "pixels")
+	// int64 に収まらない画素数も桁あふれせずに拒否し、制限しない場合もバッファを確保できる範囲に限る
+	expectLimit("pixels 1e300", `<svg width="1e300" height="1e300" xmlns="http://www.w3.org/2000/svg"/>`, Limits{}, "pixels")
+	expectLimit("pixels unlimited", `<svg width="1e300" height="10" xmlns="http://www.w3.org/2000/svg"/>`, Limits{MaxPixels: -1}, "pixels")
+	// 無限大（1e400）や 0 のサイズは不正な文書として拒否する
+	for _, size := range []string{`width="1e400" height="10"`, `width="0" height="10"`} {
+		var pe *ParseError
+		if err := render(`<svg `+size+` xmlns="http://www.w3.org/2000/svg"/>`, Limits{}); !errors.As(err, &pe) {
+			t.Errorf("%s: expected ParseError, got %v", size, err)
+		}
+	}
+
+	// 深い入れ子と要素数
+	deep := `<svg width="10" height="10" xmlns="http://www.w3.org/2000/svg">` +
+		strings.Repeat("<g>", 300) + strings.Repeat("</g>", 300) + `</svg>`
+	expectLimit("depth", deep, Limits{}, "depth")
+	if err := render(deep, Limits{MaxDepth: -1}); err != nil {
+		t.Errorf("negative MaxDepth should disable the limit: %v", err)
+	}
+	many := `<svg width="10" height="10" xmlns="http://www.w3.org/2000/svg">` +
+		strings.Repeat(`<rect width="1" height="1"/>`, 20) + `</svg>`
+	expectLimit("elements", many, Limits{MaxElements: 10}, "elements")
+
+	// パスのセグメント数とテキストの長さ
+	path := `<svg width="10" height="10" xmlns="http://www.w3.org/2000/svg"><path d="M0 0` +
+		strings.Repeat(" L1 1", 100) + `"/></svg>`
+	expectLimit("path", path, Limits{MaxPathSegments: 50}, "path segments")
+	text := `<svg width="10" height="10" xmlns="http://www.w3.org/2000/svg"><text>` +
+		strings.Repeat("a", 100) + `</text></svg>`
+	expectLimit("text", text, Limits{MaxTextLength: 50}, "text length")
+
+	// <use> の指数的な展開（billion laughs）と循環参照
+	var laughs strings.Builder
+	laughs.WriteString(`<svg width="10" height="10" xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><defs><rect id="l0" width="1" height="1"/>`)
+	for i := 1; i <= 9; i++ {
+		fmt.Fprintf(&laughs, `<g id="l%d">`, i)
+		for j := 0; j < 10; j++ {
+			fmt.Fprintf(&laughs, `<use xlink:href="#l%d"/>`, i-1)
+		}
+		laughs.WriteString(`</g>`)
+	}
+	laughs.WriteString(`</defs><use href="#l9"/></svg>`)
+	expectLimit("use", laughs.String(), Limits{}, "use expansion")
+	cycle := `<svg width="10" height="10" xmlns="http://www.w3.org/2000/svg"><g id="a"><use href="#a"/></g></svg>`
+	expectLimit("use cycle", cycle, Limits{}, "use expansion")
+
+	// 巨大なぼかしは処理する前に拒否する
+	blur := `<svg width="100" height="100" xmlns="http://www.w3.org/2000/svg">` +
+		`<defs><filter id="f"><feGaussianBlur stdDeviation="1e9"/></filter></defs>` +
+		`<rect width="50" height="50" fill="red" filter="url(#f)"/></svg>`
+	expectLimit("filter", blur, Limits{}, "filter area")
+
+	// 上限内の文書は通常どおり描画する
+	if err := render(many, Limits{}); err != nil {
+		t.Errorf("document within limits should render: %v", err)
+	}
+
+	// 読み込みの遅い入力は時間切れで打ち切る
+	o := opts
+	o.Timeout = 20 * time.Millisecond
+	if _, _, err := Render(ctx, slowReader{strings.NewReader(many)}, o); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Render past Timeout should fail with DeadlineExceeded: %v", err)
+	}
+
+	// 小さな画像に巨大なフォントサイズのテキストを描いても、グリフの大きさのメモリは確保しない
+	requireFont(t, "DejaVu Sans")
+	huge := func(size string) string {
+		return `<svg width="50" height="50" xmlns="http://www.w3.org/2000/svg">` +
+			`<text x="0" y="40" font-family="DejaVu Sans" font-size="` + size + `">Wg</text></svg>`
+	}
+	expectLimit("text area", huge("1e6"), Limits{}, "text area")
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	if err := render(huge("12000"), Limits{}); err != nil {
+		t.Errorf("large text within limits should render: %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 64<<20 {
+		t.Errorf("large text on a small canvas allocated %d MB", alloc>>20)
+	}
+}
+
+// slowReader は1回の読み込みごとに待つ io.Reader です
+type slowReader struct{ r io.Reader }
+
+func (s slowReader) Read(p []byte) (int, error) {
+	time.Sleep(5 * time.Millisecond)
+	return s.r.Read(p[:min(len(p), 16)])
+}
+
+func TestRender_ErrorsAndDiagnostics(t *testing.T) {
+	opts := Options{DisableSystemFontScan: true}
+	ctx := context.Background()
+
+	// 構文エラーは行と列つきの ParseError
+	_, _, err := Render(ctx, strings.NewReader("<svg width=\"10\" height=\"10\">\n  <rect x=\"1\""), opts)
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Line != 2 || pe.Column == 0 {
+		t.Errorf("syntax error should be a ParseError with a position: %v", err)
+	}
+
+	// 入力の読み込みと出力の書き込みの失敗は ResourceError
+	boom := errors.New("boom")
+	var re *ResourceError
+	if _, _, err := Render(ctx, iotest.ErrReader(boom), opts); !errors.As(err, &re) || re.Op != "read" || !errors.Is(err, boom) {
+		t.Errorf("read failure should be a ResourceError: %v", err)
+	}
+	small := `<svg width="10" height="10" xmlns="http://www.w3.org/2000/svg"/>`
+	if _, err := RenderTo(ctx, failingWriter{boom}, strings.NewReader(small), opts, FormatPNG); !errors.As(err, &re) || re.Op != "write" {
+		t.Errorf("write failure should be a ResourceError: %v", err)
+	}
+
+	// 診断は重要度・コード・要素のパスと id・ソース上の位置つきで、全サブシステムから集める
+	svgData := `<svg width="60" height="40" viewBox="0 0 x" xmlns="http://www.w3.org/2000/svg">
+  <style>@font-face { font-family: Remote; src: url(https://example.com/a.woff2); }</style>
+  <defs><filter id="f"><feTurbulence/></filter></defs>
+  <g transform="translate(5)">
+    <rect id="box" width="10" height="10" fill="blurple" filter="url(#nope)"/>
+    <use href="#box"/>
+  </g>
+</svg>`
+	_, diag, err := Render(ctx, strings.NewReader(svgData), opts)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	find := func(code DiagnosticCode) *Diagnostic {
+		for i := range diag.Entries {
+			if diag.Entries[i].Code == code {
+				return &diag.Entries[i]
+			}
+		}
+		t.Errorf("diagnostic %s not reported: %v", code, diag.Entries)
+		return nil
+	}
+	if e := find("parse.viewbox"); e != nil && (e.Element != "/svg" || e.Line != 1) {
+		t.Errorf("viewBox diagnostic should point at the root: %+v", e.Location)
+	}
+	if e := find("font.face"); e != nil && !errors.As(e.Err, &re) {
+		t.Errorf("@font-face diagnostic should carry a ResourceError: %v", e.Err)
+	}
+	if e := find("filter.unsupported"); e != nil && (e.Message != "<feTurbulence>" || e.Line != 3) {
+		t.Errorf("unsupported filter primitive should be reported at its element: %v", e)
+	}
+	if e := find("style.unsupported"); e != nil && (e.Message != "transform" || e.Element != "/svg/g[1]" || e.Line != 4) {
+		t.Errorf("unsupported property should be reported at its element: %v", e)
+	}
+	if e := find("style.invalid-value"); e != nil && (e.ID != "box" || e.Line != 5 || e.Column != 5) {
+		t.Errorf("invalid color should be reported at its element: %v", e)
+	}
+	if e := find("filter.not-found"); e != nil && e.Element != "/svg/g[1]/rect[1]" {
+		t.Errorf("missing filter should be reported at the filtered element: %v", e)
+	}
+	if e := find("render.unsupported"); e != nil && (e.Element != "/svg/g[1]/use[1]" || e.Severity != SeverityWarning) {
+		t.Errorf("<use> should be reported as unsupported: %v", e)
+	}
+
+	// 文字列のリストは Entries を種類ごとに分けたもの
+	if len(diag.Unsupported) != 3 || len(diag.Warnings) != 4 || len(diag.Filter(SeverityWarning)) != len(diag.Entries) {
+		t.Errorf("legacy lists should mirror the entries: unsupported %v, warnings %v", diag.Unsupported, diag.Warnings)
+	}
+}
+
+// failingWriter は常に失敗する io.Writer です
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}